@@ -0,0 +1,259 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/i18n"
+)
+
+const (
+	meetingActionPath    = "/api/v1/actions/meeting"
+	meetingActionContext = "action"
+
+	meetingActionDialIn   = "dial_in"
+	meetingActionEnd      = "end"
+	meetingActionCalendar = "calendar"
+
+	dialInTollNumberContext     = "toll_number"
+	dialInTollFreeNumberContext = "toll_free_number"
+	dialInConferenceIDContext   = "conference_id"
+
+	postTypeEnded = "ENDED"
+)
+
+// newMeetingActions returns the buttons of a meeting post, so that clients which do not render
+// the meeting card can still act on the meeting. The labels are in the language of the creator,
+// like the rest of the post.
+func (p *Plugin) newMeetingActions(l *i18n.Localizer, meeting *OnlineMeeting, hasInvite bool) []*model.PostAction {
+	actions := []*model.PostAction{p.newJoinMeetingAction(l, meeting.JoinURL)}
+
+	if meeting.DialIn != nil {
+		actions = append(actions, p.newMeetingAction(p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.action.dial_in",
+			Other: "Copy dial-in",
+		}, nil), map[string]any{
+			meetingActionContext:        meetingActionDialIn,
+			dialInTollNumberContext:     meeting.DialIn.TollNumber,
+			dialInTollFreeNumberContext: meeting.DialIn.TollFreeNumber,
+			dialInConferenceIDContext:   meeting.DialIn.ConferenceID,
+		}))
+	}
+
+	// Meetings are ended with the connected account of their organizer.
+	if config := p.getConfiguration(); config == nil || !config.UseApplicationPermissions {
+		actions = append(actions, p.newMeetingAction(p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.action.end",
+			Other: "End for everyone",
+		}, nil), map[string]any{meetingActionContext: meetingActionEnd}))
+	}
+
+	if hasInvite {
+		actions = append(actions, p.newMeetingAction(p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.action.calendar",
+			Other: "Add to my calendar",
+		}, nil), map[string]any{meetingActionContext: meetingActionCalendar}))
+	}
+	return actions
+}
+
+func (p *Plugin) newMeetingAction(name string, context map[string]any) *model.PostAction {
+	return &model.PostAction{
+		Name: name,
+		Type: model.PostActionTypeButton,
+		Integration: &model.PostActionIntegration{
+			URL:     fmt.Sprintf("/plugins/%s%s", url.PathEscape(manifest.Id), meetingActionPath),
+			Context: context,
+		},
+	}
+}
+
+// handleMeetingActionWithDeps answers a click on a button of a meeting post, on behalf of the
+// user who clicked it.
+func (p *Plugin) handleMeetingActionWithDeps(w http.ResponseWriter, r *http.Request, newClient ClientFactory) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		p.API.LogError("handleMeetingAction, unauthorized user")
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request model.PostActionIntegrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		p.API.LogError("handleMeetingAction, failed to decode action request", "Error", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	post := p.getActionPost(userID, &request)
+	if post == nil {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	l := p.getUserLocalizer(userID)
+	var response *model.PostActionIntegrationResponse
+	switch action, _ := request.Context[meetingActionContext].(string); action {
+	case meetingActionDialIn:
+		response = p.getDialInActionResponse(l, post)
+	case meetingActionEnd:
+		response = p.endMeetingAction(r, l, userID, post, newClient)
+	case meetingActionCalendar:
+		response = p.getCalendarActionResponse(l, post.Id)
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		p.API.LogWarn("failed to write response", "error", err.Error())
+	}
+}
+
+func (p *Plugin) handleMeetingAction(w http.ResponseWriter, r *http.Request) {
+	p.handleMeetingActionWithDeps(w, r, p.NewClient)
+}
+
+// getActionPost returns the post of a clicked button, or nil if it is not in the channel of the
+// request or the user cannot read it. Clients can send any request to the action endpoints, so
+// only the stored post is trusted.
+func (p *Plugin) getActionPost(userID string, request *model.PostActionIntegrationRequest) *model.Post {
+	post, appErr := p.API.GetPost(request.PostId)
+	if appErr != nil {
+		return nil
+	}
+	if post.ChannelId != request.ChannelId || !p.API.HasPermissionToChannel(userID, post.ChannelId, model.PermissionReadChannel) {
+		return nil
+	}
+	return post
+}
+
+// getPostActionContext returns the context stored with the first button of a post for which
+// match is true, or nil if there is none.
+func getPostActionContext(post *model.Post, match func(context map[string]any) bool) map[string]any {
+	for _, attachment := range post.Attachments() {
+		for _, action := range attachment.Actions {
+			if action.Integration != nil && match(action.Integration.Context) {
+				return action.Integration.Context
+			}
+		}
+	}
+	return nil
+}
+
+// getDialInActionResponse answers with the dial-in details of a meeting, formatted so that each
+// of them can be copied on its own.
+func (p *Plugin) getDialInActionResponse(l *i18n.Localizer, post *model.Post) *model.PostActionIntegrationResponse {
+	context := getPostActionContext(post, func(context map[string]any) bool {
+		return context[meetingActionContext] == meetingActionDialIn
+	})
+	if context == nil {
+		return &model.PostActionIntegrationResponse{
+			EphemeralText: p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.action.no_dial_in",
+				Other: "This meeting has no dial-in details.",
+			}, nil),
+		}
+	}
+
+	numbers := []string{}
+	for _, key := range []string{dialInTollNumberContext, dialInTollFreeNumberContext} {
+		if number, _ := context[key].(string); number != "" {
+			numbers = append(numbers, "`"+number+"`")
+		}
+	}
+	conferenceID, _ := context[dialInConferenceIDContext].(string)
+
+	return &model.PostActionIntegrationResponse{
+		EphemeralText: p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.action.dial_in_details",
+			Other: "Call {{.Numbers}} and enter the conference ID `{{.ConferenceID}}#`.",
+		}, map[string]any{
+			"Numbers":      strings.Join(numbers, " / "),
+			"ConferenceID": conferenceID,
+		}),
+	}
+}
+
+// endMeetingAction ends the meeting of a post for all its participants, with the account of its
+// organizer, and marks the post as ended.
+func (p *Plugin) endMeetingAction(r *http.Request, l *i18n.Localizer, userID string, post *model.Post, newClient ClientFactory) *model.PostActionIntegrationResponse {
+	reply := func(message *i18n.Message) *model.PostActionIntegrationResponse {
+		return &model.PostActionIntegrationResponse{EphemeralText: p.localize(l, message, nil)}
+	}
+
+	postID := post.Id
+	if post.UserId != userID {
+		return reply(&i18n.Message{ID: "mstmeetings.action.not_organizer", Other: "Only the organizer can end this meeting."})
+	}
+	if config := p.getConfiguration(); config != nil && config.UseApplicationPermissions {
+		return reply(&i18n.Message{ID: "mstmeetings.action.end_unavailable", Other: "Meetings cannot be ended from Mattermost on this server. End it in Microsoft Teams."})
+	}
+	joinURL := getString("meeting_link", post.GetProps())
+	if post.GetProp("meeting_status") != postTypeStarted || joinURL == "" {
+		return reply(&i18n.Message{ID: "mstmeetings.action.already_ended", Other: "This meeting has already ended."})
+	}
+
+	client, err := p.newUserClient(userID, newClient)
+	if err != nil {
+		return reply(&i18n.Message{ID: "mstmeetings.action.connect", Other: "Connect your Microsoft account with `/mstmeetings connect` to end this meeting."})
+	}
+	if err = client.EndMeeting(r.Context(), joinURL, getString("meeting_event_id", post.GetProps())); err != nil {
+		p.API.LogError("endMeetingAction, failed to end meeting", "PostID", postID, "Error", err.Error())
+		return reply(&i18n.Message{ID: "mstmeetings.action.end_failed", Other: "Failed to end the meeting."})
+	}
+
+	if err = p.cancelMeetingReminders(postID); err != nil {
+		p.API.LogWarn("failed to cancel meeting reminders", "PostID", postID, "error", err.Error())
+	}
+	if err = p.stopMeetingChatMirror(postID, newClient); err != nil {
+		p.API.LogWarn("failed to stop mirroring the meeting chat", "PostID", postID, "error", err.Error())
+	}
+	if appErr := p.API.KVDelete(getMeetingInviteKey(postID)); appErr != nil {
+		p.API.LogWarn("failed to delete meeting invite", "PostID", postID, "error", appErr.Error())
+	}
+	if err = p.removeActiveMeeting(post.ChannelId, postID); err != nil {
+		p.API.LogWarn("failed to remove active meeting", "PostID", postID, "error", err.Error())
+	}
+
+	// The buttons are dropped along with the attachments, as none of them applies anymore.
+	post.DelProp(model.PostPropsAttachments)
+	post.AddProp("meeting_status", postTypeEnded)
+	post.Message = p.localize(l, &i18n.Message{ID: "mstmeetings.action.ended", Other: "The meeting has ended."}, nil)
+	return &model.PostActionIntegrationResponse{Update: post}
+}
+
+// getCalendarActionResponse answers with the link of the iCalendar invite of a meeting post,
+// which is served in the timezone of the user who downloads it.
+func (p *Plugin) getCalendarActionResponse(l *i18n.Localizer, postID string) *model.PostActionIntegrationResponse {
+	invite, err := p.getMeetingInvite(postID)
+	if err != nil {
+		p.API.LogError("getCalendarActionResponse, failed to get meeting invite", "PostID", postID, "Error", err.Error())
+	}
+	siteURL, urlErr := p.getSiteURL()
+	if invite == nil || urlErr != nil {
+		return &model.PostActionIntegrationResponse{
+			EphemeralText: p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.action.no_invite",
+				Other: "The calendar invite of this meeting is no longer available.",
+			}, nil),
+		}
+	}
+
+	return &model.PostActionIntegrationResponse{
+		EphemeralText: p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.action.calendar_link",
+			Other: "[Download the invite]({{.URL}}) to add the meeting to your calendar.",
+		}, map[string]any{
+			"URL": fmt.Sprintf("%s/plugins/%s/api/v1/meetings/%s/ics", siteURL, url.PathEscape(manifest.Id), postID),
+		}),
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleMeetingAction(t *testing.T) {
+	meetingPost := func(userID, status string) *model.Post {
+		post := &model.Post{Id: "postID", UserId: userID, ChannelId: "channelID", Message: "Meeting started at [this link](https://teams.microsoft.com/l/meetup-join/planning)."}
+		post.AddProp("meeting_link", "https://teams.microsoft.com/l/meetup-join/planning")
+		post.AddProp("meeting_status", status)
+		post.AddProp("meeting_event_id", "eventID")
+		model.ParseSlackAttachment(post, []*model.SlackAttachment{{Actions: []*model.PostAction{
+			{Name: "Join"},
+			{Name: "Copy dial-in", Integration: &model.PostActionIntegration{Context: map[string]any{
+				meetingActionContext:        meetingActionDialIn,
+				dialInTollNumberContext:     "+1 425 555 0100",
+				dialInTollFreeNumberContext: "+1 800 555 0100",
+				dialInConferenceIDContext:   "4123456",
+			}}},
+		}}})
+		return post
+	}
+	postWithoutDialIn := &model.Post{Id: "postID", ChannelId: "channelID"}
+	model.ParseSlackAttachment(postWithoutDialIn, []*model.SlackAttachment{{Actions: []*model.PostAction{{Name: "Join"}}}})
+
+	tests := []struct {
+		name             string
+		context          map[string]any
+		post             *model.Post
+		postMissing      bool
+		canRead          bool
+		appPermissions   bool
+		expectedCalls    func(t *testing.T, api *plugintest.API, mockClient *MockClient)
+		expectedStatus   int
+		expectedText     string
+		expectedUpdateFn func(t *testing.T, post *model.Post)
+	}{
+		{
+			name:           "Not a channel member",
+			context:        map[string]any{meetingActionContext: meetingActionDialIn},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Post in another channel",
+			context:        map[string]any{meetingActionContext: meetingActionDialIn},
+			post:           &model.Post{Id: "postID", ChannelId: "otherChannelID"},
+			canRead:        true,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Post not found",
+			context:        map[string]any{meetingActionContext: meetingActionDialIn},
+			postMissing:    true,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Unknown action",
+			context:        map[string]any{meetingActionContext: "delete"},
+			canRead:        true,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Copy dial-in",
+			context: map[string]any{
+				meetingActionContext:      meetingActionDialIn,
+				dialInTollNumberContext:   "+1 900 555 0199",
+				dialInConferenceIDContext: "1",
+			},
+			canRead:        true,
+			expectedStatus: http.StatusOK,
+			expectedText:   "Call `+1 425 555 0100` / `+1 800 555 0100` and enter the conference ID `4123456#`.",
+		},
+		{
+			name:           "Copy dial-in without dial-in details",
+			context:        map[string]any{meetingActionContext: meetingActionDialIn},
+			post:           postWithoutDialIn,
+			canRead:        true,
+			expectedStatus: http.StatusOK,
+			expectedText:   "This meeting has no dial-in details.",
+		},
+		{
+			name:           "End by another user",
+			context:        map[string]any{meetingActionContext: meetingActionEnd},
+			post:           meetingPost("organizerID", postTypeStarted),
+			canRead:        true,
+			expectedStatus: http.StatusOK,
+			expectedText:   "Only the organizer can end this meeting.",
+		},
+		{
+			name:           "End an ended meeting",
+			context:        map[string]any{meetingActionContext: meetingActionEnd},
+			post:           meetingPost("demoUserID", postTypeEnded),
+			canRead:        true,
+			expectedStatus: http.StatusOK,
+			expectedText:   "This meeting has already ended.",
+		},
+		{
+			name:    "End without a connected account",
+			context: map[string]any{meetingActionContext: meetingActionEnd},
+			post:    meetingPost("demoUserID", postTypeStarted),
+			canRead: true,
+			expectedCalls: func(_ *testing.T, api *plugintest.API, _ *MockClient) {
+				api.On("KVGet", "token_demoUserID").Return(nil, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedText:   "Connect your Microsoft account with `/mstmeetings connect` to end this meeting.",
+		},
+		{
+			name:           "End with application permissions",
+			context:        map[string]any{meetingActionContext: meetingActionEnd},
+			canRead:        true,
+			appPermissions: true,
+			post:           meetingPost("demoUserID", postTypeStarted),
+			expectedStatus: http.StatusOK,
+			expectedText:   "Meetings cannot be ended from Mattermost on this server. End it in Microsoft Teams.",
+		},
+		{
+			name:    "End for everyone",
+			context: map[string]any{meetingActionContext: meetingActionEnd},
+			post:    meetingPost("demoUserID", postTypeStarted),
+			canRead: true,
+			expectedCalls: func(t *testing.T, api *plugintest.API, mockClient *MockClient) {
+				setupConnectedDemoUser(t, api)
+				mockClient.On("EndMeeting", "https://teams.microsoft.com/l/meetup-join/planning", "eventID").Return(nil)
+				api.On("KVGet", "meetingreminders").Return(nil, nil)
+				api.On("KVGet", "meetingchats").Return(nil, nil)
+				api.On("KVDelete", "meetinginvite_postID").Return(nil)
+				activeMeetings := []byte(`{"postID":{"post_id":"postID"}}`)
+				api.On("KVGet", "activemeetings_channelID").Return(activeMeetings, nil)
+				api.On("KVSetWithOptions", "activemeetings_channelID", []byte(`{}`), model.PluginKVSetOptions{
+					Atomic:          true,
+					OldValue:        activeMeetings,
+					ExpireInSeconds: 3600,
+				}).Return(true, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedUpdateFn: func(t *testing.T, post *model.Post) {
+				require.Equal(t, "The meeting has ended.", post.Message)
+				require.Equal(t, postTypeEnded, post.GetProp("meeting_status"))
+				require.Nil(t, post.GetProp(model.PostPropsAttachments))
+			},
+		},
+		{
+			name:    "Add to my calendar",
+			context: map[string]any{meetingActionContext: meetingActionCalendar},
+			canRead: true,
+			expectedCalls: func(_ *testing.T, api *plugintest.API, _ *MockClient) {
+				api.On("KVGet", "meetinginvite_postID").Return([]byte(`{"channel_id":"channelID","subject":"Planning"}`), nil)
+				api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewPointer("https://example.com")}})
+			},
+			expectedStatus: http.StatusOK,
+			expectedText:   "[Download the invite](https://example.com/plugins/" + manifest.Id + "/api/v1/meetings/postID/ics) to add the meeting to your calendar.",
+		},
+		{
+			name:    "Add to my calendar without an invite",
+			context: map[string]any{meetingActionContext: meetingActionCalendar},
+			canRead: true,
+			expectedCalls: func(_ *testing.T, api *plugintest.API, _ *MockClient) {
+				api.On("KVGet", "meetinginvite_postID").Return(nil, nil)
+				api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewPointer("https://example.com")}})
+			},
+			expectedStatus: http.StatusOK,
+			expectedText:   "The calendar invite of this meeting is no longer available.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			defer api.AssertExpectations(t)
+			mockClient := &MockClient{}
+			defer mockClient.AssertExpectations(t)
+			p := SetupMockPlugin(api, nil, nil)
+			p.setConfiguration(&configuration{EncryptionKey: "demo_encrypt_key", UseApplicationPermissions: tt.appPermissions})
+
+			post := tt.post
+			if post == nil {
+				post = meetingPost("demoUserID", postTypeStarted)
+			}
+			if tt.postMissing {
+				api.On("GetPost", "postID").Return(nil, &model.AppError{Message: "not found"})
+			} else {
+				api.On("GetPost", "postID").Return(post, nil)
+			}
+			if !tt.postMissing && post.ChannelId == "channelID" {
+				api.On("HasPermissionToChannel", "demoUserID", "channelID", model.PermissionReadChannel).Return(tt.canRead)
+			}
+			if tt.expectedCalls != nil {
+				tt.expectedCalls(t, api, mockClient)
+			}
+
+			body, err := json.Marshal(&model.PostActionIntegrationRequest{PostId: "postID", ChannelId: "channelID", Context: tt.context})
+			require.NoError(t, err)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, meetingActionPath, bytes.NewReader(body))
+			r.Header.Set("Mattermost-User-Id", "demoUserID")
+			p.handleMeetingActionWithDeps(w, r, mockClientFactory(mockClient))
+
+			require.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var response model.PostActionIntegrationResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			require.Equal(t, tt.expectedText, response.EphemeralText)
+			if tt.expectedUpdateFn != nil {
+				require.NotNil(t, response.Update)
+				tt.expectedUpdateFn(t, response.Update)
+			}
+		})
+	}
+}
+
+func TestNewMeetingActions(t *testing.T) {
+	p := SetupMockPlugin(&plugintest.API{}, nil, nil)
+	l := p.getUserLocalizer("demoUserID")
+
+	actions := p.newMeetingActions(l, &OnlineMeeting{JoinURL: "https://teams.microsoft.com/l/meetup-join/planning"}, false)
+	require.Len(t, actions, 2)
+	require.Equal(t, "Join", actions[0].Name)
+	require.Equal(t, "End for everyone", actions[1].Name)
+	require.Equal(t, meetingActionEnd, actions[1].Integration.Context[meetingActionContext])
+
+	actions = p.newMeetingActions(l, &OnlineMeeting{JoinURL: "https://teams.microsoft.com/l/meetup-join/planning", DialIn: &DialIn{TollNumber: "+1 425 555 0100", ConferenceID: "4123456"}}, true)
+	require.Len(t, actions, 4)
+	require.Equal(t, "Copy dial-in", actions[1].Name)
+	require.Equal(t, "4123456", actions[1].Integration.Context[dialInConferenceIDContext])
+	require.Equal(t, "Add to my calendar", actions[3].Name)
+
+	p.setConfiguration(&configuration{UseApplicationPermissions: true})
+	actions = p.newMeetingActions(l, &OnlineMeeting{JoinURL: "https://teams.microsoft.com/l/meetup-join/planning"}, false)
+	require.Len(t, actions, 1)
+	require.Equal(t, "Join", actions[0].Name)
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/i18n"
+	"github.com/pkg/errors"
+)
+
+const (
+	adminCommandHelp = "###### Mattermost MS Teams Meetings Plugin - Admin Command Help\n" +
+		"* |/mstmeetings admin list-connected [page]| - List the users who connected a Microsoft account. \n" +
+		"* |/mstmeetings admin disconnect @username| - Disconnect a user's Microsoft account. \n" +
+		"* |/mstmeetings admin reset-all| - Disconnect every user. \n" +
+		"* |/mstmeetings admin stats| - Display connection statistics."
+	adminNotAuthorizedText = "Only system administrators can use this command."
+	resetAllConfirmFlag    = "--confirm"
+
+	connectedUsersPerPage = 20
+	recentlyConnectedDays = 30
+)
+
+func getAdminAutocompleteData() *model.AutocompleteData {
+	admin := model.NewAutocompleteData("admin", "[command]", "Manage connected users")
+	admin.RoleID = model.SystemAdminRoleId
+
+	listConnected := model.NewAutocompleteData("list-connected", "[page]", "List the users who connected a Microsoft account")
+	admin.AddCommand(listConnected)
+
+	disconnect := model.NewAutocompleteData("disconnect", "@username", "Disconnect a user's Microsoft account")
+	disconnect.AddTextArgument("User to disconnect", "@username", "")
+	admin.AddCommand(disconnect)
+
+	resetAll := model.NewAutocompleteData("reset-all", "", "Disconnect every user")
+	admin.AddCommand(resetAll)
+
+	stats := model.NewAutocompleteData("stats", "", "Display connection statistics")
+	admin.AddCommand(stats)
+
+	return admin
+}
+
+// Messages of the admin command.
+var (
+	adminHelpMessage           = &i18n.Message{ID: "mstmeetings.admin.help", Other: strings.ReplaceAll(adminCommandHelp, "|", "`")}
+	adminNotAuthorizedMessage  = &i18n.Message{ID: "mstmeetings.admin.not_authorized", Other: adminNotAuthorizedText}
+	listConnectedFailedMessage = &i18n.Message{ID: "mstmeetings.admin.list_connected_failed", Other: "Failed to list connected users."}
+)
+
+func (p *Plugin) getAdminHelpText(l *i18n.Localizer) string {
+	return p.localize(l, adminHelpMessage, nil)
+}
+
+func (p *Plugin) handleAdmin(args []string, extra *model.CommandArgs) (string, error) {
+	return p.handleAdminWithDeps(args, extra, p.NewClient)
+}
+
+func (p *Plugin) handleAdminWithDeps(args []string, extra *model.CommandArgs, newClient ClientFactory) (string, error) {
+	l := p.getUserLocalizer(extra.UserId)
+	if !p.API.HasPermissionTo(extra.UserId, model.PermissionManageSystem) {
+		return p.localize(l, adminNotAuthorizedMessage, nil), nil
+	}
+
+	if len(args) < 2 {
+		return p.getAdminHelpText(l), nil
+	}
+
+	switch action := args[1]; action {
+	case "list-connected":
+		return p.handleAdminListConnected(l, args[1:])
+	case "disconnect":
+		return p.handleAdminDisconnect(l, args[1:], extra, newClient)
+	case "reset-all":
+		return p.handleAdminResetAll(l, args[1:], extra)
+	case "stats":
+		return p.handleAdminStats(l)
+	case "help":
+		return p.getAdminHelpText(l), nil
+	default:
+		return p.localize(l, unknownActionMessage, map[string]any{"Action": action}) + "\n" + p.getAdminHelpText(l), nil
+	}
+}
+
+func (p *Plugin) handleAdminListConnected(l *i18n.Localizer, args []string) (string, error) {
+	if len(args) > 2 {
+		return p.localize(l, tooManyParametersMessage, nil), nil
+	}
+
+	page := 1
+	if len(args) == 2 {
+		var err error
+		if page, err = strconv.Atoi(args[1]); err != nil || page < 1 {
+			return p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.admin.invalid_page",
+				Other: "The page must be a positive number.",
+			}, nil), nil
+		}
+	}
+
+	users, err := p.listConnectedUsers()
+	if err != nil {
+		return p.localize(l, listConnectedFailedMessage, nil), errors.Wrap(err, "cannot list connected users")
+	}
+	if len(users) == 0 {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.admin.no_connected_users",
+			Other: "No users have connected a Microsoft account.",
+		}, nil), nil
+	}
+
+	pages := (len(users) + connectedUsersPerPage - 1) / connectedUsersPerPage
+	if page > pages {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.admin.page_out_of_range",
+			Other: "There are only {{.Pages}} pages of connected users.",
+		}, map[string]any{"Pages": pages}), nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.admin.connected_users_title",
+		Other: "###### Connected users (page {{.Page}} of {{.Pages}}, {{.Users}} users)",
+	}, map[string]any{"Page": page, "Pages": pages, "Users": len(users)}) + "\n")
+	sb.WriteString(p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.admin.connected_users_header",
+		Other: "| User | Microsoft account | Connected |",
+	}, nil) + "\n|:--|:--|:--|\n")
+	for _, connected := range users[(page-1)*connectedUsersPerPage : min(page*connectedUsersPerPage, len(users))] {
+		username := connected.UserID
+		if user, appErr := p.API.GetUser(connected.UserID); appErr == nil {
+			username = "@" + user.Username
+		}
+
+		connectedAt := p.localize(l, &i18n.Message{ID: "mstmeetings.admin.connected_at_unknown", Other: "Unknown"}, nil)
+		if connected.ConnectedAt > 0 {
+			connectedAt = time.UnixMilli(connected.ConnectedAt).UTC().Format("Jan 2, 2006 15:04 MST")
+		}
+		fmt.Fprintf(&sb, "| %s | %s | %s |\n", username, connected.UPN, connectedAt)
+	}
+	if page < pages {
+		sb.WriteString("\n" + p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.admin.next_page",
+			Other: "Run `/mstmeetings admin list-connected {{.Page}}` to see the next page.",
+		}, map[string]any{"Page": page + 1}))
+	}
+
+	return sb.String(), nil
+}
+
+func (p *Plugin) handleAdminDisconnect(l *i18n.Localizer, args []string, extra *model.CommandArgs, newClient ClientFactory) (string, error) {
+	if len(args) != 2 {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.admin.disconnect_usage",
+			Other: "Please specify the user to disconnect: `/mstmeetings admin disconnect @username`.",
+		}, nil), nil
+	}
+
+	username := strings.TrimPrefix(args[1], "@")
+	data := map[string]any{"Username": username}
+	user, appErr := p.API.GetUserByUsername(username)
+	if appErr != nil {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.admin.user_not_found",
+			Other: "User @{{.Username}} was not found.",
+		}, data), nil
+	}
+
+	if _, err := p.GetUserInfo(user.Id); err != nil {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.admin.user_not_connected",
+			Other: "@{{.Username}} has not connected a Microsoft account.",
+		}, data), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.getConfiguration().getRequestTimeout())
+	defer cancel()
+
+	if err := p.disconnect(ctx, user.Id, newClient); err != nil {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.admin.disconnect_failed",
+			Other: "Failed to disconnect @{{.Username}}, {{.Error}}",
+		}, map[string]any{"Username": username, "Error": err.Error()}), nil
+	}
+
+	p.API.LogInfo("System admin disconnected a user from MS Teams Meetings", "AdminUserID", extra.UserId, "UserID", user.Id)
+	p.trackDisconnect(user.Id)
+	return p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.admin.disconnected",
+		Other: "@{{.Username}} has been disconnected from MS Teams Meetings.",
+	}, data), nil
+}
+
+func (p *Plugin) handleAdminResetAll(l *i18n.Localizer, args []string, extra *model.CommandArgs) (string, error) {
+	if len(args) > 2 {
+		return p.localize(l, tooManyParametersMessage, nil), nil
+	}
+
+	if len(args) < 2 || args[1] != resetAllConfirmFlag {
+		users, err := p.listConnectedUsers()
+		if err != nil {
+			return p.localize(l, listConnectedFailedMessage, nil), errors.Wrap(err, "cannot list connected users")
+		}
+		return p.localize(l, &i18n.Message{
+			ID: "mstmeetings.admin.reset_all_confirm",
+			Other: "This disconnects all {{.Users}} connected users, who will need to connect their Microsoft account again. " +
+				"To continue, run `/mstmeetings admin reset-all {{.Flag}}`.",
+		}, map[string]any{"Users": len(users), "Flag": resetAllConfirmFlag}), nil
+	}
+
+	p.API.LogInfo("System admin reset all MS Teams Meetings connections", "AdminUserID", extra.UserId)
+	if err := p.deleteAllOAuthTokens(); err != nil {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.admin.reset_all_failed",
+			Other: "Failed to disconnect all users.",
+		}, nil), errors.Wrap(err, "cannot reset all OAuth2 tokens")
+	}
+
+	return p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.admin.reset_all_done",
+		Other: "All users have been disconnected from MS Teams Meetings.",
+	}, nil), nil
+}
+
+func (p *Plugin) handleAdminStats(l *i18n.Localizer) (string, error) {
+	users, err := p.listConnectedUsers()
+	if err != nil {
+		return p.localize(l, listConnectedFailedMessage, nil), errors.Wrap(err, "cannot list connected users")
+	}
+
+	recentSince := time.Now().AddDate(0, 0, -recentlyConnectedDays).UnixMilli()
+	recent := 0
+	for _, user := range users {
+		if user.ConnectedAt >= recentSince {
+			recent++
+		}
+	}
+
+	return p.localize(l, &i18n.Message{
+		ID: "mstmeetings.admin.stats",
+		Other: "###### MS Teams Meetings statistics\n" +
+			"* Connected users: {{.Users}}\n" +
+			"* Connected in the last {{.Days}} days: {{.RecentUsers}}\n" +
+			"* Microsoft Graph requests retried since the plugin started: {{.Retries}}\n" +
+			"* Application permissions: {{.ApplicationPermissions}}",
+	}, map[string]any{
+		"Users":                  len(users),
+		"Days":                   recentlyConnectedDays,
+		"RecentUsers":            recent,
+		"Retries":                p.graphRetries.Load(),
+		"ApplicationPermissions": p.formatEnabled(l, p.getConfiguration().UseApplicationPermissions),
+	}), nil
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestHandleAdmin(t *testing.T) {
+	index := []byte(`{"demoUserID":{"user_id":"demoUserID","upn":"demo@example.com","connected_at":1700000000000},"oldUserID":{"user_id":"oldUserID","upn":"old@example.com"}}`)
+
+	tests := []struct {
+		name           string
+		args           []string
+		mockSetup      func(api *plugintest.API, encryptedUserInfo []byte, mockTracker *MockTracker)
+		expectedOutput string
+	}{
+		{
+			name: "Not a system admin",
+			args: []string{"admin", "stats"},
+			mockSetup: func(api *plugintest.API, _ []byte, _ *MockTracker) {
+				api.On("HasPermissionTo", "adminUserID", model.PermissionManageSystem).Return(false).Once()
+			},
+			expectedOutput: adminNotAuthorizedText,
+		},
+		{
+			name:           "No action",
+			args:           []string{"admin"},
+			expectedOutput: "Admin Command Help",
+		},
+		{
+			name:           "Unknown action",
+			args:           []string{"admin", "unknown"},
+			expectedOutput: "Unknown action `unknown`.",
+		},
+		{
+			name: "List connected users",
+			args: []string{"admin", "list-connected"},
+			mockSetup: func(api *plugintest.API, _ []byte, _ *MockTracker) {
+				api.On("KVGet", connectedUsersKey).Return(index, nil)
+				api.On("GetUser", "demoUserID").Return(&model.User{Username: "demo"}, nil)
+				api.On("GetUser", "oldUserID").Return(nil, &model.AppError{Message: "not found"})
+			},
+			expectedOutput: "###### Connected users (page 1 of 1, 2 users)\n" +
+				"| User | Microsoft account | Connected |\n|:--|:--|:--|\n" +
+				"| @demo | demo@example.com | Nov 14, 2023 22:13 UTC |\n" +
+				"| oldUserID | old@example.com | Unknown |\n",
+		},
+		{
+			name:           "List connected users with an invalid page",
+			args:           []string{"admin", "list-connected", "zero"},
+			expectedOutput: "The page must be a positive number.",
+		},
+		{
+			name: "List connected users past the last page",
+			args: []string{"admin", "list-connected", "2"},
+			mockSetup: func(api *plugintest.API, _ []byte, _ *MockTracker) {
+				api.On("KVGet", connectedUsersKey).Return(index, nil)
+			},
+			expectedOutput: "There are only 1 pages of connected users.",
+		},
+		{
+			name: "Disconnect an unknown user",
+			args: []string{"admin", "disconnect", "@nobody"},
+			mockSetup: func(api *plugintest.API, _ []byte, _ *MockTracker) {
+				api.On("GetUserByUsername", "nobody").Return(nil, &model.AppError{Message: "not found"})
+			},
+			expectedOutput: "User @nobody was not found.",
+		},
+		{
+			name: "Disconnect a user",
+			args: []string{"admin", "disconnect", "@demo"},
+			mockSetup: func(api *plugintest.API, encryptedUserInfo []byte, mockTracker *MockTracker) {
+				api.On("GetUserByUsername", "demo").Return(&model.User{Id: "demoUserID", Username: "demo"}, nil)
+				api.On("KVGet", "token_demoUserID").Return(encryptedUserInfo, nil)
+				api.On("KVDelete", "token_demoUserID").Return(nil)
+				api.On("KVDelete", "tbyrid_demo_remote_id").Return(nil)
+				api.On("KVGet", connectedUsersKey).Return([]byte(`{"demoUserID":{"user_id":"demoUserID"}}`), nil)
+				api.On("KVCompareAndSet", connectedUsersKey, []byte(`{"demoUserID":{"user_id":"demoUserID"}}`), []byte(`{}`)).Return(true, nil)
+				api.On("LogInfo", "System admin disconnected a user from MS Teams Meetings", "AdminUserID", "adminUserID", "UserID", "demoUserID")
+				mockTracker.On("TrackUserEvent", "disconnect", "demoUserID", mock.Anything).Return(nil)
+			},
+			expectedOutput: "@demo has been disconnected from MS Teams Meetings.",
+		},
+		{
+			name: "Reset all without confirmation",
+			args: []string{"admin", "reset-all"},
+			mockSetup: func(api *plugintest.API, _ []byte, _ *MockTracker) {
+				api.On("KVGet", connectedUsersKey).Return(index, nil)
+			},
+			expectedOutput: "This disconnects all 2 connected users, who will need to connect their Microsoft account again. " +
+				"To continue, run `/mstmeetings admin reset-all --confirm`.",
+		},
+		{
+			name: "Reset all",
+			args: []string{"admin", "reset-all", "--confirm"},
+			mockSetup: func(api *plugintest.API, _ []byte, _ *MockTracker) {
+				api.On("LogInfo", "System admin reset all MS Teams Meetings connections", "AdminUserID", "adminUserID")
+				api.On("KVList", 0, kvListPerPage).Return([]string{"token_demoUserID", "tbyrid_remoteID", "preferences_demoUserID"}, nil)
+				api.On("KVDelete", "token_demoUserID").Return(nil)
+				api.On("KVDelete", "tbyrid_remoteID").Return(nil)
+				api.On("KVDelete", connectedUsersKey).Return(nil)
+			},
+			expectedOutput: "All users have been disconnected from MS Teams Meetings.",
+		},
+		{
+			name: "Stats",
+			args: []string{"admin", "stats"},
+			mockSetup: func(api *plugintest.API, _ []byte, _ *MockTracker) {
+				api.On("KVGet", connectedUsersKey).Return(index, nil)
+			},
+			expectedOutput: "###### MS Teams Meetings statistics\n" +
+				"* Connected users: 2\n" +
+				"* Connected in the last 30 days: 0\n" +
+				"* Microsoft Graph requests retried since the plugin started: 3\n" +
+				"* Application permissions: disabled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			mockTracker := &MockTracker{}
+
+			p := &Plugin{
+				MattermostPlugin: plugin.MattermostPlugin{
+					API: api,
+				},
+				tracker: mockTracker,
+			}
+			p.setConfiguration(&configuration{EncryptionKey: "demo_encrypt_key"})
+			p.graphRetries.Store(3)
+
+			userInfo := &UserInfo{
+				RemoteID:   "demo_remote_id",
+				UserID:     "demoUserID",
+				OAuthToken: &oauth2.Token{AccessToken: "access_token"},
+			}
+			encryptedUserInfo, err := userInfo.EncryptedJSON([]byte("demo_encrypt_key"))
+			require.NoError(t, err)
+
+			if tt.mockSetup != nil {
+				tt.mockSetup(api, encryptedUserInfo, mockTracker)
+			}
+			api.On("HasPermissionTo", "adminUserID", model.PermissionManageSystem).Return(true).Maybe()
+
+			resp, err := p.handleAdminWithDeps(tt.args, &model.CommandArgs{UserId: "adminUserID"}, mockClientFactory(&MockClient{}))
+			require.NoError(t, err)
+			require.Contains(t, resp, tt.expectedOutput)
+
+			api.AssertExpectations(t)
+			mockTracker.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/i18n"
+	"github.com/pkg/errors"
+)
+
+const (
+	agendaKeyPrefix = "agenda_"
+	agendaJobKey    = "dailyagenda"
+	agendaInterval  = 5 * time.Minute
+	// agendaHour is the hour of the day the agenda is sent, in the timezone of each user.
+	agendaHour = 8
+
+	// maxAgendaEvents bounds the meetings of a day listed in an agenda.
+	maxAgendaEvents = 20
+	// calendarViewPageSize is how many events are requested per page of a calendar view.
+	calendarViewPageSize = 50
+)
+
+// CalendarEvent is an event of a calendar.
+type CalendarEvent struct {
+	ID      string
+	Subject string
+	Start   time.Time
+	End     time.Time
+	// JoinURL is the join URL of the Teams meeting of the event, if it has one.
+	JoinURL      string
+	IsAllDay     bool
+	Organizer    string
+	LastModified time.Time
+}
+
+// GetCalendarView returns the Teams meetings of the signed-in user's calendar between start and
+// end, ordered by start time. Cancelled events are left out.
+func (c *Client) GetCalendarView(ctx context.Context, start, end time.Time) ([]*CalendarEvent, error) {
+	return c.getCalendarView(ctx, "/me/calendarView", start, end, maxAgendaEvents)
+}
+
+// getCalendarView returns the first limit Teams meetings of the calendar view at path. Graph
+// cannot filter a calendar view on online meetings, so the pages of events are read until enough
+// meetings are found.
+func (c *Client) getCalendarView(ctx context.Context, path string, start, end time.Time, limit int) ([]*CalendarEvent, error) {
+	query := url.Values{
+		"startDateTime": {start.UTC().Format(time.RFC3339)},
+		"endDateTime":   {end.UTC().Format(time.RFC3339)},
+		"$select":       {"id,subject,start,end,isAllDay,isCancelled,lastModifiedDateTime,organizer,onlineMeeting"},
+		"$orderby":      {"start/dateTime"},
+		"$top":          {fmt.Sprint(calendarViewPageSize)},
+	}
+	events := []*CalendarEvent{}
+	for path != "" {
+		var out struct {
+			Value    []graphEvent `json:"value"`
+			NextLink string       `json:"@odata.nextLink"`
+		}
+		if err := c.do(ctx, http.MethodGet, path, query, nil, &out); err != nil {
+			return nil, errors.Wrap(err, "cannot get calendar view")
+		}
+
+		for _, e := range out.Value {
+			if e.IsCancelled || e.OnlineMeeting == nil || e.OnlineMeeting.JoinURL == "" {
+				continue
+			}
+			event := &CalendarEvent{
+				ID:       e.ID,
+				Subject:  e.Subject,
+				Start:    e.Start.toTime(),
+				End:      e.End.toTime(),
+				JoinURL:  e.OnlineMeeting.JoinURL,
+				IsAllDay: e.IsAllDay,
+			}
+			if e.Organizer != nil && e.Organizer.EmailAddress != nil {
+				event.Organizer = e.Organizer.EmailAddress.Name
+			}
+			if e.LastModifiedDateTime != nil {
+				event.LastModified = *e.LastModifiedDateTime
+			}
+			events = append(events, event)
+			if len(events) == limit {
+				return events, nil
+			}
+		}
+
+		// The next page link carries the query.
+		path, query = "", nil
+		if out.NextLink != "" {
+			if !strings.HasPrefix(out.NextLink, c.baseURL) {
+				return nil, errors.New("unexpected next page link")
+			}
+			path = strings.TrimPrefix(out.NextLink, c.baseURL)
+		}
+	}
+	return events, nil
+}
+
+// agendaSettings records whether a user receives the daily agenda, and the last day it was sent
+// in their timezone.
+type agendaSettings struct {
+	Enabled  bool   `json:"enabled"`
+	LastSent string `json:"last_sent,omitempty"`
+	// LastFailed is the last day the agenda could not be sent. It is not retried that day.
+	LastFailed string `json:"last_failed,omitempty"`
+}
+
+func getAgendaKey(userID string) string {
+	return agendaKeyPrefix + userID
+}
+
+func (p *Plugin) getAgendaSettings(userID string) (*agendaSettings, error) {
+	data, appErr := p.API.KVGet(getAgendaKey(userID))
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	settings := &agendaSettings{}
+	if data == nil {
+		return settings, nil
+	}
+	if err := json.Unmarshal(data, settings); err != nil {
+		return nil, errors.Wrap(err, "cannot decode agenda settings")
+	}
+	return settings, nil
+}
+
+func (p *Plugin) storeAgendaSettings(userID string, settings *agendaSettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return errors.Wrap(err, "cannot encode agenda settings")
+	}
+
+	if appErr := p.API.KVSet(getAgendaKey(userID), data); appErr != nil {
+		return appErr
+	}
+	return nil
+}
+
+// sendDailyAgendas sends the agenda of the day to the connected users who opted in, once their
+// morning has come. It runs on a single server of the cluster.
+func (p *Plugin) sendDailyAgendas() {
+	p.sendDailyAgendasWithDeps(p.NewClient)
+}
+
+func (p *Plugin) sendDailyAgendasWithDeps(newClient ClientFactory) {
+	if config := p.getConfiguration(); config == nil || !config.EnableDailyAgenda || config.UseApplicationPermissions {
+		return
+	}
+
+	users, err := p.listConnectedUsers()
+	if err != nil {
+		p.API.LogError("sendDailyAgendas, failed to list connected users", "error", err.Error())
+		return
+	}
+
+	now := time.Now()
+	for _, connected := range users {
+		if err := p.sendDailyAgenda(connected.UserID, now, newClient); err != nil {
+			p.API.LogWarn("sendDailyAgendas, failed to send daily agenda", "UserID", connected.UserID, "error", err.Error())
+		}
+	}
+}
+
+// sendDailyAgenda sends the agenda of a user if they opted in, it is past agendaHour in their
+// timezone and it was not sent or attempted today yet. A failed agenda is not retried until the
+// next day, as the failures are mostly missing permissions that last until the user reconnects.
+func (p *Plugin) sendDailyAgenda(userID string, now time.Time, newClient ClientFactory) error {
+	settings, err := p.getAgendaSettings(userID)
+	if err != nil {
+		return err
+	}
+	if !settings.Enabled {
+		return nil
+	}
+
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		return appErr
+	}
+
+	now = now.In(getUserLocation(user))
+	today := now.Format(time.DateOnly)
+	if now.Hour() < agendaHour || settings.LastSent == today || settings.LastFailed == today {
+		return nil
+	}
+
+	if err = p.sendAgenda(user, now, newClient); err != nil {
+		settings.LastFailed = today
+		if storeErr := p.storeAgendaSettings(userID, settings); storeErr != nil {
+			p.API.LogWarn("sendDailyAgenda, failed to record the failed agenda", "UserID", userID, "error", storeErr.Error())
+		}
+		return err
+	}
+
+	settings.LastSent = today
+	return p.storeAgendaSettings(userID, settings)
+}
+
+// sendAgenda sends a user the Teams meetings of their calendar on the day of now, in a direct
+// message with a button to join each of them.
+func (p *Plugin) sendAgenda(user *model.User, now time.Time, newClient ClientFactory) error {
+	client, err := p.newUserClient(user.Id, newClient)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.getConfiguration().getRequestTimeout())
+	defer cancel()
+
+	// Users who connected before the agenda was enabled have not granted Calendars.Read yet, so
+	// their requests fail until they reconnect.
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	events, err := client.GetCalendarView(ctx, dayStart, dayStart.AddDate(0, 0, 1))
+	if err != nil {
+		return err
+	}
+
+	channel, appErr := p.API.GetDirectChannel(user.Id, p.botUserID)
+	if appErr != nil {
+		return appErr
+	}
+
+	l := p.getUserLocalizer(user.Id)
+	attachments := []*model.SlackAttachment{}
+	for _, event := range events {
+		if event.JoinURL == "" {
+			continue
+		}
+		attachments = append(attachments, &model.SlackAttachment{
+			Title:     event.Subject,
+			TitleLink: event.JoinURL,
+			Text:      p.formatAgendaEventTime(l, event, now.Location()),
+			Actions:   []*model.PostAction{p.newJoinMeetingAction(l, event.JoinURL)},
+		})
+	}
+
+	post := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: channel.Id,
+		Message: p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.agenda.title",
+			Other: "Your Teams meetings for {{.Date}}:",
+		}, map[string]any{"Date": now.Format(time.DateOnly)}),
+	}
+	if len(attachments) == 0 {
+		post.Message = p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.agenda.empty",
+			Other: "You have no Teams meetings on {{.Date}}.",
+		}, map[string]any{"Date": now.Format(time.DateOnly)})
+	} else {
+		model.ParseSlackAttachment(post, attachments)
+	}
+
+	if _, appErr = p.API.CreatePost(post); appErr != nil {
+		return appErr
+	}
+	return nil
+}
+
+func (p *Plugin) formatAgendaEventTime(l *i18n.Localizer, event *CalendarEvent, loc *time.Location) string {
+	if event.IsAllDay {
+		return p.localize(l, &i18n.Message{ID: "mstmeetings.agenda.all_day", Other: "All day"}, nil)
+	}
+	return event.Start.In(loc).Format("15:04") + " – " + event.End.In(loc).Format("15:04")
+}
+
+func (p *Plugin) formatAgendaSettings(l *i18n.Localizer, settings *agendaSettings) string {
+	return p.localize(l, &i18n.Message{
+		ID: "mstmeetings.agenda.settings",
+		Other: "Daily agenda: {{.Enabled}}\n" +
+			"Run `/mstmeetings agenda on` to receive the Teams meetings of your day every morning at {{.Hour}}:00, `/mstmeetings agenda off` to stop, or `/mstmeetings agenda now` to receive today's agenda now.",
+	}, map[string]any{"Enabled": p.formatOnOff(l, settings.Enabled), "Hour": agendaHour})
+}
+
+func (p *Plugin) handleAgenda(args []string, extra *model.CommandArgs) (string, error) {
+	return p.handleAgendaWithDeps(args, extra, p.NewClient)
+}
+
+func (p *Plugin) handleAgendaWithDeps(args []string, extra *model.CommandArgs, newClient ClientFactory) (string, error) {
+	l := p.getUserLocalizer(extra.UserId)
+	if config := p.getConfiguration(); config == nil || !config.EnableDailyAgenda || config.UseApplicationPermissions {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.agenda.disabled",
+			Other: "The daily agenda is not enabled on this server.",
+		}, nil), nil
+	}
+	if len(args) > 2 {
+		return p.localize(l, tooManyParametersMessage, nil), nil
+	}
+
+	settings, err := p.getAgendaSettings(extra.UserId)
+	if err != nil {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.agenda.get_settings_failed",
+			Other: "Failed to get your agenda settings.",
+		}, nil), errors.Wrap(err, "cannot get agenda settings")
+	}
+	if len(args) < 2 {
+		return p.formatAgendaSettings(l, settings), nil
+	}
+
+	user, appErr := p.API.GetUser(extra.UserId)
+	if appErr != nil {
+		return p.localize(l, getUserFailedMessage, nil), errors.Wrap(appErr, "cannot get user")
+	}
+	now := time.Now().In(getUserLocation(user))
+
+	switch strings.ToLower(args[1]) {
+	case "on":
+		settings.Enabled = true
+		// The first agenda is sent on the next morning, as today's can be requested with now.
+		if now.Hour() >= agendaHour {
+			settings.LastSent = now.Format(time.DateOnly)
+		}
+	case "off":
+		settings.Enabled = false
+	case "now":
+		if _, err = p.GetUserInfo(extra.UserId); err != nil {
+			return p.localize(l, connectFirstMessage, nil), nil
+		}
+		if err = p.sendAgenda(user, now, newClient); err != nil {
+			return p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.agenda.send_failed",
+				Other: "Failed to get your agenda. You may need to reconnect your Microsoft account with `/mstmeetings connect`.",
+			}, nil), errors.Wrap(err, "cannot send agenda")
+		}
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.agenda.sent",
+			Other: "Your agenda has been sent to you in a direct message.",
+		}, nil), nil
+	default:
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.agenda.unknown_option",
+			Other: "Unknown agenda option `{{.Option}}`.",
+		}, map[string]any{"Option": args[1]}) + "\n" + p.formatAgendaSettings(l, settings), nil
+	}
+
+	if err = p.storeAgendaSettings(extra.UserId, settings); err != nil {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.agenda.save_failed",
+			Other: "Failed to save your agenda settings.",
+		}, nil), errors.Wrap(err, "cannot store agenda settings")
+	}
+	return p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.agenda.saved",
+		Other: "Your agenda settings have been saved.",
+	}, nil) + "\n" + p.formatAgendaSettings(l, settings), nil
+}
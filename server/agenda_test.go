@@ -0,0 +1,208 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendDailyAgenda(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	user := &model.User{Id: "demoUserID", Timezone: model.StringMap{"useAutomaticTimezone": "false", "manualTimezone": "Europe/Paris"}}
+	morning := time.Date(2026, 10, 19, 9, 0, 0, 0, paris)
+	dayStart := time.Date(2026, 10, 19, 0, 0, 0, 0, paris)
+
+	events := []*CalendarEvent{
+		{Subject: "Planning", Start: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC), End: time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC), JoinURL: "https://teams.microsoft.com/l/meetup-join/planning"},
+		{Subject: "Lunch", Start: time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC), End: time.Date(2026, 10, 19, 11, 0, 0, 0, time.UTC)},
+	}
+
+	tests := []struct {
+		name          string
+		now           time.Time
+		settings      []byte
+		events        []*CalendarEvent
+		expectedCalls func(api *plugintest.API)
+	}{
+		{
+			name:          "Not opted in",
+			now:           morning,
+			expectedCalls: func(_ *plugintest.API) {},
+		},
+		{
+			name:     "Before the agenda hour",
+			now:      time.Date(2026, 10, 19, 7, 30, 0, 0, paris),
+			settings: []byte(`{"enabled":true,"last_sent":"2026-10-18"}`),
+			expectedCalls: func(api *plugintest.API) {
+				api.On("GetUser", "demoUserID").Return(user, nil)
+			},
+		},
+		{
+			name:     "Already sent today",
+			now:      morning,
+			settings: []byte(`{"enabled":true,"last_sent":"2026-10-19"}`),
+			expectedCalls: func(api *plugintest.API) {
+				api.On("GetUser", "demoUserID").Return(user, nil)
+			},
+		},
+		{
+			name:     "Already failed today",
+			now:      morning,
+			settings: []byte(`{"enabled":true,"last_sent":"2026-10-18","last_failed":"2026-10-19"}`),
+			expectedCalls: func(api *plugintest.API) {
+				api.On("GetUser", "demoUserID").Return(user, nil)
+			},
+		},
+		{
+			name:     "Agenda sent",
+			now:      morning,
+			settings: []byte(`{"enabled":true,"last_sent":"2026-10-18"}`),
+			events:   events,
+			expectedCalls: func(api *plugintest.API) {
+				api.On("GetUser", "demoUserID").Return(user, nil)
+				api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+					attachments := post.Attachments()
+					return post.ChannelId == "dmChannelID" &&
+						post.Message == "Your Teams meetings for 2026-10-19:" &&
+						len(attachments) == 1 &&
+						attachments[0].Title == "Planning" &&
+						attachments[0].Text == "14:00 – 15:00" &&
+						len(attachments[0].Actions) == 1
+				})).Return(&model.Post{}, nil)
+				api.On("KVSet", "agenda_demoUserID", []byte(`{"enabled":true,"last_sent":"2026-10-19"}`)).Return(nil)
+			},
+		},
+		{
+			name:     "No meetings today",
+			now:      morning,
+			settings: []byte(`{"enabled":true}`),
+			events:   []*CalendarEvent{},
+			expectedCalls: func(api *plugintest.API) {
+				api.On("GetUser", "demoUserID").Return(user, nil)
+				api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+					return post.Message == "You have no Teams meetings on 2026-10-19." && len(post.Attachments()) == 0
+				})).Return(&model.Post{}, nil)
+				api.On("KVSet", "agenda_demoUserID", []byte(`{"enabled":true,"last_sent":"2026-10-19"}`)).Return(nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			defer api.AssertExpectations(t)
+			mockClient := &MockClient{}
+			defer mockClient.AssertExpectations(t)
+			p := SetupMockPlugin(api, nil, nil)
+			p.botUserID = "botUserID"
+			p.setConfiguration(&configuration{EncryptionKey: "demo_encrypt_key", EnableDailyAgenda: true})
+
+			api.On("KVGet", "agenda_demoUserID").Return(tt.settings, nil)
+			if tt.events != nil {
+				setupConnectedDemoUser(t, api)
+				api.On("GetDirectChannel", "demoUserID", "botUserID").Return(&model.Channel{Id: "dmChannelID"}, nil)
+				mockClient.On("GetCalendarView", mock.MatchedBy(dayStart.Equal), mock.MatchedBy(dayStart.AddDate(0, 0, 1).Equal)).Return(tt.events, nil)
+			}
+			tt.expectedCalls(api)
+
+			require.NoError(t, p.sendDailyAgenda("demoUserID", tt.now, mockClientFactory(mockClient)))
+		})
+	}
+}
+
+func TestSendDailyAgendaFailure(t *testing.T) {
+	api := &plugintest.API{}
+	defer api.AssertExpectations(t)
+	mockClient := &MockClient{}
+	defer mockClient.AssertExpectations(t)
+	p := SetupMockPlugin(api, nil, nil)
+	p.botUserID = "botUserID"
+	p.setConfiguration(&configuration{EncryptionKey: "demo_encrypt_key", EnableDailyAgenda: true})
+
+	setupConnectedDemoUser(t, api)
+	api.On("KVGet", "agenda_demoUserID").Return([]byte(`{"enabled":true,"last_sent":"2026-10-18"}`), nil)
+	api.On("GetUser", "demoUserID").Return(&model.User{Id: "demoUserID"}, nil)
+	mockClient.On("GetCalendarView", mock.Anything, mock.Anything).Return([]*CalendarEvent(nil), &GraphError{StatusCode: http.StatusForbidden})
+	// The agenda is not retried until the next day.
+	api.On("KVSet", "agenda_demoUserID", []byte(`{"enabled":true,"last_sent":"2026-10-18","last_failed":"2026-10-19"}`)).Return(nil)
+
+	err := p.sendDailyAgenda("demoUserID", time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC), mockClientFactory(mockClient))
+	require.EqualError(t, err, "graph request failed with status 403")
+}
+
+func TestHandleAgenda(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         *configuration
+		args           []string
+		settings       []byte
+		expectedStored []byte
+		expectedOutput string
+	}{
+		{
+			name:           "Not enabled",
+			config:         &configuration{},
+			args:           []string{"agenda", "on"},
+			expectedOutput: "The daily agenda is not enabled on this server.",
+		},
+		{
+			name:           "Show the settings",
+			config:         &configuration{EnableDailyAgenda: true},
+			args:           []string{"agenda"},
+			expectedOutput: "Daily agenda: Off",
+		},
+		{
+			name:           "Turn off",
+			config:         &configuration{EnableDailyAgenda: true},
+			args:           []string{"agenda", "off"},
+			settings:       []byte(`{"enabled":true,"last_sent":"2026-10-18"}`),
+			expectedStored: []byte(`{"enabled":false,"last_sent":"2026-10-18"}`),
+			expectedOutput: "Your agenda settings have been saved.",
+		},
+		{
+			name:           "Unknown option",
+			config:         &configuration{EnableDailyAgenda: true},
+			args:           []string{"agenda", "tomorrow"},
+			expectedOutput: "Unknown agenda option `tomorrow`.",
+		},
+		{
+			name:           "Agenda now without a connected account",
+			config:         &configuration{EnableDailyAgenda: true},
+			args:           []string{"agenda", "now"},
+			expectedOutput: "Connect your Microsoft account with `/mstmeetings connect` first.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			defer api.AssertExpectations(t)
+			p := SetupMockPlugin(api, nil, nil)
+			p.setConfiguration(tt.config)
+
+			if tt.config.EnableDailyAgenda {
+				api.On("KVGet", "agenda_demoUserID").Return(tt.settings, nil)
+			}
+			if tt.config.EnableDailyAgenda && len(tt.args) > 1 {
+				api.On("GetUser", "demoUserID").Return(&model.User{Id: "demoUserID"}, nil)
+			}
+			if tt.expectedStored != nil {
+				api.On("KVSet", "agenda_demoUserID", tt.expectedStored).Return(nil)
+			}
+			api.On("KVGet", "token_demoUserID").Return(nil, nil).Maybe()
+
+			output, err := p.handleAgendaWithDeps(tt.args, &model.CommandArgs{UserId: "demoUserID"}, mockClientFactory(&MockClient{}))
+			require.NoError(t, err)
+			require.Contains(t, output, tt.expectedOutput)
+		})
+	}
+}
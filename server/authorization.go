@@ -4,12 +4,16 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
 
-	msgraph "github.com/yaegashi/msgraph.go/beta"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/i18n"
+	"github.com/pkg/errors"
 	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
 	"golang.org/x/oauth2/microsoft"
 )
 
@@ -19,7 +23,7 @@ type authError struct {
 }
 
 type AuthResult struct {
-	User     *msgraph.User
+	User     *RemoteUser
 	UserInfo *UserInfo
 	Client   ClientInterface
 }
@@ -29,20 +33,42 @@ func (ae *authError) Error() string {
 	return string(errorString)
 }
 
-func (p *Plugin) getOauthMessage(channelID string) (string, error) {
+func (p *Plugin) getOauthMessage(l *i18n.Localizer, channelID string) (string, error) {
 	pluginOauthURL, err := p.getPluginOauthURL()
 	if err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("[Click here to link your Microsoft account.](%s/connect?channelID=%s)", pluginOauthURL, url.QueryEscape(channelID)), nil
+	return p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.connect.link",
+		Other: "[Click here to link your Microsoft account.]({{.URL}})",
+	}, map[string]any{"URL": fmt.Sprintf("%s/connect?channelID=%s", pluginOauthURL, url.QueryEscape(channelID))}), nil
 }
 
-func (p *Plugin) authenticateAndFetchUser(userID, channelID string, newClient ClientFactory) (*AuthResult, *authError) {
-	oauthMsg, err := p.getOauthMessage(channelID)
+func (p *Plugin) authenticateAndFetchUser(ctx context.Context, userID, channelID string, newClient ClientFactory) (*AuthResult, *authError) {
+	if config := p.getConfiguration(); config != nil && config.UseApplicationPermissions {
+		authResult, err := p.authenticateWithApplicationPermissions(ctx, userID, newClient)
+		if err == nil {
+			return authResult, nil
+		}
+		// Users outside the application access policy can still connect their own account.
+		p.API.LogWarn("authenticateAndFetchUser, falling back to delegated permissions", "UserID", userID, "error", err.Error())
+	}
+
+	return p.authenticateWithConnectedAccount(ctx, userID, channelID, newClient)
+}
+
+// authenticateWithConnectedAccount fetches the Microsoft user with the OAuth2 token stored when
+// the user connected their account.
+func (p *Plugin) authenticateWithConnectedAccount(ctx context.Context, userID, channelID string, newClient ClientFactory) (*AuthResult, *authError) {
+	l := p.getUserLocalizer(userID)
+	oauthMsg, err := p.getOauthMessage(l, channelID)
 	if err != nil {
 		p.API.LogError("authenticateAndFetchUser, cannot get oauth message", "error", err.Error())
-		return nil, &authError{Message: "Error getting oauth messsage.", Err: err}
+		return nil, &authError{Message: p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.connect.link_failed",
+			Other: "Error getting oauth messsage.",
+		}, nil), Err: err}
 	}
 
 	userInfo, apiErr := p.GetUserInfo(userID)
@@ -53,13 +79,19 @@ func (p *Plugin) authenticateAndFetchUser(userID, channelID string, newClient Cl
 	conf, err := p.getOAuthConfig()
 	if err != nil {
 		p.API.LogError("authenticateAndFetchUser, cannot get oauth config", "error", err.Error())
-		return nil, &authError{Message: "Error getting oauth config.", Err: err}
+		return nil, &authError{Message: p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.connect.oauth_config_failed",
+			Other: "Error getting oauth config.",
+		}, nil), Err: err}
 	}
 
 	client := newClient(conf, userInfo.OAuthToken)
-	user, err := client.GetMe()
+	user, err := client.GetMe(ctx)
 	if err != nil {
 		p.API.LogError("authenticateAndFetchUser, cannot get user", "error", err.Error())
+		if isTimeout(err) {
+			return nil, &authError{Message: p.localize(l, requestTimeoutMessage, nil), Err: err}
+		}
 		return nil, &authError{Message: oauthMsg, Err: err}
 	}
 
@@ -70,10 +102,125 @@ func (p *Plugin) authenticateAndFetchUser(userID, channelID string, newClient Cl
 	}, nil
 }
 
-func (p *Plugin) disconnect(userID string) error {
+// authenticateWithApplicationPermissions resolves the Mattermost user to a Microsoft user with an
+// app-only token, so meetings can be created on their behalf without a stored OAuth2 token.
+func (p *Plugin) authenticateWithApplicationPermissions(ctx context.Context, userID string, newClient ClientFactory) (*AuthResult, error) {
+	config := p.getConfiguration()
+	if config.appTokenSource == nil {
+		return nil, errors.New("application token source is not configured")
+	}
+
+	conf, err := p.getOAuthConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get oauth config")
+	}
+
+	token, err := config.appTokenSource.Token()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get application token")
+	}
+
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "cannot get user")
+	}
+
+	client := newClient(conf, token)
+	userInfo, remoteUser, err := p.resolveRemoteUser(ctx, client, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthResult{
+		User:     remoteUser,
+		UserInfo: userInfo,
+		Client:   client,
+	}, nil
+}
+
+// resolveRemoteUser finds the Microsoft user matching the email of a Mattermost user. Only
+// verified emails and the emails of SSO users are trusted, as users can otherwise set theirs to
+// the address of someone else. The returned UserInfo carries no OAuth2 token and is not meant
+// to be stored.
+func (p *Plugin) resolveRemoteUser(ctx context.Context, client ClientInterface, user *model.User) (*UserInfo, *RemoteUser, error) {
+	if user.Email == "" {
+		return nil, nil, errors.New("user has no email")
+	}
+	if !user.EmailVerified && !user.IsSSOUser() {
+		return nil, nil, errors.New("user email is not verified")
+	}
+
+	remoteUser, err := client.GetUser(ctx, user.Email)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot get remote user")
+	}
+
+	if remoteUser.ID == "" || remoteUser.UserPrincipalName == "" {
+		return nil, nil, errors.New("remote user has no ID or user principal name")
+	}
+
+	email := user.Email
+	if remoteUser.Mail != "" {
+		email = remoteUser.Mail
+	}
+
+	return &UserInfo{
+		UserID:   user.Id,
+		Email:    email,
+		RemoteID: remoteUser.ID,
+		UPN:      remoteUser.UserPrincipalName,
+	}, remoteUser, nil
+}
+
+func (p *Plugin) disconnect(ctx context.Context, userID string, newClient ClientFactory) error {
+	if p.getConfiguration().RevokeSessionsOnDisconnect {
+		if err := p.revokeSignInSessions(ctx, userID, newClient); err != nil {
+			p.API.LogWarn("disconnect, failed to revoke sign-in sessions", "UserID", userID, "error", err.Error())
+		}
+	}
 	return p.RemoveUser(userID)
 }
 
+// revokeSignInSessions revokes the refresh tokens of the user's Microsoft account, using the
+// token stored for them.
+func (p *Plugin) revokeSignInSessions(ctx context.Context, userID string, newClient ClientFactory) error {
+	client, err := p.newUserClient(userID, newClient)
+	if err != nil {
+		return err
+	}
+	return client.RevokeSignInSessions(ctx)
+}
+
+// newUserClient returns a client acting with the connected account of a user. An expired token
+// is refreshed and stored first, as the client would otherwise refresh it again on every use
+// and the rotated refresh token would be lost.
+func (p *Plugin) newUserClient(userID string, newClient ClientFactory) (ClientInterface, error) {
+	userInfo, err := p.GetUserInfo(userID)
+	if err != nil {
+		return nil, err
+	}
+	if userInfo.OAuthToken == nil {
+		return nil, errors.New("no stored OAuth2 token")
+	}
+
+	conf, err := p.getOAuthConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := conf.TokenSource(p.oauthContext(context.Background()), userInfo.OAuthToken).Token()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot refresh OAuth2 token")
+	}
+	if token.AccessToken != userInfo.OAuthToken.AccessToken {
+		userInfo.OAuthToken = token
+		if err := p.StoreUserInfo(userInfo); err != nil {
+			p.API.LogWarn("failed to store the refreshed OAuth2 token", "UserID", userID, "error", err.Error())
+		}
+	}
+	return newClient(conf, token), nil
+}
+
 func (p *Plugin) getOAuthConfig() (*oauth2.Config, error) {
 	config := p.getConfiguration()
 
@@ -88,14 +235,53 @@ func (p *Plugin) getOAuthConfig() (*oauth2.Config, error) {
 
 	redirectURL := fmt.Sprintf("%s/complete", pluginOauthURL)
 
+	scopes := []string{
+		"offline_access",
+		"OnlineMeetings.ReadWrite",
+	}
+	if config.AllowedTenantIDs != "" {
+		// The tenant of the account is read from the ID token.
+		scopes = append(scopes, "openid")
+	}
+	if config.RevokeSessionsOnDisconnect {
+		scopes = append(scopes, "User.RevokeSessions.All")
+	}
+	if config.EnableCalendarIntegration {
+		scopes = append(scopes, "Calendars.ReadWrite")
+	}
+	if config.EnablePresenceSync {
+		scopes = append(scopes, "Presence.Read.All")
+	}
+	if config.EnableDailyAgenda && !config.EnableCalendarIntegration {
+		scopes = append(scopes, "Calendars.Read")
+	}
+	if config.EnableCalendarSubscriptions {
+		scopes = append(scopes, "Calendars.Read.Shared", "Group.Read.All")
+	}
+	if config.EnableMeetingChatMirror {
+		scopes = append(scopes, "Chat.Read")
+	}
+	if config.EnableWebinars {
+		scopes = append(scopes, "VirtualEvent.ReadWrite")
+	}
+
 	return &oauth2.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
 		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+		Endpoint:     microsoft.AzureADEndpoint(clientAuthority),
+	}, nil
+}
+
+// getAppOAuthConfig returns the client credentials configuration used to obtain app-only tokens.
+func (c *configuration) getAppOAuthConfig() *clientcredentials.Config {
+	return &clientcredentials.Config{
+		ClientID:     c.OAuth2ClientID,
+		ClientSecret: c.OAuth2ClientSecret,
+		TokenURL:     microsoft.AzureADEndpoint(c.OAuth2Authority).TokenURL,
 		Scopes: []string{
-			"offline_access",
-			"OnlineMeetings.ReadWrite",
+			"https://graph.microsoft.com/.default",
 		},
-		Endpoint: microsoft.AzureADEndpoint(clientAuthority),
-	}, nil
+	}
 }
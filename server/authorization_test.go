@@ -4,11 +4,18 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
 )
 
 func TestGetOauthMessage(t *testing.T) {
@@ -21,7 +28,7 @@ func TestGetOauthMessage(t *testing.T) {
 			description: "successful",
 			siteURL:     "https://example-url.com",
 			setupFunc: func(p *Plugin) {
-				msg, err := p.getOauthMessage("mockChannelID")
+				msg, err := p.getOauthMessage(defaultLocalizer, "mockChannelID")
 				require.NoError(t, err)
 				require.EqualValues(t, "[Click here to link your Microsoft account.](https://example-url.com/plugins/com.mattermost.msteamsmeetings/oauth2/connect?channelID=mockChannelID)", msg)
 			},
@@ -30,7 +37,7 @@ func TestGetOauthMessage(t *testing.T) {
 			description: "missing site URL",
 			siteURL:     "",
 			setupFunc: func(p *Plugin) {
-				msg, err := p.getOauthMessage("mockChannelID")
+				msg, err := p.getOauthMessage(defaultLocalizer, "mockChannelID")
 				require.EqualError(t, err, "error fetching siteURL")
 				require.EqualValues(t, "", msg)
 			},
@@ -51,3 +58,133 @@ func TestGetOauthMessage(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthenticateAndFetchUserWithApplicationPermissions(t *testing.T) {
+	remoteID := "remoteID"
+	upn := "user@contoso.com"
+
+	for _, testCase := range []struct {
+		description   string
+		setup         func(api *plugintest.API, client *MockClient)
+		expectedError string
+	}{
+		{
+			description: "user resolved by email",
+			setup: func(api *plugintest.API, client *MockClient) {
+				api.On("GetUser", "testUserID").Return(&model.User{Id: "testUserID", Email: "user@contoso.com", EmailVerified: true}, nil)
+				client.On("GetUser", "user@contoso.com").Return(&RemoteUser{ID: remoteID, UserPrincipalName: upn}, nil)
+			},
+		},
+		{
+			description: "SSO user resolved by email",
+			setup: func(api *plugintest.API, client *MockClient) {
+				api.On("GetUser", "testUserID").Return(&model.User{Id: "testUserID", Email: "user@contoso.com", AuthService: model.UserAuthServiceSaml}, nil)
+				client.On("GetUser", "user@contoso.com").Return(&RemoteUser{ID: remoteID, UserPrincipalName: upn}, nil)
+			},
+		},
+		{
+			description: "unverified email is not resolved",
+			setup: func(api *plugintest.API, client *MockClient) {
+				api.On("GetUser", "testUserID").Return(&model.User{Id: "testUserID", Email: "user@contoso.com"}, nil)
+				api.On("LogWarn", "authenticateAndFetchUser, falling back to delegated permissions", "UserID", "testUserID", "error", "user email is not verified")
+				api.On("KVGet", "token_testUserID").Return(nil, nil)
+			},
+			expectedError: "Your Mattermost account is not connected to any Microsoft Teams account",
+		},
+		{
+			description: "falls back to delegated permissions",
+			setup: func(api *plugintest.API, client *MockClient) {
+				api.On("GetUser", "testUserID").Return(&model.User{Id: "testUserID", Email: "user@contoso.com", EmailVerified: true}, nil)
+				client.On("GetUser", "user@contoso.com").Return(&RemoteUser{}, errors.New("not found"))
+				api.On("LogWarn", "authenticateAndFetchUser, falling back to delegated permissions", "UserID", "testUserID", "error", "cannot get remote user: not found")
+				api.On("KVGet", "token_testUserID").Return(nil, nil)
+			},
+			expectedError: "Your Mattermost account is not connected to any Microsoft Teams account",
+		},
+	} {
+		t.Run(testCase.description, func(t *testing.T) {
+			api := &plugintest.API{}
+			client := &MockClient{}
+			p := SetupMockPlugin(api, nil, client)
+			p.setConfiguration(&configuration{
+				UseApplicationPermissions: true,
+				appTokenSource:            oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "appToken"}),
+			})
+			api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewPointer("https://example.com")}})
+			testCase.setup(api, client)
+
+			authResult, authErr := p.authenticateAndFetchUser(context.Background(), "testUserID", "testChannelID", mockClientFactory(client))
+			if testCase.expectedError != "" {
+				require.NotNil(t, authErr)
+				require.EqualError(t, authErr.Err, testCase.expectedError)
+			} else {
+				require.Nil(t, authErr)
+				require.Equal(t, &UserInfo{UserID: "testUserID", Email: "user@contoso.com", RemoteID: remoteID, UPN: upn}, authResult.UserInfo)
+				require.Nil(t, authResult.UserInfo.OAuthToken)
+			}
+
+			api.AssertExpectations(t)
+			client.AssertExpectations(t)
+		})
+	}
+}
+
+// tokenEndpointTransport answers every request as the token endpoint of Azure AD.
+type tokenEndpointTransport struct {
+	requests int
+}
+
+func (t *tokenEndpointTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.requests++
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"access_token": "refreshedToken", "refresh_token": "rotatedRefreshToken", "token_type": "Bearer", "expires_in": 3600}`))
+	return w.Result(), nil
+}
+
+func TestNewUserClientStoresRefreshedToken(t *testing.T) {
+	for _, testCase := range []struct {
+		description      string
+		token            *oauth2.Token
+		expectedToken    string
+		expectedRequests int
+	}{
+		{
+			description:   "valid token",
+			token:         &oauth2.Token{AccessToken: "token", RefreshToken: "refreshToken", Expiry: time.Now().Add(time.Hour)},
+			expectedToken: "token",
+		},
+		{
+			description:      "expired token",
+			token:            &oauth2.Token{AccessToken: "token", RefreshToken: "refreshToken", Expiry: time.Now().Add(-time.Hour)},
+			expectedToken:    "refreshedToken",
+			expectedRequests: 1,
+		},
+	} {
+		t.Run(testCase.description, func(t *testing.T) {
+			api := &plugintest.API{}
+			defer api.AssertExpectations(t)
+			transport := &tokenEndpointTransport{}
+			p := SetupMockPlugin(api, nil, nil)
+			p.setConfiguration(&configuration{EncryptionKey: "demo_encrypt_key", httpClient: &http.Client{Transport: transport}})
+
+			encryptedUserInfo, err := (&UserInfo{UserID: "demoUserID", RemoteID: "remoteID", OAuthToken: testCase.token}).EncryptedJSON([]byte("demo_encrypt_key"))
+			require.NoError(t, err)
+			api.On("KVGet", "token_demoUserID").Return(encryptedUserInfo, nil)
+			api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewPointer("https://example.com")}})
+			if testCase.expectedRequests > 0 {
+				api.On("KVSet", "token_demoUserID", mock.Anything).Return(nil)
+				api.On("KVSet", "tbyrid_remoteID", mock.Anything).Return(nil)
+			}
+
+			var token *oauth2.Token
+			_, err = p.newUserClient("demoUserID", func(_ *oauth2.Config, t *oauth2.Token) ClientInterface {
+				token = t
+				return &MockClient{}
+			})
+			require.NoError(t, err)
+			require.Equal(t, testCase.expectedToken, token.AccessToken)
+			require.Equal(t, testCase.expectedRequests, transport.requests)
+		})
+	}
+}
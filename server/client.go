@@ -4,16 +4,45 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/mattermost/mattermost/server/public/plugin"
-	msgraph "github.com/yaegashi/msgraph.go/beta"
+	"github.com/pkg/errors"
 	"golang.org/x/oauth2"
 )
 
+const (
+	graphBaseURL = "https://graph.microsoft.com/v1.0"
+	// graphBetaBaseURL serves the endpoints only available in beta.
+	graphBetaBaseURL = "https://graph.microsoft.com/beta"
+)
+
 type ClientInterface interface {
-	CreateMeeting(creator *UserInfo, attendeesIDs []*UserInfo, subject string) (*msgraph.OnlineMeeting, error)
-	GetMe() (*msgraph.User, error)
+	CreateMeeting(ctx context.Context, creator *UserInfo, attendeesIDs []*UserInfo, options *MeetingOptions) (*OnlineMeeting, error)
+	GetMeetingByJoinURL(ctx context.Context, joinURL string) (*OnlineMeeting, error)
+	EndMeeting(ctx context.Context, joinURL, eventID string) error
+	IsMeetingCancelled(ctx context.Context, joinURL, eventID string) (bool, error)
+	GetMe(ctx context.Context) (*RemoteUser, error)
+	GetUser(ctx context.Context, email string) (*RemoteUser, error)
+	GetPresences(ctx context.Context, remoteIDs []string) (map[string]*Presence, error)
+	GetCalendarView(ctx context.Context, start, end time.Time) ([]*CalendarEvent, error)
+	FindCalendar(ctx context.Context, ref string) (*CalendarSource, error)
+	GetSharedCalendarView(ctx context.Context, source *CalendarSource, start, end time.Time) ([]*CalendarEvent, error)
+	SubscribeToCalendar(ctx context.Context, source *CalendarSource, notificationURL, clientState string, expiresAt time.Time) (*GraphSubscription, error)
+	GetChatMessage(ctx context.Context, chatID, messageID string) (*ChatMessage, error)
+	SubscribeToChat(ctx context.Context, chatID, notificationURL, clientState string, expiresAt time.Time) (*GraphSubscription, error)
+	RenewSubscription(ctx context.Context, subscriptionID string, expiresAt time.Time) error
+	DeleteSubscription(ctx context.Context, subscriptionID string) error
+	CreateWebinar(ctx context.Context, options *WebinarOptions) (*Webinar, error)
+	GetWebinarRegistrationCount(ctx context.Context, webinarID string) (int, error)
+	RevokeSignInSessions(ctx context.Context) error
 }
 
 // ClientFactory is a function type for creating clients, used for dependency injection in tests
@@ -21,16 +50,101 @@ type ClientFactory func(conf *oauth2.Config, token *oauth2.Token) ClientInterfac
 
 // Client represents a MSGraph API client
 type Client struct {
-	builder *msgraph.GraphServiceRequestBuilder
-	api     plugin.API
+	httpClient  *http.Client
+	baseURL     string
+	betaBaseURL string
+	api         plugin.API
 }
 
 // NewClient returns a new MSGraph API client.
 func (p *Plugin) NewClient(conf *oauth2.Config, token *oauth2.Token) ClientInterface {
-	ctx := context.Background()
+	ctx := p.oauthContext(context.Background())
 	httpClient := conf.Client(ctx, token)
+	httpClient.Transport = newRetryTransport(httpClient.Transport, p.API, &p.graphRetries)
 	return &Client{
-		builder: msgraph.NewClient(httpClient),
-		api:     p.API,
+		httpClient:  httpClient,
+		baseURL:     graphBaseURL,
+		betaBaseURL: graphBetaBaseURL,
+		api:         p.API,
+	}
+}
+
+// GraphError is an error response returned by Microsoft Graph.
+type GraphError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *GraphError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("graph request failed with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("graph request failed with status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// do sends a request to Microsoft Graph, encoding in as the JSON body when set and decoding the
+// JSON response into out when set.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	return c.send(ctx, method, c.baseURL+path, query, in, out)
+}
+
+// doBeta sends a request to the beta endpoint of Microsoft Graph, for the APIs not available in
+// v1.0.
+func (c *Client) doBeta(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	return c.send(ctx, method, c.betaBaseURL+path, query, in, out)
+}
+
+func (c *Client) send(ctx context.Context, method, u string, query url.Values, in, out interface{}) error {
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return errors.Wrap(err, "cannot encode request")
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return errors.Wrap(err, "cannot create request")
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		graphErr := &GraphError{StatusCode: resp.StatusCode}
+		var errResp struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			graphErr.Code = errResp.Error.Code
+			graphErr.Message = errResp.Error.Message
+		}
+		return graphErr
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errors.Wrap(err, "cannot decode response")
 	}
+	return nil
 }
@@ -0,0 +1,476 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) (*Client, *plugintest.API) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	api := &plugintest.API{}
+	return &Client{
+		httpClient:  server.Client(),
+		baseURL:     server.URL,
+		betaBaseURL: server.URL + "/beta",
+		api:         api,
+	}, api
+}
+
+func TestClientCreateMeeting(t *testing.T) {
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "/users/creatorRemoteID/onlineMeetings", r.URL.Path)
+
+		var in graphOnlineMeeting
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+		require.Equal(t, "Standup", in.Subject)
+		require.Equal(t, "creatorRemoteID", in.Participants.Organizer.Identity.User.ID)
+		require.Len(t, in.Participants.Attendees, 1)
+		require.Equal(t, "attendee@contoso.com", in.Participants.Attendees[0].Upn)
+		require.Equal(t, 30*time.Minute, in.EndDateTime.Sub(*in.StartDateTime))
+		require.Equal(t, "organization", in.LobbyBypassSettings.Scope)
+
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": "meetingID", "subject": "Standup", "joinWebUrl": "https://teams.microsoft.com/l/meetup-join/test"}`))
+	})
+
+	meeting, err := client.CreateMeeting(context.Background(),
+		&UserInfo{RemoteID: "creatorRemoteID", UPN: "creator@contoso.com"},
+		[]*UserInfo{{RemoteID: "attendeeRemoteID", UPN: "attendee@contoso.com"}},
+		&MeetingOptions{Subject: "Standup", Duration: 30 * time.Minute, LobbyBypassScope: "organization"})
+	require.NoError(t, err)
+	require.Equal(t, "meetingID", meeting.ID)
+	require.Equal(t, "https://teams.microsoft.com/l/meetup-join/test", meeting.JoinURL)
+}
+
+func TestClientCreateMeetingEvent(t *testing.T) {
+	start := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /users/creatorRemoteID/events":
+			var in graphEvent
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+			require.Equal(t, "Planning", in.Subject)
+			require.Equal(t, &graphDateTimeTimeZone{DateTime: "2026-10-20T09:00:00", TimeZone: "UTC"}, in.Start)
+			require.Equal(t, &graphDateTimeTimeZone{DateTime: "2026-10-20T09:30:00", TimeZone: "UTC"}, in.End)
+			require.True(t, in.IsOnlineMeeting)
+			require.Equal(t, []graphAttendee{{EmailAddress: &graphEmailAddress{Address: "attendee@contoso.com"}, Type: "required"}}, in.Attendees)
+
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id": "eventID", "subject": "Planning", "start": {"dateTime": "2026-10-20T09:00:00.0000000", "timeZone": "UTC"}, "onlineMeeting": {"joinUrl": "https://teams.microsoft.com/l/meetup-join/test"}}`))
+		case "GET /users/creatorRemoteID/onlineMeetings":
+			require.Equal(t, "JoinWebUrl eq 'https://teams.microsoft.com/l/meetup-join/test'", r.URL.Query().Get("$filter"))
+			_, _ = w.Write([]byte(`{"value": [{"id": "meetingID"}]}`))
+		case "PATCH /users/creatorRemoteID/onlineMeetings/meetingID":
+			var in graphOnlineMeeting
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+			require.Equal(t, "organization", in.LobbyBypassSettings.Scope)
+			_, _ = w.Write([]byte(`{"id": "meetingID"}`))
+		default:
+			t.Fatalf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+
+	meeting, err := client.CreateMeeting(context.Background(),
+		&UserInfo{RemoteID: "creatorRemoteID", UPN: "creator@contoso.com"},
+		[]*UserInfo{{RemoteID: "creatorRemoteID", UPN: "creator@contoso.com"}, {RemoteID: "attendeeRemoteID", Email: "attendee@contoso.com"}},
+		&MeetingOptions{Subject: "Planning", StartDateTime: start, Duration: 30 * time.Minute, LobbyBypassScope: "organization", CreateCalendarEvent: true})
+	require.NoError(t, err)
+	require.Equal(t, "meetingID", meeting.ID)
+	require.Equal(t, "eventID", meeting.EventID)
+	require.Equal(t, "https://teams.microsoft.com/l/meetup-join/test", meeting.JoinURL)
+	require.True(t, start.Equal(meeting.StartDateTime))
+}
+
+func TestClientGetMe(t *testing.T) {
+	t.Run("user returned", func(t *testing.T) {
+		client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "/me", r.URL.Path)
+			require.Equal(t, "id,mail,userPrincipalName", r.URL.Query().Get("$select"))
+			_, _ = w.Write([]byte(`{"id": "remoteID", "mail": "user@contoso.com", "userPrincipalName": "user@contoso.com"}`))
+		})
+
+		user, err := client.GetMe(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, &RemoteUser{ID: "remoteID", Mail: "user@contoso.com", UserPrincipalName: "user@contoso.com"}, user)
+	})
+
+	t.Run("graph error", func(t *testing.T) {
+		client, api := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error": {"code": "InvalidAuthenticationToken", "message": "Access token has expired."}}`))
+		})
+		api.On("LogError", "cannot get user: graph request failed with status 401: InvalidAuthenticationToken: Access token has expired.").Return()
+
+		_, err := client.GetMe(context.Background())
+		var graphErr *GraphError
+		require.ErrorAs(t, err, &graphErr)
+		require.Equal(t, http.StatusUnauthorized, graphErr.StatusCode)
+		require.Equal(t, "InvalidAuthenticationToken", graphErr.Code)
+		api.AssertExpectations(t)
+	})
+}
+
+func TestClientGetPresences(t *testing.T) {
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "/communications/getPresencesByUserId", r.URL.Path)
+		var in struct {
+			IDs []string `json:"ids"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+		require.Equal(t, []string{"remoteID", "otherRemoteID"}, in.IDs)
+		_, _ = w.Write([]byte(`{"value": [
+			{"id": "remoteID", "availability": "Busy", "activity": "InAMeeting"},
+			{"id": "otherRemoteID", "availability": "Available", "activity": "Available"}
+		]}`))
+	})
+
+	presences, err := client.GetPresences(context.Background(), []string{"remoteID", "otherRemoteID"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]*Presence{
+		"remoteID":      {Availability: "Busy", Activity: "InAMeeting"},
+		"otherRemoteID": {Availability: "Available", Activity: "Available"},
+	}, presences)
+	require.True(t, presences["remoteID"].inMeeting())
+	require.False(t, (&Presence{Availability: "Busy", Activity: "Busy"}).inMeeting())
+}
+
+func TestClientGetCalendarView(t *testing.T) {
+	var serverURL string
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/me/calendarView", r.URL.Path)
+		if r.URL.Query().Get("$skiptoken") == "" {
+			require.Equal(t, "2026-10-19T07:00:00Z", r.URL.Query().Get("startDateTime"))
+			require.Equal(t, "2026-10-20T07:00:00Z", r.URL.Query().Get("endDateTime"))
+			require.Equal(t, "50", r.URL.Query().Get("$top"))
+			_, _ = w.Write([]byte(`{"value": [
+				{"subject": "Planning", "start": {"dateTime": "2026-10-19T14:00:00.0000000", "timeZone": "UTC"}, "end": {"dateTime": "2026-10-19T15:00:00.0000000", "timeZone": "UTC"}, "onlineMeeting": {"joinUrl": "https://teams.microsoft.com/l/meetup-join/planning"}},
+				{"subject": "Lunch", "start": {"dateTime": "2026-10-19T19:00:00.0000000", "timeZone": "UTC"}, "end": {"dateTime": "2026-10-19T20:00:00.0000000", "timeZone": "UTC"}},
+				{"subject": "Cancelled", "isCancelled": true, "onlineMeeting": {"joinUrl": "https://teams.microsoft.com/l/meetup-join/cancelled"}}
+			], "@odata.nextLink": "` + serverURL + `/me/calendarView?$skiptoken=next"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"value": [
+			{"subject": "Retro", "start": {"dateTime": "2026-10-19T21:00:00.0000000", "timeZone": "UTC"}, "end": {"dateTime": "2026-10-19T22:00:00.0000000", "timeZone": "UTC"}, "onlineMeeting": {"joinUrl": "https://teams.microsoft.com/l/meetup-join/retro"}}
+		]}`))
+	})
+	serverURL = client.baseURL
+
+	start := time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC)
+	events, err := client.GetCalendarView(context.Background(), start, start.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Equal(t, []*CalendarEvent{
+		{
+			Subject: "Planning",
+			Start:   time.Date(2026, 10, 19, 14, 0, 0, 0, time.UTC),
+			End:     time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC),
+			JoinURL: "https://teams.microsoft.com/l/meetup-join/planning",
+		},
+		{
+			Subject: "Retro",
+			Start:   time.Date(2026, 10, 19, 21, 0, 0, 0, time.UTC),
+			End:     time.Date(2026, 10, 19, 22, 0, 0, 0, time.UTC),
+			JoinURL: "https://teams.microsoft.com/l/meetup-join/retro",
+		},
+	}, events)
+}
+
+func TestClientGetMeetingByJoinURL(t *testing.T) {
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/me/onlineMeetings", r.URL.Path)
+		require.Equal(t, "JoinWebUrl eq 'https://teams.microsoft.com/l/meetup-join/o''brien'", r.URL.Query().Get("$filter"))
+		_, _ = w.Write([]byte(`{"value": [{
+			"id": "meetingID",
+			"joinWebUrl": "https://teams.microsoft.com/l/meetup-join/o'brien",
+			"subject": "Planning",
+			"participants": {"organizer": {"upn": "megan@contoso.com", "identity": {"user": {"id": "remoteID", "displayName": "Megan Bowen"}}}},
+			"audioConferencing": {"conferenceId": "4123456", "tollNumber": "+1 425 555 0100", "tollFreeNumber": ""}
+		}]}`))
+	})
+
+	meeting, err := client.GetMeetingByJoinURL(context.Background(), "https://teams.microsoft.com/l/meetup-join/o'brien")
+	require.NoError(t, err)
+	require.Equal(t, "meetingID", meeting.ID)
+	require.Equal(t, "Planning", meeting.Subject)
+	require.Equal(t, "Megan Bowen", meeting.Organizer)
+	require.Equal(t, &DialIn{TollNumber: "+1 425 555 0100", ConferenceID: "4123456"}, meeting.DialIn)
+}
+
+func TestClientEndMeeting(t *testing.T) {
+	requests := []string{}
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`{"value": [{"id": "meetingID", "joinWebUrl": "https://teams.microsoft.com/l/meetup-join/planning"}]}`))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	require.NoError(t, client.EndMeeting(context.Background(), "https://teams.microsoft.com/l/meetup-join/planning", ""))
+	require.Equal(t, []string{"GET /me/onlineMeetings", "DELETE /me/onlineMeetings/meetingID"}, requests)
+
+	// Meetings created as calendar events are cancelled with their event.
+	requests = nil
+	require.NoError(t, client.EndMeeting(context.Background(), "https://teams.microsoft.com/l/meetup-join/planning", "eventID"))
+	require.Equal(t, []string{"POST /me/events/eventID/cancel"}, requests)
+}
+
+func TestClientIsMeetingCancelled(t *testing.T) {
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/me/onlineMeetings":
+			if strings.Contains(r.URL.Query().Get("$filter"), "planning") {
+				_, _ = w.Write([]byte(`{"value": [{"id": "meetingID"}]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"value": []}`))
+		case "/me/events/cancelledEventID":
+			_, _ = w.Write([]byte(`{"isCancelled": true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	cancelled, err := client.IsMeetingCancelled(context.Background(), "https://teams.microsoft.com/l/meetup-join/planning", "")
+	require.NoError(t, err)
+	require.False(t, cancelled)
+
+	cancelled, err = client.IsMeetingCancelled(context.Background(), "https://teams.microsoft.com/l/meetup-join/deleted", "")
+	require.NoError(t, err)
+	require.True(t, cancelled)
+
+	cancelled, err = client.IsMeetingCancelled(context.Background(), "", "cancelledEventID")
+	require.NoError(t, err)
+	require.True(t, cancelled)
+
+	cancelled, err = client.IsMeetingCancelled(context.Background(), "", "deletedEventID")
+	require.NoError(t, err)
+	require.True(t, cancelled)
+}
+
+func TestClientFindCalendar(t *testing.T) {
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/groups":
+			require.Equal(t, "mail eq 'design@example.com'", r.URL.Query().Get("$filter"))
+			_, _ = w.Write([]byte(`{"value": [{"id": "groupID", "displayName": "Design"}]}`))
+		case "/me/calendars":
+			_, _ = w.Write([]byte(`{"value": [{"id": "calendarID", "name": "Release Train"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	source, err := client.FindCalendar(context.Background(), "design@example.com")
+	require.NoError(t, err)
+	require.Equal(t, &CalendarSource{Kind: calendarSourceGroup, ID: "groupID", Name: "Design"}, source)
+
+	source, err = client.FindCalendar(context.Background(), "release train")
+	require.NoError(t, err)
+	require.Equal(t, &CalendarSource{Kind: calendarSourceCalendar, ID: "calendarID", Name: "Release Train"}, source)
+
+	_, err = client.FindCalendar(context.Background(), "00000000-0000-0000-0000-000000000000")
+	require.Error(t, err)
+}
+
+func TestClientGetSharedCalendarView(t *testing.T) {
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/groups/groupID/calendarView", r.URL.Path)
+		_, _ = w.Write([]byte(`{"value": [{
+			"id": "eventID",
+			"subject": "Design review",
+			"start": {"dateTime": "2026-10-20T14:00:00.0000000", "timeZone": "UTC"},
+			"end": {"dateTime": "2026-10-20T15:00:00.0000000", "timeZone": "UTC"},
+			"lastModifiedDateTime": "2026-10-19T08:30:00Z",
+			"organizer": {"emailAddress": {"name": "Jane Doe", "address": "jane@example.com"}},
+			"onlineMeeting": {"joinUrl": "https://teams.microsoft.com/l/meetup-join/review"}
+		}]}`))
+	})
+
+	start := time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC)
+	events, err := client.GetSharedCalendarView(context.Background(), &CalendarSource{Kind: calendarSourceGroup, ID: "groupID"}, start, start.AddDate(0, 0, 7))
+	require.NoError(t, err)
+	require.Equal(t, []*CalendarEvent{{
+		ID:           "eventID",
+		Subject:      "Design review",
+		Start:        time.Date(2026, 10, 20, 14, 0, 0, 0, time.UTC),
+		End:          time.Date(2026, 10, 20, 15, 0, 0, 0, time.UTC),
+		JoinURL:      "https://teams.microsoft.com/l/meetup-join/review",
+		Organizer:    "Jane Doe",
+		LastModified: time.Date(2026, 10, 19, 8, 30, 0, 0, time.UTC),
+	}}, events)
+}
+
+func TestClientGetChatMessage(t *testing.T) {
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chats/19:meeting@thread.v2/messages/message":
+			_, _ = w.Write([]byte(`{
+				"id": "message",
+				"messageType": "message",
+				"from": {"user": {"id": "remoteID", "displayName": "Jane Doe"}},
+				"body": {"contentType": "html", "content": "<p>Hello <b>team</b></p>"}
+			}`))
+		case "/chats/19:meeting@thread.v2/messages/ended":
+			_, _ = w.Write([]byte(`{
+				"id": "ended",
+				"messageType": "systemEventMessage",
+				"body": {"contentType": "html", "content": "<systemEventMessage/>"},
+				"eventDetail": {"@odata.type": "#microsoft.graph.callEndedEventMessageDetail"}
+			}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	message, err := client.GetChatMessage(context.Background(), "19:meeting@thread.v2", "message")
+	require.NoError(t, err)
+	require.Equal(t, &ChatMessage{ID: "message", UserID: "remoteID", UserName: "Jane Doe", Text: "Hello **team**"}, message)
+
+	message, err = client.GetChatMessage(context.Background(), "19:meeting@thread.v2", "ended")
+	require.NoError(t, err)
+	require.True(t, message.System)
+	require.True(t, message.CallEnded)
+}
+
+func TestClientSubscribeToChat(t *testing.T) {
+	expiresAt := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "/subscriptions", r.URL.Path)
+
+		var in map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+		require.Equal(t, "created", in["changeType"])
+		require.Equal(t, "/chats/19:meeting@thread.v2/messages", in["resource"])
+		require.Equal(t, "https://example.com/notifications", in["notificationUrl"])
+		require.Equal(t, "secret", in["clientState"])
+		require.Equal(t, "2026-10-19T09:00:00Z", in["expirationDateTime"])
+		_, _ = w.Write([]byte(`{"id": "subscriptionID", "expirationDateTime": "2026-10-19T08:59:00Z"}`))
+	})
+
+	subscription, err := client.SubscribeToChat(context.Background(), "19:meeting@thread.v2", "https://example.com/notifications", "secret", expiresAt)
+	require.NoError(t, err)
+	require.Equal(t, &GraphSubscription{ID: "subscriptionID", ExpiresAt: expiresAt.Add(-time.Minute)}, subscription)
+}
+
+func TestClientSubscribeToCalendar(t *testing.T) {
+	expiresAt := time.Date(2026, 10, 22, 9, 0, 0, 0, time.UTC)
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/subscriptions", r.URL.Path)
+
+		var in map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+		require.Equal(t, "created,updated", in["changeType"])
+		require.Equal(t, "/groups/groupID/events", in["resource"])
+		_, _ = w.Write([]byte(`{"id": "subscriptionID"}`))
+	})
+
+	subscription, err := client.SubscribeToCalendar(context.Background(), &CalendarSource{Kind: calendarSourceGroup, ID: "groupID"}, "https://example.com/notifications", "secret", expiresAt)
+	require.NoError(t, err)
+	require.Equal(t, &GraphSubscription{ID: "subscriptionID", ExpiresAt: expiresAt}, subscription)
+}
+
+func TestClientCreateWebinar(t *testing.T) {
+	requests := []string{}
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.URL.Path {
+		case "/beta/solutions/virtualEvents/webinars":
+			var in map[string]any
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+			require.Equal(t, "Product launch", in["displayName"])
+			require.Equal(t, "everyone", in["audience"])
+			require.Equal(t, map[string]any{"dateTime": "2026-11-02T16:00:00", "timeZone": "UTC"}, in["startDateTime"])
+			require.Equal(t, map[string]any{"dateTime": "2026-11-02T17:30:00", "timeZone": "UTC"}, in["endDateTime"])
+			_, _ = w.Write([]byte(`{"id": "webinarID"}`))
+		case "/beta/solutions/virtualEvents/webinars/webinarID/registrationConfiguration":
+			var in map[string]any
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+			require.Equal(t, float64(250), in["capacity"])
+			_, _ = w.Write([]byte(`{"capacity": 250, "registrationWebUrl": "https://events.teams.microsoft.com/event/webinarID"}`))
+		case "/beta/solutions/virtualEvents/webinars/webinarID/publish":
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	webinar, err := client.CreateWebinar(context.Background(), &WebinarOptions{
+		Subject:       "Product launch",
+		StartDateTime: time.Date(2026, 11, 2, 16, 0, 0, 0, time.UTC),
+		Duration:      90 * time.Minute,
+		Capacity:      250,
+		Audience:      "everyone",
+	})
+	require.NoError(t, err)
+	require.Equal(t, &Webinar{ID: "webinarID", RegistrationURL: "https://events.teams.microsoft.com/event/webinarID"}, webinar)
+	require.Equal(t, []string{
+		"POST /beta/solutions/virtualEvents/webinars",
+		"POST /beta/solutions/virtualEvents/webinars/webinarID/registrationConfiguration",
+		"POST /beta/solutions/virtualEvents/webinars/webinarID/publish",
+	}, requests)
+}
+
+func TestClientCreateWebinarCancelsDraft(t *testing.T) {
+	requests := []string{}
+	client, api := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.URL.Path {
+		case "/beta/solutions/virtualEvents/webinars":
+			_, _ = w.Write([]byte(`{"id": "webinarID"}`))
+		case "/beta/solutions/virtualEvents/webinars/webinarID/registrationConfiguration":
+			_, _ = w.Write([]byte(`{"capacity": 250}`))
+		case "/beta/solutions/virtualEvents/webinars/webinarID/publish":
+			w.WriteHeader(http.StatusForbidden)
+		case "/beta/solutions/virtualEvents/webinars/webinarID/cancel":
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	defer api.AssertExpectations(t)
+
+	_, err := client.CreateWebinar(context.Background(), &WebinarOptions{
+		Subject:       "Product launch",
+		StartDateTime: time.Date(2026, 11, 2, 16, 0, 0, 0, time.UTC),
+		Duration:      time.Hour,
+		Capacity:      250,
+	})
+	require.EqualError(t, err, "cannot publish webinar: graph request failed with status 403")
+	require.Equal(t, []string{
+		"POST /beta/solutions/virtualEvents/webinars",
+		"POST /beta/solutions/virtualEvents/webinars/webinarID/registrationConfiguration",
+		"POST /beta/solutions/virtualEvents/webinars/webinarID/publish",
+		"POST /beta/solutions/virtualEvents/webinars/webinarID/cancel",
+	}, requests)
+}
+
+func TestClientGetWebinarRegistrationCount(t *testing.T) {
+	var serverURL string
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/solutions/virtualEvents/webinars/webinarID/registrations", r.URL.Path)
+		if r.URL.Query().Get("$skiptoken") == "" {
+			_, _ = w.Write([]byte(`{"value": [{"status": "registered"}, {"status": "canceled"}], "@odata.nextLink": "` + serverURL + `/solutions/virtualEvents/webinars/webinarID/registrations?$skiptoken=next"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"value": [{"status": "registered"}, {"status": "waitlisted"}]}`))
+	})
+	serverURL = client.baseURL
+
+	count, err := client.GetWebinarRegistrationCount(context.Background(), "webinarID")
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+}
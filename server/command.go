@@ -4,26 +4,38 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"strings"
 
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
 	"github.com/mattermost/mattermost/server/public/pluginapi"
 	"github.com/mattermost/mattermost/server/public/pluginapi/experimental/command"
+	"github.com/mattermost/mattermost/server/public/pluginapi/i18n"
 	"github.com/pkg/errors"
 )
 
 const (
-	availableCommands = "Available commands: start, connect, disconnect, help"
+	availableCommands = "Available commands: start, new, connect, disconnect, settings, channel, agenda, subscribe, unsubscribe, subscriptions, webinar, help"
 	commandHelp       = "###### Mattermost MS Teams Meetings Plugin - Slash Command Help\n" +
 		"* |/mstmeetings start| - Start an MS Teams meeting. \n" +
+		"* |/mstmeetings new| - Create an MS Teams meeting with options. \n" +
 		"* |/mstmeetings connect| - Connect to MS Teams meeting. \n" +
 		"* |/mstmeetings disconnect| - Disconnect your Mattermost account from MS Teams. \n" +
+		"* |/mstmeetings settings| - View or change your meeting settings. \n" +
+		"* |/mstmeetings channel| - View or change the meeting settings of this channel. \n" +
+		"* |/mstmeetings agenda| - Receive the Teams meetings of your day every morning. \n" +
+		"* |/mstmeetings subscribe| - Announce the Teams meetings of a group or shared calendar in this channel. \n" +
+		"* |/mstmeetings unsubscribe| - Stop announcing the meetings of a calendar in this channel. \n" +
+		"* |/mstmeetings subscriptions| - List the calendars announced in this channel. \n" +
+		"* |/mstmeetings webinar create| - Create a Teams webinar with registration. \n" +
 		"* |/mstmeetings help| - Display this help text."
 	tooManyParametersText = "Too many parameters."
+	requestTimeoutText    = "Microsoft Teams did not respond in time. Please try again."
 )
 
+var helpMessage = &i18n.Message{ID: "mstmeetings.command.help", Other: strings.ReplaceAll(commandHelp, "|", "`")}
+
 func getCommand(client *pluginapi.Client) *model.Command {
 	iconData, err := command.GetIconData(&client.System, "assets/profile.svg")
 	if err != nil {
@@ -57,6 +69,9 @@ func getAutocompleteData() *model.AutocompleteData {
 	start := model.NewAutocompleteData("start", "", "Start an MS Teams meeting")
 	cmd.AddCommand(start)
 
+	newMeeting := model.NewAutocompleteData("new", "", "Create an MS Teams meeting with options")
+	cmd.AddCommand(newMeeting)
+
 	connect := model.NewAutocompleteData("connect", "",
 		"Connect your Mattermost account to MS Teams")
 	cmd.AddCommand(connect)
@@ -65,6 +80,51 @@ func getAutocompleteData() *model.AutocompleteData {
 		"Disconnect your Mattermost account from MS Teams")
 	cmd.AddCommand(disconnect)
 
+	settings := model.NewAutocompleteData("settings", "[setting] [value]", "View or change your meeting settings")
+	settings.AddStaticListArgument("Setting", false, []model.AutocompleteListItem{
+		{Item: "topic", HelpText: "Topic template of meetings started without a topic"},
+		{Item: "duration", HelpText: "Meeting duration in minutes"},
+		{Item: "invite", HelpText: "Invite channel members: on, off or default"},
+		{Item: "skip-recent-check", HelpText: "Skip the recent meeting confirmation: on or off"},
+		{Item: "lobby", HelpText: "Lobby policy of your meetings"},
+		{Item: "reminder", HelpText: "Minutes before scheduled meetings to remind you: a number, off or default"},
+		{Item: "presence", HelpText: "Show your Teams meetings in your custom status: on or off"},
+		{Item: "reset", HelpText: "Restore the default settings"},
+	})
+	cmd.AddCommand(settings)
+
+	channel := model.NewAutocompleteData("channel", "[setting] [value]", "View or change the meeting settings of this channel")
+	channel.AddStaticListArgument("Setting", false, []model.AutocompleteListItem{
+		{Item: "duplicate-window", HelpText: "Recent meeting window in seconds: a number, off or default"},
+	})
+	cmd.AddCommand(channel)
+
+	agenda := model.NewAutocompleteData("agenda", "[on|off|now]", "Receive the Teams meetings of your day every morning")
+	agenda.AddStaticListArgument("Option", false, []model.AutocompleteListItem{
+		{Item: "on", HelpText: "Receive your agenda every morning"},
+		{Item: "off", HelpText: "Stop receiving your agenda"},
+		{Item: "now", HelpText: "Receive today's agenda now"},
+	})
+	cmd.AddCommand(agenda)
+
+	subscribe := model.NewAutocompleteData("subscribe", "[group-or-calendar]", "Announce the Teams meetings of a group or shared calendar in this channel")
+	subscribe.AddTextArgument("Email address or ID of a Microsoft 365 group, or name of a shared calendar", "[group-or-calendar]", "")
+	cmd.AddCommand(subscribe)
+
+	unsubscribe := model.NewAutocompleteData("unsubscribe", "[group-or-calendar]", "Stop announcing the meetings of a calendar in this channel")
+	unsubscribe.AddTextArgument("Name or ID of a subscribed calendar", "[group-or-calendar]", "")
+	cmd.AddCommand(unsubscribe)
+
+	subscriptions := model.NewAutocompleteData("subscriptions", "", "List the calendars announced in this channel")
+	cmd.AddCommand(subscriptions)
+
+	webinar := model.NewAutocompleteData("webinar", "create", "Create a Teams webinar with registration")
+	webinarCreate := model.NewAutocompleteData("create", "", "Create a Teams webinar with registration")
+	webinar.AddCommand(webinarCreate)
+	cmd.AddCommand(webinar)
+
+	cmd.AddCommand(getAdminAutocompleteData())
+
 	help := model.NewAutocompleteData("help", "", "Display usage information")
 	cmd.AddCommand(help)
 
@@ -76,36 +136,58 @@ func (p *Plugin) executeCommand(_ *plugin.Context, args *model.CommandArgs) (str
 	cmd := split[0]
 	action := ""
 
+	l := p.getUserLocalizer(args.UserId)
 	if cmd != "/mstmeetings" {
-		return fmt.Sprintf("Command '%s' is not /mstmeetings. Please try again.", cmd), nil
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.command.invalid_command",
+			Other: "Command '{{.Command}}' is not /mstmeetings. Please try again.",
+		}, map[string]any{"Command": cmd}), nil
 	}
 
 	if len(split) > 1 {
 		action = split[1]
 	} else {
-		return p.handleHelp()
+		return p.handleHelp(l)
 	}
 
 	switch action {
 	case "start":
 		return p.handleStart(split[1:], args)
+	case "new":
+		return p.handleNew(split[1:], args)
 	case "connect":
 		return p.handleConnect(split[1:], args)
 	case "disconnect":
 		return p.handleDisconnect(split[1:], args)
+	case "settings":
+		return p.handleSettings(split[1:], args)
+	case "channel":
+		return p.handleChannel(split[1:], args)
+	case "agenda":
+		return p.handleAgenda(split[1:], args)
+	case "subscribe":
+		return p.handleSubscribe(split[1:], args)
+	case "unsubscribe":
+		return p.handleUnsubscribe(split[1:], args)
+	case "subscriptions":
+		return p.handleSubscriptions(split[1:], args)
+	case "webinar":
+		return p.handleWebinar(split[1:], args)
+	case "admin":
+		return p.handleAdmin(split[1:], args)
 	case "help":
-		return p.handleHelp()
+		return p.handleHelp(l)
 	}
 
-	return fmt.Sprintf("Unknown action `%v`.\n%s", action, p.getHelpText()), nil
+	return p.localize(l, unknownActionMessage, map[string]any{"Action": action}) + "\n" + p.getHelpText(l), nil
 }
 
-func (p *Plugin) getHelpText() string {
-	return strings.ReplaceAll(commandHelp, "|", "`")
+func (p *Plugin) getHelpText(l *i18n.Localizer) string {
+	return p.localize(l, helpMessage, nil)
 }
 
-func (p *Plugin) handleHelp() (string, error) {
-	return p.getHelpText(), nil
+func (p *Plugin) handleHelp(l *i18n.Localizer) (string, error) {
+	return p.getHelpText(l), nil
 }
 
 func (p *Plugin) handleStartWithDeps(args []string, extra *model.CommandArgs, newClient ClientFactory) (string, error) {
@@ -114,39 +196,65 @@ func (p *Plugin) handleStartWithDeps(args []string, extra *model.CommandArgs, ne
 		topic = strings.Join(args[1:], " ")
 	}
 	userID := extra.UserId
+	l := p.getUserLocalizer(userID)
 	user, appErr := p.API.GetUser(userID)
 	if appErr != nil {
-		return "Cannot get user.", errors.Wrap(appErr, "cannot get user")
+		return p.localize(l, getUserFailedMessage, nil), errors.Wrap(appErr, "cannot get user")
 	}
 
 	if _, appErr = p.API.GetChannelMember(extra.ChannelId, userID); appErr != nil {
-		return "We could not get channel members.", errors.Wrap(appErr, "cannot get channel member")
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.start.get_channel_member_failed",
+			Other: "We could not get channel members.",
+		}, nil), errors.Wrap(appErr, "cannot get channel member")
 	}
 
-	recentMeeting, recentMeetingURL, creatorName, provider, appErr := p.checkPreviousMessages(extra.ChannelId)
-	if appErr != nil {
-		return "Error checking previous messages.", errors.Wrap(appErr, "cannot check previous messages")
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.getConfiguration().getRequestTimeout())
+	defer cancel()
+
+	prefs := p.getUserPreferencesOrDefault(userID)
+	if !prefs.SkipRecentMeetingCheck {
+		recentMeeting, err := p.findRecentMeeting(extra.ChannelId, extra.RootId)
+		if err != nil {
+			return p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.start.check_previous_messages_failed",
+				Other: "Error checking previous messages.",
+			}, nil), errors.Wrap(err, "cannot check recent meetings")
+		}
 
-	if recentMeeting {
-		p.postConfirmCreateOrJoin(recentMeetingURL, extra.ChannelId, topic, userID, creatorName, provider)
-		p.trackMeetingDuplication(extra.UserId)
-		return "", nil
+		if recentMeeting != nil {
+			p.postConfirmCreateOrJoin(recentMeeting.Link, extra.ChannelId, extra.RootId, topic, userID, recentMeeting.CreatorUsername, recentMeeting.Provider)
+			p.trackMeetingDuplication(extra.UserId)
+			return "", nil
+		}
 	}
 
-	authResult, authErr := p.authenticateAndFetchUser(userID, extra.ChannelId, newClient)
+	authResult, authErr := p.authenticateAndFetchUser(ctx, userID, extra.ChannelId, newClient)
 	if authErr != nil {
+		if isTimeout(authErr.Err) {
+			return authErr.Message, authErr.Err
+		}
+
 		// the user state will be needed later while connecting the user to MS teams meeting via OAuth
-		if _, err := p.StoreState(userID, extra.ChannelId, false); err != nil {
+		if err := p.storeMeetingRequestState(userID, &pendingMeeting{ChannelID: extra.ChannelId, RootID: extra.RootId, Topic: topic}); err != nil {
 			p.API.LogWarn("failed to store user state", "error", err.Error())
 		}
 
 		return authErr.Message, authErr.Err
 	}
 
-	_, _, err := p.postMeetingWithDeps(user, extra.ChannelId, topic, authResult.Client, authResult.UserInfo)
+	_, _, err := p.postMeetingWithDeps(ctx, user, extra.ChannelId, extra.RootId, prefs.meetingOptions(topic), authResult.Client, authResult.UserInfo)
+	if isTimeout(err) {
+		return p.localize(l, requestTimeoutMessage, nil), errors.Wrap(err, "cannot post message")
+	}
+	if errors.Is(err, errTooManyInvitees) {
+		return p.localize(l, tooManyInviteesMessage, map[string]any{"Max": maxInvitees}), nil
+	}
 	if err != nil {
-		return "Failed to post message. Please try again.", errors.Wrap(err, "cannot post message")
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.start.post_meeting_failed",
+			Other: "Failed to post message. Please try again.",
+		}, nil), errors.Wrap(err, "cannot post message")
 	}
 
 	p.trackMeetingStart(extra.UserId, telemetryStartSourceCommand)
@@ -158,12 +266,21 @@ func (p *Plugin) handleStart(args []string, extra *model.CommandArgs) (string, e
 }
 
 func (p *Plugin) handleConnectWithDeps(args []string, extra *model.CommandArgs, newClient ClientFactory) (string, error) {
+	l := p.getUserLocalizer(extra.UserId)
 	if len(args) > 1 {
-		return tooManyParametersText, nil
+		return p.localize(l, tooManyParametersMessage, nil), nil
 	}
 
-	authResult, authErr := p.authenticateAndFetchUser(extra.UserId, extra.ChannelId, newClient)
+	ctx, cancel := context.WithTimeout(context.Background(), p.getConfiguration().getRequestTimeout())
+	defer cancel()
+
+	// Users resolved with application permissions can still connect their own account.
+	authResult, authErr := p.authenticateWithConnectedAccount(ctx, extra.UserId, extra.ChannelId, newClient)
 	if authErr != nil {
+		if isTimeout(authErr.Err) {
+			return authErr.Message, authErr.Err
+		}
+
 		// the user state will be needed later while connecting the user to MS teams meeting via OAuth
 		if _, err := p.StoreState(extra.UserId, extra.ChannelId, true); err != nil {
 			p.API.LogWarn("failed to store user state", "error", err.Error())
@@ -173,7 +290,10 @@ func (p *Plugin) handleConnectWithDeps(args []string, extra *model.CommandArgs,
 	}
 
 	if authResult.User != nil {
-		return "User already connected to MS Teams Meetings", nil
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.connect.already_connected",
+			Other: "User already connected to MS Teams Meetings",
+		}, nil), nil
 	}
 
 	return "", nil
@@ -183,17 +303,32 @@ func (p *Plugin) handleConnect(args []string, extra *model.CommandArgs) (string,
 	return p.handleConnectWithDeps(args, extra, p.NewClient)
 }
 
-func (p *Plugin) handleDisconnect(args []string, extra *model.CommandArgs) (string, error) {
+func (p *Plugin) handleDisconnectWithDeps(args []string, extra *model.CommandArgs, newClient ClientFactory) (string, error) {
+	l := p.getUserLocalizer(extra.UserId)
 	if len(args) > 1 {
-		return tooManyParametersText, nil
+		return p.localize(l, tooManyParametersMessage, nil), nil
 	}
-	err := p.disconnect(extra.UserId)
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.getConfiguration().getRequestTimeout())
+	defer cancel()
+
+	err := p.disconnect(ctx, extra.UserId, newClient)
 	if err != nil {
-		return fmt.Sprintf("Failed to disconnect user, %s", err.Error()), nil
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.disconnect.failed",
+			Other: "Failed to disconnect user, {{.Error}}",
+		}, map[string]any{"Error": err.Error()}), nil
 	}
 
 	p.trackDisconnect(extra.UserId)
-	return "You have successfully disconnected from MS Teams Meetings.", nil
+	return p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.disconnect.success",
+		Other: "You have successfully disconnected from MS Teams Meetings.",
+	}, nil), nil
+}
+
+func (p *Plugin) handleDisconnect(args []string, extra *model.CommandArgs) (string, error) {
+	return p.handleDisconnectWithDeps(args, extra, p.NewClient)
 }
 
 // ExecuteCommand is called when any registered by this plugin command is executed
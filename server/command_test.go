@@ -4,13 +4,14 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
-	msgraph "github.com/yaegashi/msgraph.go/beta"
 	"golang.org/x/oauth2"
 
 	"github.com/mattermost/mattermost/server/public/model"
@@ -45,14 +46,103 @@ type MockClient struct {
 	mock.Mock
 }
 
-func (m *MockClient) GetMe() (*msgraph.User, error) {
+func (m *MockClient) GetMe(_ context.Context) (*RemoteUser, error) {
 	args := m.Called()
-	return args.Get(0).(*msgraph.User), args.Error(1)
+	return args.Get(0).(*RemoteUser), args.Error(1)
 }
 
-func (m *MockClient) CreateMeeting(_ *UserInfo, _ []*UserInfo, _ string) (*msgraph.OnlineMeeting, error) {
+func (m *MockClient) GetUser(_ context.Context, email string) (*RemoteUser, error) {
+	args := m.Called(email)
+	return args.Get(0).(*RemoteUser), args.Error(1)
+}
+
+func (m *MockClient) GetPresences(_ context.Context, remoteIDs []string) (map[string]*Presence, error) {
+	args := m.Called(remoteIDs)
+	return args.Get(0).(map[string]*Presence), args.Error(1)
+}
+
+func (m *MockClient) GetCalendarView(_ context.Context, start, end time.Time) ([]*CalendarEvent, error) {
+	args := m.Called(start, end)
+	return args.Get(0).([]*CalendarEvent), args.Error(1)
+}
+
+func (m *MockClient) FindCalendar(_ context.Context, ref string) (*CalendarSource, error) {
+	args := m.Called(ref)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*CalendarSource), args.Error(1)
+}
+
+func (m *MockClient) GetSharedCalendarView(_ context.Context, source *CalendarSource, start, end time.Time) ([]*CalendarEvent, error) {
+	args := m.Called(source, start, end)
+	return args.Get(0).([]*CalendarEvent), args.Error(1)
+}
+
+func (m *MockClient) GetChatMessage(_ context.Context, chatID, messageID string) (*ChatMessage, error) {
+	args := m.Called(chatID, messageID)
+	return args.Get(0).(*ChatMessage), args.Error(1)
+}
+
+func (m *MockClient) SubscribeToChat(_ context.Context, chatID, notificationURL, clientState string, expiresAt time.Time) (*GraphSubscription, error) {
+	args := m.Called(chatID, notificationURL, clientState, expiresAt)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*GraphSubscription), args.Error(1)
+}
+
+func (m *MockClient) SubscribeToCalendar(_ context.Context, source *CalendarSource, notificationURL, clientState string, expiresAt time.Time) (*GraphSubscription, error) {
+	args := m.Called(source, notificationURL, clientState, expiresAt)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*GraphSubscription), args.Error(1)
+}
+
+func (m *MockClient) RenewSubscription(_ context.Context, subscriptionID string, expiresAt time.Time) error {
+	args := m.Called(subscriptionID, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockClient) DeleteSubscription(_ context.Context, subscriptionID string) error {
+	args := m.Called(subscriptionID)
+	return args.Error(0)
+}
+
+func (m *MockClient) CreateWebinar(_ context.Context, options *WebinarOptions) (*Webinar, error) {
+	args := m.Called(options)
+	return args.Get(0).(*Webinar), args.Error(1)
+}
+
+func (m *MockClient) GetWebinarRegistrationCount(_ context.Context, webinarID string) (int, error) {
+	args := m.Called(webinarID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockClient) RevokeSignInSessions(_ context.Context) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *MockClient) GetMeetingByJoinURL(_ context.Context, joinURL string) (*OnlineMeeting, error) {
+	args := m.Called(joinURL)
+	return args.Get(0).(*OnlineMeeting), args.Error(1)
+}
+
+func (m *MockClient) EndMeeting(_ context.Context, joinURL, eventID string) error {
+	args := m.Called(joinURL, eventID)
+	return args.Error(0)
+}
+
+func (m *MockClient) IsMeetingCancelled(_ context.Context, joinURL, eventID string) (bool, error) {
+	args := m.Called(joinURL, eventID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockClient) CreateMeeting(_ context.Context, _ *UserInfo, _ []*UserInfo, _ *MeetingOptions) (*OnlineMeeting, error) {
 	args := m.Called()
-	return args.Get(0).(*msgraph.OnlineMeeting), args.Error(1)
+	return args.Get(0).(*OnlineMeeting), args.Error(1)
 }
 
 // mockClientFactory returns a ClientFactory that always returns the given mock client
@@ -89,7 +179,7 @@ func TestHandleConnect(t *testing.T) {
 				api.On("KVGet", "token_demoUserID").Return(encryptedUserInfo, nil)
 				api.On("KVSet", "msteamsmeetinguserstate_demoUserID", []byte("msteamsmeetinguserstate_demoUserID_demoChannelID_true")).Return(nil)
 				api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewPointer("https://example.com")}})
-				mockClient.On("GetMe").Return(&msgraph.User{}, errors.New("error getting user details"))
+				mockClient.On("GetMe").Return(&RemoteUser{}, errors.New("error getting user details"))
 				api.On("LogError", "authenticateAndFetchUser, cannot get user", "error", "error getting user details").Return()
 			},
 			expectedOutput: "",
@@ -103,7 +193,7 @@ func TestHandleConnect(t *testing.T) {
 			mockSetup: func(api *plugintest.API, encryptedUserInfo []byte, mockClient *MockClient) {
 				api.On("KVGet", "token_demoUserID").Return(encryptedUserInfo, nil)
 				api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewPointer("https://example.com")}})
-				mockClient.On("GetMe").Return(&msgraph.User{}, nil)
+				mockClient.On("GetMe").Return(&RemoteUser{}, nil)
 			},
 			expectedOutput: "",
 			expectError:    false,
@@ -154,12 +244,35 @@ func TestHandleConnect(t *testing.T) {
 	}
 }
 
+func TestHandleConnectWithApplicationPermissions(t *testing.T) {
+	api := &plugintest.API{}
+	mockClient := &MockClient{}
+	p := SetupMockPlugin(api, nil, mockClient)
+	p.setConfiguration(&configuration{
+		EncryptionKey:             "demo_encrypt_key",
+		UseApplicationPermissions: true,
+		appTokenSource:            oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "appToken"}),
+	})
+
+	// The user is not resolved with the application token, as they can connect anyway.
+	api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewPointer("https://example.com")}})
+	api.On("KVGet", "token_demoUserID").Return(nil, nil)
+	api.On("KVSet", "msteamsmeetinguserstate_demoUserID", []byte("msteamsmeetinguserstate_demoUserID_demoChannelID_true")).Return(nil)
+
+	resp, err := p.handleConnectWithDeps([]string{"connect"}, &model.CommandArgs{UserId: "demoUserID", ChannelId: "demoChannelID"}, mockClientFactory(mockClient))
+	require.Error(t, err)
+	require.Contains(t, resp, "Click here to link your Microsoft account.")
+	api.AssertExpectations(t)
+	mockClient.AssertExpectations(t)
+}
+
 func TestHandleDisconnect(t *testing.T) {
 	tests := []struct {
 		name           string
 		args           []string
 		commandArgs    *model.CommandArgs
 		mockSetup      func(api *plugintest.API, encryptedUserInfo []byte, mockTracker *MockTracker)
+		revokeSession  bool
 		expectedOutput string
 	}{
 		{
@@ -188,6 +301,24 @@ func TestHandleDisconnect(t *testing.T) {
 				api.On("KVGet", "token_demoUserID").Return(encryptedUserInfo, nil)
 				api.On("KVDelete", "token_demoUserID").Return(nil)
 				api.On("KVDelete", "tbyrid_demo_remote_id").Return(nil)
+				api.On("KVGet", connectedUsersKey).Return([]byte(`{"demoUserID":{"user_id":"demoUserID"}}`), nil)
+				api.On("KVCompareAndSet", connectedUsersKey, []byte(`{"demoUserID":{"user_id":"demoUserID"}}`), []byte(`{}`)).Return(true, nil)
+				mockTracker.On("TrackUserEvent", "disconnect", "demoUserID", mock.Anything).Return(nil)
+			},
+			expectedOutput: "You have successfully disconnected from MS Teams Meetings.",
+		},
+		{
+			name:          "Successful disconnection with sessions revoked",
+			args:          []string{"param"},
+			commandArgs:   &model.CommandArgs{UserId: "demoUserID"},
+			revokeSession: true,
+			mockSetup: func(api *plugintest.API, encryptedUserInfo []byte, mockTracker *MockTracker) {
+				api.On("KVGet", "token_demoUserID").Return(encryptedUserInfo, nil)
+				api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewPointer("https://example.com")}})
+				api.On("KVDelete", "token_demoUserID").Return(nil)
+				api.On("KVDelete", "tbyrid_demo_remote_id").Return(nil)
+				api.On("KVGet", connectedUsersKey).Return([]byte(`{"demoUserID":{"user_id":"demoUserID"}}`), nil)
+				api.On("KVCompareAndSet", connectedUsersKey, []byte(`{"demoUserID":{"user_id":"demoUserID"}}`), []byte(`{}`)).Return(true, nil)
 				mockTracker.On("TrackUserEvent", "disconnect", "demoUserID", mock.Anything).Return(nil)
 			},
 			expectedOutput: "You have successfully disconnected from MS Teams Meetings.",
@@ -207,14 +338,16 @@ func TestHandleDisconnect(t *testing.T) {
 			}
 
 			p.setConfiguration(&configuration{
-				EncryptionKey: "demo_encrypt_key",
+				EncryptionKey:              "demo_encrypt_key",
+				RevokeSessionsOnDisconnect: tt.revokeSession,
 			})
 
 			userInfo := &UserInfo{
-				Email:    "dummy@email.com",
-				RemoteID: "demo_remote_id",
-				UserID:   "dummy_user_id",
-				UPN:      "dummy_upn",
+				Email:      "dummy@email.com",
+				RemoteID:   "demo_remote_id",
+				UserID:     "dummy_user_id",
+				UPN:        "dummy_upn",
+				OAuthToken: &oauth2.Token{AccessToken: "access_token"},
 			}
 
 			encryptedUserInfo, err := userInfo.EncryptedJSON([]byte("demo_encrypt_key"))
@@ -222,12 +355,18 @@ func TestHandleDisconnect(t *testing.T) {
 
 			tt.mockSetup(api, encryptedUserInfo, mockTracker)
 
-			resp, err := p.handleDisconnect(tt.args, tt.commandArgs)
+			mockClient := &MockClient{}
+			if tt.revokeSession {
+				mockClient.On("RevokeSignInSessions").Return(nil)
+			}
+
+			resp, err := p.handleDisconnectWithDeps(tt.args, tt.commandArgs, mockClientFactory(mockClient))
 			require.NoError(t, err)
 			require.Contains(t, resp, tt.expectedOutput)
 
 			api.AssertExpectations(t)
 			mockTracker.AssertExpectations(t)
+			mockClient.AssertExpectations(t)
 		})
 	}
 }
@@ -270,7 +409,9 @@ func TestHandleStart(t *testing.T) {
 			mockSetup: func(api *plugintest.API, _ []byte, _ *MockTracker, _ *MockClient) {
 				api.On("GetUser", "demoUserID").Return(&model.User{Id: "demoUserID"}, nil)
 				api.On("GetChannelMember", "demoChannelID", "demoUserID").Return(&model.ChannelMember{ChannelId: "demoChannelID"}, nil)
-				api.On("GetPostsSince", "demoChannelID", (time.Now().Unix()-30)*1000).Return(nil, &model.AppError{Message: "error getting previous post for channel"})
+				api.On("KVGet", "preferences_demoUserID").Return(nil, nil)
+				api.On("KVGet", "channelsettings_demoChannelID").Return(nil, nil)
+				api.On("KVGet", "activemeetings_demoChannelID").Return(nil, &model.AppError{Message: "error getting previous post for channel"})
 			},
 			expectError:   true,
 			expectedError: "error getting previous post for channel",
@@ -280,25 +421,18 @@ func TestHandleStart(t *testing.T) {
 			args:        []string{"param1", "param2"},
 			commandArgs: &model.CommandArgs{UserId: "demoUserID", ChannelId: "demoChannelID"},
 			mockSetup: func(api *plugintest.API, _ []byte, mockTracker *MockTracker, _ *MockClient) {
-				postList := &model.PostList{
-					Order: []string{"post1"},
-					Posts: map[string]*model.Post{
-						"post1": {
-							Id:        "post1",
-							ChannelId: "demoChannelID",
-							CreateAt:  time.Now().UnixNano() / int64(time.Millisecond),
-							UpdateAt:  time.Now().UnixNano() / int64(time.Millisecond),
-							Props: map[string]interface{}{
-								"meeting_provider":         "meetingProvider",
-								"meeting_link":             "meetingLink",
-								"meeting_creator_username": "creatorName",
-							},
-						},
-					},
-				}
+				activeMeetings, _ := json.Marshal(map[string]*activeMeeting{"meetingPostID": {
+					PostID:          "meetingPostID",
+					Link:            "meetingLink",
+					CreatorUsername: "creatorName",
+					Provider:        "meetingProvider",
+					CreateAt:        time.Now().UnixMilli(),
+				}})
 				api.On("GetUser", "demoUserID").Return(&model.User{Id: "demoUserID"}, nil)
 				api.On("GetChannelMember", "demoChannelID", "demoUserID").Return(&model.ChannelMember{ChannelId: "demoChannelID"}, nil)
-				api.On("GetPostsSince", "demoChannelID", (time.Now().Unix()-30)*1000).Return(postList, nil)
+				api.On("KVGet", "preferences_demoUserID").Return(nil, nil)
+				api.On("KVGet", "channelsettings_demoChannelID").Return(nil, nil)
+				api.On("KVGet", "activemeetings_demoChannelID").Return(activeMeetings, nil)
 				api.On("SendEphemeralPost", "demoUserID", mock.Anything).Return(&model.Post{})
 				mockTracker.On("TrackUserEvent", mock.Anything, "demoUserID", mock.Anything).Return(nil)
 			},
@@ -312,21 +446,13 @@ func TestHandleStart(t *testing.T) {
 			mockSetup: func(api *plugintest.API, _ []byte, _ *MockTracker, _ *MockClient) {
 				api.On("GetUser", "demoUserID").Return(&model.User{Id: "demoUserID"}, nil)
 				api.On("GetChannelMember", "demoChannelID", "demoUserID").Return(&model.ChannelMember{ChannelId: "demoChannelID"}, nil)
-				postList := &model.PostList{
-					Order: []string{"post1"},
-					Posts: map[string]*model.Post{
-						"post1": {
-							Id:        "post1",
-							ChannelId: "demoChannelID",
-							CreateAt:  time.Now().UnixNano() / int64(time.Millisecond),
-							UpdateAt:  time.Now().UnixNano() / int64(time.Millisecond),
-						},
-					},
-				}
-				api.On("GetPostsSince", "demoChannelID", (time.Now().Unix()-30)*1000).Return(postList, nil)
+				api.On("KVGet", "preferences_demoUserID").Return(nil, nil)
+				api.On("KVGet", "channelsettings_demoChannelID").Return(nil, nil)
+				api.On("KVGet", "activemeetings_demoChannelID").Return(nil, nil)
 				api.On("KVGet", "token_demoUserID").Return(nil, &model.AppError{Message: "deletion error"})
 				api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewPointer("https://example.com")}})
 				api.On("KVSet", "msteamsmeetinguserstate_demoUserID", []byte("msteamsmeetinguserstate_demoUserID_demoChannelID_false")).Return(nil)
+				api.On("KVSetWithExpiry", "pendingmeeting_demoUserID", []byte(`{"channel_id":"demoChannelID","topic":"param2"}`), int64(pendingMeetingExpirySeconds)).Return(nil)
 			},
 			expectError:   true,
 			expectedError: "Your Mattermost account is not connected to any Microsoft Teams account",
@@ -338,33 +464,99 @@ func TestHandleStart(t *testing.T) {
 			mockSetup: func(api *plugintest.API, encryptedUserInfo []byte, mockTracker *MockTracker, mockClient *MockClient) {
 				api.On("GetUser", "demoUserID").Return(&model.User{Id: "demoUserID"}, nil)
 				api.On("GetChannelMember", "demoChannelID", "demoUserID").Return(&model.ChannelMember{ChannelId: "demoChannelID"}, nil)
-
-				postList := &model.PostList{
-					Order: []string{"post1"},
-					Posts: map[string]*model.Post{
-						"post1": {
-							Id:        "post1",
-							ChannelId: "demoChannelID",
-							CreateAt:  time.Now().UnixNano() / int64(time.Millisecond),
-							UpdateAt:  time.Now().UnixNano() / int64(time.Millisecond),
-						},
-					},
-				}
+				api.On("KVGet", "preferences_demoUserID").Return(nil, nil)
 
 				joinURL := "demoJoinURL"
 
-				api.On("GetPostsSince", "demoChannelID", (time.Now().Unix()-30)*1000).Return(postList, nil)
+				api.On("KVGet", "channelsettings_demoChannelID").Return(nil, nil)
+				api.On("KVGet", "activemeetings_demoChannelID").Return(nil, nil)
 				api.On("KVGet", "token_demoUserID").Return(encryptedUserInfo, nil)
 				api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewPointer("https://example.com")}})
 				api.On("HasPermissionToChannel", "demoUserID", "demoChannelID", model.PermissionCreatePost).Return(true)
 				api.On("GetChannel", "demoChannelID").Return(&model.Channel{Id: "demoChannelID", Type: model.ChannelTypeOpen}, nil)
 				api.On("CreatePost", mock.Anything).Return(&model.Post{Id: "demoPostID"}, nil)
-				mockClient.On("GetMe").Return(&msgraph.User{}, nil)
-				mockClient.On("CreateMeeting", mock.Anything, mock.Anything, mock.Anything).Return(&msgraph.OnlineMeeting{JoinURL: &joinURL}, nil)
+				api.On("KVSetWithOptions", "activemeetings_demoChannelID", mock.Anything, mock.Anything).Return(true, nil)
+				mockClient.On("GetMe").Return(&RemoteUser{}, nil)
+				mockClient.On("CreateMeeting", mock.Anything, mock.Anything, mock.Anything).Return(&OnlineMeeting{JoinURL: joinURL}, nil)
+				mockTracker.On("TrackUserEvent", "meeting_started", "demoUserID", mock.Anything).Return(nil)
+			},
+			expectError: false,
+		},
+		{
+			name:        "Meeting started in a thread",
+			args:        []string{"param1"},
+			commandArgs: &model.CommandArgs{UserId: "demoUserID", ChannelId: "demoChannelID", RootId: "demoRootID"},
+			mockSetup: func(api *plugintest.API, encryptedUserInfo []byte, mockTracker *MockTracker, mockClient *MockClient) {
+				// A meeting posted in the channel itself does not prevent starting one in a thread.
+				activeMeetings, _ := json.Marshal(map[string]*activeMeeting{"meetingPostID": {
+					PostID:   "meetingPostID",
+					Link:     "meetingLink",
+					Provider: msteamsProviderName,
+					CreateAt: time.Now().UnixMilli(),
+				}})
+				api.On("GetUser", "demoUserID").Return(&model.User{Id: "demoUserID"}, nil)
+				api.On("GetChannelMember", "demoChannelID", "demoUserID").Return(&model.ChannelMember{ChannelId: "demoChannelID"}, nil)
+				api.On("KVGet", "preferences_demoUserID").Return(nil, nil)
+				api.On("KVGet", "channelsettings_demoChannelID").Return(nil, nil)
+				api.On("KVGet", "activemeetings_demoChannelID").Return(activeMeetings, nil)
+				api.On("KVGet", "token_demoUserID").Return(encryptedUserInfo, nil)
+				api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewPointer("https://example.com")}})
+				api.On("HasPermissionToChannel", "demoUserID", "demoChannelID", model.PermissionCreatePost).Return(true)
+				api.On("GetChannel", "demoChannelID").Return(&model.Channel{Id: "demoChannelID", Type: model.ChannelTypeOpen}, nil)
+				api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+					return post.RootId == "demoRootID"
+				})).Return(&model.Post{Id: "demoPostID"}, nil)
+				api.On("KVSetWithOptions", "activemeetings_demoChannelID", mock.Anything, mock.Anything).Return(true, nil)
+				mockClient.On("GetMe").Return(&RemoteUser{}, nil)
+				mockClient.On("CreateMeeting").Return(&OnlineMeeting{JoinURL: "demoJoinURL"}, nil)
 				mockTracker.On("TrackUserEvent", "meeting_started", "demoUserID", mock.Anything).Return(nil)
 			},
 			expectError: false,
 		},
+		{
+			name:        "Recent meeting check skipped by preference",
+			args:        []string{"param1"},
+			commandArgs: &model.CommandArgs{UserId: "demoUserID", ChannelId: "demoChannelID"},
+			mockSetup: func(api *plugintest.API, encryptedUserInfo []byte, mockTracker *MockTracker, mockClient *MockClient) {
+				api.On("GetUser", "demoUserID").Return(&model.User{Id: "demoUserID", Username: "demo"}, nil)
+				api.On("GetChannelMember", "demoChannelID", "demoUserID").Return(&model.ChannelMember{ChannelId: "demoChannelID"}, nil)
+				api.On("KVGet", "preferences_demoUserID").Return([]byte(`{"topic_template":"{channel} sync","skip_recent_meeting_check":true}`), nil)
+				api.On("KVGet", "token_demoUserID").Return(encryptedUserInfo, nil)
+				api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewPointer("https://example.com")}})
+				api.On("HasPermissionToChannel", "demoUserID", "demoChannelID", model.PermissionCreatePost).Return(true)
+				api.On("GetChannel", "demoChannelID").Return(&model.Channel{Id: "demoChannelID", DisplayName: "Town Square", Type: model.ChannelTypeOpen}, nil)
+				api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+					return post.GetProp("meeting_topic") == "Town Square sync"
+				})).Return(&model.Post{Id: "demoPostID"}, nil)
+				api.On("KVGet", "activemeetings_demoChannelID").Return(nil, nil)
+				api.On("KVSetWithOptions", "activemeetings_demoChannelID", mock.Anything, mock.Anything).Return(true, nil)
+				mockClient.On("GetMe").Return(&RemoteUser{}, nil)
+				mockClient.On("CreateMeeting").Return(&OnlineMeeting{JoinURL: "demoJoinURL"}, nil)
+				mockTracker.On("TrackUserEvent", "meeting_started", "demoUserID", mock.Anything).Return(nil)
+			},
+			expectError: false,
+		},
+		{
+			name:        "Meeting creation timed out",
+			args:        []string{"param1", "param2"},
+			commandArgs: &model.CommandArgs{UserId: "demoUserID", ChannelId: "demoChannelID"},
+			mockSetup: func(api *plugintest.API, encryptedUserInfo []byte, _ *MockTracker, mockClient *MockClient) {
+				api.On("GetUser", "demoUserID").Return(&model.User{Id: "demoUserID"}, nil)
+				api.On("GetChannelMember", "demoChannelID", "demoUserID").Return(&model.ChannelMember{ChannelId: "demoChannelID"}, nil)
+				api.On("KVGet", "preferences_demoUserID").Return(nil, nil)
+				api.On("KVGet", "channelsettings_demoChannelID").Return(nil, nil)
+				api.On("KVGet", "activemeetings_demoChannelID").Return(nil, nil)
+				api.On("KVGet", "token_demoUserID").Return(encryptedUserInfo, nil)
+				api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewPointer("https://example.com")}})
+				api.On("HasPermissionToChannel", "demoUserID", "demoChannelID", model.PermissionCreatePost).Return(true)
+				api.On("GetChannel", "demoChannelID").Return(&model.Channel{Id: "demoChannelID", Type: model.ChannelTypeOpen}, nil)
+				mockClient.On("GetMe").Return(&RemoteUser{}, nil)
+				mockClient.On("CreateMeeting", mock.Anything, mock.Anything, mock.Anything).Return(&OnlineMeeting{}, context.DeadlineExceeded)
+			},
+			expectError:    true,
+			expectedError:  "context deadline exceeded",
+			expectedOutput: requestTimeoutText,
+		},
 	}
 
 	for _, tt := range tests {
@@ -399,6 +591,7 @@ func TestHandleStart(t *testing.T) {
 			resp, err := p.handleStartWithDeps(tt.args, tt.commandArgs, mockClientFactory(mockClient))
 			if tt.expectError {
 				require.ErrorContains(t, err, tt.expectedError)
+				require.Contains(t, resp, tt.expectedOutput)
 			} else {
 				require.NoError(t, err)
 				require.Contains(t, resp, tt.expectedOutput)
@@ -415,11 +608,19 @@ func TestGetHelpText(t *testing.T) {
 	p := &Plugin{}
 	expected := "###### Mattermost MS Teams Meetings Plugin - Slash Command Help\n" +
 		"* `/mstmeetings start` - Start an MS Teams meeting. \n" +
+		"* `/mstmeetings new` - Create an MS Teams meeting with options. \n" +
 		"* `/mstmeetings connect` - Connect to MS Teams meeting. \n" +
 		"* `/mstmeetings disconnect` - Disconnect your Mattermost account from MS Teams. \n" +
+		"* `/mstmeetings settings` - View or change your meeting settings. \n" +
+		"* `/mstmeetings channel` - View or change the meeting settings of this channel. \n" +
+		"* `/mstmeetings agenda` - Receive the Teams meetings of your day every morning. \n" +
+		"* `/mstmeetings subscribe` - Announce the Teams meetings of a group or shared calendar in this channel. \n" +
+		"* `/mstmeetings unsubscribe` - Stop announcing the meetings of a calendar in this channel. \n" +
+		"* `/mstmeetings subscriptions` - List the calendars announced in this channel. \n" +
+		"* `/mstmeetings webinar create` - Create a Teams webinar with registration. \n" +
 		"* `/mstmeetings help` - Display this help text."
 
-	actual := p.getHelpText()
+	actual := p.getHelpText(defaultLocalizer)
 	require.Equal(t, expected, actual)
 }
 
@@ -450,7 +651,7 @@ func TestExecuteCommand(t *testing.T) {
 				ChannelId: "dummyChannelID",
 				UserId:    "dummyUserID",
 			},
-			expectedMsg: "###### Mattermost MS Teams Meetings Plugin - Slash Command Help\n* `/mstmeetings start` - Start an MS Teams meeting. \n* `/mstmeetings connect` - Connect to MS Teams meeting. \n* `/mstmeetings disconnect` - Disconnect your Mattermost account from MS Teams. \n* `/mstmeetings help` - Display this help text.",
+			expectedMsg: "###### Mattermost MS Teams Meetings Plugin - Slash Command Help\n* `/mstmeetings start` - Start an MS Teams meeting. \n* `/mstmeetings new` - Create an MS Teams meeting with options. \n* `/mstmeetings connect` - Connect to MS Teams meeting. \n* `/mstmeetings disconnect` - Disconnect your Mattermost account from MS Teams. \n* `/mstmeetings settings` - View or change your meeting settings. \n* `/mstmeetings channel` - View or change the meeting settings of this channel. \n* `/mstmeetings agenda` - Receive the Teams meetings of your day every morning. \n* `/mstmeetings subscribe` - Announce the Teams meetings of a group or shared calendar in this channel. \n* `/mstmeetings unsubscribe` - Stop announcing the meetings of a calendar in this channel. \n* `/mstmeetings subscriptions` - List the calendars announced in this channel. \n* `/mstmeetings webinar create` - Create a Teams webinar with registration. \n* `/mstmeetings help` - Display this help text.",
 		},
 	}
 
@@ -4,14 +4,20 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"net/http"
 	"reflect"
+	"time"
 
 	"github.com/mattermost/mattermost/server/public/pluginapi/experimental/bot/logger"
 	"github.com/mattermost/mattermost/server/public/pluginapi/experimental/telemetry"
 	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
 )
 
+const defaultRequestTimeout = 30 * time.Second
+
 // configuration captures the plugin's external configuration as exposed in the Mattermost server
 // configuration, as well as values computed from the configuration. Any public fields will be
 // deserialized from the Mattermost server configuration in OnConfigurationChange.
@@ -28,6 +34,42 @@ type configuration struct {
 	OAuth2ClientID     string `json:"oauth2clientid"`
 	OAuth2ClientSecret string `json:"oauth2clientsecret"`
 	EncryptionKey      string `json:"encryptionkey"`
+
+	// UseApplicationPermissions creates meetings without users connecting their account, which
+	// turns off the features acting with their account, such as ending meetings, the daily
+	// agenda, calendar subscriptions, meeting chats, webinars and link unfurling.
+	UseApplicationPermissions bool `json:"useapplicationpermissions"`
+	RequestTimeoutSeconds     int  `json:"requesttimeoutseconds"`
+	RequirePKCE               bool `json:"requirepkce"`
+
+	AllowedTenantIDs     string `json:"allowedtenantids"`
+	AllowedEmailDomains  string `json:"allowedemaildomains"`
+	RequireMatchingEmail bool   `json:"requirematchingemail"`
+
+	RevokeSessionsOnDisconnect  bool `json:"revokesessionsondisconnect"`
+	EnableCalendarIntegration   bool `json:"enablecalendarintegration"`
+	EnablePresenceSync          bool `json:"enablepresencesync"`
+	EnableDailyAgenda           bool `json:"enabledailyagenda"`
+	EnableCalendarSubscriptions bool `json:"enablecalendarsubscriptions"`
+	EnableMeetingChatMirror     bool `json:"enablemeetingchatmirror"`
+	EnableWebinars              bool `json:"enablewebinars"`
+	EnableMeetingLinkUnfurl     bool `json:"enablemeetinglinkunfurl"`
+
+	DuplicateMeetingWindowSeconds        int  `json:"duplicatemeetingwindowseconds"`
+	DuplicateMeetingIgnoreOtherProviders bool `json:"duplicatemeetingignoreotherproviders"`
+
+	ProxyURL       string `json:"proxyurl"`
+	ProxyUsername  string `json:"proxyusername"`
+	ProxyPassword  string `json:"proxypassword"`
+	NoProxy        string `json:"noproxy"`
+	CACertificates string `json:"cacertificates"`
+
+	// httpClient carries the proxy and CA settings. It is nil when neither is configured.
+	httpClient *http.Client
+
+	// appTokenSource issues app-only tokens through the client credentials
+	// flow. It is only set when UseApplicationPermissions is enabled.
+	appTokenSource oauth2.TokenSource
 }
 
 func (c *configuration) ToMap() (map[string]interface{}, error) {
@@ -61,9 +103,12 @@ func (c *configuration) Clone() *configuration {
 // IsValid checks if all needed fields are set.
 func (c *configuration) IsValid() error {
 	switch {
-	case len(c.OAuth2ClientSecret) == 0:
+	case len(c.OAuth2ClientSecret) == 0 && !c.RequirePKCE:
 		return errors.New("OAuthClientSecret is not configured")
 
+	case len(c.OAuth2ClientSecret) == 0 && c.UseApplicationPermissions:
+		return errors.New("OAuthClientSecret is required to use application permissions")
+
 	case len(c.OAuth2ClientID) == 0:
 		return errors.New("OAuthClientID is not configured")
 
@@ -74,6 +119,14 @@ func (c *configuration) IsValid() error {
 	return nil
 }
 
+// getRequestTimeout returns how long a slash command or HTTP request may wait on Microsoft Graph.
+func (c *configuration) getRequestTimeout() time.Duration {
+	if c == nil || c.RequestTimeoutSeconds <= 0 {
+		return defaultRequestTimeout
+	}
+	return time.Duration(c.RequestTimeoutSeconds) * time.Second
+}
+
 // getConfiguration retrieves the active configuration under lock, making it safe to use
 // concurrently. The active configuration may change underneath the client of this method, but
 // the struct returned by this API call is considered immutable.
@@ -134,6 +187,20 @@ func (p *Plugin) OnConfigurationChange() error {
 		p.API.LogInfo("auto-generated encryption key in the configuration")
 	}
 
+	httpClient, err := loaded.newHTTPClient()
+	if err != nil {
+		return errors.Wrap(err, "invalid proxy configuration")
+	}
+	loaded.httpClient = httpClient
+
+	if loaded.UseApplicationPermissions {
+		ctx := context.Background()
+		if httpClient != nil {
+			ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+		}
+		loaded.appTokenSource = loaded.getAppOAuthConfig().TokenSource(ctx)
+	}
+
 	p.setConfiguration(&loaded)
 
 	if changedEncryptionKey {
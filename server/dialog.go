@@ -0,0 +1,413 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/i18n"
+	"github.com/pkg/errors"
+)
+
+const (
+	meetingDialogPath       = "/api/v1/dialog/meeting"
+	meetingDialogCallbackID = "new_meeting"
+	dialogStartTimeLayout   = "2006-01-02 15:04"
+
+	dialogFieldTopic         = "topic"
+	dialogFieldStartTime     = "start_time"
+	dialogFieldDuration      = "duration"
+	dialogFieldInviteUser    = "invite_user"
+	dialogFieldInviteChannel = "invite_channel"
+	dialogFieldLobby         = "lobby"
+	dialogFieldCalendarEvent = "calendar_event"
+	dialogFieldReminder      = "reminder"
+)
+
+// dialogReminderMinutes are the reminder lead times offered for a meeting.
+var dialogReminderMinutes = []int{0, 5, 10, 15, 30, 60}
+
+// Messages shared by the meeting and webinar dialogs.
+var (
+	dialogCreateMessage     = &i18n.Message{ID: "mstmeetings.dialog.create", Other: "Create"}
+	dialogStartTimeMessage  = &i18n.Message{ID: "mstmeetings.dialog.start_time", Other: "Start time"}
+	dialogDurationMessage   = &i18n.Message{ID: "mstmeetings.dialog.duration", Other: "Duration (minutes)"}
+	invalidStartTimeMessage = &i18n.Message{
+		ID:    "mstmeetings.dialog.invalid_start_time",
+		Other: "The start time must be formatted as YYYY-MM-DD HH:MM.",
+	}
+	pastStartTimeMessage = &i18n.Message{ID: "mstmeetings.dialog.past_start_time", Other: "The start time must be in the future."}
+)
+
+func (p *Plugin) handleNew(args []string, extra *model.CommandArgs) (string, error) {
+	l := p.getUserLocalizer(extra.UserId)
+	if len(args) > 1 {
+		return p.localize(l, tooManyParametersMessage, nil), nil
+	}
+
+	user, appErr := p.API.GetUser(extra.UserId)
+	if appErr != nil {
+		return p.localize(l, getUserFailedMessage, nil), errors.Wrap(appErr, "cannot get user")
+	}
+
+	dialog := p.getMeetingDialog(l, user, p.getUserPreferencesOrDefault(extra.UserId))
+	// The thread is carried through the dialog so that the meeting is posted where the command ran.
+	dialog.State = extra.RootId
+	appErr = p.API.OpenInteractiveDialog(model.OpenDialogRequest{
+		TriggerId: extra.TriggerId,
+		URL:       fmt.Sprintf("/plugins/%s%s", url.PathEscape(manifest.Id), meetingDialogPath),
+		Dialog:    dialog,
+	})
+	if appErr != nil {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.dialog.open_failed",
+			Other: "Failed to open the meeting dialog.",
+		}, nil), errors.Wrap(appErr, "cannot open interactive dialog")
+	}
+	return "", nil
+}
+
+func (p *Plugin) getMeetingDialog(l *i18n.Localizer, user *model.User, prefs *UserPreferences) model.Dialog {
+	duration := int(defaultMeetingDuration.Minutes())
+	if prefs.DurationMinutes > 0 {
+		duration = prefs.DurationMinutes
+	}
+
+	reminderOptions := make([]*model.PostActionOptions, 0, len(dialogReminderMinutes))
+	for _, minutes := range dialogReminderMinutes {
+		text := p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.dialog.reminder_minutes",
+			Other: "{{.Minutes}} minutes before",
+		}, map[string]any{"Minutes": minutes})
+		if minutes == 0 {
+			text = p.localize(l, &i18n.Message{ID: "mstmeetings.dialog.no_reminder", Other: "No reminder"}, nil)
+		}
+		reminderOptions = append(reminderOptions, &model.PostActionOptions{Text: text, Value: strconv.Itoa(minutes)})
+	}
+
+	lobbyOptions := make([]*model.PostActionOptions, 0, len(lobbyBypassScopes))
+	for _, scope := range lobbyBypassScopes {
+		lobbyOptions = append(lobbyOptions, &model.PostActionOptions{Text: scope, Value: scope})
+	}
+
+	elements := []model.DialogElement{
+		{
+			DisplayName: p.localize(l, &i18n.Message{ID: "mstmeetings.dialog.topic", Other: "Topic"}, nil),
+			Name:        dialogFieldTopic,
+			Type:        "text",
+			Default:     prefs.TopicTemplate,
+			Placeholder: p.localize(l, defaultSubjectMessage, nil),
+			HelpText: p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.dialog.topic_help",
+				Other: "Can reference {channel}, {user} and {date}.",
+			}, nil),
+			Optional:  true,
+			MaxLength: maxTopicTemplateLength,
+		},
+		{
+			DisplayName: p.localize(l, dialogStartTimeMessage, nil),
+			Name:        dialogFieldStartTime,
+			Type:        "text",
+			Placeholder: "YYYY-MM-DD HH:MM",
+			HelpText: p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.dialog.start_time_help",
+				Other: "In your timezone ({{.Timezone}}). Leave empty to start the meeting now.",
+			}, map[string]any{"Timezone": getUserLocation(user).String()}),
+			Optional: true,
+		},
+		{
+			DisplayName: p.localize(l, dialogDurationMessage, nil),
+			Name:        dialogFieldDuration,
+			Type:        "text",
+			SubType:     "number",
+			Default:     strconv.Itoa(duration),
+		},
+		{
+			DisplayName: p.localize(l, &i18n.Message{ID: "mstmeetings.dialog.reminder", Other: "Reminder"}, nil),
+			Name:        dialogFieldReminder,
+			Type:        "select",
+			HelpText: p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.dialog.reminder_help",
+				Other: "When invitees are reminded of a scheduled meeting. Leave empty to use each invitee's setting.",
+			}, nil),
+			Options:  reminderOptions,
+			Optional: true,
+		},
+		{
+			DisplayName: p.localize(l, &i18n.Message{ID: "mstmeetings.dialog.invite_user", Other: "Invite a user"}, nil),
+			Name:        dialogFieldInviteUser,
+			Type:        "select",
+			DataSource:  "users",
+			Optional:    true,
+		},
+		{
+			DisplayName: p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.dialog.invite_channel",
+				Other: "Invite the members of a channel",
+			}, nil),
+			Name:       dialogFieldInviteChannel,
+			Type:       "select",
+			DataSource: "channels",
+			HelpText: p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.dialog.invite_channel_help",
+				Other: "Members of this channel are invited in addition to the members of the current direct or group message.",
+			}, nil),
+			Optional: true,
+		},
+		{
+			DisplayName: p.localize(l, &i18n.Message{ID: "mstmeetings.dialog.lobby", Other: "Lobby policy"}, nil),
+			Name:        dialogFieldLobby,
+			Type:        "select",
+			Default:     prefs.LobbyBypassScope,
+			HelpText: p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.dialog.lobby_help",
+				Other: "Who can join the meeting without waiting in the lobby.",
+			}, nil),
+			Options:  lobbyOptions,
+			Optional: true,
+		},
+	}
+	if p.getConfiguration().EnableCalendarIntegration {
+		elements = append(elements, model.DialogElement{
+			DisplayName: p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.dialog.calendar_event",
+				Other: "Create a calendar event",
+			}, nil),
+			Name: dialogFieldCalendarEvent,
+			Type: "bool",
+			Placeholder: p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.dialog.calendar_event_help",
+				Other: "Add the meeting to your calendar and send invitations",
+			}, nil),
+			Default:  "false",
+			Optional: true,
+		})
+	}
+
+	return model.Dialog{
+		CallbackId:  meetingDialogCallbackID,
+		Title:       p.localize(l, &i18n.Message{ID: "mstmeetings.dialog.title", Other: "New MS Teams Meeting"}, nil),
+		SubmitLabel: p.localize(l, dialogCreateMessage, nil),
+		Elements:    elements,
+	}
+}
+
+// getSubmissionString returns a dialog value as a string. Number fields may be submitted as
+// numbers.
+func getSubmissionString(submission map[string]any, name string) string {
+	switch value := submission[name].(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+func getSubmissionBool(submission map[string]any, name string) bool {
+	switch value := submission[name].(type) {
+	case bool:
+		return value
+	case string:
+		return value == trueString
+	default:
+		return false
+	}
+}
+
+// parseMeetingDialog validates a meeting dialog submission. The returned errors are keyed by
+// field and meant to be shown to the user.
+func (p *Plugin) parseMeetingDialog(l *i18n.Localizer, user *model.User, request *model.SubmitDialogRequest) (*MeetingOptions, map[string]string) {
+	submission := request.Submission
+	fieldErrors := map[string]string{}
+
+	options := &MeetingOptions{
+		TopicTemplate:    getSubmissionString(submission, dialogFieldTopic),
+		LobbyBypassScope: getSubmissionString(submission, dialogFieldLobby),
+	}
+	if len(options.TopicTemplate) > maxTopicTemplateLength {
+		fieldErrors[dialogFieldTopic] = p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.dialog.invalid_topic",
+			Other: "The topic must be at most {{.Length}} characters long.",
+		}, map[string]any{"Length": maxTopicTemplateLength})
+	}
+
+	if startTime := getSubmissionString(submission, dialogFieldStartTime); startTime != "" {
+		start, err := time.ParseInLocation(dialogStartTimeLayout, startTime, getUserLocation(user))
+		switch {
+		case err != nil:
+			fieldErrors[dialogFieldStartTime] = p.localize(l, invalidStartTimeMessage, nil)
+		case start.Before(time.Now().Add(-time.Minute)):
+			fieldErrors[dialogFieldStartTime] = p.localize(l, pastStartTimeMessage, nil)
+		default:
+			options.StartDateTime = start
+		}
+	}
+
+	minutes, err := strconv.Atoi(getSubmissionString(submission, dialogFieldDuration))
+	if err != nil || minutes < 1 || minutes > maxMeetingDuration {
+		fieldErrors[dialogFieldDuration] = p.localize(l, invalidDurationMessage, map[string]any{"Max": maxMeetingDuration})
+	}
+	options.Duration = time.Duration(minutes) * time.Minute
+
+	if options.LobbyBypassScope != "" && !slices.Contains(lobbyBypassScopes, options.LobbyBypassScope) {
+		fieldErrors[dialogFieldLobby] = p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.dialog.invalid_lobby",
+			Other: "Select a lobby policy from the list.",
+		}, nil)
+	}
+
+	if reminder := getSubmissionString(submission, dialogFieldReminder); reminder != "" {
+		minutes, err := strconv.Atoi(reminder)
+		if err != nil || !slices.Contains(dialogReminderMinutes, minutes) {
+			fieldErrors[dialogFieldReminder] = p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.dialog.invalid_reminder",
+				Other: "Select a reminder from the list.",
+			}, nil)
+		} else {
+			leadTime := time.Duration(minutes) * time.Minute
+			options.ReminderLeadTime = &leadTime
+		}
+	}
+
+	if inviteUserID := getSubmissionString(submission, dialogFieldInviteUser); inviteUserID != "" {
+		options.InviteUserIDs = append(options.InviteUserIDs, inviteUserID)
+	}
+
+	if inviteChannelID := getSubmissionString(submission, dialogFieldInviteChannel); inviteChannelID != "" {
+		memberIDs, err := p.getInvitedChannelMembers(user.Id, inviteChannelID)
+		switch {
+		case errors.Is(err, errTooManyInvitees):
+			fieldErrors[dialogFieldInviteChannel] = p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.dialog.invite_channel_too_large",
+				Other: "Channels with more than {{.Max}} members cannot be invited.",
+			}, map[string]any{"Max": maxInvitees})
+		case err != nil:
+			fieldErrors[dialogFieldInviteChannel] = p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.dialog.invalid_invite_channel",
+				Other: "You can only invite the members of channels you belong to.",
+			}, nil)
+		}
+		options.InviteUserIDs = append(options.InviteUserIDs, memberIDs...)
+	}
+
+	options.CreateCalendarEvent = p.getConfiguration().EnableCalendarIntegration && getSubmissionBool(submission, dialogFieldCalendarEvent)
+
+	if len(fieldErrors) > 0 {
+		return nil, fieldErrors
+	}
+	return options, nil
+}
+
+func (p *Plugin) getInvitedChannelMembers(userID, channelID string) ([]string, error) {
+	if _, appErr := p.API.GetChannelMember(channelID, userID); appErr != nil {
+		return nil, appErr
+	}
+
+	return p.getChannelMemberIDs(channelID)
+}
+
+func (p *Plugin) handleMeetingDialog(w http.ResponseWriter, r *http.Request) {
+	p.handleMeetingDialogWithDeps(w, r, p.NewClient)
+}
+
+func (p *Plugin) handleMeetingDialogWithDeps(w http.ResponseWriter, r *http.Request, newClient ClientFactory) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		p.API.LogError("handleMeetingDialog, unauthorized user")
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request model.SubmitDialogRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		p.API.LogError("handleMeetingDialog, failed to decode dialog submission", "Error", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Cancelled {
+		return
+	}
+
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		p.API.LogError("handleMeetingDialog, failed to get user", "UserID", userID, "Error", appErr.Message)
+		http.Error(w, appErr.Error(), appErr.StatusCode)
+		return
+	}
+
+	l := p.getUserLocalizer(userID)
+	if _, appErr = p.API.GetChannelMember(request.ChannelId, userID); appErr != nil {
+		p.writeDialogResponse(w, &model.SubmitDialogResponse{Error: p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.dialog.not_channel_member",
+			Other: "You are not a member of this channel.",
+		}, nil)})
+		return
+	}
+
+	rootID, err := p.getThreadRootID(request.ChannelId, request.State)
+	if err != nil {
+		p.writeDialogResponse(w, &model.SubmitDialogResponse{Error: p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.dialog.thread_not_found",
+			Other: "The thread of this meeting no longer exists.",
+		}, nil)})
+		return
+	}
+
+	options, fieldErrors := p.parseMeetingDialog(l, user, &request)
+	if fieldErrors != nil {
+		p.writeDialogResponse(w, &model.SubmitDialogResponse{Errors: fieldErrors})
+		return
+	}
+
+	authResult, authErr := p.authenticateAndFetchUser(r.Context(), userID, request.ChannelId, newClient)
+	if authErr != nil {
+		if isTimeout(authErr.Err) {
+			p.writeDialogResponse(w, &model.SubmitDialogResponse{Error: p.localize(l, requestTimeoutMessage, nil)})
+			return
+		}
+		if _, err := p.postConnect(request.ChannelId, userID); err != nil {
+			p.API.LogWarn("failed to create connect post", "error", err.Error())
+		}
+		p.writeDialogResponse(w, &model.SubmitDialogResponse{Error: p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.dialog.connect",
+			Other: "Connect your Microsoft account with the link posted in the channel, then create the meeting again.",
+		}, nil)})
+		return
+	}
+
+	if _, _, err := p.postMeetingWithDeps(r.Context(), user, request.ChannelId, rootID, options, authResult.Client, authResult.UserInfo); err != nil {
+		p.API.LogError("handleMeetingDialog, failed to post meeting", "UserID", userID, "Error", err.Error())
+		message := p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.dialog.create_failed",
+			Other: "Failed to create the meeting. Please try again.",
+		}, nil)
+		switch {
+		case isTimeout(err):
+			message = p.localize(l, requestTimeoutMessage, nil)
+		case errors.Is(err, errTooManyInvitees):
+			message = p.localize(l, tooManyInviteesMessage, map[string]any{"Max": maxInvitees})
+		}
+		p.writeDialogResponse(w, &model.SubmitDialogResponse{Error: message})
+		return
+	}
+
+	p.trackMeetingStart(userID, telemetryStartSourceDialog)
+}
+
+func (p *Plugin) writeDialogResponse(w http.ResponseWriter, response *model.SubmitDialogResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		p.API.LogWarn("failed to write response", "error", err.Error())
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleNew(t *testing.T) {
+	api := &plugintest.API{}
+	p := &Plugin{MattermostPlugin: plugin.MattermostPlugin{API: api}}
+	p.setConfiguration(&configuration{EnableCalendarIntegration: true})
+
+	api.On("GetUser", "demoUserID").Return(&model.User{Id: "demoUserID"}, nil)
+	api.On("KVGet", "preferences_demoUserID").Return([]byte(`{"topic_template":"Sync","duration_minutes":30}`), nil)
+	api.On("OpenInteractiveDialog", mock.MatchedBy(func(request model.OpenDialogRequest) bool {
+		elements := map[string]model.DialogElement{}
+		for _, element := range request.Dialog.Elements {
+			elements[element.Name] = element
+		}
+		return request.TriggerId == "demoTriggerID" &&
+			request.URL == "/plugins/com.mattermost.msteamsmeetings/api/v1/dialog/meeting" &&
+			elements[dialogFieldTopic].Default == "Sync" &&
+			elements[dialogFieldDuration].Default == "30" &&
+			elements[dialogFieldCalendarEvent].Type == "bool"
+	})).Return(nil)
+
+	resp, err := p.handleNew([]string{"new"}, &model.CommandArgs{UserId: "demoUserID", TriggerId: "demoTriggerID"})
+	require.NoError(t, err)
+	require.Empty(t, resp)
+	api.AssertExpectations(t)
+}
+
+func TestParseMeetingDialog(t *testing.T) {
+	user := &model.User{Id: "demoUserID", Timezone: model.StringMap{"useAutomaticTimezone": "false", "manualTimezone": "Europe/Paris"}}
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	start := time.Now().In(paris).Add(24 * time.Hour).Truncate(time.Minute)
+
+	t.Run("valid submission", func(t *testing.T) {
+		api := &plugintest.API{}
+		p := &Plugin{MattermostPlugin: plugin.MattermostPlugin{API: api}}
+		p.setConfiguration(&configuration{})
+
+		api.On("GetChannelMember", "otherChannelID", "demoUserID").Return(&model.ChannelMember{}, nil)
+		api.On("GetChannelMembers", "otherChannelID", 0, 100).Return(model.ChannelMembers{{UserId: "memberID"}}, nil)
+
+		options, fieldErrors := p.parseMeetingDialog(defaultLocalizer, user, &model.SubmitDialogRequest{Submission: map[string]any{
+			dialogFieldTopic:         "Planning",
+			dialogFieldStartTime:     start.Format(dialogStartTimeLayout),
+			dialogFieldDuration:      float64(45),
+			dialogFieldInviteUser:    "invitedID",
+			dialogFieldInviteChannel: "otherChannelID",
+			dialogFieldLobby:         "organization",
+			dialogFieldReminder:      "15",
+			dialogFieldCalendarEvent: true,
+		}})
+		require.Nil(t, fieldErrors)
+		require.Equal(t, "Planning", options.TopicTemplate)
+		require.Empty(t, options.Subject)
+		require.True(t, start.Equal(options.StartDateTime))
+		require.Equal(t, 45*time.Minute, options.Duration)
+		require.Equal(t, []string{"invitedID", "memberID"}, options.InviteUserIDs)
+		require.Equal(t, "organization", options.LobbyBypassScope)
+		require.Equal(t, model.NewPointer(15*time.Minute), options.ReminderLeadTime)
+		require.False(t, options.CreateCalendarEvent, "calendar events require the calendar integration")
+		api.AssertExpectations(t)
+	})
+
+	t.Run("invalid submission", func(t *testing.T) {
+		api := &plugintest.API{}
+		p := &Plugin{MattermostPlugin: plugin.MattermostPlugin{API: api}}
+		p.setConfiguration(&configuration{})
+
+		api.On("GetChannelMember", "otherChannelID", "demoUserID").Return(nil, &model.AppError{Message: "not a member"})
+
+		_, fieldErrors := p.parseMeetingDialog(defaultLocalizer, user, &model.SubmitDialogRequest{Submission: map[string]any{
+			dialogFieldStartTime:     "tomorrow",
+			dialogFieldDuration:      "0",
+			dialogFieldInviteChannel: "otherChannelID",
+			dialogFieldLobby:         "nobody",
+			dialogFieldReminder:      "7",
+		}})
+		require.Equal(t, map[string]string{
+			dialogFieldStartTime:     "The start time must be formatted as YYYY-MM-DD HH:MM.",
+			dialogFieldDuration:      "The duration must be between 1 and 1440 minutes.",
+			dialogFieldInviteChannel: "You can only invite the members of channels you belong to.",
+			dialogFieldLobby:         "Select a lobby policy from the list.",
+			dialogFieldReminder:      "Select a reminder from the list.",
+		}, fieldErrors)
+	})
+}
+
+func TestHandleMeetingDialog(t *testing.T) {
+	tests := []struct {
+		name         string
+		submission   map[string]any
+		setup        func(api *plugintest.API, mockTracker *MockTracker, mockClient *MockClient)
+		expectedBody string
+	}{
+		{
+			name:       "Validation errors",
+			submission: map[string]any{dialogFieldDuration: "-5"},
+			setup: func(api *plugintest.API, _ *MockTracker, _ *MockClient) {
+				api.On("GetUser", "demoUserID").Return(&model.User{Id: "demoUserID"}, nil)
+				api.On("GetChannelMember", "demoChannelID", "demoUserID").Return(&model.ChannelMember{}, nil)
+			},
+			expectedBody: `{"errors":{"duration":"The duration must be between 1 and 1440 minutes."}}` + "\n",
+		},
+		{
+			name:       "Not a channel member",
+			submission: map[string]any{dialogFieldDuration: "30"},
+			setup: func(api *plugintest.API, _ *MockTracker, _ *MockClient) {
+				api.On("GetUser", "demoUserID").Return(&model.User{Id: "demoUserID"}, nil)
+				api.On("GetChannelMember", "demoChannelID", "demoUserID").Return(nil, &model.AppError{Message: "not a member"})
+			},
+			expectedBody: `{"error":"You are not a member of this channel."}` + "\n",
+		},
+		{
+			name:       "Meeting created",
+			submission: map[string]any{dialogFieldTopic: "Planning", dialogFieldDuration: "30"},
+			setup: func(api *plugintest.API, mockTracker *MockTracker, mockClient *MockClient) {
+				encryptedUserInfo, err := (&UserInfo{RemoteID: "demo_remote_id"}).EncryptedJSON([]byte("demo_encrypt_key"))
+				require.NoError(t, err)
+
+				api.On("GetUser", "demoUserID").Return(&model.User{Id: "demoUserID", Username: "demo"}, nil)
+				api.On("GetChannelMember", "demoChannelID", "demoUserID").Return(&model.ChannelMember{}, nil)
+				api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewPointer("https://example.com")}})
+				api.On("KVGet", "token_demoUserID").Return(encryptedUserInfo, nil)
+				api.On("HasPermissionToChannel", "demoUserID", "demoChannelID", model.PermissionCreatePost).Return(true)
+				api.On("GetChannel", "demoChannelID").Return(&model.Channel{Id: "demoChannelID", Type: model.ChannelTypeOpen}, nil)
+				api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+					return post.GetProp("meeting_topic") == "Planning"
+				})).Return(&model.Post{}, nil)
+				api.On("KVGet", "activemeetings_demoChannelID").Return(nil, nil)
+				api.On("KVSetWithOptions", "activemeetings_demoChannelID", mock.Anything, mock.Anything).Return(true, nil)
+				mockClient.On("GetMe").Return(&RemoteUser{}, nil)
+				mockClient.On("CreateMeeting").Return(&OnlineMeeting{JoinURL: "demoJoinURL"}, nil)
+				mockTracker.On("TrackUserEvent", "meeting_started", "demoUserID", mock.Anything).Return(nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			mockTracker := &MockTracker{}
+			mockClient := &MockClient{}
+			p := &Plugin{
+				MattermostPlugin: plugin.MattermostPlugin{API: api},
+				tracker:          mockTracker,
+			}
+			p.setConfiguration(&configuration{EncryptionKey: "demo_encrypt_key"})
+			tt.setup(api, mockTracker, mockClient)
+
+			body, err := json.Marshal(&model.SubmitDialogRequest{
+				CallbackId: meetingDialogCallbackID,
+				ChannelId:  "demoChannelID",
+				UserId:     "demoUserID",
+				Submission: tt.submission,
+			})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, meetingDialogPath, bytes.NewReader(body))
+			req.Header.Set("Mattermost-User-ID", "demoUserID")
+			w := httptest.NewRecorder()
+
+			p.handleMeetingDialogWithDeps(w, req, mockClientFactory(mockClient))
+
+			require.Equal(t, http.StatusOK, w.Result().StatusCode)
+			require.Equal(t, tt.expectedBody, w.Body.String())
+			api.AssertExpectations(t)
+			mockTracker.AssertExpectations(t)
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,285 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/i18n"
+	"github.com/pkg/errors"
+)
+
+const (
+	activeMeetingsKeyPrefix  = "activemeetings_"
+	channelSettingsKeyPrefix = "channelsettings_"
+
+	defaultDuplicateMeetingWindow = 30 * time.Second
+	maxDuplicateMeetingWindow     = time.Hour
+)
+
+// activeMeeting is an entry of the index of meetings recently posted in a channel, whichever
+// plugin posted them, keyed by post ID. The index replaces scanning the channel for meeting
+// posts, which missed meetings in busy channels.
+type activeMeeting struct {
+	PostID          string `json:"post_id"`
+	RootID          string `json:"root_id"`
+	Link            string `json:"link"`
+	CreatorUsername string `json:"creator_username"`
+	Provider        string `json:"provider"`
+	CreateAt        int64  `json:"create_at"`
+}
+
+// channelSettings are the settings of a channel overriding the plugin configuration.
+type channelSettings struct {
+	// DuplicateMeetingWindowSeconds overrides the duplicate meeting window. Zero disables the
+	// recent meeting check in the channel.
+	DuplicateMeetingWindowSeconds *int `json:"duplicate_meeting_window_seconds,omitempty"`
+}
+
+// getDuplicateMeetingWindow returns for how long a meeting prevents starting another one in the
+// same channel without confirmation.
+func (c *configuration) getDuplicateMeetingWindow() time.Duration {
+	if c == nil || c.DuplicateMeetingWindowSeconds <= 0 {
+		return defaultDuplicateMeetingWindow
+	}
+	return min(time.Duration(c.DuplicateMeetingWindowSeconds)*time.Second, maxDuplicateMeetingWindow)
+}
+
+func getActiveMeetingsKey(channelID string) string {
+	return activeMeetingsKeyPrefix + channelID
+}
+
+func getChannelSettingsKey(channelID string) string {
+	return channelSettingsKeyPrefix + channelID
+}
+
+func (p *Plugin) getChannelSettings(channelID string) (*channelSettings, error) {
+	data, appErr := p.API.KVGet(getChannelSettingsKey(channelID))
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	settings := &channelSettings{}
+	if data == nil {
+		return settings, nil
+	}
+	if err := json.Unmarshal(data, settings); err != nil {
+		return nil, errors.Wrap(err, "cannot decode channel settings")
+	}
+	return settings, nil
+}
+
+func (p *Plugin) storeChannelSettings(channelID string, settings *channelSettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return errors.Wrap(err, "cannot encode channel settings")
+	}
+
+	if appErr := p.API.KVSet(getChannelSettingsKey(channelID), data); appErr != nil {
+		return appErr
+	}
+	return nil
+}
+
+// getChannelDuplicateMeetingWindow returns the duplicate meeting window of a channel, which is
+// zero when the check is disabled in the channel.
+func (p *Plugin) getChannelDuplicateMeetingWindow(channelID string) (time.Duration, error) {
+	settings, err := p.getChannelSettings(channelID)
+	if err != nil {
+		return 0, err
+	}
+	if settings.DuplicateMeetingWindowSeconds != nil {
+		return time.Duration(*settings.DuplicateMeetingWindowSeconds) * time.Second, nil
+	}
+	return p.getConfiguration().getDuplicateMeetingWindow(), nil
+}
+
+func (p *Plugin) getActiveMeetings(channelID string) (map[string]*activeMeeting, []byte, error) {
+	return getJSONIndex[*activeMeeting](p.API, getActiveMeetingsKey(channelID))
+}
+
+// recordActiveMeeting adds a meeting to the index of its channel, dropping the meetings older
+// than any window can cover. The index expires once its last meeting is too old to count.
+func (p *Plugin) recordActiveMeeting(channelID string, meeting *activeMeeting) error {
+	return updateJSONIndex(p.API, getActiveMeetingsKey(channelID), maxDuplicateMeetingWindow, func(meetings map[string]*activeMeeting) {
+		cutoff := time.Now().Add(-maxDuplicateMeetingWindow).UnixMilli()
+		for postID, m := range meetings {
+			if m.CreateAt < cutoff {
+				delete(meetings, postID)
+			}
+		}
+		meetings[meeting.PostID] = meeting
+	})
+}
+
+// removeActiveMeeting drops a meeting post that ended or was deleted from the index of its channel.
+func (p *Plugin) removeActiveMeeting(channelID, postID string) error {
+	meetings, _, err := p.getActiveMeetings(channelID)
+	if err != nil {
+		return err
+	}
+	if _, ok := meetings[postID]; !ok {
+		return nil
+	}
+
+	return updateJSONIndex(p.API, getActiveMeetingsKey(channelID), maxDuplicateMeetingWindow, func(meetings map[string]*activeMeeting) {
+		delete(meetings, postID)
+	})
+}
+
+// recordMeetingPost adds the meeting posted by another plugin, or shared by a user, to the index
+// of its channel. Meetings started through this plugin are recorded when they are posted.
+func (p *Plugin) recordMeetingPost(post *model.Post) {
+	provider := getString("meeting_provider", post.GetProps())
+	link := getString("meeting_link", post.GetProps())
+	if provider == "" || link == "" {
+		return
+	}
+	if provider == msteamsProviderName && post.GetProp("meeting_shared") != true {
+		return
+	}
+
+	err := p.recordActiveMeeting(post.ChannelId, &activeMeeting{
+		PostID:          post.Id,
+		RootID:          post.RootId,
+		Link:            link,
+		CreatorUsername: getString("meeting_creator_username", post.GetProps()),
+		Provider:        provider,
+		CreateAt:        post.CreateAt,
+	})
+	if err != nil {
+		p.API.LogWarn("failed to record meeting post", "PostID", post.Id, "error", err.Error())
+	}
+}
+
+// findRecentMeeting returns the most recent meeting of a thread within the duplicate meeting
+// window of its channel, or nil if there is none. An empty rootID stands for the channel itself.
+// The meeting a thread replies to counts as part of the thread.
+func (p *Plugin) findRecentMeeting(channelID, rootID string) (*activeMeeting, error) {
+	window, err := p.getChannelDuplicateMeetingWindow(channelID)
+	if err != nil || window <= 0 {
+		return nil, err
+	}
+
+	meetings, _, err := p.getActiveMeetings(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	config := p.getConfiguration()
+	ignoreOtherProviders := config != nil && config.DuplicateMeetingIgnoreOtherProviders
+	cutoff := time.Now().Add(-window).UnixMilli()
+	var recent *activeMeeting
+	for _, meeting := range meetings {
+		if meeting.CreateAt < cutoff || (recent != nil && meeting.CreateAt <= recent.CreateAt) {
+			continue
+		}
+		if meeting.RootID != rootID && (rootID == "" || meeting.PostID != rootID) {
+			continue
+		}
+		if ignoreOtherProviders && meeting.Provider != msteamsProviderName {
+			continue
+		}
+		recent = meeting
+	}
+	return recent, nil
+}
+
+func (p *Plugin) canManageChannelSettings(userID string, channel *model.Channel) bool {
+	switch channel.Type {
+	case model.ChannelTypeOpen:
+		return p.API.HasPermissionToChannel(userID, channel.Id, model.PermissionManagePublicChannelProperties)
+	case model.ChannelTypePrivate:
+		return p.API.HasPermissionToChannel(userID, channel.Id, model.PermissionManagePrivateChannelProperties)
+	default:
+		return p.API.HasPermissionToChannel(userID, channel.Id, model.PermissionCreatePost)
+	}
+}
+
+func (p *Plugin) formatDuplicateMeetingWindow(l *i18n.Localizer, window time.Duration) string {
+	if window <= 0 {
+		return p.formatOnOff(l, false)
+	}
+	return p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.channel.window_seconds",
+		Other: "{{.Seconds}} seconds",
+	}, map[string]any{"Seconds": int(window.Seconds())})
+}
+
+// handleChannel shows or changes the settings of the current channel.
+func (p *Plugin) handleChannel(args []string, extra *model.CommandArgs) (string, error) {
+	l := p.getUserLocalizer(extra.UserId)
+	settings, err := p.getChannelSettings(extra.ChannelId)
+	if err != nil {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.channel.get_settings_failed",
+			Other: "Failed to get the channel settings.",
+		}, nil), errors.Wrap(err, "cannot get channel settings")
+	}
+
+	if len(args) < 2 {
+		window := p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.channel.window_default",
+			Other: "{{.Window}} (default)",
+		}, map[string]any{"Window": p.formatDuplicateMeetingWindow(l, p.getConfiguration().getDuplicateMeetingWindow())})
+		if settings.DuplicateMeetingWindowSeconds != nil {
+			window = p.formatDuplicateMeetingWindow(l, time.Duration(*settings.DuplicateMeetingWindowSeconds)*time.Second)
+		}
+		return p.localize(l, &i18n.Message{
+			ID: "mstmeetings.channel.settings",
+			Other: "###### MS Teams Meetings settings of this channel\n" +
+				"* Recent meeting window (`duplicate-window`): {{.Window}}\n\n" +
+				"Run `/mstmeetings channel duplicate-window <seconds|off|default>` to change it.",
+		}, map[string]any{"Window": window}), nil
+	}
+
+	if args[1] != "duplicate-window" {
+		return p.localize(l, unknownSettingMessage, map[string]any{"Setting": args[1]}), nil
+	}
+	if len(args) != 3 {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.channel.usage",
+			Other: "Run `/mstmeetings channel duplicate-window <seconds|off|default>`.",
+		}, nil), nil
+	}
+
+	channel, appErr := p.API.GetChannel(extra.ChannelId)
+	if appErr != nil {
+		return p.localize(l, getChannelFailedMessage, nil), errors.Wrap(appErr, "cannot get channel")
+	}
+	if !p.canManageChannelSettings(extra.UserId, channel) {
+		return p.localize(l, channelSettingsNotAllowedMessage, nil), nil
+	}
+
+	maxSeconds := int(maxDuplicateMeetingWindow.Seconds())
+	switch value := args[2]; value {
+	case "default":
+		settings.DuplicateMeetingWindowSeconds = nil
+	case "off":
+		settings.DuplicateMeetingWindowSeconds = model.NewPointer(0)
+	default:
+		seconds, convErr := strconv.Atoi(value)
+		if convErr != nil || seconds < 1 || seconds > maxSeconds {
+			return p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.channel.invalid_window",
+				Other: "The window must be between 1 and {{.Max}} seconds, `off` or `default`.",
+			}, map[string]any{"Max": maxSeconds}), nil
+		}
+		settings.DuplicateMeetingWindowSeconds = &seconds
+	}
+
+	if err = p.storeChannelSettings(extra.ChannelId, settings); err != nil {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.channel.save_failed",
+			Other: "Failed to save the channel settings.",
+		}, nil), errors.Wrap(err, "cannot store channel settings")
+	}
+	return p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.channel.saved",
+		Other: "The channel settings have been saved.",
+	}, nil), nil
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDuplicateMeetingWindow(t *testing.T) {
+	require.Equal(t, 30*time.Second, (*configuration)(nil).getDuplicateMeetingWindow())
+	require.Equal(t, 30*time.Second, (&configuration{}).getDuplicateMeetingWindow())
+	require.Equal(t, 2*time.Minute, (&configuration{DuplicateMeetingWindowSeconds: 120}).getDuplicateMeetingWindow())
+	require.Equal(t, time.Hour, (&configuration{DuplicateMeetingWindowSeconds: 7200}).getDuplicateMeetingWindow())
+}
+
+func TestFindRecentMeeting(t *testing.T) {
+	now := time.Now()
+	meetings, err := json.Marshal(map[string]*activeMeeting{
+		"zoomPostID":   {PostID: "zoomPostID", Link: "zoomLink", CreatorUsername: "zoomUser", Provider: "Zoom", CreateAt: now.Add(-10 * time.Second).UnixMilli()},
+		"olderPostID":  {PostID: "olderPostID", Link: "olderLink", Provider: msteamsProviderName, CreateAt: now.Add(-25 * time.Second).UnixMilli()},
+		"teamsPostID":  {PostID: "teamsPostID", Link: "teamsLink", CreatorUsername: "teamsUser", Provider: msteamsProviderName, CreateAt: now.Add(-20 * time.Second).UnixMilli()},
+		"threadPostID": {PostID: "threadPostID", Link: "threadLink", Provider: msteamsProviderName, RootID: "threadRootID", CreateAt: now.Add(-5 * time.Second).UnixMilli()},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		config          *configuration
+		channelSettings []byte
+		rootID          string
+		expectedLink    string
+	}{
+		{
+			name:         "Most recent meeting of any provider",
+			config:       &configuration{},
+			expectedLink: "zoomLink",
+		},
+		{
+			name:         "Other providers ignored",
+			config:       &configuration{DuplicateMeetingIgnoreOtherProviders: true},
+			expectedLink: "teamsLink",
+		},
+		{
+			name:   "Meetings older than the window",
+			config: &configuration{DuplicateMeetingWindowSeconds: 5},
+		},
+		{
+			name:            "Channel override extends the window",
+			config:          &configuration{DuplicateMeetingWindowSeconds: 5, DuplicateMeetingIgnoreOtherProviders: true},
+			channelSettings: []byte(`{"duplicate_meeting_window_seconds":60}`),
+			expectedLink:    "teamsLink",
+		},
+		{
+			name:         "Meeting in the same thread",
+			config:       &configuration{},
+			rootID:       "threadRootID",
+			expectedLink: "threadLink",
+		},
+		{
+			name:         "Thread of a meeting post",
+			config:       &configuration{},
+			rootID:       "teamsPostID",
+			expectedLink: "teamsLink",
+		},
+		{
+			name:   "No meeting in the thread",
+			config: &configuration{},
+			rootID: "otherRootID",
+		},
+		{
+			name:            "Check disabled in the channel",
+			config:          &configuration{},
+			channelSettings: []byte(`{"duplicate_meeting_window_seconds":0}`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			defer api.AssertExpectations(t)
+			p := &Plugin{MattermostPlugin: plugin.MattermostPlugin{API: api}}
+			p.setConfiguration(tt.config)
+
+			api.On("KVGet", "channelsettings_demoChannelID").Return(tt.channelSettings, nil)
+			api.On("KVGet", "activemeetings_demoChannelID").Return(meetings, nil).Maybe()
+
+			meeting, err := p.findRecentMeeting("demoChannelID", tt.rootID)
+			require.NoError(t, err)
+			if tt.expectedLink == "" {
+				require.Nil(t, meeting)
+				return
+			}
+			require.NotNil(t, meeting)
+			require.Equal(t, tt.expectedLink, meeting.Link)
+		})
+	}
+}
+
+func TestRecordActiveMeeting(t *testing.T) {
+	api := &plugintest.API{}
+	defer api.AssertExpectations(t)
+	p := &Plugin{MattermostPlugin: plugin.MattermostPlugin{API: api}}
+
+	now := time.Now().UnixMilli()
+	old, err := json.Marshal(map[string]*activeMeeting{
+		"recentPostID":  {PostID: "recentPostID", Link: "recentLink", CreateAt: now - 1000},
+		"expiredPostID": {PostID: "expiredPostID", Link: "expiredLink", CreateAt: time.Now().Add(-2 * time.Hour).UnixMilli()},
+	})
+	require.NoError(t, err)
+	expected, err := json.Marshal(map[string]*activeMeeting{
+		"newPostID":    {PostID: "newPostID", RootID: "rootID", Link: "newLink", Provider: "Jitsi", CreateAt: now},
+		"recentPostID": {PostID: "recentPostID", Link: "recentLink", CreateAt: now - 1000},
+	})
+	require.NoError(t, err)
+
+	api.On("KVGet", "activemeetings_demoChannelID").Return(old, nil)
+	api.On("KVSetWithOptions", "activemeetings_demoChannelID", expected, model.PluginKVSetOptions{
+		Atomic:          true,
+		OldValue:        old,
+		ExpireInSeconds: 3600,
+	}).Return(true, nil)
+
+	p.recordMeetingPost(&model.Post{
+		Id:        "newPostID",
+		ChannelId: "demoChannelID",
+		RootId:    "rootID",
+		CreateAt:  now,
+		Props:     model.StringInterface{"meeting_provider": "Jitsi", "meeting_link": "newLink"},
+	})
+
+	// Posts of this plugin are recorded when they are created, and other posts are ignored.
+	p.recordMeetingPost(&model.Post{ChannelId: "demoChannelID", Props: model.StringInterface{"meeting_provider": msteamsProviderName, "meeting_link": "link"}})
+	p.recordMeetingPost(&model.Post{ChannelId: "demoChannelID", Message: "hello"})
+}
+
+func TestRecordSharedMeeting(t *testing.T) {
+	api := &plugintest.API{}
+	defer api.AssertExpectations(t)
+	p := &Plugin{MattermostPlugin: plugin.MattermostPlugin{API: api}}
+
+	api.On("KVGet", "activemeetings_demoChannelID").Return(nil, nil)
+	api.On("KVSetWithOptions", "activemeetings_demoChannelID", mock.MatchedBy(func(data []byte) bool {
+		return strings.Contains(string(data), `"link":"sharedLink"`)
+	}), mock.Anything).Return(true, nil)
+
+	p.recordMeetingPost(&model.Post{
+		Id:        "sharedPostID",
+		ChannelId: "demoChannelID",
+		Props: model.StringInterface{
+			"meeting_provider": msteamsProviderName,
+			"meeting_link":     "sharedLink",
+			"meeting_shared":   true,
+		},
+	})
+}
+
+func TestHandleChannel(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		canManage      bool
+		expectedStored []byte
+		expectedOutput string
+	}{
+		{
+			name:           "Show the default window",
+			args:           []string{"channel"},
+			expectedOutput: "* Recent meeting window (`duplicate-window`): 30 seconds (default)",
+		},
+		{
+			name:           "Set the window",
+			args:           []string{"channel", "duplicate-window", "120"},
+			canManage:      true,
+			expectedStored: []byte(`{"duplicate_meeting_window_seconds":120}`),
+			expectedOutput: "The channel settings have been saved.",
+		},
+		{
+			name:           "Disable the check",
+			args:           []string{"channel", "duplicate-window", "off"},
+			canManage:      true,
+			expectedStored: []byte(`{"duplicate_meeting_window_seconds":0}`),
+			expectedOutput: "The channel settings have been saved.",
+		},
+		{
+			name:           "Invalid window",
+			args:           []string{"channel", "duplicate-window", "7200"},
+			canManage:      true,
+			expectedOutput: "The window must be between 1 and 3600 seconds, `off` or `default`.",
+		},
+		{
+			name:           "Not a channel admin",
+			args:           []string{"channel", "duplicate-window", "120"},
+			expectedOutput: "You do not have permission to change the settings of this channel.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			defer api.AssertExpectations(t)
+			p := &Plugin{MattermostPlugin: plugin.MattermostPlugin{API: api}}
+			p.setConfiguration(&configuration{})
+
+			api.On("KVGet", "channelsettings_demoChannelID").Return(nil, nil)
+			if len(tt.args) > 2 {
+				api.On("GetChannel", "demoChannelID").Return(&model.Channel{Id: "demoChannelID", Type: model.ChannelTypeOpen}, nil)
+				api.On("HasPermissionToChannel", "demoUserID", "demoChannelID", model.PermissionManagePublicChannelProperties).Return(tt.canManage)
+			}
+			if tt.expectedStored != nil {
+				api.On("KVSet", "channelsettings_demoChannelID", tt.expectedStored).Return(nil)
+			}
+
+			output, err := p.handleChannel(tt.args, &model.CommandArgs{UserId: "demoUserID", ChannelId: "demoChannelID"})
+			require.NoError(t, err)
+			require.Contains(t, output, tt.expectedOutput)
+		})
+	}
+}
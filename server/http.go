@@ -8,13 +8,29 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
 	"net/http"
 
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/mattermost/mattermost/server/public/pluginapi/i18n"
 	"golang.org/x/oauth2"
 )
 
+var connectedPageTemplate = template.Must(template.New("connected").Parse(`
+<!DOCTYPE html>
+<html>
+	<head>
+		<script>
+			window.close();
+		</script>
+	</head>
+	<body>
+		<p>{{.}}</p>
+	</body>
+</html>
+`))
+
 const (
 	postTypeStarted = "STARTED"
 	postTypeConfirm = "RECENTLY_CREATED"
@@ -30,14 +46,41 @@ func (p *Plugin) ServeHTTP(_ *plugin.Context, w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// Bound every Microsoft Graph call made while serving the request.
+	ctx, cancel := context.WithTimeout(r.Context(), config.getRequestTimeout())
+	defer cancel()
+	r = r.WithContext(ctx)
+
 	switch path := r.URL.Path; path {
 	case "/api/v1/meetings":
 		p.handleStartMeeting(w, r)
+	case meetingFromPostPath:
+		p.handleStartMeetingFromPost(w, r)
+	case meetingDialogPath:
+		p.handleMeetingDialog(w, r)
+	case "/api/v1/preferences":
+		p.handlePreferences(w, r)
+	case joinMeetingActionPath:
+		p.handleJoinMeetingAction(w, r)
+	case meetingActionPath:
+		p.handleMeetingAction(w, r)
+	case meetingChatNotificationsPath:
+		p.handleMeetingChatNotifications(w, r)
+	case calendarNotificationsPath:
+		p.handleCalendarNotifications(w, r)
+	case webinarsPath:
+		p.handleCreateWebinar(w, r)
+	case webinarDialogPath:
+		p.handleWebinarDialog(w, r)
 	case "/oauth2/connect":
 		p.connectUser(w, r)
 	case "/oauth2/complete":
 		p.completeUserOAuth(w, r)
 	default:
+		if match := meetingInvitePathRegexp.FindStringSubmatch(path); match != nil {
+			p.handleMeetingInvite(w, r, match[1])
+			return
+		}
 		http.NotFound(w, r)
 	}
 }
@@ -71,7 +114,14 @@ func (p *Plugin) connectUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	url := conf.AuthCodeURL(state, oauth2.AccessTypeOffline)
+	verifier := oauth2.GenerateVerifier()
+	if err = p.StoreVerifier(getOAuthUserStateKey(userID), verifier); err != nil {
+		p.API.LogError("connectUser, failed to store PKCE verifier", "UserID", userID, "Error", err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	url := conf.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier))
 	http.Redirect(w, r, url, http.StatusFound)
 }
 
@@ -83,7 +133,7 @@ func (p *Plugin) completeUserOAuth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
+	ctx := r.Context()
 	conf, err := p.getOAuthConfig()
 	if err != nil {
 		p.API.LogError("completeUserOAuth, failed to get oauth config", "Error", err.Error())
@@ -128,46 +178,73 @@ func (p *Plugin) completeUserOAuth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tok, err := conf.Exchange(ctx, code)
+	verifier, err := p.PopVerifier(key)
+	if err != nil {
+		p.API.LogError("completeUserOAuth, failed to get PKCE verifier", "Error", err.Error())
+		http.Error(w, "missing PKCE verifier", http.StatusBadRequest)
+		return
+	}
+
+	var exchangeOpts []oauth2.AuthCodeOption
+	switch {
+	case verifier != "":
+		exchangeOpts = append(exchangeOpts, oauth2.VerifierOption(verifier))
+	case p.getConfiguration().RequirePKCE:
+		p.API.LogError("completeUserOAuth, missing PKCE verifier", "UserID", userID)
+		http.Error(w, "missing PKCE verifier", http.StatusBadRequest)
+		return
+	}
+
+	tok, err := conf.Exchange(p.oauthContext(ctx), code, exchangeOpts...)
 	if err != nil {
 		p.API.LogDebug("complete oauth, error getting token", "error", err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeGraphError(w, err)
 		return
 	}
 
 	client := p.NewClient(conf, tok)
 
-	remoteUser, err := client.GetMe()
+	remoteUser, err := client.GetMe(ctx)
 	if err != nil {
 		p.API.LogDebug("complete oauth, error getting user", "error", err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeGraphError(w, err)
 		return
 	}
 
-	if remoteUser.Mail == nil {
+	if remoteUser.Mail == "" {
 		p.API.LogDebug("user has no mail")
 		http.Error(w, "User has no mail. Please check the user is properly configured in Microsoft", http.StatusInternalServerError)
 		return
 	}
 
-	if remoteUser.ID == nil {
+	if remoteUser.ID == "" {
 		p.API.LogDebug("user has no ID")
 		http.Error(w, "User has no ID. Please check the user is properly configured in Microsoft", http.StatusInternalServerError)
 		return
 	}
 
-	if remoteUser.UserPrincipalName == nil {
+	if remoteUser.UserPrincipalName == "" {
 		p.API.LogDebug("user has no UPN")
 		http.Error(w, "User has no user principal name. Please check the user is properly configured in Microsoft", http.StatusInternalServerError)
 		return
 	}
 
+	l := p.getUserLocalizer(userID)
+	if err = p.checkConnectionAllowed(l, userID, remoteUser, tok); err != nil {
+		p.API.LogWarn("completeUserOAuth, connection rejected", "UserID", userID, "RemoteID", remoteUser.ID, "UPN", remoteUser.UserPrincipalName, "Reason", err.Error())
+		writeHTMLError(w, http.StatusForbidden, p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.oauth.connection_rejected_title",
+			Other: "Unable to connect your Microsoft account",
+		}, nil), err.Error())
+		return
+	}
+
 	userInfo := &UserInfo{
 		UserID:     userID,
 		OAuthToken: tok,
-		Email:      *remoteUser.Mail,
-		RemoteID:   *remoteUser.ID,
-		UPN:        *remoteUser.UserPrincipalName,
+		Email:      remoteUser.Mail,
+		RemoteID:   remoteUser.ID,
+		UPN:        remoteUser.UserPrincipalName,
 	}
 
 	err = p.StoreUserInfo(userInfo)
@@ -176,31 +253,45 @@ func (p *Plugin) completeUserOAuth(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Unable to connect user to Microsoft", http.StatusInternalServerError)
 		return
 	}
+	if err = p.addConnectedUser(userInfo); err != nil {
+		p.API.LogWarn("failed to add user to the connected users index", "UserID", userID, "error", err.Error())
+	}
 
 	p.trackConnect(userID)
 
-	html := `
-<!DOCTYPE html>
-<html>
-	<head>
-		<script>
-			window.close();
-		</script>
-	</head>
-	<body>
-		<p>Completed connecting to Microsoft. Please close this window.</p>
-	</body>
-</html>
-`
-	if justConnect {
+	var pending *pendingMeeting
+	if !justConnect {
+		pending, err = p.GetPendingMeeting(userID)
+		if err != nil {
+			p.API.LogWarn("complete oauth, error getting pending meeting", "error", err.Error())
+		}
+		_ = p.DeletePendingMeeting(userID)
+	}
+
+	switch {
+	case justConnect:
+		post := &model.Post{
+			UserId:    p.botUserID,
+			ChannelId: channelID,
+			Message: p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.oauth.connected",
+				Other: "You have successfully connected to MS Teams Meetings.",
+			}, nil),
+		}
+
+		p.API.SendEphemeralPost(userID, post)
+	case pending == nil:
 		post := &model.Post{
 			UserId:    p.botUserID,
 			ChannelId: channelID,
-			Message:   "You have successfully connected to MS Teams Meetings.",
+			Message: p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.oauth.connected_request_expired",
+				Other: "You have successfully connected to MS Teams Meetings. Your meeting request has expired, please start the meeting again.",
+			}, nil),
 		}
 
 		p.API.SendEphemeralPost(userID, post)
-	} else {
+	default:
 		user, appErr := p.API.GetUser(userID)
 		if appErr != nil {
 			p.API.LogError("complete oauth, error getting MM user", "error", appErr.Error())
@@ -208,20 +299,27 @@ func (p *Plugin) completeUserOAuth(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		_, _, err = p.postMeetingWithDeps(user, channelID, "", client, userInfo)
+		prefs := p.getUserPreferencesOrDefault(userID)
+		options := prefs.meetingOptions(pending.Topic)
+		options.InviteUserIDs = pending.InviteUserIDs
+		_, _, err = p.postMeetingWithDeps(ctx, user, pending.ChannelID, pending.RootID, options, client, userInfo)
 		if err != nil {
 			p.API.LogDebug("complete oauth, error posting meeting", "error", err.Error())
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeGraphError(w, err)
 			return
 		}
 	}
 
 	w.Header().Set("Content-Type", "text/html")
-	_, _ = w.Write([]byte(html))
+	_ = connectedPageTemplate.Execute(w, p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.oauth.completed",
+		Other: "Completed connecting to Microsoft. Please close this window.",
+	}, nil))
 }
 
 type startMeetingRequest struct {
 	ChannelID string `json:"channel_id"`
+	RootID    string `json:"root_id"`
 	Personal  bool   `json:"personal"`
 	Topic     string `json:"topic"`
 	MeetingID int    `json:"meeting_id"`
@@ -266,26 +364,39 @@ func (p *Plugin) handleStartMeetingWithDeps(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	if r.URL.Query().Get("force") == "" {
-		recentMeeting, recentMeetingURL, creatorName, provider, cpmErr := p.checkPreviousMessages(req.ChannelID)
-		if cpmErr != nil {
-			p.API.LogError("handleStartMeeting, error occurred while checking previous messages in channel", "ChannelID", req.ChannelID, "Error", cpmErr.Message)
-			http.Error(w, cpmErr.Error(), cpmErr.StatusCode)
+	rootID, err := p.getThreadRootID(req.ChannelID, req.RootID)
+	if err != nil {
+		p.API.LogWarn("handleStartMeeting, invalid root post", "UserID", userID, "RootID", req.RootID, "Error", err.Error())
+		http.Error(w, "Invalid root_id", http.StatusBadRequest)
+		return
+	}
+
+	prefs := p.getUserPreferencesOrDefault(userID)
+	if r.URL.Query().Get("force") == "" && !prefs.SkipRecentMeetingCheck {
+		recentMeeting, recentErr := p.findRecentMeeting(req.ChannelID, rootID)
+		if recentErr != nil {
+			p.API.LogError("handleStartMeeting, error occurred while checking recent meetings in channel", "ChannelID", req.ChannelID, "Error", recentErr.Error())
+			http.Error(w, recentErr.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		if recentMeeting {
+		if recentMeeting != nil {
 			_, err = w.Write([]byte(`{"meeting_url": ""}`))
 			if err != nil {
 				p.API.LogWarn("failed to write response", "error", err.Error())
 			}
-			p.postConfirmCreateOrJoin(recentMeetingURL, req.ChannelID, req.Topic, userID, creatorName, provider)
+			p.postConfirmCreateOrJoin(recentMeeting.Link, req.ChannelID, rootID, req.Topic, userID, recentMeeting.CreatorUsername, recentMeeting.Provider)
 			p.trackMeetingDuplication(userID)
 			return
 		}
 	}
 
-	authResult, authErr := p.authenticateAndFetchUser(userID, req.ChannelID, newClient)
+	authResult, authErr := p.authenticateAndFetchUser(r.Context(), userID, req.ChannelID, newClient)
+	if authErr != nil && isTimeout(authErr.Err) {
+		p.API.LogError("handleStartMeeting, timed out authenticating user", "UserID", userID, "Error", authErr.Err.Error())
+		http.Error(w, requestTimeoutText, http.StatusGatewayTimeout)
+		return
+	}
 	if authErr != nil {
 		if _, err = w.Write([]byte(`{"meeting_url": ""}`)); err != nil {
 			p.API.LogWarn("failed to write response", "error", err.Error())
@@ -298,17 +409,17 @@ func (p *Plugin) handleStartMeetingWithDeps(w http.ResponseWriter, r *http.Reque
 		}
 
 		// the user state will be needed later while connecting the user to MS teams meeting via OAuth
-		if _, err = p.StoreState(userID, req.ChannelID, false); err != nil {
+		if err = p.storeMeetingRequestState(userID, &pendingMeeting{ChannelID: req.ChannelID, RootID: rootID, Topic: req.Topic}); err != nil {
 			p.API.LogWarn("failed to store user state", "error", err.Error())
 		}
 
 		return
 	}
 
-	_, meeting, err := p.postMeetingWithDeps(user, req.ChannelID, req.Topic, authResult.Client, authResult.UserInfo)
+	_, meeting, err := p.postMeetingWithDeps(r.Context(), user, req.ChannelID, rootID, prefs.meetingOptions(req.Topic), authResult.Client, authResult.UserInfo)
 	if err != nil {
 		p.API.LogError("handleStartMeeting, failed to post meeting", "UserID", user.Id, "Error", err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeGraphError(w, err)
 		return
 	}
 
@@ -317,12 +428,26 @@ func (p *Plugin) handleStartMeetingWithDeps(w http.ResponseWriter, r *http.Reque
 		p.trackMeetingForced(userID)
 	}
 
-	_, err = fmt.Fprintf(w, `{"meeting_url": "%s"}`, *meeting.JoinURL)
+	_, err = fmt.Fprintf(w, `{"meeting_url": "%s"}`, meeting.JoinURL)
 	if err != nil {
 		p.API.LogWarn("failed to write response", "error", err.Error())
 	}
 }
 
+// writeGraphError reports a failed Microsoft Graph call, telling timeouts and meetings with too
+// many invitees apart from other failures.
+func writeGraphError(w http.ResponseWriter, err error) {
+	if isTimeout(err) {
+		http.Error(w, requestTimeoutText, http.StatusGatewayTimeout)
+		return
+	}
+	if errors.Is(err, errTooManyInvitees) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
 func (p *Plugin) handleStartMeeting(w http.ResponseWriter, r *http.Request) {
 	p.handleStartMeetingWithDeps(w, r, p.NewClient)
 }
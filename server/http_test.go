@@ -9,19 +9,19 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
-	"time"
 
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
 	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
-	msgraph "github.com/yaegashi/msgraph.go/beta"
 	"golang.org/x/oauth2"
 )
 
 func TestConnectUser(t *testing.T) {
+	var verifier string
 	api := &plugintest.API{}
 	p := &Plugin{
 		MattermostPlugin: plugin.MattermostPlugin{
@@ -107,9 +107,9 @@ func TestConnectUser(t *testing.T) {
 			userID:              "testUserID",
 			channelID:           "testChannelID",
 			expectedStatus:      http.StatusFound,
-			expectedBody:        "<a href=\"https://login.microsoftonline.com/testOAuth2Authority/oauth2/v2.0/authorize?access_type=offline&amp;client_id=testOAuth2ClientID&amp;redirect_uri=testSiteURL%2Fplugins%2Fcom.mattermost.msteamsmeetings%2Foauth2%2Fcomplete&amp;response_type=code&amp;scope=offline_access+OnlineMeetings.ReadWrite&amp;state=testOAuthState\">Found</a>.\n\n",
+			expectedBody:        "<a href=\"https://login.microsoftonline.com/testOAuth2Authority/oauth2/v2.0/authorize?access_type=offline&amp;client_id=testOAuth2ClientID&amp;code_challenge={challenge}&amp;code_challenge_method=S256&amp;redirect_uri=testSiteURL%2Fplugins%2Fcom.mattermost.msteamsmeetings%2Foauth2%2Fcomplete&amp;response_type=code&amp;scope=offline_access+OnlineMeetings.ReadWrite&amp;state=testOAuthState\">Found</a>.\n\n",
 			redirectExpected:    true,
-			expectedRedirectURL: "https://login.microsoftonline.com/testOAuth2Authority/oauth2/v2.0/authorize?access_type=offline&client_id=testOAuth2ClientID&redirect_uri=testSiteURL%2Fplugins%2Fcom.mattermost.msteamsmeetings%2Foauth2%2Fcomplete&response_type=code&scope=offline_access+OnlineMeetings.ReadWrite&state=testOAuthState",
+			expectedRedirectURL: "https://login.microsoftonline.com/testOAuth2Authority/oauth2/v2.0/authorize?access_type=offline&client_id=testOAuth2ClientID&code_challenge={challenge}&code_challenge_method=S256&redirect_uri=testSiteURL%2Fplugins%2Fcom.mattermost.msteamsmeetings%2Foauth2%2Fcomplete&response_type=code&scope=offline_access+OnlineMeetings.ReadWrite&state=testOAuthState",
 			setup: func() {
 				p.setConfiguration(&configuration{
 					OAuth2ClientID:     "testOAuth2ClientID",
@@ -126,6 +126,9 @@ func TestConnectUser(t *testing.T) {
 
 				mockState := "testOAuthState"
 				api.On("KVGet", getOAuthUserStateKey("testUserID")).Return([]byte(mockState), nil)
+				api.On("KVSetWithExpiry", getOAuthUserStateKey("testUserID")+pkceVerifierKeySuffix, mock.Anything, int64(pkceVerifierExpirySeconds)).Run(func(args mock.Arguments) {
+					verifier = string(args.Get(1).([]byte))
+				}).Return(nil)
 			},
 		},
 	}
@@ -148,11 +151,12 @@ func TestConnectUser(t *testing.T) {
 			body, err := io.ReadAll(resp.Body)
 			require.NoError(t, err)
 
+			challenge := oauth2.S256ChallengeFromVerifier(verifier)
 			require.Equal(t, tt.expectedStatus, resp.StatusCode)
-			require.Equal(t, tt.expectedBody, string(body))
+			require.Equal(t, strings.ReplaceAll(tt.expectedBody, "{challenge}", challenge), string(body))
 
 			if tt.redirectExpected {
-				require.Equal(t, tt.expectedRedirectURL, resp.Header.Get("Location"))
+				require.Equal(t, strings.ReplaceAll(tt.expectedRedirectURL, "{challenge}", challenge), resp.Header.Get("Location"))
 			}
 
 			api.AssertExpectations(t)
@@ -181,6 +185,7 @@ func TestHandleStartMeeting(t *testing.T) {
 		name           string
 		userID         string
 		channelID      string
+		rootID         string
 		expectedStatus int
 		expectedBody   string
 		setup          func()
@@ -239,6 +244,20 @@ func TestHandleStartMeeting(t *testing.T) {
 				api.On("LogError", "handleStartMeeting, failed to get channel member", "UserID", "testUserID", "Error", "mock error").Return(nil)
 			},
 		},
+		{
+			name:           "Root Post In Another Channel",
+			userID:         "testUserID",
+			channelID:      "testChannelID",
+			rootID:         "rootpostidrootpostidrootpo",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid root_id\n",
+			setup: func() {
+				api.On("GetUser", "testUserID").Return(&model.User{Id: "testUserID"}, nil)
+				api.On("GetChannelMember", "testChannelID", "testUserID").Return(nil, nil)
+				api.On("GetPost", "rootpostidrootpostidrootpo").Return(&model.Post{Id: "rootpostidrootpostidrootpo", ChannelId: "otherChannelID"}, nil)
+				api.On("LogWarn", "handleStartMeeting, invalid root post", "UserID", "testUserID", "RootID", "rootpostidrootpostidrootpo", "Error", "root post is not in the channel").Return(nil)
+			},
+		},
 		{
 			name:           "Error Checking Previous Messages",
 			userID:         "testUserID",
@@ -249,8 +268,10 @@ func TestHandleStartMeeting(t *testing.T) {
 				user := &model.User{Id: "testUserID"}
 				api.On("GetUser", "testUserID").Return(user, nil)
 				api.On("GetChannelMember", "testChannelID", "testUserID").Return(nil, nil)
-				api.On("GetPostsSince", "testChannelID", (time.Now().Unix()-30)*1000).Return(nil, &model.AppError{Message: "mock error while checking previous messages", StatusCode: http.StatusInternalServerError})
-				api.On("LogError", "handleStartMeeting, error occurred while checking previous messages in channel", "ChannelID", "testChannelID", "Error", "mock error while checking previous messages").Return(nil)
+				api.On("KVGet", "preferences_testUserID").Return(nil, nil)
+				api.On("KVGet", "channelsettings_testChannelID").Return(nil, nil)
+				api.On("KVGet", "activemeetings_testChannelID").Return(nil, &model.AppError{Message: "mock error while checking previous messages"})
+				api.On("LogError", "handleStartMeeting, error occurred while checking recent meetings in channel", "ChannelID", "testChannelID", "Error", "mock error while checking previous messages").Return(nil)
 			},
 		},
 		{
@@ -267,7 +288,9 @@ func TestHandleStartMeeting(t *testing.T) {
 				})
 				api.On("GetUser", "testUserID").Return(&model.User{Id: "testUserID"}, nil)
 				api.On("GetChannelMember", "testChannelID", "testUserID").Return(nil, nil)
-				api.On("GetPostsSince", "testChannelID", (time.Now().Unix()-30)*1000).Return(&model.PostList{}, nil)
+				api.On("KVGet", "preferences_testUserID").Return(nil, nil)
+				api.On("KVGet", "channelsettings_testChannelID").Return(nil, nil)
+				api.On("KVGet", "activemeetings_testChannelID").Return(nil, nil)
 				api.On("LogError", "postConnect, cannot get oauth message", "error", "error fetching siteURL").Return()
 				api.On("LogError", "authenticateAndFetchUser, cannot get oauth message", "error", "error fetching siteURL").Return()
 				api.On("LogWarn", "failed to create connect post", "error", mock.Anything).Return(nil)
@@ -300,7 +323,9 @@ func TestHandleStartMeeting(t *testing.T) {
 				api.On("KVGet", "token_testUserID").Return(encryptedTestUserInfo, nil)
 				api.On("GetUser", "testUserID").Return(&model.User{Id: "testUserID"}, nil)
 				api.On("GetChannelMember", "testChannelID", "testUserID").Return(nil, nil)
-				api.On("GetPostsSince", "testChannelID", (time.Now().Unix()-30)*1000).Return(&model.PostList{}, nil)
+				api.On("KVGet", "preferences_testUserID").Return(nil, nil)
+				api.On("KVGet", "channelsettings_testChannelID").Return(nil, nil)
+				api.On("KVGet", "activemeetings_testChannelID").Return(nil, nil)
 				api.On("LogError", "authenticateAndFetchUser, cannot get oauth config", "error", "error fetching siteURL").Return()
 				api.On("LogError", "postConnect, cannot get oauth message", "error", "error fetching siteURL").Return()
 				api.On("LogWarn", "failed to create connect post", "error", "error fetching siteURL")
@@ -328,10 +353,12 @@ func TestHandleStartMeeting(t *testing.T) {
 				api.On("KVGet", "token_testUserID").Return(encryptedTestUserInfo, nil)
 				api.On("GetUser", "testUserID").Return(&model.User{Id: "testUserID"}, nil)
 				api.On("GetChannelMember", "testChannelID", "testUserID").Return(nil, nil)
-				api.On("GetPostsSince", "testChannelID", (time.Now().Unix()-30)*1000).Return(&model.PostList{}, nil)
+				api.On("KVGet", "preferences_testUserID").Return(nil, nil)
+				api.On("KVGet", "channelsettings_testChannelID").Return(nil, nil)
+				api.On("KVGet", "activemeetings_testChannelID").Return(nil, nil)
 				api.On("LogError", "handleStartMeeting, failed to post meeting", "UserID", "testUserID", "Error", "cannot create post in this channel")
 				api.On("HasPermissionToChannel", "testUserID", "testChannelID", model.PermissionCreatePost).Return(false)
-				mockClient.On("GetMe").Return(&msgraph.User{}, nil)
+				mockClient.On("GetMe").Return(&RemoteUser{}, nil)
 			},
 		},
 		{
@@ -359,11 +386,14 @@ func TestHandleStartMeeting(t *testing.T) {
 				api.On("GetUser", "testUserID").Return(&model.User{Id: "testUserID"}, nil)
 				api.On("GetChannel", "testChannelID").Return(&model.Channel{Id: "testChannelID", Type: model.ChannelTypeOpen}, nil)
 				api.On("GetChannelMember", "testChannelID", "testUserID").Return(nil, nil)
-				api.On("GetPostsSince", "testChannelID", (time.Now().Unix()-30)*1000).Return(&model.PostList{}, nil)
+				api.On("KVGet", "preferences_testUserID").Return(nil, nil)
+				api.On("KVGet", "channelsettings_testChannelID").Return(nil, nil)
+				api.On("KVGet", "activemeetings_testChannelID").Return(nil, nil)
 				api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+				api.On("KVSetWithOptions", "activemeetings_testChannelID", mock.Anything, mock.Anything).Return(true, nil)
 				api.On("HasPermissionToChannel", "testUserID", "testChannelID", model.PermissionCreatePost).Return(true)
-				mockClient.On("GetMe").Return(&msgraph.User{}, nil)
-				mockClient.On("CreateMeeting", mock.Anything, mock.Anything, mock.Anything).Return(&msgraph.OnlineMeeting{JoinURL: &testJoinURL}, nil)
+				mockClient.On("GetMe").Return(&RemoteUser{}, nil)
+				mockClient.On("CreateMeeting", mock.Anything, mock.Anything, mock.Anything).Return(&OnlineMeeting{JoinURL: testJoinURL}, nil)
 				tracker.On("TrackUserEvent", "meeting_started", "testUserID", mock.Anything).Return(nil)
 			},
 		},
@@ -389,6 +419,7 @@ func TestHandleStartMeeting(t *testing.T) {
 			default:
 				reqBody, _ = json.Marshal(&startMeetingRequest{
 					ChannelID: tc.channelID,
+					RootID:    tc.rootID,
 					Personal:  false,
 					Topic:     "Test Meeting",
 					MeetingID: 123,
@@ -572,6 +603,32 @@ func TestCompleteUserOAuth(t *testing.T) {
 				api.On("LogError", "completeUserOAuth, unauthorized user", "UserID", "testUserID").Return(nil)
 			},
 		},
+		{
+			name:              "Missing PKCE verifier when required",
+			userID:            "testUserID",
+			expectedStatus:    http.StatusBadRequest,
+			expectedBody:      "missing PKCE verifier\n",
+			state:             "msteamsmeetinguserstate_testUserID_testChannelID_true",
+			authorizationCode: "testAuthCode",
+			setup: func() {
+				p.setConfiguration(&configuration{
+					OAuth2ClientID:  "testOAuth2ClientID",
+					OAuth2Authority: "testOAuth2Authority",
+					RequirePKCE:     true,
+				})
+				siteURL := "testSiteURL"
+				api.On("GetConfig").Return(&model.Config{
+					ServiceSettings: model.ServiceSettings{
+						SiteURL: &siteURL,
+					},
+				})
+				api.On("KVGet", "msteamsmeetinguserstate_testUserID").Return([]byte("msteamsmeetinguserstate_testUserID_testChannelID_true"), nil)
+				api.On("KVDelete", "msteamsmeetinguserstate_testUserID").Return(nil)
+				api.On("KVGet", "msteamsmeetinguserstate_testUserID_pkceverifier").Return(nil, nil)
+				api.On("KVDelete", "msteamsmeetinguserstate_testUserID_pkceverifier").Return(nil)
+				api.On("LogError", "completeUserOAuth, missing PKCE verifier", "UserID", "testUserID").Return(nil)
+			},
+		},
 	}
 
 	for _, tt := range tests {
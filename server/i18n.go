@@ -0,0 +1,77 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"github.com/mattermost/mattermost/server/public/pluginapi/i18n"
+	goi18n "github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+)
+
+// i18nPath is the directory of the translation files in the plugin bundle.
+const i18nPath = "assets/i18n"
+
+// defaultLocalizer renders the English default messages when no translations are loaded.
+var defaultLocalizer = goi18n.NewLocalizer(goi18n.NewBundle(language.English), language.English.String())
+
+// Messages shared by several handlers.
+var (
+	tooManyParametersMessage         = &i18n.Message{ID: "mstmeetings.too_many_parameters", Other: tooManyParametersText}
+	requestTimeoutMessage            = &i18n.Message{ID: "mstmeetings.request_timeout", Other: requestTimeoutText}
+	unknownActionMessage             = &i18n.Message{ID: "mstmeetings.command.unknown_action", Other: "Unknown action `{{.Action}}`."}
+	unknownSettingMessage            = &i18n.Message{ID: "mstmeetings.settings.unknown_setting", Other: "Unknown setting `{{.Setting}}`."}
+	defaultSubjectMessage            = &i18n.Message{ID: "mstmeetings.default_subject", Other: defaultMeetingSubject}
+	getUserFailedMessage             = &i18n.Message{ID: "mstmeetings.get_user_failed", Other: "Cannot get user."}
+	getChannelFailedMessage          = &i18n.Message{ID: "mstmeetings.get_channel_failed", Other: "Failed to get the channel."}
+	channelSettingsNotAllowedMessage = &i18n.Message{
+		ID:    "mstmeetings.channel_settings_not_allowed",
+		Other: "You do not have permission to change the settings of this channel.",
+	}
+	connectFirstMessage = &i18n.Message{
+		ID:    "mstmeetings.connect_first",
+		Other: "Connect your Microsoft account with `/mstmeetings connect` first.",
+	}
+	tooManyInviteesMessage = &i18n.Message{
+		ID:    "mstmeetings.too_many_invitees",
+		Other: "A meeting cannot invite more than {{.Max}} people. Invite a smaller channel, or turn off inviting the channel members with `/mstmeetings settings invite off`.",
+	}
+)
+
+// getUserLocalizer returns a localizer for the locale of a user.
+func (p *Plugin) getUserLocalizer(userID string) *i18n.Localizer {
+	if p.i18nBundle == nil {
+		return defaultLocalizer
+	}
+	return p.i18nBundle.GetUserLocalizer(userID)
+}
+
+// localize renders a message, falling back to its English default when it is not translated.
+func (p *Plugin) localize(l *i18n.Localizer, message *i18n.Message, data map[string]any) string {
+	text, err := l.Localize(&i18n.LocalizeConfig{DefaultMessage: message, TemplateData: data})
+	if err != nil {
+		var notFound *goi18n.MessageNotFoundErr
+		if !errors.As(err, &notFound) || text == "" {
+			p.API.LogWarn("failed to localize message", "id", message.ID, "error", err.Error())
+			return message.Other
+		}
+	}
+	return text
+}
+
+// formatOnOff renders a boolean setting.
+func (p *Plugin) formatOnOff(l *i18n.Localizer, value bool) string {
+	if value {
+		return p.localize(l, &i18n.Message{ID: "mstmeetings.settings.on", Other: "On"}, nil)
+	}
+	return p.localize(l, &i18n.Message{ID: "mstmeetings.settings.off", Other: "Off"}, nil)
+}
+
+// formatEnabled renders whether a feature is enabled.
+func (p *Plugin) formatEnabled(l *i18n.Localizer, value bool) string {
+	if value {
+		return p.localize(l, &i18n.Message{ID: "mstmeetings.settings.enabled", Other: "enabled"}, nil)
+	}
+	return p.localize(l, &i18n.Message{ID: "mstmeetings.settings.disabled", Other: "disabled"}, nil)
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/mattermost/mattermost/server/public/pluginapi/i18n"
+	"github.com/stretchr/testify/require"
+)
+
+func readTranslations(t *testing.T, locale string) map[string]string {
+	data, err := os.ReadFile(filepath.Join("..", i18nPath, "active."+locale+".json"))
+	require.NoError(t, err)
+
+	translations := map[string]string{}
+	require.NoError(t, json.Unmarshal(data, &translations))
+	return translations
+}
+
+func TestTranslationFiles(t *testing.T) {
+	english := readTranslations(t, "en")
+	require.Equal(t, helpMessage.Other, english[helpMessage.ID])
+	require.Equal(t, tooManyParametersText, english[tooManyParametersMessage.ID])
+	require.Equal(t, requestTimeoutText, english[requestTimeoutMessage.ID])
+
+	for _, locale := range []string{"de", "fr", "es", "ja"} {
+		t.Run(locale, func(t *testing.T) {
+			translations := readTranslations(t, locale)
+			for id, message := range english {
+				translation, ok := translations[id]
+				require.True(t, ok, "missing translation of %s", id)
+				require.Equal(t, strings.Count(message, "{{"), strings.Count(translation, "{{"), "placeholders of %s", id)
+			}
+			require.Len(t, translations, len(english))
+		})
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	api := &plugintest.API{}
+	p := &Plugin{MattermostPlugin: plugin.MattermostPlugin{API: api}}
+
+	api.On("GetBundlePath").Return("..", nil)
+	api.On("GetUser", "germanUserID").Return(&model.User{Id: "germanUserID", Locale: "de"}, nil)
+	api.On("GetUser", "englishUserID").Return(&model.User{Id: "englishUserID", Locale: "en"}, nil)
+
+	bundle, err := i18n.InitBundle(p.API, i18nPath)
+	require.NoError(t, err)
+	p.i18nBundle = bundle
+
+	german := p.getUserLocalizer("germanUserID")
+	require.Equal(t, "Zu viele Parameter.", p.localize(german, tooManyParametersMessage, nil))
+	require.Equal(t, "Meeting gestartet unter [diesem Link](https://teams.example.com).", p.localize(german, &i18n.Message{
+		ID:    "mstmeetings.meeting.started",
+		Other: "Meeting started at [this link]({{.JoinURL}}).",
+	}, map[string]any{"JoinURL": "https://teams.example.com"}))
+	require.Contains(t, p.getHelpText(german), "Hilfe zum Slash-Befehl")
+
+	english := p.getUserLocalizer("englishUserID")
+	require.Equal(t, tooManyParametersText, p.localize(english, tooManyParametersMessage, nil))
+
+	// Messages without a translation fall back to the English default.
+	require.Equal(t, "Not translated yet.", p.localize(german, &i18n.Message{ID: "mstmeetings.test.untranslated", Other: "Not translated yet."}, nil))
+	api.AssertExpectations(t)
+}
@@ -0,0 +1,314 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	meetingInviteKeyPrefix = "meetinginvite_"
+	meetingInviteFilename  = "invite.ics"
+
+	// meetingInviteRetention is how long invites stay downloadable after their meeting ends.
+	meetingInviteRetention = 30 * 24 * time.Hour
+
+	icsDateTimeLayout = "20060102T150405"
+	// icsLineLength is the maximum length in octets of a content line, excluding the line break.
+	icsLineLength = 75
+)
+
+var meetingInvitePathRegexp = regexp.MustCompile(`^/api/v1/meetings/([a-z0-9]{26})/ics$`)
+
+// meetingInvite holds what is needed to render the iCalendar invite of a scheduled meeting in the
+// timezone of each user downloading it.
+type meetingInvite struct {
+	ChannelID      string    `json:"channel_id"`
+	Subject        string    `json:"subject"`
+	JoinURL        string    `json:"join_url"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	OrganizerName  string    `json:"organizer_name"`
+	OrganizerEmail string    `json:"organizer_email"`
+	AttendeeEmails []string  `json:"attendee_emails,omitempty"`
+}
+
+// newMeetingInvite returns the invite of a meeting, or nil if the meeting is not scheduled.
+func newMeetingInvite(channelID string, creator *model.User, creatorInfo *UserInfo, attendees []*UserInfo, meeting *OnlineMeeting) *meetingInvite {
+	if !meeting.StartDateTime.After(time.Now().Add(time.Minute)) {
+		return nil
+	}
+
+	invite := &meetingInvite{
+		ChannelID:      channelID,
+		Subject:        meeting.Subject,
+		JoinURL:        meeting.JoinURL,
+		Start:          meeting.StartDateTime,
+		End:            meeting.EndDateTime,
+		OrganizerName:  creator.GetDisplayName(model.ShowFullName),
+		OrganizerEmail: creatorInfo.getEmailAddress(),
+	}
+	if invite.Subject == "" {
+		invite.Subject = defaultMeetingSubject
+	}
+	if invite.End.Before(invite.Start) {
+		invite.End = invite.Start.Add(defaultMeetingDuration)
+	}
+	if invite.OrganizerEmail == "" {
+		invite.OrganizerEmail = creator.Email
+	}
+	for _, attendee := range attendees {
+		if address := attendee.getEmailAddress(); address != "" && address != invite.OrganizerEmail {
+			invite.AttendeeEmails = append(invite.AttendeeEmails, address)
+		}
+	}
+	return invite
+}
+
+// getEmailAddress returns the address of the Microsoft account of a user.
+func (u *UserInfo) getEmailAddress() string {
+	if u.Email != "" {
+		return u.Email
+	}
+	return u.UPN
+}
+
+// iCalendar renders the invite as an RFC 5545 calendar, with its times in the given location.
+// The organizer and the attendees are left out when email addresses are hidden, as their values
+// must be addresses.
+func (inv *meetingInvite) iCalendar(loc *time.Location, showEmailAddresses bool) []byte {
+	w := &icsWriter{}
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:-//Mattermost//" + manifest.Id + "//EN")
+	w.line("CALSCALE:GREGORIAN")
+	w.line("METHOD:PUBLISH")
+
+	utc := loc.String() == "UTC"
+	if !utc {
+		w.timezone(loc, inv.Start, inv.End)
+	}
+
+	w.line("BEGIN:VEVENT")
+	w.line("UID:" + inv.uid())
+	w.line("DTSTAMP:" + time.Now().UTC().Format(icsDateTimeLayout) + "Z")
+	if utc {
+		w.line("DTSTART:" + inv.Start.UTC().Format(icsDateTimeLayout) + "Z")
+		w.line("DTEND:" + inv.End.UTC().Format(icsDateTimeLayout) + "Z")
+	} else {
+		w.line("DTSTART;TZID=" + loc.String() + ":" + inv.Start.In(loc).Format(icsDateTimeLayout))
+		w.line("DTEND;TZID=" + loc.String() + ":" + inv.End.In(loc).Format(icsDateTimeLayout))
+	}
+	w.line("SUMMARY:" + escapeICSText(inv.Subject))
+	w.line("DESCRIPTION:" + escapeICSText(inv.JoinURL))
+	w.line("LOCATION:" + escapeICSText(msteamsProviderName))
+	w.line("URL:" + inv.JoinURL)
+	if showEmailAddresses {
+		if inv.OrganizerEmail != "" {
+			w.line("ORGANIZER;CN=" + quoteICSParam(inv.OrganizerName) + ":mailto:" + inv.OrganizerEmail)
+		}
+		for _, address := range inv.AttendeeEmails {
+			w.line("ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION:mailto:" + address)
+		}
+	}
+	w.line("END:VEVENT")
+	w.line("END:VCALENDAR")
+	return w.Bytes()
+}
+
+// uid identifies the event by its join URL, so that importing the invite again updates it.
+func (inv *meetingInvite) uid() string {
+	sum := sha256.Sum256([]byte(inv.JoinURL))
+	return hex.EncodeToString(sum[:16]) + "@" + manifest.Id
+}
+
+// icsWriter writes folded iCalendar content lines.
+type icsWriter struct {
+	bytes.Buffer
+}
+
+func (w *icsWriter) line(s string) {
+	for length := icsLineLength; len(s) > length; length = icsLineLength - 1 {
+		cut := length
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+	}
+	w.WriteString(s + "\r\n")
+}
+
+// timezone writes the definition of a location, with the observances in effect between from and
+// to so that both ends of the event resolve to the right offset.
+func (w *icsWriter) timezone(loc *time.Location, from, to time.Time) {
+	w.line("BEGIN:VTIMEZONE")
+	w.line("TZID:" + loc.String())
+
+	t := from.In(loc)
+	for {
+		name, offset := t.Zone()
+		start, end := t.ZoneBounds()
+		offsetFrom := offset
+		onset := time.Unix(0, 0).In(time.FixedZone("", offset))
+		if !start.IsZero() {
+			_, offsetFrom = start.Add(-time.Second).Zone()
+			onset = start.In(time.FixedZone("", offsetFrom))
+		}
+
+		component := "STANDARD"
+		if t.IsDST() {
+			component = "DAYLIGHT"
+		}
+		w.line("BEGIN:" + component)
+		w.line("DTSTART:" + onset.Format(icsDateTimeLayout))
+		w.line("TZOFFSETFROM:" + formatICSOffset(offsetFrom))
+		w.line("TZOFFSETTO:" + formatICSOffset(offset))
+		w.line("TZNAME:" + escapeICSText(name))
+		w.line("END:" + component)
+
+		if end.IsZero() || end.After(to) {
+			break
+		}
+		t = end
+	}
+	w.line("END:VTIMEZONE")
+}
+
+// formatICSOffset formats a UTC offset in seconds as ±HHMM, or ±HHMMSS when it has seconds.
+func formatICSOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	formatted := fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset%3600/60)
+	if seconds := offset % 60; seconds != 0 {
+		formatted += fmt.Sprintf("%02d", seconds)
+	}
+	return formatted
+}
+
+var icsTextReplacer = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escapeICSText(s string) string {
+	return icsTextReplacer.Replace(s)
+}
+
+// quoteICSParam quotes a parameter value, which cannot contain double quotes or control characters.
+func quoteICSParam(s string) string {
+	return `"` + strings.Map(func(r rune) rune {
+		if r == '"' || r < ' ' {
+			return -1
+		}
+		return r
+	}, s) + `"`
+}
+
+func getMeetingInviteKey(postID string) string {
+	return meetingInviteKeyPrefix + postID
+}
+
+func (p *Plugin) getMeetingInvite(postID string) (*meetingInvite, error) {
+	data, appErr := p.API.KVGet(getMeetingInviteKey(postID))
+	if appErr != nil {
+		return nil, appErr
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var invite meetingInvite
+	if err := json.Unmarshal(data, &invite); err != nil {
+		return nil, errors.Wrap(err, "cannot decode meeting invite")
+	}
+	return &invite, nil
+}
+
+func (p *Plugin) storeMeetingInvite(postID string, invite *meetingInvite) error {
+	data, err := json.Marshal(invite)
+	if err != nil {
+		return errors.Wrap(err, "cannot encode meeting invite")
+	}
+
+	_, appErr := p.API.KVSetWithOptions(getMeetingInviteKey(postID), data, model.PluginKVSetOptions{
+		ExpireInSeconds: int64(time.Until(invite.End.Add(meetingInviteRetention)).Seconds()),
+	})
+	if appErr != nil {
+		return appErr
+	}
+	return nil
+}
+
+// isEmailAddressShown reports whether the privacy settings of the server show email addresses to
+// all users.
+func (p *Plugin) isEmailAddressShown() bool {
+	config := p.API.GetConfig()
+	return config != nil && config.PrivacySettings.ShowEmailAddress != nil && *config.PrivacySettings.ShowEmailAddress
+}
+
+// uploadMeetingInvite uploads the invite in the timezone of its organizer, to be attached to the
+// meeting post. The attachment can be read by every channel member, so it only holds email
+// addresses when they are shown to all users.
+func (p *Plugin) uploadMeetingInvite(invite *meetingInvite, creator *model.User) (string, error) {
+	info, appErr := p.API.UploadFile(invite.iCalendar(getUserLocation(creator), p.isEmailAddressShown()), invite.ChannelID, meetingInviteFilename)
+	if appErr != nil {
+		return "", appErr
+	}
+	return info.Id, nil
+}
+
+// handleMeetingInvite serves the invite of a meeting post in the timezone of the requesting user.
+// Like user profiles, the invite holds email addresses only when the privacy settings show them,
+// or to system admins.
+func (p *Plugin) handleMeetingInvite(w http.ResponseWriter, r *http.Request, postID string) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		p.API.LogError("handleMeetingInvite, unauthorized user")
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	invite, err := p.getMeetingInvite(postID)
+	if err != nil {
+		p.API.LogError("handleMeetingInvite, failed to get meeting invite", "PostID", postID, "Error", err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if invite == nil || !p.API.HasPermissionToChannel(userID, invite.ChannelID, model.PermissionReadChannel) {
+		http.NotFound(w, r)
+		return
+	}
+
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		p.API.LogError("handleMeetingInvite, failed to get user", "UserID", userID, "Error", appErr.Error())
+		http.Error(w, appErr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+meetingInviteFilename+`"`)
+	showEmailAddresses := p.isEmailAddressShown() || p.API.HasPermissionTo(userID, model.PermissionManageSystem)
+	if _, err := w.Write(invite.iCalendar(getUserLocation(user), showEmailAddresses)); err != nil {
+		p.API.LogWarn("failed to write response", "error", err.Error())
+	}
+}
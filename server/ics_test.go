@@ -0,0 +1,195 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeetingInviteICalendar(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	invite := &meetingInvite{
+		Subject:        "Planning; Q4, budget",
+		JoinURL:        "https://teams.microsoft.com/l/meetup-join/19%3ameeting_abc%40thread.v2/0?context=%7b%22Tid%22%3a%22tenant%22%7d",
+		Start:          time.Date(2026, 10, 25, 0, 30, 0, 0, time.UTC),
+		End:            time.Date(2026, 10, 25, 1, 30, 0, 0, time.UTC),
+		OrganizerName:  `Megan "MB" Bowen`,
+		OrganizerEmail: "megan@example.com",
+		AttendeeEmails: []string{"alex@example.com"},
+	}
+
+	t.Run("User timezone", func(t *testing.T) {
+		ics := string(invite.iCalendar(berlin, true))
+		for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+			require.LessOrEqual(t, len(line), icsLineLength)
+		}
+		unfolded := strings.ReplaceAll(ics, "\r\n ", "")
+
+		// The meeting spans the end of daylight saving time, so both observances are defined.
+		require.Contains(t, unfolded, "BEGIN:VTIMEZONE\r\nTZID:Europe/Berlin\r\n")
+		require.Contains(t, unfolded, "BEGIN:DAYLIGHT\r\nDTSTART:20260329T020000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\nTZNAME:CEST\r\nEND:DAYLIGHT\r\n")
+		require.Contains(t, unfolded, "BEGIN:STANDARD\r\nDTSTART:20261025T030000\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\nTZNAME:CET\r\nEND:STANDARD\r\n")
+		require.Contains(t, unfolded, "DTSTART;TZID=Europe/Berlin:20261025T023000\r\n")
+		require.Contains(t, unfolded, "DTEND;TZID=Europe/Berlin:20261025T023000\r\n")
+
+		require.Contains(t, unfolded, `SUMMARY:Planning\; Q4\, budget`+"\r\n")
+		require.Contains(t, unfolded, "URL:"+invite.JoinURL+"\r\n")
+		require.Contains(t, unfolded, `ORGANIZER;CN="Megan MB Bowen":mailto:megan@example.com`+"\r\n")
+		require.Contains(t, unfolded, "ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION:mailto:alex@example.com\r\n")
+		require.Contains(t, unfolded, "UID:"+invite.uid()+"\r\n")
+	})
+
+	t.Run("UTC", func(t *testing.T) {
+		ics := string(invite.iCalendar(time.UTC, true))
+		require.NotContains(t, ics, "VTIMEZONE")
+		require.Contains(t, ics, "DTSTART:20261025T003000Z\r\n")
+		require.Contains(t, ics, "DTEND:20261025T013000Z\r\n")
+	})
+
+	t.Run("Email addresses hidden", func(t *testing.T) {
+		ics := string(invite.iCalendar(time.UTC, false))
+		require.NotContains(t, ics, "ORGANIZER")
+		require.NotContains(t, ics, "ATTENDEE")
+		require.NotContains(t, ics, "@example.com")
+	})
+}
+
+func TestNewMeetingInvite(t *testing.T) {
+	creator := &model.User{Id: "creatorID", FirstName: "Megan", LastName: "Bowen", Email: "megan@mattermost.example.com"}
+	start := time.Now().Add(24 * time.Hour)
+
+	invite := newMeetingInvite("channelID", creator, &UserInfo{UPN: "megan@example.com"}, []*UserInfo{
+		{UPN: "megan@example.com"},
+		{Email: "alex@example.com", UPN: "alex@tenant.example.com"},
+	}, &OnlineMeeting{JoinURL: "joinURL", StartDateTime: start})
+	require.NotNil(t, invite)
+	require.Equal(t, defaultMeetingSubject, invite.Subject)
+	require.Equal(t, "Megan Bowen", invite.OrganizerName)
+	require.Equal(t, "megan@example.com", invite.OrganizerEmail)
+	require.Equal(t, []string{"alex@example.com"}, invite.AttendeeEmails)
+	require.Equal(t, start.Add(defaultMeetingDuration), invite.End)
+
+	require.Nil(t, newMeetingInvite("channelID", creator, &UserInfo{}, nil, &OnlineMeeting{JoinURL: "joinURL", StartDateTime: time.Now()}))
+}
+
+func TestHandleMeetingInvite(t *testing.T) {
+	postID := model.NewId()
+	invite, err := json.Marshal(&meetingInvite{
+		ChannelID:      "demoChannelID",
+		Subject:        "Planning",
+		JoinURL:        "joinURL",
+		Start:          time.Date(2026, 11, 2, 14, 0, 0, 0, time.UTC),
+		End:            time.Date(2026, 11, 2, 15, 0, 0, 0, time.UTC),
+		OrganizerName:  "Megan Bowen",
+		OrganizerEmail: "megan@example.com",
+		AttendeeEmails: []string{"alex@example.com"},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		userID         string
+		invite         []byte
+		canRead        bool
+		showEmails     bool
+		isAdmin        bool
+		expectedStatus int
+	}{
+		{
+			name:           "Unauthorized user",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Unknown meeting",
+			userID:         "demoUserID",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Not a channel member",
+			userID:         "demoUserID",
+			invite:         invite,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Invite in the user timezone",
+			userID:         "demoUserID",
+			invite:         invite,
+			canRead:        true,
+			showEmails:     true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Email addresses hidden",
+			userID:         "demoUserID",
+			invite:         invite,
+			canRead:        true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Email addresses hidden except to system admins",
+			userID:         "demoUserID",
+			invite:         invite,
+			canRead:        true,
+			isAdmin:        true,
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			defer api.AssertExpectations(t)
+			p := &Plugin{MattermostPlugin: plugin.MattermostPlugin{API: api}}
+
+			if tt.userID == "" {
+				api.On("LogError", "handleMeetingInvite, unauthorized user").Return()
+			} else {
+				api.On("KVGet", "meetinginvite_"+postID).Return(tt.invite, nil)
+			}
+			if tt.invite != nil {
+				api.On("HasPermissionToChannel", "demoUserID", "demoChannelID", model.PermissionReadChannel).Return(tt.canRead)
+			}
+			if tt.canRead {
+				api.On("GetUser", "demoUserID").Return(&model.User{
+					Id:       "demoUserID",
+					Timezone: model.StringMap{"useAutomaticTimezone": "false", "manualTimezone": "America/New_York"},
+				}, nil)
+				api.On("GetConfig").Return(&model.Config{PrivacySettings: model.PrivacySettings{ShowEmailAddress: model.NewPointer(tt.showEmails)}})
+				if !tt.showEmails {
+					api.On("HasPermissionTo", "demoUserID", model.PermissionManageSystem).Return(tt.isAdmin)
+				}
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/meetings/"+postID+"/ics", nil)
+			if tt.userID != "" {
+				r.Header.Set("Mattermost-User-Id", tt.userID)
+			}
+			p.handleMeetingInvite(w, r, postID)
+
+			require.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				require.Equal(t, "text/calendar; charset=utf-8", w.Header().Get("Content-Type"))
+				require.Contains(t, w.Body.String(), "DTSTART;TZID=America/New_York:20261102T090000\r\n")
+				if tt.showEmails || tt.isAdmin {
+					require.Contains(t, w.Body.String(), "ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION:mailto:alex@example.com\r\n")
+				} else {
+					require.NotContains(t, w.Body.String(), "@example.com")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+const (
+	connectedUsersKey = "connectedusers"
+
+	indexUpdateAttempts = 5
+	kvListPerPage       = 1000
+)
+
+// connectedUser is an entry of the index of users with a connected Microsoft account. The
+// token_ keys cannot be listed efficiently, so the index is kept alongside them.
+type connectedUser struct {
+	UserID      string `json:"user_id"`
+	UPN         string `json:"upn"`
+	RemoteID    string `json:"remote_id,omitempty"`
+	ConnectedAt int64  `json:"connected_at"`
+}
+
+// getJSONIndex returns the index stored as a JSON object at key, along with its raw value for a
+// later compare-and-set. A missing key reads as an empty index.
+func getJSONIndex[V any](api plugin.API, key string) (map[string]V, []byte, error) {
+	data, appErr := api.KVGet(key)
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+
+	index := map[string]V{}
+	if data != nil {
+		if err := json.Unmarshal(data, &index); err != nil {
+			return nil, nil, errors.Wrapf(err, "cannot decode %s", key)
+		}
+	}
+	return index, data, nil
+}
+
+// updateJSONIndex applies update to the index stored at key, retrying if another server changed
+// it concurrently. A positive expiry makes the index expire once it is no longer updated.
+func updateJSONIndex[V any](api plugin.API, key string, expiry time.Duration, update func(index map[string]V)) error {
+	for range indexUpdateAttempts {
+		index, oldData, err := getJSONIndex[V](api, key)
+		if err != nil {
+			return err
+		}
+
+		update(index)
+		newData, err := json.Marshal(index)
+		if err != nil {
+			return errors.Wrapf(err, "cannot encode %s", key)
+		}
+
+		var saved bool
+		var appErr *model.AppError
+		if expiry > 0 {
+			saved, appErr = api.KVSetWithOptions(key, newData, model.PluginKVSetOptions{
+				Atomic:          true,
+				OldValue:        oldData,
+				ExpireInSeconds: int64(expiry.Seconds()),
+			})
+		} else {
+			saved, appErr = api.KVCompareAndSet(key, oldData, newData)
+		}
+		if appErr != nil {
+			return appErr
+		}
+		if saved {
+			return nil
+		}
+	}
+	return errors.Errorf("too many concurrent updates of %s", key)
+}
+
+func (p *Plugin) getConnectedUsersIndex() (map[string]*connectedUser, []byte, error) {
+	return getJSONIndex[*connectedUser](p.API, connectedUsersKey)
+}
+
+func (p *Plugin) updateConnectedUsersIndex(update func(index map[string]*connectedUser)) error {
+	return updateJSONIndex(p.API, connectedUsersKey, 0, update)
+}
+
+func (p *Plugin) addConnectedUser(info *UserInfo) error {
+	return p.updateConnectedUsersIndex(func(index map[string]*connectedUser) {
+		index[info.UserID] = &connectedUser{
+			UserID:      info.UserID,
+			UPN:         info.UPN,
+			RemoteID:    info.RemoteID,
+			ConnectedAt: time.Now().UnixMilli(),
+		}
+	})
+}
+
+func (p *Plugin) removeConnectedUser(userID string) error {
+	return p.updateConnectedUsersIndex(func(index map[string]*connectedUser) {
+		delete(index, userID)
+	})
+}
+
+// listConnectedUsers returns the connected users, most recently connected first.
+func (p *Plugin) listConnectedUsers() ([]*connectedUser, error) {
+	index, _, err := p.getConnectedUsersIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]*connectedUser, 0, len(index))
+	for _, user := range index {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].ConnectedAt != users[j].ConnectedAt {
+			return users[i].ConnectedAt > users[j].ConnectedAt
+		}
+		return users[i].UserID < users[j].UserID
+	})
+	return users, nil
+}
+
+// ensureConnectedUsersIndex builds the index from the stored tokens of users who connected
+// before it existed. Their connection date is unknown.
+func (p *Plugin) ensureConnectedUsersIndex() {
+	data, appErr := p.API.KVGet(connectedUsersKey)
+	if appErr != nil || data != nil {
+		return
+	}
+
+	var userIDs []string
+	for page := 0; ; page++ {
+		keys, appErr := p.API.KVList(page, kvListPerPage)
+		if appErr != nil {
+			p.API.LogError("failed to list keys to build the connected users index", "error", appErr.Error())
+			return
+		}
+		for _, key := range keys {
+			if userID, ok := strings.CutPrefix(key, tokenKey); ok {
+				userIDs = append(userIDs, userID)
+			}
+		}
+		if len(keys) < kvListPerPage {
+			break
+		}
+	}
+
+	err := p.updateConnectedUsersIndex(func(index map[string]*connectedUser) {
+		for _, userID := range userIDs {
+			if _, ok := index[userID]; ok {
+				continue
+			}
+			info, err := p.GetUserInfo(userID)
+			if err != nil {
+				continue
+			}
+			index[userID] = &connectedUser{UserID: userID, UPN: info.UPN, RemoteID: info.RemoteID}
+		}
+	})
+	if err != nil {
+		p.API.LogError("failed to build the connected users index", "error", err.Error())
+	}
+}
@@ -6,52 +6,414 @@ package main
 import (
 	"context"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
-	msgraph "github.com/yaegashi/msgraph.go/beta"
 )
 
-func (c *Client) CreateMeeting(creator *UserInfo, attendeesIDs []*UserInfo, subject string) (*msgraph.OnlineMeeting, error) {
-	ctx := context.Background()
-	start := time.Now()
-	end := start.Add(1 * time.Hour)
-	attendees := []msgraph.MeetingParticipantInfo{}
-	if subject == "" {
-		subject = "MS Teams Meeting"
+const (
+	defaultMeetingSubject  = "MS Teams Meeting"
+	defaultMeetingDuration = 1 * time.Hour
+
+	graphDateTimeLayout = "2006-01-02T15:04:05"
+)
+
+// MeetingOptions are the settings of a meeting being created. Zero values use the defaults.
+type MeetingOptions struct {
+	Subject string
+	// TopicTemplate is the subject used when Subject is empty. Its {channel}, {user} and {date}
+	// placeholders are expanded when the meeting is posted.
+	TopicTemplate string
+	// StartDateTime is when the meeting starts. The zero value starts it now.
+	StartDateTime time.Time
+	Duration      time.Duration
+	// LobbyBypassScope is the Microsoft Graph lobby bypass scope, such as "organization".
+	LobbyBypassScope string
+	// InviteChannelMembers controls whether channel members are invited. When unset, only the
+	// members of direct and group messages are invited.
+	InviteChannelMembers *bool
+	// InviteUserIDs are the Mattermost users invited in addition to the channel members.
+	InviteUserIDs []string
+	// ReminderLeadTime is how long before a scheduled meeting its invitees are reminded of it,
+	// zero turning reminders off. When unset, each invitee's setting applies.
+	ReminderLeadTime *time.Duration
+	// CreateCalendarEvent creates the meeting as an event in the organizer's calendar, so that
+	// it shows up in the attendees' calendars too.
+	CreateCalendarEvent bool
+}
+
+// OnlineMeeting is a Microsoft Teams meeting.
+type OnlineMeeting struct {
+	ID            string
+	JoinURL       string
+	Subject       string
+	StartDateTime time.Time
+	EndDateTime   time.Time
+	// Organizer is the display name of the organizer, or their user principal name.
+	Organizer string
+	// EventID is the calendar event of the meeting, if one was created.
+	EventID string
+	// ChatID is the thread ID of the meeting chat. Meetings created as calendar events do not
+	// return it.
+	ChatID string
+	// DialIn is how to join the meeting by phone, if the organizer has audio conferencing.
+	DialIn *DialIn
+}
+
+// DialIn holds the audio conferencing details of a meeting.
+type DialIn struct {
+	TollNumber     string
+	TollFreeNumber string
+	ConferenceID   string
+}
+
+type graphIdentity struct {
+	ID          string `json:"id,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+type graphIdentitySet struct {
+	User *graphIdentity `json:"user,omitempty"`
+}
+
+type graphMeetingParticipantInfo struct {
+	Identity *graphIdentitySet `json:"identity,omitempty"`
+	Upn      string            `json:"upn,omitempty"`
+}
+
+type graphMeetingParticipants struct {
+	Organizer *graphMeetingParticipantInfo  `json:"organizer,omitempty"`
+	Attendees []graphMeetingParticipantInfo `json:"attendees"`
+}
+
+type graphLobbyBypassSettings struct {
+	Scope string `json:"scope,omitempty"`
+}
+
+type graphChatInfo struct {
+	ThreadID string `json:"threadId,omitempty"`
+}
+
+type graphAudioConferencing struct {
+	TollNumber     string `json:"tollNumber,omitempty"`
+	TollFreeNumber string `json:"tollFreeNumber,omitempty"`
+	ConferenceID   string `json:"conferenceId,omitempty"`
+}
+
+type graphOnlineMeeting struct {
+	ID                  string                    `json:"id,omitempty"`
+	JoinWebURL          string                    `json:"joinWebUrl,omitempty"`
+	Subject             string                    `json:"subject,omitempty"`
+	StartDateTime       *time.Time                `json:"startDateTime,omitempty"`
+	EndDateTime         *time.Time                `json:"endDateTime,omitempty"`
+	Participants        *graphMeetingParticipants `json:"participants,omitempty"`
+	LobbyBypassSettings *graphLobbyBypassSettings `json:"lobbyBypassSettings,omitempty"`
+	ChatInfo            *graphChatInfo            `json:"chatInfo,omitempty"`
+	AudioConferencing   *graphAudioConferencing   `json:"audioConferencing,omitempty"`
+}
+
+func (m *graphOnlineMeeting) toOnlineMeeting() *OnlineMeeting {
+	meeting := &OnlineMeeting{
+		ID:      m.ID,
+		JoinURL: m.JoinWebURL,
+		Subject: m.Subject,
 	}
-	for _, attendee := range attendeesIDs {
-		attendees = append(attendees, msgraph.MeetingParticipantInfo{
-			Identity: &msgraph.IdentitySet{
-				User: &msgraph.Identity{
-					ID: &attendee.RemoteID,
-				},
+	if m.StartDateTime != nil {
+		meeting.StartDateTime = *m.StartDateTime
+	}
+	if m.EndDateTime != nil {
+		meeting.EndDateTime = *m.EndDateTime
+	}
+	if m.ChatInfo != nil {
+		meeting.ChatID = m.ChatInfo.ThreadID
+	}
+	if audio := m.AudioConferencing; audio != nil && audio.ConferenceID != "" && (audio.TollNumber != "" || audio.TollFreeNumber != "") {
+		meeting.DialIn = &DialIn{
+			TollNumber:     audio.TollNumber,
+			TollFreeNumber: audio.TollFreeNumber,
+			ConferenceID:   audio.ConferenceID,
+		}
+	}
+	if organizer := m.Participants.getOrganizer(); organizer != nil {
+		meeting.Organizer = organizer.Upn
+		if organizer.Identity != nil && organizer.Identity.User != nil && organizer.Identity.User.DisplayName != "" {
+			meeting.Organizer = organizer.Identity.User.DisplayName
+		}
+	}
+	return meeting
+}
+
+func (p *graphMeetingParticipants) getOrganizer() *graphMeetingParticipantInfo {
+	if p == nil {
+		return nil
+	}
+	return p.Organizer
+}
+
+func newGraphParticipant(info *UserInfo) graphMeetingParticipantInfo {
+	return graphMeetingParticipantInfo{
+		Identity: &graphIdentitySet{
+			User: &graphIdentity{
+				ID: info.RemoteID,
 			},
-			Upn: &attendee.UPN,
-		})
+		},
+		Upn: info.UPN,
+	}
+}
+
+func (c *Client) CreateMeeting(ctx context.Context, creator *UserInfo, attendeesIDs []*UserInfo, options *MeetingOptions) (*OnlineMeeting, error) {
+	if options.CreateCalendarEvent {
+		return c.createMeetingEvent(ctx, creator, attendeesIDs, options)
+	}
+
+	subject, start, end := options.schedule()
+	attendees := []graphMeetingParticipantInfo{}
+	for _, attendee := range attendeesIDs {
+		attendees = append(attendees, newGraphParticipant(attendee))
 	}
 
-	in := msgraph.OnlineMeeting{
+	organizer := newGraphParticipant(creator)
+	in := graphOnlineMeeting{
 		StartDateTime: &start,
 		EndDateTime:   &end,
-		Subject:       &subject,
-		Participants: &msgraph.MeetingParticipants{
-			Organizer: &msgraph.MeetingParticipantInfo{
-				Identity: &msgraph.IdentitySet{
-					User: &msgraph.Identity{
-						ID: &creator.RemoteID,
-					},
-				},
-				Upn: &creator.UPN,
-			},
+		Subject:       subject,
+		Participants: &graphMeetingParticipants{
+			Organizer: &organizer,
 			Attendees: attendees,
 		},
 	}
-	out := msgraph.OnlineMeeting{}
+	if options.LobbyBypassScope != "" {
+		in.LobbyBypassSettings = &graphLobbyBypassSettings{Scope: options.LobbyBypassScope}
+	}
+	out := graphOnlineMeeting{}
 
-	err := c.builder.Users().ID(creator.RemoteID).OnlineMeetings().Request().JSONRequest(ctx, http.MethodPost, "", &in, &out)
+	err := c.do(ctx, http.MethodPost, "/users/"+url.PathEscape(creator.RemoteID)+"/onlineMeetings", nil, &in, &out)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot create meeting")
 	}
-	return &out, nil
+	return out.toOnlineMeeting(), nil
+}
+
+// schedule returns the subject and time span of the meeting, applying the defaults.
+func (o *MeetingOptions) schedule() (subject string, start, end time.Time) {
+	subject = o.Subject
+	if subject == "" {
+		subject = defaultMeetingSubject
+	}
+
+	start = o.StartDateTime
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	duration := o.Duration
+	if duration <= 0 {
+		duration = defaultMeetingDuration
+	}
+	return subject, start, start.Add(duration)
+}
+
+type graphDateTimeTimeZone struct {
+	DateTime string `json:"dateTime"`
+	TimeZone string `json:"timeZone"`
+}
+
+func newGraphDateTime(t time.Time) *graphDateTimeTimeZone {
+	return &graphDateTimeTimeZone{
+		DateTime: t.UTC().Format(graphDateTimeLayout),
+		TimeZone: "UTC",
+	}
+}
+
+func (d *graphDateTimeTimeZone) toTime() time.Time {
+	if d == nil {
+		return time.Time{}
+	}
+	loc, err := time.LoadLocation(d.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	// Graph returns fractional seconds, which the layout accepts when parsing.
+	t, err := time.ParseInLocation(graphDateTimeLayout, d.DateTime, loc)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+type graphEmailAddress struct {
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address"`
+}
+
+type graphRecipient struct {
+	EmailAddress *graphEmailAddress `json:"emailAddress,omitempty"`
+}
+
+type graphAttendee struct {
+	EmailAddress *graphEmailAddress `json:"emailAddress"`
+	Type         string             `json:"type"`
+}
+
+type graphOnlineMeetingInfo struct {
+	JoinURL string `json:"joinUrl,omitempty"`
+}
+
+type graphEvent struct {
+	ID                    string                  `json:"id,omitempty"`
+	Subject               string                  `json:"subject,omitempty"`
+	Start                 *graphDateTimeTimeZone  `json:"start,omitempty"`
+	End                   *graphDateTimeTimeZone  `json:"end,omitempty"`
+	IsAllDay              bool                    `json:"isAllDay,omitempty"`
+	IsCancelled           bool                    `json:"isCancelled,omitempty"`
+	LastModifiedDateTime  *time.Time              `json:"lastModifiedDateTime,omitempty"`
+	Organizer             *graphRecipient         `json:"organizer,omitempty"`
+	Attendees             []graphAttendee         `json:"attendees,omitempty"`
+	IsOnlineMeeting       bool                    `json:"isOnlineMeeting,omitempty"`
+	OnlineMeetingProvider string                  `json:"onlineMeetingProvider,omitempty"`
+	OnlineMeeting         *graphOnlineMeetingInfo `json:"onlineMeeting,omitempty"`
+}
+
+// createMeetingEvent creates a calendar event with a Teams meeting. Graph sends the invitations
+// to the attendees.
+func (c *Client) createMeetingEvent(ctx context.Context, creator *UserInfo, attendeesIDs []*UserInfo, options *MeetingOptions) (*OnlineMeeting, error) {
+	subject, start, end := options.schedule()
+
+	in := graphEvent{
+		Subject:               subject,
+		Start:                 newGraphDateTime(start),
+		End:                   newGraphDateTime(end),
+		IsOnlineMeeting:       true,
+		OnlineMeetingProvider: "teamsForBusiness",
+	}
+	for _, attendee := range attendeesIDs {
+		address := attendee.Email
+		if address == "" {
+			address = attendee.UPN
+		}
+		if address == "" || attendee.RemoteID == creator.RemoteID {
+			continue
+		}
+		in.Attendees = append(in.Attendees, graphAttendee{
+			EmailAddress: &graphEmailAddress{Address: address},
+			Type:         "required",
+		})
+	}
+	out := graphEvent{}
+
+	err := c.do(ctx, http.MethodPost, "/users/"+url.PathEscape(creator.RemoteID)+"/events", nil, &in, &out)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create meeting event")
+	}
+	if out.OnlineMeeting == nil || out.OnlineMeeting.JoinURL == "" {
+		return nil, errors.New("created meeting event has no join URL")
+	}
+
+	meeting := &OnlineMeeting{
+		JoinURL:       out.OnlineMeeting.JoinURL,
+		Subject:       out.Subject,
+		StartDateTime: out.Start.toTime(),
+		EndDateTime:   out.End.toTime(),
+		EventID:       out.ID,
+	}
+
+	// Events do not take meeting settings, so the lobby policy is set on the meeting afterwards.
+	if options.LobbyBypassScope != "" {
+		if err := c.setLobbyBypassScope(ctx, creator, meeting, options.LobbyBypassScope); err != nil {
+			c.api.LogWarn("cannot set the lobby policy of the meeting event", "error", err.Error())
+		}
+	}
+	return meeting, nil
+}
+
+// errMeetingNotFound is returned when the signed-in user has no meeting with a join URL.
+var errMeetingNotFound = errors.New("meeting not found")
+
+// findOnlineMeeting looks up the meeting with the given join URL among the online meetings at
+// path, which only returns the meetings of the signed-in user.
+func (c *Client) findOnlineMeeting(ctx context.Context, path, joinURL string) (*graphOnlineMeeting, error) {
+	var found struct {
+		Value []graphOnlineMeeting `json:"value"`
+	}
+	query := url.Values{"$filter": {"JoinWebUrl eq '" + strings.ReplaceAll(joinURL, "'", "''") + "'"}}
+	if err := c.do(ctx, http.MethodGet, path, query, nil, &found); err != nil {
+		return nil, errors.Wrap(err, "cannot find meeting")
+	}
+	if len(found.Value) == 0 {
+		return nil, errMeetingNotFound
+	}
+	return &found.Value[0], nil
+}
+
+// GetMeetingByJoinURL returns a meeting of the signed-in user from its join URL.
+func (c *Client) GetMeetingByJoinURL(ctx context.Context, joinURL string) (*OnlineMeeting, error) {
+	found, err := c.findOnlineMeeting(ctx, "/me/onlineMeetings", joinURL)
+	if err != nil {
+		return nil, err
+	}
+	return found.toOnlineMeeting(), nil
+}
+
+// EndMeeting ends a meeting of the signed-in user. A meeting created as a calendar event is
+// cancelled, which notifies its attendees, and any other meeting is deleted from its join URL.
+func (c *Client) EndMeeting(ctx context.Context, joinURL, eventID string) error {
+	if eventID != "" {
+		if err := c.do(ctx, http.MethodPost, "/me/events/"+url.PathEscape(eventID)+"/cancel", nil, &struct{}{}, nil); err != nil {
+			return errors.Wrap(err, "cannot cancel meeting event")
+		}
+		return nil
+	}
+
+	found, err := c.findOnlineMeeting(ctx, "/me/onlineMeetings", joinURL)
+	if err != nil {
+		return err
+	}
+	if err := c.do(ctx, http.MethodDelete, "/me/onlineMeetings/"+url.PathEscape(found.ID), nil, nil, nil); err != nil {
+		return errors.Wrap(err, "cannot end meeting")
+	}
+	return nil
+}
+
+// IsMeetingCancelled reports whether a meeting of the signed-in user was cancelled in Teams or
+// Outlook. A meeting created as a calendar event is cancelled along with its event.
+func (c *Client) IsMeetingCancelled(ctx context.Context, joinURL, eventID string) (bool, error) {
+	if eventID == "" {
+		_, err := c.findOnlineMeeting(ctx, "/me/onlineMeetings", joinURL)
+		if errors.Is(err, errMeetingNotFound) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	var event struct {
+		IsCancelled bool `json:"isCancelled"`
+	}
+	query := url.Values{"$select": {"isCancelled"}}
+	err := c.do(ctx, http.MethodGet, "/me/events/"+url.PathEscape(eventID), query, nil, &event)
+	var graphErr *GraphError
+	if errors.As(err, &graphErr) && graphErr.StatusCode == http.StatusNotFound {
+		return true, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "cannot get meeting event")
+	}
+	return event.IsCancelled, nil
+}
+
+func (c *Client) setLobbyBypassScope(ctx context.Context, creator *UserInfo, meeting *OnlineMeeting, scope string) error {
+	path := "/users/" + url.PathEscape(creator.RemoteID) + "/onlineMeetings"
+
+	found, err := c.findOnlineMeeting(ctx, path, meeting.JoinURL)
+	if err != nil {
+		return err
+	}
+	meeting.ID = found.ID
+
+	in := graphOnlineMeeting{LobbyBypassSettings: &graphLobbyBypassSettings{Scope: scope}}
+	if err := c.do(ctx, http.MethodPatch, path+"/"+url.PathEscape(meeting.ID), nil, &in, nil); err != nil {
+		return errors.Wrap(err, "cannot update meeting")
+	}
+	return nil
 }
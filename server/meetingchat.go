@@ -0,0 +1,603 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+)
+
+const (
+	meetingChatsKey              = "meetingchats"
+	meetingChatMessagePrefix     = "meetingchatmessage_"
+	meetingChatJobKey            = "meetingchats"
+	meetingChatInterval          = 5 * time.Minute
+	meetingChatNotificationsPath = "/api/v1/meetingchat/notifications"
+
+	// meetingChatSubscriptionLifetime is how long a Graph subscription lasts before it is renewed.
+	// Subscriptions to chat messages expire after an hour at most.
+	meetingChatSubscriptionLifetime = time.Hour
+	// meetingChatRenewalMargin is how long before its expiry a subscription is renewed. It is
+	// longer than the interval of the job.
+	meetingChatRenewalMargin = 15 * time.Minute
+	// meetingChatGracePeriod is how long after its scheduled end a meeting chat is mirrored, in
+	// case the meeting runs late and the end of the call is missed.
+	meetingChatGracePeriod = 2 * time.Hour
+	// mirroredMessageRetention is how long mirrored messages are remembered, so that notifications
+	// delivered twice are mirrored once.
+	mirroredMessageRetention = 24 * time.Hour
+
+	graphCallEndedEventType = "#microsoft.graph.callEndedEventMessageDetail"
+)
+
+// ChatMessage is a message of a Teams chat.
+type ChatMessage struct {
+	ID string
+	// UserID and UserName identify the Microsoft user who sent the message. They are empty for
+	// messages sent by applications and for system messages.
+	UserID   string
+	UserName string
+	// Text is the content of the message as Markdown.
+	Text string
+	// System is set for the events posted in the chat, such as members joining.
+	System bool
+	// CallEnded is set for the event posted when the meeting call ends.
+	CallEnded bool
+}
+
+type graphItemBody struct {
+	ContentType string `json:"contentType"`
+	Content     string `json:"content"`
+}
+
+type graphEventMessageDetail struct {
+	ODataType string `json:"@odata.type"`
+}
+
+type graphChatMessage struct {
+	ID              string                   `json:"id"`
+	MessageType     string                   `json:"messageType"`
+	DeletedDateTime *time.Time               `json:"deletedDateTime"`
+	From            *graphIdentitySet        `json:"from"`
+	Body            *graphItemBody           `json:"body"`
+	EventDetail     *graphEventMessageDetail `json:"eventDetail"`
+}
+
+// GetChatMessage returns a message of a chat. Deleted messages have no text.
+func (c *Client) GetChatMessage(ctx context.Context, chatID, messageID string) (*ChatMessage, error) {
+	var out graphChatMessage
+	path := "/chats/" + url.PathEscape(chatID) + "/messages/" + url.PathEscape(messageID)
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, &out); err != nil {
+		return nil, errors.Wrap(err, "cannot get chat message")
+	}
+
+	message := &ChatMessage{
+		ID:     out.ID,
+		System: out.MessageType != "message",
+	}
+	if out.EventDetail != nil && out.EventDetail.ODataType == graphCallEndedEventType {
+		message.CallEnded = true
+	}
+	if out.From != nil && out.From.User != nil {
+		message.UserID = out.From.User.ID
+		message.UserName = out.From.User.DisplayName
+	}
+	if out.Body != nil && out.DeletedDateTime == nil {
+		message.Text = escapeMarkdown(out.Body.Content)
+		if out.Body.ContentType == "html" {
+			message.Text = htmlToMarkdown(out.Body.Content)
+		}
+	}
+	return message, nil
+}
+
+// GraphSubscription is a subscription to the change notifications of a Graph resource.
+type GraphSubscription struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+type graphSubscription struct {
+	ID                 string     `json:"id,omitempty"`
+	ChangeType         string     `json:"changeType,omitempty"`
+	NotificationURL    string     `json:"notificationUrl,omitempty"`
+	Resource           string     `json:"resource,omitempty"`
+	ExpirationDateTime *time.Time `json:"expirationDateTime,omitempty"`
+	ClientState        string     `json:"clientState,omitempty"`
+}
+
+// SubscribeToChat asks Graph to notify notificationURL of the messages posted in a chat until
+// expiresAt. Graph validates notificationURL before the subscription is created.
+func (c *Client) SubscribeToChat(ctx context.Context, chatID, notificationURL, clientState string, expiresAt time.Time) (*GraphSubscription, error) {
+	subscription, err := c.createSubscription(ctx, "/chats/"+chatID+"/messages", "created", notificationURL, clientState, expiresAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot subscribe to chat")
+	}
+	return subscription, nil
+}
+
+func (c *Client) createSubscription(ctx context.Context, resource, changeType, notificationURL, clientState string, expiresAt time.Time) (*GraphSubscription, error) {
+	expiresAt = expiresAt.UTC()
+	in := graphSubscription{
+		ChangeType:         changeType,
+		NotificationURL:    notificationURL,
+		Resource:           resource,
+		ExpirationDateTime: &expiresAt,
+		ClientState:        clientState,
+	}
+	var out graphSubscription
+	if err := c.do(ctx, http.MethodPost, "/subscriptions", nil, &in, &out); err != nil {
+		return nil, err
+	}
+
+	subscription := &GraphSubscription{ID: out.ID, ExpiresAt: expiresAt}
+	if out.ExpirationDateTime != nil {
+		subscription.ExpiresAt = *out.ExpirationDateTime
+	}
+	return subscription, nil
+}
+
+// RenewSubscription extends a subscription until expiresAt.
+func (c *Client) RenewSubscription(ctx context.Context, subscriptionID string, expiresAt time.Time) error {
+	expiresAt = expiresAt.UTC()
+	in := graphSubscription{ExpirationDateTime: &expiresAt}
+	if err := c.do(ctx, http.MethodPatch, "/subscriptions/"+url.PathEscape(subscriptionID), nil, &in, nil); err != nil {
+		return errors.Wrap(err, "cannot renew subscription")
+	}
+	return nil
+}
+
+// DeleteSubscription stops the notifications of a subscription.
+func (c *Client) DeleteSubscription(ctx context.Context, subscriptionID string) error {
+	if err := c.do(ctx, http.MethodDelete, "/subscriptions/"+url.PathEscape(subscriptionID), nil, nil, nil); err != nil {
+		return errors.Wrap(err, "cannot delete subscription")
+	}
+	return nil
+}
+
+// markdownEscaper escapes the characters Mattermost renders as Markdown.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"*", `\*`,
+	"_", `\_`,
+	"`", "\\`",
+	"~", `\~`,
+	"[", `\[`,
+	"]", `\]`,
+	"|", `\|`,
+	"#", `\#`,
+	">", `\>`,
+)
+
+// linkEscaper escapes the parentheses that would end the destination of a Markdown link.
+var linkEscaper = strings.NewReplacer("(", "%28", ")", "%29")
+
+// channelMentionRegexp matches the mentions notifying every member of a channel.
+var channelMentionRegexp = regexp.MustCompile(`(?i)@(channel|all|here)\b`)
+
+// escapeMarkdown escapes the text of a Teams message so that it is posted as written, without
+// Markdown formatting or channel-wide mentions.
+func escapeMarkdown(text string) string {
+	return channelMentionRegexp.ReplaceAllString(markdownEscaper.Replace(text), "`@$1`")
+}
+
+// htmlToMarkdown converts the HTML of a Teams message to Markdown, keeping links and emphasis.
+// The text itself is escaped, and only http and https links are kept.
+func htmlToMarkdown(content string) string {
+	root, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return content
+	}
+
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(escapeMarkdown(n.Data))
+			return
+		}
+		if n.Type != html.ElementNode && n.Type != html.DocumentNode {
+			return
+		}
+
+		var prefix, suffix string
+		switch n.Data {
+		case "br":
+			b.WriteString("\n")
+			return
+		case "p", "div":
+			suffix = "\n"
+		case "b", "strong":
+			prefix, suffix = "**", "**"
+		case "i", "em":
+			prefix, suffix = "_", "_"
+		case "a":
+			for _, attr := range n.Attr {
+				if u, err := url.Parse(attr.Val); attr.Key == "href" && err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+					prefix, suffix = "[", "]("+linkEscaper.Replace(u.String())+")"
+				}
+			}
+		case "script", "style":
+			return
+		}
+
+		b.WriteString(prefix)
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		b.WriteString(suffix)
+	}
+	walk(root)
+
+	return strings.TrimSpace(b.String())
+}
+
+// mirroredMeetingChat is an entry of the index of meeting chats mirrored into Mattermost, keyed by
+// the ID of the meeting post.
+type mirroredMeetingChat struct {
+	PostID    string `json:"post_id"`
+	ChannelID string `json:"channel_id"`
+	// RootID is the thread the messages are posted in.
+	RootID    string `json:"root_id"`
+	JoinURL   string `json:"join_url"`
+	CreatorID string `json:"creator_id"`
+	// ChatID is the thread ID of the meeting chat. It is looked up from the join URL when the
+	// meeting was created as a calendar event.
+	ChatID string `json:"chat_id,omitempty"`
+	// ClientState authenticates the notifications of the subscription.
+	ClientState string `json:"client_state"`
+	// SubscriptionID is empty until Graph accepted the subscription.
+	SubscriptionID string `json:"subscription_id,omitempty"`
+	ExpiresAt      int64  `json:"expires_at,omitempty"`
+	// EndAt is when mirroring stops if the end of the call was not notified.
+	EndAt int64 `json:"end_at"`
+}
+
+func (p *Plugin) getMeetingChatsIndex() (map[string]*mirroredMeetingChat, []byte, error) {
+	return getJSONIndex[*mirroredMeetingChat](p.API, meetingChatsKey)
+}
+
+func (p *Plugin) updateMeetingChatsIndex(update func(index map[string]*mirroredMeetingChat)) error {
+	return updateJSONIndex(p.API, meetingChatsKey, 0, update)
+}
+
+func (p *Plugin) getMeetingChatNotificationURL() (string, error) {
+	siteURL, err := p.getSiteURL()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/plugins/%s%s", siteURL, url.PathEscape(manifest.Id), meetingChatNotificationsPath), nil
+}
+
+// startMeetingChatMirror mirrors the chat of a meeting created by the plugin into the thread of
+// its post. The chat is read with the connected account of the creator, so it is not mirrored
+// for the meetings created with application permissions.
+func (p *Plugin) startMeetingChatMirror(post *model.Post, meeting *OnlineMeeting) error {
+	return p.startMeetingChatMirrorWithDeps(post, meeting, p.NewClient)
+}
+
+func (p *Plugin) startMeetingChatMirrorWithDeps(post *model.Post, meeting *OnlineMeeting, newClient ClientFactory) error {
+	rootID := post.RootId
+	if rootID == "" {
+		rootID = post.Id
+	}
+	end := meeting.EndDateTime
+	if end.IsZero() {
+		end = time.Now().Add(defaultMeetingDuration)
+	}
+	chat := &mirroredMeetingChat{
+		PostID:      post.Id,
+		ChannelID:   post.ChannelId,
+		RootID:      rootID,
+		JoinURL:     meeting.JoinURL,
+		CreatorID:   post.UserId,
+		ChatID:      meeting.ChatID,
+		ClientState: model.NewId(),
+		EndAt:       end.Add(meetingChatGracePeriod).UnixMilli(),
+	}
+
+	// The job retries the subscriptions Graph did not accept.
+	if err := p.subscribeToMeetingChat(chat, newClient); err != nil {
+		p.API.LogDebug("startMeetingChatMirror, cannot subscribe to the meeting chat", "PostID", post.Id, "error", err.Error())
+	}
+
+	return p.updateMeetingChatsIndex(func(index map[string]*mirroredMeetingChat) {
+		index[chat.PostID] = chat
+	})
+}
+
+// subscribeToMeetingChat subscribes to the messages of a meeting chat, looking up the chat first
+// if needed.
+func (p *Plugin) subscribeToMeetingChat(chat *mirroredMeetingChat, newClient ClientFactory) error {
+	client, err := p.newUserClient(chat.CreatorID, newClient)
+	if err != nil {
+		return err
+	}
+
+	notificationURL, err := p.getMeetingChatNotificationURL()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.getConfiguration().getRequestTimeout())
+	defer cancel()
+
+	if chat.ChatID == "" {
+		meeting, err := client.GetMeetingByJoinURL(ctx, chat.JoinURL)
+		if err != nil {
+			return err
+		}
+		if meeting.ChatID == "" {
+			return errors.New("meeting has no chat")
+		}
+		chat.ChatID = meeting.ChatID
+	}
+
+	subscription, err := client.SubscribeToChat(ctx, chat.ChatID, notificationURL, chat.ClientState, time.Now().Add(meetingChatSubscriptionLifetime))
+	if err != nil {
+		return err
+	}
+	chat.SubscriptionID = subscription.ID
+	chat.ExpiresAt = subscription.ExpiresAt.UnixMilli()
+	return nil
+}
+
+// stopMeetingChatMirror stops mirroring the chat of a meeting post, if it is mirrored.
+func (p *Plugin) stopMeetingChatMirror(postID string, newClient ClientFactory) error {
+	index, _, err := p.getMeetingChatsIndex()
+	if err != nil {
+		return err
+	}
+	if index[postID] == nil {
+		return nil
+	}
+
+	var stopped *mirroredMeetingChat
+	err = p.updateMeetingChatsIndex(func(index map[string]*mirroredMeetingChat) {
+		stopped = index[postID]
+		delete(index, postID)
+	})
+	if err != nil {
+		return err
+	}
+	if stopped != nil {
+		p.deleteMeetingChatSubscription(stopped, newClient)
+	}
+	return nil
+}
+
+// deleteMeetingChatSubscription deletes the Graph subscription of a chat no longer mirrored. It
+// expires on its own if it cannot be deleted.
+func (p *Plugin) deleteMeetingChatSubscription(chat *mirroredMeetingChat, newClient ClientFactory) {
+	if chat.SubscriptionID == "" {
+		return
+	}
+
+	client, err := p.newUserClient(chat.CreatorID, newClient)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), p.getConfiguration().getRequestTimeout())
+		defer cancel()
+		err = client.DeleteSubscription(ctx, chat.SubscriptionID)
+	}
+	if err != nil {
+		p.API.LogDebug("failed to delete the meeting chat subscription", "PostID", chat.PostID, "error", err.Error())
+	}
+}
+
+// renewMeetingChatSubscriptions renews the subscriptions to the mirrored meeting chats before
+// they expire, retries the ones Graph did not accept and stops mirroring the meetings past their
+// end. It runs on a single server of the cluster.
+func (p *Plugin) renewMeetingChatSubscriptions() {
+	p.renewMeetingChatSubscriptionsWithDeps(p.NewClient)
+}
+
+func (p *Plugin) renewMeetingChatSubscriptionsWithDeps(newClient ClientFactory) {
+	index, _, err := p.getMeetingChatsIndex()
+	if err != nil {
+		p.API.LogError("renewMeetingChatSubscriptions, failed to get the meeting chats index", "error", err.Error())
+		return
+	}
+
+	config := p.getConfiguration()
+	enabled := config != nil && config.EnableMeetingChatMirror && !config.UseApplicationPermissions
+	now := time.Now()
+	for postID, chat := range index {
+		if !enabled || now.UnixMilli() >= chat.EndAt {
+			if err := p.stopMeetingChatMirror(postID, newClient); err != nil {
+				p.API.LogWarn("renewMeetingChatSubscriptions, failed to stop mirroring a meeting chat", "PostID", postID, "error", err.Error())
+			}
+			continue
+		}
+		if chat.SubscriptionID != "" && time.UnixMilli(chat.ExpiresAt).Sub(now) > meetingChatRenewalMargin {
+			continue
+		}
+
+		if err := p.renewMeetingChatSubscription(chat, now, newClient); err != nil {
+			p.API.LogDebug("renewMeetingChatSubscriptions, failed to renew the meeting chat subscription", "PostID", postID, "error", err.Error())
+			continue
+		}
+		err := p.updateMeetingChatsIndex(func(index map[string]*mirroredMeetingChat) {
+			if _, ok := index[postID]; ok {
+				index[postID] = chat
+			}
+		})
+		if err != nil {
+			p.API.LogWarn("renewMeetingChatSubscriptions, failed to update the meeting chats index", "PostID", postID, "error", err.Error())
+		}
+	}
+}
+
+// renewMeetingChatSubscription extends the subscription of a chat, subscribing again if it was
+// never accepted or has expired.
+func (p *Plugin) renewMeetingChatSubscription(chat *mirroredMeetingChat, now time.Time, newClient ClientFactory) error {
+	if chat.SubscriptionID != "" && now.UnixMilli() < chat.ExpiresAt {
+		client, err := p.newUserClient(chat.CreatorID, newClient)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.getConfiguration().getRequestTimeout())
+		defer cancel()
+
+		expiresAt := now.Add(meetingChatSubscriptionLifetime)
+		if err = client.RenewSubscription(ctx, chat.SubscriptionID, expiresAt); err == nil {
+			chat.ExpiresAt = expiresAt.UnixMilli()
+			return nil
+		}
+		p.API.LogDebug("failed to renew the meeting chat subscription, subscribing again", "PostID", chat.PostID, "error", err.Error())
+	}
+
+	chat.SubscriptionID = ""
+	return p.subscribeToMeetingChat(chat, newClient)
+}
+
+type graphChangeNotification struct {
+	SubscriptionID string `json:"subscriptionId"`
+	ClientState    string `json:"clientState"`
+	ResourceData   *struct {
+		ID string `json:"id"`
+	} `json:"resourceData"`
+}
+
+// handleMeetingChatNotifications receives the notifications of the messages posted in mirrored
+// meeting chats. The requests come from Graph, not from Mattermost users, so each notification is
+// authenticated by the client state of its subscription.
+func (p *Plugin) handleMeetingChatNotifications(w http.ResponseWriter, r *http.Request) {
+	p.handleMeetingChatNotificationsWithDeps(w, r, p.NewClient)
+}
+
+func (p *Plugin) handleMeetingChatNotificationsWithDeps(w http.ResponseWriter, r *http.Request, newClient ClientFactory) {
+	// Graph checks that the endpoint answers before creating a subscription.
+	if token := r.URL.Query().Get("validationToken"); token != "" {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(token))
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var notifications struct {
+		Value []graphChangeNotification `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&notifications); err != nil {
+		http.Error(w, "invalid notifications", http.StatusBadRequest)
+		return
+	}
+
+	index, _, err := p.getMeetingChatsIndex()
+	if err != nil {
+		p.API.LogError("handleMeetingChatNotifications, failed to get the meeting chats index", "error", err.Error())
+		http.Error(w, "cannot get meeting chats", http.StatusInternalServerError)
+		return
+	}
+	chats := map[string]*mirroredMeetingChat{}
+	for _, chat := range index {
+		if chat.SubscriptionID != "" {
+			chats[chat.SubscriptionID] = chat
+		}
+	}
+
+	type chatMessage struct {
+		chat      *mirroredMeetingChat
+		messageID string
+	}
+	var messages []chatMessage
+	for _, notification := range notifications.Value {
+		chat := chats[notification.SubscriptionID]
+		if chat == nil || subtle.ConstantTimeCompare([]byte(notification.ClientState), []byte(chat.ClientState)) != 1 {
+			p.API.LogDebug("handleMeetingChatNotifications, ignoring notification of an unknown subscription", "SubscriptionID", notification.SubscriptionID)
+			continue
+		}
+		if notification.ResourceData == nil || notification.ResourceData.ID == "" {
+			continue
+		}
+		messages = append(messages, chatMessage{chat: chat, messageID: notification.ResourceData.ID})
+	}
+
+	// Graph expects an answer within a few seconds, so the messages are mirrored afterwards.
+	w.WriteHeader(http.StatusAccepted)
+	if len(messages) == 0 {
+		return
+	}
+
+	p.meetingChatMirrors.Add(1)
+	go func() {
+		defer p.meetingChatMirrors.Done()
+		for _, message := range messages {
+			ctx, cancel := context.WithTimeout(context.Background(), p.getConfiguration().getRequestTimeout())
+			err := p.mirrorChatMessage(ctx, message.chat, message.messageID, newClient)
+			cancel()
+			if err != nil {
+				p.API.LogWarn("handleMeetingChatNotifications, failed to mirror chat message", "PostID", message.chat.PostID, "error", err.Error())
+			}
+		}
+	}()
+}
+
+// mirrorChatMessage posts a message of a meeting chat in the thread of the meeting post, as the
+// Mattermost user connected to the sender's Microsoft account if they can post in the channel,
+// or else as the bot on their behalf.
+func (p *Plugin) mirrorChatMessage(ctx context.Context, chat *mirroredMeetingChat, messageID string, newClient ClientFactory) error {
+	client, err := p.newUserClient(chat.CreatorID, newClient)
+	if err != nil {
+		return err
+	}
+
+	message, err := client.GetChatMessage(ctx, chat.ChatID, messageID)
+	if err != nil {
+		return err
+	}
+	if message.CallEnded {
+		return p.stopMeetingChatMirror(chat.PostID, newClient)
+	}
+	if message.System || message.Text == "" {
+		return nil
+	}
+
+	// Graph may deliver a notification more than once.
+	firstDelivery, appErr := p.API.KVSetWithOptions(meetingChatMessagePrefix+chat.PostID+"_"+message.ID, []byte{1}, model.PluginKVSetOptions{
+		Atomic:          true,
+		OldValue:        nil,
+		ExpireInSeconds: int64(mirroredMessageRetention.Seconds()),
+	})
+	if appErr != nil {
+		return appErr
+	}
+	if !firstDelivery {
+		return nil
+	}
+
+	post := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: chat.ChannelID,
+		RootId:    chat.RootID,
+		Message:   message.Text,
+		Props: model.StringInterface{
+			"from_mstmeetings_chat": true,
+		},
+	}
+	if sender, err := p.getUserInfoByRemoteID(message.UserID); err == nil && p.API.HasPermissionToChannel(sender.UserID, chat.ChannelID, model.PermissionCreatePost) {
+		post.UserId = sender.UserID
+	} else if message.UserName != "" {
+		post.Message = fmt.Sprintf("**%s:** %s", escapeMarkdown(message.UserName), message.Text)
+	}
+
+	if _, appErr = p.API.CreatePost(post); appErr != nil {
+		return appErr
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTMLToMarkdown(t *testing.T) {
+	tests := map[string]string{
+		"plain text":                                "plain text",
+		"<p>Hello <b>team</b></p>":                  "Hello **team**",
+		"<div>line one<br>line two</div>":           "line one\nline two",
+		`<p>See <a href="https://x.y">this</a></p>`: "See [this](https://x.y)",
+		"<p>&lt;tag&gt; &amp; <em>more</em></p>":    `<tag\> & _more_`,
+		"<p>*bold* [x](y) @channel @All</p>":        `\*bold\* \[x\](y) ` + "`@channel` `@All`",
+		`<a href="javascript:alert(1)">click</a>`:   "click",
+		`<a href="https://x.y/a_(b)">link</a>`:      "[link](https://x.y/a_%28b%29)",
+	}
+	for content, expected := range tests {
+		require.Equal(t, expected, htmlToMarkdown(content), content)
+	}
+}
+
+func TestStartMeetingChatMirror(t *testing.T) {
+	api := &plugintest.API{}
+	defer api.AssertExpectations(t)
+	mockClient := &MockClient{}
+	defer mockClient.AssertExpectations(t)
+	p := SetupMockPlugin(api, nil, nil)
+	p.setConfiguration(&configuration{EncryptionKey: "demo_encrypt_key", EnableMeetingChatMirror: true})
+	setupConnectedDemoUser(t, api)
+
+	end := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	mockClient.On("SubscribeToChat", "19:meeting@thread.v2", "https://example.com/plugins/"+manifest.Id+meetingChatNotificationsPath, mock.Anything, mock.Anything).
+		Return(&GraphSubscription{ID: "subscriptionID", ExpiresAt: expiresAt}, nil)
+	api.On("KVGet", "meetingchats").Return(nil, nil)
+	api.On("KVCompareAndSet", "meetingchats", []byte(nil), mock.MatchedBy(func(data []byte) bool {
+		var index map[string]*mirroredMeetingChat
+		require.NoError(t, json.Unmarshal(data, &index))
+		chat := index["postID"]
+		return chat != nil &&
+			chat.RootID == "postID" &&
+			chat.ChatID == "19:meeting@thread.v2" &&
+			chat.SubscriptionID == "subscriptionID" &&
+			chat.ClientState != "" &&
+			chat.ExpiresAt == expiresAt.UnixMilli() &&
+			chat.EndAt == end.Add(meetingChatGracePeriod).UnixMilli()
+	})).Return(true, nil)
+
+	post := &model.Post{Id: "postID", ChannelId: "channelID", UserId: "demoUserID"}
+	meeting := &OnlineMeeting{JoinURL: "joinURL", ChatID: "19:meeting@thread.v2", EndDateTime: end}
+	require.NoError(t, p.startMeetingChatMirrorWithDeps(post, meeting, mockClientFactory(mockClient)))
+}
+
+func TestHandleMeetingChatNotifications(t *testing.T) {
+	chat := &mirroredMeetingChat{
+		PostID:         "postID",
+		ChannelID:      "channelID",
+		RootID:         "rootID",
+		CreatorID:      "demoUserID",
+		ChatID:         "chatID",
+		ClientState:    "secret",
+		SubscriptionID: "subscriptionID",
+		EndAt:          time.Now().Add(time.Hour).UnixMilli(),
+	}
+	index, err := json.Marshal(map[string]*mirroredMeetingChat{"postID": chat})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		clientState   string
+		message       *ChatMessage
+		expectedCalls func(t *testing.T, api *plugintest.API, mockClient *MockClient)
+	}{
+		{
+			name:        "Unknown client state",
+			clientState: "forged",
+			expectedCalls: func(_ *testing.T, api *plugintest.API, _ *MockClient) {
+				api.On("LogDebug", mock.Anything, "SubscriptionID", "subscriptionID")
+			},
+		},
+		{
+			name:        "Message of a connected user",
+			clientState: "secret",
+			message:     &ChatMessage{ID: "messageID", UserID: "senderRemoteID", UserName: "Jane Doe", Text: "Hello"},
+			expectedCalls: func(t *testing.T, api *plugintest.API, _ *MockClient) {
+				sender, err := (&UserInfo{UserID: "senderUserID", RemoteID: "senderRemoteID"}).EncryptedJSON([]byte("demo_encrypt_key"))
+				require.NoError(t, err)
+				api.On("KVGet", "tbyrid_senderRemoteID").Return(sender, nil)
+				api.On("HasPermissionToChannel", "senderUserID", "channelID", model.PermissionCreatePost).Return(true)
+				api.On("KVSetWithOptions", "meetingchatmessage_postID_messageID", []byte{1}, mock.Anything).Return(true, nil)
+				api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+					return post.UserId == "senderUserID" && post.ChannelId == "channelID" && post.RootId == "rootID" && post.Message == "Hello"
+				})).Return(&model.Post{}, nil)
+			},
+		},
+		{
+			name:        "Message of a connected user who cannot post in the channel",
+			clientState: "secret",
+			message:     &ChatMessage{ID: "messageID", UserID: "senderRemoteID", UserName: "Jane Doe", Text: "Hello"},
+			expectedCalls: func(t *testing.T, api *plugintest.API, _ *MockClient) {
+				sender, err := (&UserInfo{UserID: "senderUserID", RemoteID: "senderRemoteID"}).EncryptedJSON([]byte("demo_encrypt_key"))
+				require.NoError(t, err)
+				api.On("KVGet", "tbyrid_senderRemoteID").Return(sender, nil)
+				api.On("HasPermissionToChannel", "senderUserID", "channelID", model.PermissionCreatePost).Return(false)
+				api.On("KVSetWithOptions", "meetingchatmessage_postID_messageID", []byte{1}, mock.Anything).Return(true, nil)
+				api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+					return post.UserId == "botUserID" && post.Message == "**Jane Doe:** Hello"
+				})).Return(&model.Post{}, nil)
+			},
+		},
+		{
+			name:        "Message of a user who is not connected",
+			clientState: "secret",
+			message:     &ChatMessage{ID: "messageID", UserID: "guestRemoteID", UserName: "Guest", Text: "Hi"},
+			expectedCalls: func(_ *testing.T, api *plugintest.API, _ *MockClient) {
+				api.On("KVGet", "tbyrid_guestRemoteID").Return(nil, nil)
+				api.On("KVSetWithOptions", "meetingchatmessage_postID_messageID", []byte{1}, mock.Anything).Return(true, nil)
+				api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+					return post.UserId == "botUserID" && post.Message == "**Guest:** Hi"
+				})).Return(&model.Post{}, nil)
+			},
+		},
+		{
+			name:        "Message already mirrored",
+			clientState: "secret",
+			message:     &ChatMessage{ID: "messageID", UserID: "senderRemoteID", Text: "Hello"},
+			expectedCalls: func(_ *testing.T, api *plugintest.API, _ *MockClient) {
+				api.On("KVSetWithOptions", "meetingchatmessage_postID_messageID", []byte{1}, mock.Anything).Return(false, nil)
+			},
+		},
+		{
+			name:          "System message",
+			clientState:   "secret",
+			message:       &ChatMessage{ID: "messageID", System: true},
+			expectedCalls: func(_ *testing.T, _ *plugintest.API, _ *MockClient) {},
+		},
+		{
+			name:        "Call ended",
+			clientState: "secret",
+			message:     &ChatMessage{ID: "messageID", System: true, CallEnded: true},
+			expectedCalls: func(_ *testing.T, api *plugintest.API, mockClient *MockClient) {
+				api.On("KVCompareAndSet", "meetingchats", index, []byte(`{}`)).Return(true, nil)
+				mockClient.On("DeleteSubscription", "subscriptionID").Return(nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			defer api.AssertExpectations(t)
+			mockClient := &MockClient{}
+			defer mockClient.AssertExpectations(t)
+			p := SetupMockPlugin(api, nil, nil)
+			p.botUserID = "botUserID"
+			p.setConfiguration(&configuration{EncryptionKey: "demo_encrypt_key", EnableMeetingChatMirror: true})
+
+			api.On("KVGet", "meetingchats").Return(index, nil)
+			if tt.message != nil {
+				setupConnectedDemoUser(t, api)
+				mockClient.On("GetChatMessage", "chatID", "messageID").Return(tt.message, nil)
+			}
+			tt.expectedCalls(t, api, mockClient)
+
+			body := []byte(`{"value": [{"subscriptionId": "subscriptionID", "clientState": "` + tt.clientState + `", "changeType": "created", "resourceData": {"id": "messageID"}}]}`)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, meetingChatNotificationsPath, bytes.NewReader(body))
+			p.handleMeetingChatNotificationsWithDeps(w, r, mockClientFactory(mockClient))
+			p.meetingChatMirrors.Wait()
+
+			require.Equal(t, http.StatusAccepted, w.Code)
+		})
+	}
+}
+
+func TestHandleMeetingChatNotificationsValidation(t *testing.T) {
+	p := SetupMockPlugin(&plugintest.API{}, nil, nil)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, meetingChatNotificationsPath+"?validationToken=abc%20def", nil)
+	p.handleMeetingChatNotifications(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+	require.Equal(t, "abc def", w.Body.String())
+}
+
+func TestRenewMeetingChatSubscriptions(t *testing.T) {
+	api := &plugintest.API{}
+	defer api.AssertExpectations(t)
+	mockClient := &MockClient{}
+	defer mockClient.AssertExpectations(t)
+	p := SetupMockPlugin(api, nil, nil)
+	p.setConfiguration(&configuration{EncryptionKey: "demo_encrypt_key", EnableMeetingChatMirror: true})
+	setupConnectedDemoUser(t, api)
+
+	now := time.Now()
+	stored, err := json.Marshal(map[string]*mirroredMeetingChat{
+		"expiringPostID": {PostID: "expiringPostID", CreatorID: "demoUserID", SubscriptionID: "expiringID", ExpiresAt: now.Add(5 * time.Minute).UnixMilli(), EndAt: now.Add(time.Hour).UnixMilli()},
+		"freshPostID":    {PostID: "freshPostID", CreatorID: "demoUserID", SubscriptionID: "freshID", ExpiresAt: now.Add(50 * time.Minute).UnixMilli(), EndAt: now.Add(time.Hour).UnixMilli()},
+		"endedPostID":    {PostID: "endedPostID", CreatorID: "demoUserID", SubscriptionID: "endedID", ExpiresAt: now.Add(50 * time.Minute).UnixMilli(), EndAt: now.Add(-time.Minute).UnixMilli()},
+	})
+	require.NoError(t, err)
+
+	api.On("KVGet", "meetingchats").Return(stored, nil)
+	api.On("KVCompareAndSet", "meetingchats", stored, mock.MatchedBy(func(data []byte) bool {
+		var index map[string]*mirroredMeetingChat
+		require.NoError(t, json.Unmarshal(data, &index))
+		return index["endedPostID"] == nil || index["expiringPostID"].ExpiresAt > now.Add(meetingChatRenewalMargin).UnixMilli()
+	})).Return(true, nil)
+	mockClient.On("RenewSubscription", "expiringID", mock.Anything).Return(nil)
+	mockClient.On("DeleteSubscription", "endedID").Return(nil)
+
+	p.renewMeetingChatSubscriptionsWithDeps(mockClientFactory(mockClient))
+}
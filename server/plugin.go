@@ -4,14 +4,18 @@
 package main
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
 	"github.com/mattermost/mattermost/server/public/pluginapi"
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
 	"github.com/mattermost/mattermost/server/public/pluginapi/experimental/telemetry"
+	"github.com/mattermost/mattermost/server/public/pluginapi/i18n"
 	"github.com/pkg/errors"
 )
 
@@ -37,6 +41,32 @@ type Plugin struct {
 
 	telemetryClient telemetry.Client
 	tracker         telemetry.Tracker
+
+	// i18nBundle holds the translations of the messages shown to users.
+	i18nBundle *i18n.Bundle
+
+	// presenceSyncJob polls the Teams presence of connected users.
+	presenceSyncJob *cluster.Job
+
+	// meetingReminderJob sends the reminders of scheduled meetings.
+	meetingReminderJob *cluster.Job
+
+	// agendaJob sends the daily agenda of the users who opted in.
+	agendaJob *cluster.Job
+	// calendarSubscriptionJob announces the meetings of the subscribed calendars.
+	calendarSubscriptionJob *cluster.Job
+	// meetingChatJob renews the subscriptions to the mirrored meeting chats.
+	meetingChatJob *cluster.Job
+	// webinarJob reports the registrations of upcoming webinars.
+	webinarJob *cluster.Job
+	// meetingChatMirrors tracks the meeting chat messages being mirrored in the background.
+	meetingChatMirrors sync.WaitGroup
+	// calendarNotificationSyncs tracks the calendars being synced in the background after a
+	// change notification.
+	calendarNotificationSyncs sync.WaitGroup
+
+	// graphRetries counts the Microsoft Graph requests retried after throttling or transient errors.
+	graphRetries atomic.Int64
 }
 
 // OnActivate checks if the configurations is valid and ensures the bot account exists
@@ -67,6 +97,11 @@ func (p *Plugin) OnActivate() error {
 		return errors.Wrap(err, "couldn't get bundle path")
 	}
 
+	p.i18nBundle, err = i18n.InitBundle(p.API, i18nPath)
+	if err != nil {
+		return errors.Wrap(err, "couldn't load translations")
+	}
+
 	if err = p.API.RegisterCommand(getCommand(pluginAPIClient)); err != nil {
 		return errors.WithMessage(err, "OnActivate: failed to register command")
 	}
@@ -80,6 +115,38 @@ func (p *Plugin) OnActivate() error {
 		return errors.Wrap(appErr, "couldn't set profile image")
 	}
 
+	go p.ensureConnectedUsersIndex()
+
+	p.presenceSyncJob, err = cluster.Schedule(p.API, presenceSyncJobKey, cluster.MakeWaitForInterval(presenceSyncInterval), p.syncPresence)
+	if err != nil {
+		return errors.Wrap(err, "failed to schedule the presence sync job")
+	}
+
+	p.meetingReminderJob, err = cluster.Schedule(p.API, meetingReminderJobKey, cluster.MakeWaitForInterval(meetingReminderInterval), p.sendMeetingReminders)
+	if err != nil {
+		return errors.Wrap(err, "failed to schedule the meeting reminder job")
+	}
+
+	p.agendaJob, err = cluster.Schedule(p.API, agendaJobKey, cluster.MakeWaitForInterval(agendaInterval), p.sendDailyAgendas)
+	if err != nil {
+		return errors.Wrap(err, "failed to schedule the daily agenda job")
+	}
+
+	p.calendarSubscriptionJob, err = cluster.Schedule(p.API, calendarSubscriptionJobKey, cluster.MakeWaitForInterval(calendarSubscriptionInterval), p.syncCalendarSubscriptions)
+	if err != nil {
+		return errors.Wrap(err, "failed to schedule the calendar subscription job")
+	}
+
+	p.meetingChatJob, err = cluster.Schedule(p.API, meetingChatJobKey, cluster.MakeWaitForInterval(meetingChatInterval), p.renewMeetingChatSubscriptions)
+	if err != nil {
+		return errors.Wrap(err, "failed to schedule the meeting chat job")
+	}
+
+	p.webinarJob, err = cluster.Schedule(p.API, webinarJobKey, cluster.MakeWaitForInterval(webinarReportInterval), p.reportWebinarRegistrations)
+	if err != nil {
+		return errors.Wrap(err, "failed to schedule the webinar job")
+	}
+
 	p.telemetryClient, err = telemetry.NewRudderClient()
 	if err != nil {
 		p.API.LogWarn("telemetry client not started", "error", err.Error())
@@ -88,7 +155,86 @@ func (p *Plugin) OnActivate() error {
 	return nil
 }
 
+// UserHasBeenDeactivated removes the stored connection of deactivated users. Deleting a user
+// through the API deactivates them first, so this also covers user deletion.
+func (p *Plugin) UserHasBeenDeactivated(_ *plugin.Context, user *model.User) {
+	if _, err := p.GetUserInfo(user.Id); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.getConfiguration().getRequestTimeout())
+	defer cancel()
+
+	if err := p.disconnect(ctx, user.Id, p.NewClient); err != nil {
+		p.API.LogWarn("UserHasBeenDeactivated, failed to remove user connection", "UserID", user.Id, "error", err.Error())
+		return
+	}
+	p.API.LogInfo("Removed the Microsoft account connection of a deactivated user", "UserID", user.Id)
+}
+
+// MessageHasBeenPosted turns shared meeting links into meeting cards, and records the meetings
+// posted by other meeting plugins and the shared meeting links for the recent meeting check.
+//
+// Links are unfurled here rather than in MessageWillBePosted, which holds the post of the user
+// until it returns: looking the meeting up in Microsoft Graph takes up to unfurlTimeout and
+// would delay every post sharing a Teams link, and a slow or failed lookup must not hold up or
+// drop the post. The card replaces the plain link once it is known.
+func (p *Plugin) MessageHasBeenPosted(_ *plugin.Context, post *model.Post) {
+	p.messageHasBeenPostedWithDeps(post, p.NewClient)
+}
+
+func (p *Plugin) messageHasBeenPostedWithDeps(post *model.Post, newClient ClientFactory) {
+	if unfurled := p.unfurlMeetingLinkWithDeps(post, newClient); unfurled != nil {
+		updated, appErr := p.API.UpdatePost(unfurled)
+		if appErr != nil {
+			p.API.LogWarn("failed to turn the shared meeting link into a meeting card", "PostID", post.Id, "error", appErr.Error())
+		} else {
+			post = updated
+		}
+	}
+	p.recordMeetingPost(post)
+}
+
 func (p *Plugin) OnDeactivate() error {
+	if p.presenceSyncJob != nil {
+		if err := p.presenceSyncJob.Close(); err != nil {
+			p.API.LogWarn("OnDeactivate: failed to close the presence sync job", "error", err.Error())
+		}
+	}
+
+	if p.meetingReminderJob != nil {
+		if err := p.meetingReminderJob.Close(); err != nil {
+			p.API.LogWarn("OnDeactivate: failed to close the meeting reminder job", "error", err.Error())
+		}
+	}
+
+	if p.agendaJob != nil {
+		if err := p.agendaJob.Close(); err != nil {
+			p.API.LogWarn("OnDeactivate: failed to close the daily agenda job", "error", err.Error())
+		}
+	}
+
+	if p.calendarSubscriptionJob != nil {
+		if err := p.calendarSubscriptionJob.Close(); err != nil {
+			p.API.LogWarn("OnDeactivate: failed to close the calendar subscription job", "error", err.Error())
+		}
+	}
+
+	if p.meetingChatJob != nil {
+		if err := p.meetingChatJob.Close(); err != nil {
+			p.API.LogWarn("OnDeactivate: failed to close the meeting chat job", "error", err.Error())
+		}
+	}
+
+	if p.webinarJob != nil {
+		if err := p.webinarJob.Close(); err != nil {
+			p.API.LogWarn("OnDeactivate: failed to close the webinar job", "error", err.Error())
+		}
+	}
+
+	p.meetingChatMirrors.Wait()
+	p.calendarNotificationSyncs.Wait()
+
 	if p.telemetryClient != nil {
 		err := p.telemetryClient.Close()
 		if err != nil {
@@ -4,44 +4,77 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"time"
 
 	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/i18n"
 	"github.com/pkg/errors"
-	msgraph "github.com/yaegashi/msgraph.go/beta"
 )
 
-func (p *Plugin) postMeetingWithDeps(creator *model.User, channelID string, topic string, client ClientInterface, userInfo *UserInfo) (*model.Post, *msgraph.OnlineMeeting, error) {
+const (
+	channelMembersPerPage = 100
+	// maxInvitees bounds the attendees of a meeting, as each of them is looked up before the
+	// meeting is created and remembered for its reminders.
+	maxInvitees = 250
+)
+
+// errTooManyInvitees is returned when a meeting would invite more than maxInvitees users.
+var errTooManyInvitees = errors.Errorf("a meeting cannot invite more than %d users", maxInvitees)
+
+func (p *Plugin) postMeetingWithDeps(ctx context.Context, creator *model.User, channelID, rootID string, options *MeetingOptions, client ClientInterface, userInfo *UserInfo) (*model.Post, *OnlineMeeting, error) {
 	if !p.API.HasPermissionToChannel(creator.Id, channelID, model.PermissionCreatePost) {
 		return nil, nil, errors.New("cannot create post in this channel")
 	}
 
-	attendees := []*UserInfo{}
-
 	channel, appErr := p.API.GetChannel(channelID)
 	if appErr != nil {
 		return nil, nil, appErr
 	}
 
-	if channel.IsGroupOrDirect() {
-		var members model.ChannelMembers
-		members, appErr = p.API.GetChannelMembers(channelID, 0, 100)
-		if appErr != nil {
-			return nil, nil, appErr
+	inviteMembers := channel.IsGroupOrDirect()
+	if options.InviteChannelMembers != nil {
+		inviteMembers = *options.InviteChannelMembers
+	}
+
+	attendeeIDs := []string{}
+	if inviteMembers {
+		memberIDs, err := p.getChannelMemberIDs(channelID)
+		if err != nil {
+			return nil, nil, err
 		}
-		if members == nil {
-			return nil, nil, errors.New("returned members is nil")
+		attendeeIDs = append(attendeeIDs, memberIDs...)
+	}
+	attendeeIDs = append(attendeeIDs, options.InviteUserIDs...)
+
+	invited := map[string]bool{}
+	uniqueAttendeeIDs := []string{}
+	for _, attendeeID := range attendeeIDs {
+		if !invited[attendeeID] {
+			invited[attendeeID] = true
+			uniqueAttendeeIDs = append(uniqueAttendeeIDs, attendeeID)
 		}
-		for _, member := range members {
-			attendeeInfo, err := p.GetUserInfo(member.UserId)
-			if err != nil {
-				continue
-			}
-			attendees = append(attendees, attendeeInfo)
+	}
+	attendeeIDs = uniqueAttendeeIDs
+	if len(attendeeIDs) > maxInvitees {
+		return nil, nil, errTooManyInvitees
+	}
+
+	attendees := []*UserInfo{}
+	for _, attendeeID := range attendeeIDs {
+		attendeeInfo, err := p.getAttendeeInfo(ctx, client, attendeeID)
+		if err != nil {
+			continue
 		}
+		attendees = append(attendees, attendeeInfo)
 	}
 
-	meeting, err := client.CreateMeeting(userInfo, attendees, topic)
+	meetingOptions := *options
+	if meetingOptions.Subject == "" {
+		meetingOptions.Subject = expandTopicTemplate(options.TopicTemplate, channel, creator)
+	}
+
+	meeting, err := client.CreateMeeting(ctx, userInfo, attendees, &meetingOptions)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -49,34 +82,172 @@ func (p *Plugin) postMeetingWithDeps(creator *model.User, channelID string, topi
 	post := &model.Post{
 		UserId:    creator.Id,
 		ChannelId: channelID,
-		Message:   fmt.Sprintf("Meeting started at [this link](%s).", *meeting.JoinURL),
+		RootId:    rootID,
+		Message:   p.getMeetingMessage(creator, meeting),
 		Type:      "custom_mstmeetings",
 		Props: map[string]interface{}{
-			"meeting_link":             *meeting.JoinURL,
+			"meeting_link":             meeting.JoinURL,
 			"meeting_status":           postTypeStarted,
 			"meeting_personal":         true,
-			"meeting_topic":            topic,
+			"meeting_topic":            meetingOptions.Subject,
 			"meeting_creator_username": creator.Username,
 			"meeting_provider":         msteamsProviderName,
 		},
 	}
+	if meeting.EventID != "" {
+		post.AddProp("meeting_event_id", meeting.EventID)
+	}
+
+	invite := newMeetingInvite(channelID, creator, userInfo, attendees, meeting)
+	if invite != nil {
+		fileID, err := p.uploadMeetingInvite(invite, creator)
+		if err != nil {
+			p.API.LogWarn("failed to upload meeting invite", "ChannelID", channelID, "error", err.Error())
+		} else {
+			post.FileIds = model.StringArray{fileID}
+		}
+	}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+		Actions: p.newMeetingActions(p.getUserLocalizer(creator.Id), meeting, invite != nil),
+	}})
 
 	post, appErr = p.API.CreatePost(post)
 	if appErr != nil {
 		return nil, nil, appErr
 	}
 
+	if invite != nil {
+		if err = p.storeMeetingInvite(post.Id, invite); err != nil {
+			p.API.LogWarn("failed to store meeting invite", "PostID", post.Id, "error", err.Error())
+		}
+
+		inviteeIDs := append([]string{creator.Id}, attendeeIDs...)
+		if err = p.scheduleMeetingReminders(post, meeting, inviteeIDs, options.ReminderLeadTime); err != nil {
+			p.API.LogWarn("failed to schedule meeting reminders", "PostID", post.Id, "error", err.Error())
+		}
+	}
+
+	if config := p.getConfiguration(); config != nil && config.EnableMeetingChatMirror && !config.UseApplicationPermissions {
+		if err = p.startMeetingChatMirror(post, meeting); err != nil {
+			p.API.LogWarn("failed to mirror the meeting chat", "PostID", post.Id, "error", err.Error())
+		}
+	}
+
+	err = p.recordActiveMeeting(channelID, &activeMeeting{
+		PostID:          post.Id,
+		RootID:          rootID,
+		Link:            meeting.JoinURL,
+		CreatorUsername: creator.Username,
+		Provider:        msteamsProviderName,
+		CreateAt:        post.CreateAt,
+	})
+	if err != nil {
+		p.API.LogWarn("failed to record active meeting", "ChannelID", channelID, "error", err.Error())
+	}
+
 	return post, meeting, nil
 }
 
-func (p *Plugin) postConfirmCreateOrJoin(meetingURL string, channelID string, topic string, userID string, creatorName string, provider string) *model.Post {
-	message := "There is another recent meeting created on this channel."
+// getChannelMemberIDs returns the IDs of every member of a channel, or errTooManyInvitees when
+// they are more than can be invited.
+func (p *Plugin) getChannelMemberIDs(channelID string) ([]string, error) {
+	var memberIDs []string
+	for page := 0; ; page++ {
+		members, appErr := p.API.GetChannelMembers(channelID, page, channelMembersPerPage)
+		if appErr != nil {
+			return nil, appErr
+		}
+		if members == nil {
+			return nil, errors.New("returned members is nil")
+		}
+		for _, member := range members {
+			memberIDs = append(memberIDs, member.UserId)
+		}
+		if len(memberIDs) > maxInvitees {
+			return nil, errTooManyInvitees
+		}
+		if len(members) < channelMembersPerPage {
+			return memberIDs, nil
+		}
+	}
+}
+
+// getThreadRootID checks that a post belongs to a channel and returns the root of its thread, so
+// that meetings started from a reply go into the same thread.
+func (p *Plugin) getThreadRootID(channelID, postID string) (string, error) {
+	if postID == "" {
+		return "", nil
+	}
+	if !model.IsValidId(postID) {
+		return "", errors.New("invalid root post id")
+	}
+
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil {
+		return "", appErr
+	}
+	if post.ChannelId != channelID {
+		return "", errors.New("root post is not in the channel")
+	}
+	if post.RootId != "" {
+		return post.RootId, nil
+	}
+	return post.Id, nil
+}
+
+// getMeetingMessage describes a meeting that just started, or when a scheduled meeting starts in
+// the timezone of its creator.
+func (p *Plugin) getMeetingMessage(creator *model.User, meeting *OnlineMeeting) string {
+	l := p.getUserLocalizer(creator.Id)
+	if !meeting.StartDateTime.After(time.Now().Add(time.Minute)) {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.meeting.started",
+			Other: "Meeting started at [this link]({{.JoinURL}}).",
+		}, map[string]any{"JoinURL": meeting.JoinURL})
+	}
+
+	return p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.meeting.scheduled",
+		Other: "Meeting scheduled for {{.StartTime}} at [this link]({{.JoinURL}}).",
+	}, map[string]any{
+		"StartTime": meeting.StartDateTime.In(getUserLocation(creator)).Format("2006-01-02 15:04 MST"),
+		"JoinURL":   meeting.JoinURL,
+	})
+}
+
+// getAttendeeInfo returns the stored info of a connected user. With application permissions,
+// members who never connected are resolved in the directory instead.
+func (p *Plugin) getAttendeeInfo(ctx context.Context, client ClientInterface, userID string) (*UserInfo, error) {
+	info, err := p.GetUserInfo(userID)
+	if config := p.getConfiguration(); err == nil || config == nil || !config.UseApplicationPermissions {
+		return info, err
+	}
+
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	info, _, err = p.resolveRemoteUser(ctx, client, user)
+	return info, err
+}
+
+func (p *Plugin) postConfirmCreateOrJoin(meetingURL string, channelID string, rootID string, topic string, userID string, creatorName string, provider string) *model.Post {
+	l := p.getUserLocalizer(userID)
+	message := p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.meeting.recent",
+		Other: "There is another recent meeting created on this channel.",
+	}, nil)
 	if provider != msteamsProviderName {
-		message = fmt.Sprintf("There is another recent meeting created on this channel with %s.", provider)
+		message = p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.meeting.recent_with_provider",
+			Other: "There is another recent meeting created on this channel with {{.Provider}}.",
+		}, map[string]any{"Provider": provider})
 	}
 	post := &model.Post{
 		UserId:    p.botUserID,
 		ChannelId: channelID,
+		RootId:    rootID,
 		Message:   message,
 		Type:      "custom_mstmeetings",
 		Props: map[string]interface{}{
@@ -94,7 +265,7 @@ func (p *Plugin) postConfirmCreateOrJoin(meetingURL string, channelID string, to
 }
 
 func (p *Plugin) postConnect(channelID string, userID string) (*model.Post, error) {
-	oauthMsg, err := p.getOauthMessage(channelID)
+	oauthMsg, err := p.getOauthMessage(p.getUserLocalizer(userID), channelID)
 	if err != nil {
 		p.API.LogError("postConnect, cannot get oauth message", "error", err.Error())
 		return nil, err
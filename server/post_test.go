@@ -4,15 +4,18 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
 	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
-	msgraph "github.com/yaegashi/msgraph.go/beta"
 )
 
 var mockPost = mock.AnythingOfType("*model.Post")
@@ -29,6 +32,7 @@ func TestPostMeetingWithDeps(t *testing.T) {
 		name          string
 		creator       *model.User
 		userInfo      *UserInfo
+		rootID        string
 		expectedError string
 		setup         func()
 	}{
@@ -82,7 +86,7 @@ func TestPostMeetingWithDeps(t *testing.T) {
 				api.On("HasPermissionToChannel", "testUserID", "testChannelID", model.PermissionCreatePost).Return(true)
 				api.On("GetChannel", "testChannelID").Return(&model.Channel{Id: "testChannelID", Type: model.ChannelTypeDirect}, nil)
 				api.On("GetChannelMembers", "testChannelID", 0, 100).Return(model.ChannelMembers{}, nil)
-				client.On("CreateMeeting").Return(&msgraph.OnlineMeeting{}, errors.New("error creating the meeting"))
+				client.On("CreateMeeting").Return(&OnlineMeeting{}, errors.New("error creating the meeting"))
 			},
 		},
 		{
@@ -95,7 +99,7 @@ func TestPostMeetingWithDeps(t *testing.T) {
 				api.On("GetChannel", "testChannelID").Return(&model.Channel{Id: "testChannelID", Type: model.ChannelTypeDirect}, nil)
 				api.On("GetChannelMembers", "testChannelID", 0, 100).Return(model.ChannelMembers{}, nil)
 				api.On("CreatePost", mockPost).Return(nil, &model.AppError{Message: "error creating the post"})
-				client.On("CreateMeeting").Return(&msgraph.OnlineMeeting{JoinURL: &mockJoinURL}, nil)
+				client.On("CreateMeeting").Return(&OnlineMeeting{JoinURL: mockJoinURL}, nil)
 			},
 		},
 		{
@@ -107,7 +111,57 @@ func TestPostMeetingWithDeps(t *testing.T) {
 				api.On("GetChannel", "testChannelID").Return(&model.Channel{Id: "testChannelID", Type: model.ChannelTypeDirect}, nil)
 				api.On("GetChannelMembers", "testChannelID", 0, 100).Return(model.ChannelMembers{}, nil)
 				api.On("CreatePost", mockPost).Return(&model.Post{}, nil)
-				client.On("CreateMeeting").Return(&msgraph.OnlineMeeting{JoinURL: &mockJoinURL}, nil)
+				api.On("KVGet", "activemeetings_testChannelID").Return(nil, nil)
+				api.On("KVSetWithOptions", "activemeetings_testChannelID", mock.Anything, mock.Anything).Return(true, nil)
+				client.On("CreateMeeting").Return(&OnlineMeeting{JoinURL: mockJoinURL}, nil)
+			},
+		},
+		{
+			name:     "Meeting posted in a thread",
+			creator:  &model.User{Id: "testUserID", Username: "testUsername"},
+			userInfo: info,
+			rootID:   "testRootID",
+			setup: func() {
+				api.On("HasPermissionToChannel", "testUserID", "testChannelID", model.PermissionCreatePost).Return(true)
+				api.On("GetChannel", "testChannelID").Return(&model.Channel{Id: "testChannelID", Type: model.ChannelTypeOpen}, nil)
+				api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+					return post.RootId == "testRootID"
+				})).Return(&model.Post{Id: "testPostID"}, nil)
+				api.On("KVGet", "activemeetings_testChannelID").Return(nil, nil)
+				api.On("KVSetWithOptions", "activemeetings_testChannelID", mock.MatchedBy(func(data []byte) bool {
+					return strings.Contains(string(data), `"post_id":"testPostID","root_id":"testRootID"`)
+				}), mock.Anything).Return(true, nil)
+				client.On("CreateMeeting").Return(&OnlineMeeting{JoinURL: mockJoinURL}, nil)
+			},
+		},
+		{
+			name:     "Scheduled meeting posted with its invite and reminders",
+			creator:  &model.User{Id: "testUserID", Username: "testUsername"},
+			userInfo: info,
+			setup: func() {
+				api.On("HasPermissionToChannel", "testUserID", "testChannelID", model.PermissionCreatePost).Return(true)
+				api.On("GetChannel", "testChannelID").Return(&model.Channel{Id: "testChannelID", Type: model.ChannelTypeOpen}, nil)
+				// Email addresses are hidden, so the attached invite leaves them out.
+				api.On("GetConfig").Return(&model.Config{PrivacySettings: model.PrivacySettings{ShowEmailAddress: model.NewPointer(false)}})
+				api.On("UploadFile", mock.MatchedBy(func(data []byte) bool {
+					return strings.Contains(string(data), "BEGIN:VEVENT") && !strings.Contains(string(data), "ORGANIZER")
+				}), "testChannelID", "invite.ics").Return(&model.FileInfo{Id: "testFileID"}, nil)
+				api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+					attachments := post.Attachments()
+					return len(post.FileIds) == 1 && post.FileIds[0] == "testFileID" &&
+						len(attachments) == 1 && len(attachments[0].Actions) == 4 &&
+						attachments[0].Actions[3].Name == "Add to my calendar"
+				})).Return(&model.Post{Id: "testPostID"}, nil)
+				api.On("KVSetWithOptions", "meetinginvite_testPostID", mock.Anything, mock.Anything).Return(true, nil)
+				api.On("KVGet", "preferences_testUserID").Return(nil, nil)
+				api.On("KVGet", "meetingreminders").Return(nil, nil)
+				api.On("KVCompareAndSet", "meetingreminders", []byte(nil), mock.MatchedBy(func(data []byte) bool {
+					return strings.Contains(string(data), `"testPostID":{"post_id":"testPostID"`)
+				})).Return(true, nil)
+				api.On("KVGet", "activemeetings_testChannelID").Return(nil, nil)
+				api.On("KVSetWithOptions", "activemeetings_testChannelID", mock.Anything, mock.Anything).Return(true, nil)
+				start := time.Now().Add(24 * time.Hour)
+				client.On("CreateMeeting").Return(&OnlineMeeting{JoinURL: mockJoinURL, StartDateTime: start, EndDateTime: start.Add(time.Hour), DialIn: &DialIn{TollNumber: "+1 425 555 0100", ConferenceID: "4123456"}}, nil)
 			},
 		},
 	}
@@ -119,7 +173,7 @@ func TestPostMeetingWithDeps(t *testing.T) {
 
 			tt.setup()
 
-			_, _, err := p.postMeetingWithDeps(tt.creator, "testChannelID", "testTopic", client, tt.userInfo)
+			_, _, err := p.postMeetingWithDeps(context.Background(), tt.creator, "testChannelID", tt.rootID, &MeetingOptions{Subject: "testTopic"}, client, tt.userInfo)
 
 			if tt.expectedError != "" {
 				require.Error(t, err)
@@ -133,6 +187,88 @@ func TestPostMeetingWithDeps(t *testing.T) {
 	}
 }
 
+func TestPostMeetingTopic(t *testing.T) {
+	p, api, client := SetupPluginMocks()
+	creator := &model.User{Id: "testUserID", Username: "testUsername"}
+
+	for name, tc := range map[string]struct {
+		options       *MeetingOptions
+		expectedTopic string
+	}{
+		"explicit topic is kept as is": {
+			options:       &MeetingOptions{Subject: "Review {date} with {user}", TopicTemplate: "{channel} sync"},
+			expectedTopic: "Review {date} with {user}",
+		},
+		"default topic expands the template": {
+			options:       &MeetingOptions{TopicTemplate: "{channel} sync"},
+			expectedTopic: "Town Square sync",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			api.ExpectedCalls = nil
+			client.ExpectedCalls = nil
+
+			api.On("HasPermissionToChannel", "testUserID", "testChannelID", model.PermissionCreatePost).Return(true)
+			api.On("GetChannel", "testChannelID").Return(&model.Channel{Id: "testChannelID", DisplayName: "Town Square", Type: model.ChannelTypeOpen}, nil)
+			api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+				return post.GetProp("meeting_topic") == tc.expectedTopic
+			})).Return(&model.Post{}, nil)
+			api.On("KVGet", "activemeetings_testChannelID").Return(nil, nil)
+			api.On("KVSetWithOptions", "activemeetings_testChannelID", mock.Anything, mock.Anything).Return(true, nil)
+			client.On("CreateMeeting").Return(&OnlineMeeting{JoinURL: "testJoinURL"}, nil)
+
+			_, _, err := p.postMeetingWithDeps(context.Background(), creator, "testChannelID", "", tc.options, client, &UserInfo{Email: "testEmail"})
+			require.NoError(t, err)
+			api.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetChannelMemberIDs(t *testing.T) {
+	api := &plugintest.API{}
+	p := &Plugin{MattermostPlugin: plugin.MattermostPlugin{API: api}}
+
+	firstPage := make(model.ChannelMembers, channelMembersPerPage)
+	for i := range firstPage {
+		firstPage[i].UserId = "member" + strconv.Itoa(i)
+	}
+	api.On("GetChannelMembers", "testChannelID", 0, channelMembersPerPage).Return(firstPage, nil)
+	api.On("GetChannelMembers", "testChannelID", 1, channelMembersPerPage).Return(model.ChannelMembers{{UserId: "lastMember"}}, nil)
+
+	memberIDs, err := p.getChannelMemberIDs("testChannelID")
+	require.NoError(t, err)
+	require.Len(t, memberIDs, channelMembersPerPage+1)
+	require.Equal(t, "member0", memberIDs[0])
+	require.Equal(t, "lastMember", memberIDs[channelMembersPerPage])
+	api.AssertExpectations(t)
+
+	api.ExpectedCalls = nil
+	for page := 0; page*channelMembersPerPage <= maxInvitees; page++ {
+		api.On("GetChannelMembers", "largeChannelID", page, channelMembersPerPage).Return(firstPage, nil)
+	}
+	_, err = p.getChannelMemberIDs("largeChannelID")
+	require.ErrorIs(t, err, errTooManyInvitees)
+	api.AssertExpectations(t)
+}
+
+func TestPostMeetingTooManyInvitees(t *testing.T) {
+	p, api, client := SetupPluginMocks()
+	api.ExpectedCalls = nil
+	client.ExpectedCalls = nil
+
+	inviteeIDs := make([]string, maxInvitees+1)
+	for i := range inviteeIDs {
+		inviteeIDs[i] = "invitee" + strconv.Itoa(i)
+	}
+	api.On("HasPermissionToChannel", "testUserID", "testChannelID", model.PermissionCreatePost).Return(true)
+	api.On("GetChannel", "testChannelID").Return(&model.Channel{Id: "testChannelID", Type: model.ChannelTypeOpen}, nil)
+
+	_, _, err := p.postMeetingWithDeps(context.Background(), &model.User{Id: "testUserID"}, "testChannelID", "", &MeetingOptions{InviteUserIDs: inviteeIDs}, client, &UserInfo{Email: "testEmail"})
+	require.ErrorIs(t, err, errTooManyInvitees)
+	api.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
 func TestPostConfirmCreateOrJoin(t *testing.T) {
 	p, api, _ := SetupPluginMocks()
 
@@ -179,7 +315,7 @@ func TestPostConfirmCreateOrJoin(t *testing.T) {
 			api.ExpectedCalls = nil
 			api.On("SendEphemeralPost", userID, mockPost).Return(expectedPost, nil)
 
-			post := p.postConfirmCreateOrJoin(meetingURL, channelID, topic, userID, creatorName, tt.provider)
+			post := p.postConfirmCreateOrJoin(meetingURL, channelID, "", topic, userID, creatorName, tt.provider)
 			require.Equal(t, tt.expectedMessage, post.Message)
 		})
 	}
@@ -0,0 +1,173 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const meetingFromPostPath = "/api/v1/meetings/from_post"
+
+// userMentionRegexp matches the @-mentions of a message, but not the addresses it contains.
+var userMentionRegexp = regexp.MustCompile(`(?:^|[^\w@.])@([a-zA-Z0-9][a-zA-Z0-9._-]*)`)
+
+// specialMentions notify channel members rather than a user.
+var specialMentions = []string{"all", "channel", "here"}
+
+type startMeetingFromPostRequest struct {
+	PostID string `json:"post_id"`
+}
+
+// getMeetingSubjectFromPost returns the message of a post on a single line, shortened to fit a
+// meeting subject.
+func getMeetingSubjectFromPost(post *model.Post) string {
+	subject := strings.Join(strings.Fields(post.Message), " ")
+	if utf8.RuneCountInString(subject) <= maxTopicTemplateLength {
+		return subject
+	}
+	runes := []rune(subject)
+	return strings.TrimSpace(string(runes[:maxTopicTemplateLength-1])) + "…"
+}
+
+// getMentionedUsernames returns the usernames mentioned in a message, without the special
+// mentions.
+func getMentionedUsernames(message string) []string {
+	usernames := []string{}
+	for _, match := range userMentionRegexp.FindAllStringSubmatch(message, -1) {
+		// Mentions ending a sentence are followed by punctuation that usernames may contain.
+		username := strings.ToLower(strings.TrimRight(match[1], ".-_"))
+		if username == "" || slices.Contains(specialMentions, username) || slices.Contains(usernames, username) {
+			continue
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames
+}
+
+// getPostInviteeIDs returns the author of a post and the users it mentions, leaving out the
+// creator of the meeting, bots, deactivated users and users who cannot read the channel, as the
+// message becomes the subject of the meeting.
+func (p *Plugin) getPostInviteeIDs(post *model.Post, creatorID string) ([]string, error) {
+	inviteeIDs := []string{}
+	if post.UserId != creatorID {
+		inviteeIDs = append(inviteeIDs, post.UserId)
+	}
+
+	usernames := getMentionedUsernames(post.Message)
+	if len(usernames) == 0 {
+		return inviteeIDs, nil
+	}
+	users, appErr := p.API.GetUsersByUsernames(usernames)
+	if appErr != nil {
+		return nil, appErr
+	}
+	for _, user := range users {
+		if user.IsBot || user.DeleteAt != 0 || user.Id == creatorID || slices.Contains(inviteeIDs, user.Id) {
+			continue
+		}
+		if !p.API.HasPermissionToChannel(user.Id, post.ChannelId, model.PermissionReadChannel) {
+			continue
+		}
+		inviteeIDs = append(inviteeIDs, user.Id)
+	}
+	return inviteeIDs, nil
+}
+
+// handleStartMeetingFromPostWithDeps starts a meeting about a post, in its thread. Unlike
+// starting a meeting from the channel, the recent meeting check is skipped as the user picked
+// the post explicitly.
+func (p *Plugin) handleStartMeetingFromPostWithDeps(w http.ResponseWriter, r *http.Request, newClient ClientFactory) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		p.API.LogError("handleStartMeetingFromPost, unauthorized user")
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req startMeetingFromPostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		p.API.LogError("handleStartMeetingFromPost, failed to decode request", "Error", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !model.IsValidId(req.PostID) {
+		http.Error(w, "Invalid post_id", http.StatusBadRequest)
+		return
+	}
+
+	post, appErr := p.API.GetPost(req.PostID)
+	if appErr != nil || !p.API.HasPermissionToChannel(userID, post.ChannelId, model.PermissionReadChannel) {
+		http.NotFound(w, r)
+		return
+	}
+
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		p.API.LogError("handleStartMeetingFromPost, failed to get user", "UserID", userID, "Error", appErr.Message)
+		http.Error(w, appErr.Error(), appErr.StatusCode)
+		return
+	}
+
+	rootID := post.RootId
+	if rootID == "" {
+		rootID = post.Id
+	}
+	subject := getMeetingSubjectFromPost(post)
+	inviteeIDs, err := p.getPostInviteeIDs(post, userID)
+	if err != nil {
+		p.API.LogError("handleStartMeetingFromPost, failed to get invitees", "PostID", post.Id, "Error", err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	authResult, authErr := p.authenticateAndFetchUser(r.Context(), userID, post.ChannelId, newClient)
+	if authErr != nil && isTimeout(authErr.Err) {
+		p.API.LogError("handleStartMeetingFromPost, timed out authenticating user", "UserID", userID, "Error", authErr.Err.Error())
+		http.Error(w, requestTimeoutText, http.StatusGatewayTimeout)
+		return
+	}
+	if authErr != nil {
+		if _, err = w.Write([]byte(`{"meeting_url": ""}`)); err != nil {
+			p.API.LogWarn("failed to write response", "error", err.Error())
+		}
+
+		if _, err = p.postConnect(post.ChannelId, userID); err != nil {
+			p.API.LogWarn("failed to create connect post", "error", err.Error())
+			return
+		}
+
+		pending := &pendingMeeting{ChannelID: post.ChannelId, RootID: rootID, Topic: subject, InviteUserIDs: inviteeIDs}
+		if err = p.storeMeetingRequestState(userID, pending); err != nil {
+			p.API.LogWarn("failed to store user state", "error", err.Error())
+		}
+		return
+	}
+
+	options := p.getUserPreferencesOrDefault(userID).meetingOptions(subject)
+	options.InviteUserIDs = inviteeIDs
+	_, meeting, err := p.postMeetingWithDeps(r.Context(), user, post.ChannelId, rootID, options, authResult.Client, authResult.UserInfo)
+	if err != nil {
+		p.API.LogError("handleStartMeetingFromPost, failed to post meeting", "UserID", userID, "Error", err.Error())
+		writeGraphError(w, err)
+		return
+	}
+
+	p.trackMeetingStart(userID, telemetryStartSourcePostMenu)
+
+	if _, err = fmt.Fprintf(w, `{"meeting_url": "%s"}`, meeting.JoinURL); err != nil {
+		p.API.LogWarn("failed to write response", "error", err.Error())
+	}
+}
+
+func (p *Plugin) handleStartMeetingFromPost(w http.ResponseWriter, r *http.Request) {
+	p.handleStartMeetingFromPostWithDeps(w, r, p.NewClient)
+}
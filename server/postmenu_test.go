@@ -0,0 +1,127 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMentionedUsernames(t *testing.T) {
+	require.Equal(t, []string{"jane.doe", "bob"}, getMentionedUsernames("@Jane.Doe can you sync with @bob and @jane.doe? cc @channel"))
+	require.Equal(t, []string{"ana"}, getMentionedUsernames("Mail ana@example.com or ping @ana."))
+	require.Empty(t, getMentionedUsernames("No mentions here"))
+}
+
+func TestGetMeetingSubjectFromPost(t *testing.T) {
+	require.Equal(t, "Can we review the release plan?", getMeetingSubjectFromPost(&model.Post{Message: "  Can we review\nthe release   plan?\n"}))
+
+	subject := getMeetingSubjectFromPost(&model.Post{Message: strings.Repeat("a", 300)})
+	require.Equal(t, maxTopicTemplateLength, len([]rune(subject)))
+	require.True(t, strings.HasSuffix(subject, "…"))
+}
+
+func TestGetPostInviteeIDs(t *testing.T) {
+	api := &plugintest.API{}
+	defer api.AssertExpectations(t)
+	p := SetupMockPlugin(api, nil, nil)
+
+	post := &model.Post{ChannelId: "channelID", UserId: "authorID", Message: "@bob @carol @dave @demo please review"}
+	api.On("GetUsersByUsernames", []string{"bob", "carol", "dave", "demo"}).Return([]*model.User{
+		{Id: "bobID", Username: "bob"},
+		{Id: "carolID", Username: "carol"},
+		{Id: "daveID", Username: "dave", IsBot: true},
+		{Id: "demoUserID", Username: "demo"},
+	}, nil)
+	api.On("HasPermissionToChannel", "bobID", "channelID", model.PermissionReadChannel).Return(true)
+	api.On("HasPermissionToChannel", "carolID", "channelID", model.PermissionReadChannel).Return(false)
+
+	inviteeIDs, err := p.getPostInviteeIDs(post, "demoUserID")
+	require.NoError(t, err)
+	require.Equal(t, []string{"authorID", "bobID"}, inviteeIDs)
+}
+
+func TestHandleStartMeetingFromPost(t *testing.T) {
+	tests := []struct {
+		name           string
+		connected      bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Meeting started in the thread of the post",
+			connected:      true,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"meeting_url": "https://teams.microsoft.com/l/meetup-join/review"}`,
+		},
+		{
+			name:           "Not connected",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"meeting_url": ""}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			defer api.AssertExpectations(t)
+			mockClient := &MockClient{}
+			defer mockClient.AssertExpectations(t)
+			tracker := &MockTracker{}
+			defer tracker.AssertExpectations(t)
+			p := SetupMockPlugin(api, tracker, nil)
+			p.setConfiguration(&configuration{EncryptionKey: "demo_encrypt_key"})
+
+			post := &model.Post{Id: model.NewId(), RootId: "rootID", ChannelId: "channelID", UserId: "authorID", Message: "  Can we review the plan with @bob?\n"}
+			api.On("GetPost", post.Id).Return(post, nil)
+			api.On("HasPermissionToChannel", "demoUserID", "channelID", model.PermissionReadChannel).Return(true)
+			api.On("GetUser", "demoUserID").Return(&model.User{Id: "demoUserID"}, nil)
+			api.On("GetUsersByUsernames", []string{"bob"}).Return([]*model.User{{Id: "bobID", Username: "bob"}}, nil)
+			api.On("HasPermissionToChannel", "bobID", "channelID", model.PermissionReadChannel).Return(true)
+			api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewPointer("https://example.com")}})
+
+			if tt.connected {
+				setupConnectedDemoUser(t, api)
+				mockClient.On("GetMe").Return(&RemoteUser{}, nil)
+				api.On("KVGet", "preferences_demoUserID").Return(nil, nil)
+				api.On("HasPermissionToChannel", "demoUserID", "channelID", model.PermissionCreatePost).Return(true)
+				api.On("GetChannel", "channelID").Return(&model.Channel{Id: "channelID", Type: model.ChannelTypeOpen}, nil)
+				// The author and the mentioned user are looked up to be invited.
+				api.On("KVGet", "token_authorID").Return(nil, nil).Once()
+				api.On("KVGet", "token_bobID").Return(nil, nil).Once()
+				mockClient.On("CreateMeeting").Return(&OnlineMeeting{JoinURL: "https://teams.microsoft.com/l/meetup-join/review"}, nil)
+				api.On("CreatePost", mock.MatchedBy(func(created *model.Post) bool {
+					return created.RootId == "rootID" && created.GetProp("meeting_topic") == "Can we review the plan with @bob?"
+				})).Return(&model.Post{Id: "meetingPostID"}, nil)
+				api.On("KVGet", "activemeetings_channelID").Return(nil, nil)
+				api.On("KVSetWithOptions", "activemeetings_channelID", mock.Anything, mock.Anything).Return(true, nil)
+				tracker.On("TrackUserEvent", "meeting_started", "demoUserID", map[string]any{"source": telemetryStartSourcePostMenu}).Return(nil)
+			} else {
+				api.On("KVGet", "token_demoUserID").Return(nil, nil)
+				api.On("SendEphemeralPost", "demoUserID", mock.Anything).Return(&model.Post{})
+				api.On("KVSet", "msteamsmeetinguserstate_demoUserID", mock.Anything).Return(nil)
+				api.On("KVSetWithExpiry", "pendingmeeting_demoUserID", mock.MatchedBy(func(data []byte) bool {
+					return strings.Contains(string(data), `"root_id":"rootID"`) &&
+						strings.Contains(string(data), `"invite_user_ids":["authorID","bobID"]`)
+				}), mock.Anything).Return(nil)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, meetingFromPostPath, bytes.NewReader([]byte(`{"post_id": "`+post.Id+`"}`)))
+			r.Header.Set("Mattermost-User-Id", "demoUserID")
+			p.handleStartMeetingFromPostWithDeps(w, r, mockClientFactory(mockClient))
+
+			require.Equal(t, tt.expectedStatus, w.Code)
+			require.Equal(t, tt.expectedBody, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,398 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/i18n"
+	"github.com/pkg/errors"
+)
+
+const (
+	preferencesKeyPrefix = "preferences_"
+
+	maxTopicTemplateLength = 255
+	maxMeetingDuration     = 24 * 60
+)
+
+// lobbyBypassScopes are the Microsoft Graph lobby bypass scopes a user can prefer.
+var lobbyBypassScopes = []string{
+	"organizer",
+	"organization",
+	"organizationAndFederated",
+	"organizationExcludingGuests",
+	"invited",
+	"everyone",
+}
+
+// UserPreferences are the defaults a user applies to the meetings they start. Zero values keep
+// the plugin defaults.
+type UserPreferences struct {
+	// TopicTemplate is the topic of meetings started without one. It can reference {channel},
+	// {user} and {date}.
+	TopicTemplate          string `json:"topic_template"`
+	DurationMinutes        int    `json:"duration_minutes"`
+	InviteChannelMembers   *bool  `json:"invite_channel_members"`
+	SkipRecentMeetingCheck bool   `json:"skip_recent_meeting_check"`
+	LobbyBypassScope       string `json:"lobby_bypass_scope"`
+	// ReminderMinutes is how long before scheduled meetings the user is reminded of them. Zero
+	// turns reminders off.
+	ReminderMinutes *int `json:"reminder_minutes"`
+	// SyncPresence shows the Teams meetings of the user in their custom status, when the presence
+	// sync is enabled.
+	SyncPresence bool `json:"sync_presence"`
+}
+
+// validatePreferences checks that the preferences can be applied to a meeting. The returned
+// error is meant to be shown to the user.
+func (p *Plugin) validatePreferences(l *i18n.Localizer, prefs *UserPreferences) error {
+	if len(prefs.TopicTemplate) > maxTopicTemplateLength {
+		return errors.New(p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.settings.invalid_topic",
+			Other: "The topic template must be at most {{.Length}} characters long.",
+		}, map[string]any{"Length": maxTopicTemplateLength}))
+	}
+	if prefs.DurationMinutes < 0 || prefs.DurationMinutes > maxMeetingDuration {
+		return errors.New(p.localize(l, invalidDurationMessage, map[string]any{"Max": maxMeetingDuration}))
+	}
+	if prefs.LobbyBypassScope != "" && !slices.Contains(lobbyBypassScopes, prefs.LobbyBypassScope) {
+		return errors.New(p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.settings.invalid_lobby",
+			Other: "The lobby policy must be one of: {{.Scopes}}.",
+		}, map[string]any{"Scopes": strings.Join(lobbyBypassScopes, ", ")}))
+	}
+	if prefs.ReminderMinutes != nil && (*prefs.ReminderMinutes < 0 || *prefs.ReminderMinutes > maxReminderMinutes) {
+		return errors.New(p.localize(l, invalidReminderMessage, map[string]any{"Max": maxReminderMinutes}))
+	}
+	return nil
+}
+
+// meetingOptions returns the options of a meeting started with the given topic, falling back to
+// the topic template when no topic is given.
+func (prefs *UserPreferences) meetingOptions(topic string) *MeetingOptions {
+	return &MeetingOptions{
+		Subject:              topic,
+		TopicTemplate:        prefs.TopicTemplate,
+		Duration:             time.Duration(prefs.DurationMinutes) * time.Minute,
+		LobbyBypassScope:     prefs.LobbyBypassScope,
+		InviteChannelMembers: prefs.InviteChannelMembers,
+	}
+}
+
+// expandTopicTemplate replaces the placeholders of a topic template.
+func expandTopicTemplate(template string, channel *model.Channel, creator *model.User) string {
+	if !strings.Contains(template, "{") {
+		return template
+	}
+
+	channelName := channel.DisplayName
+	if channelName == "" {
+		channelName = channel.Name
+	}
+	return strings.NewReplacer(
+		"{channel}", channelName,
+		"{user}", creator.Username,
+		"{date}", time.Now().Format(time.DateOnly),
+	).Replace(template)
+}
+
+func getPreferencesKey(userID string) string {
+	return preferencesKeyPrefix + userID
+}
+
+// GetUserPreferences returns the stored preferences of a user, or the defaults if they have none.
+func (p *Plugin) GetUserPreferences(userID string) (*UserPreferences, error) {
+	data, appErr := p.API.KVGet(getPreferencesKey(userID))
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	prefs := &UserPreferences{}
+	if data == nil {
+		return prefs, nil
+	}
+	if err := json.Unmarshal(data, prefs); err != nil {
+		return nil, errors.Wrap(err, "cannot decode user preferences")
+	}
+	return prefs, nil
+}
+
+func (p *Plugin) StoreUserPreferences(userID string, prefs *UserPreferences) error {
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return errors.Wrap(err, "cannot encode user preferences")
+	}
+
+	if appErr := p.API.KVSet(getPreferencesKey(userID), data); appErr != nil {
+		return appErr
+	}
+	return errors.Wrap(p.setPresenceSync(userID, prefs.SyncPresence), "cannot update presence sync")
+}
+
+func (p *Plugin) DeleteUserPreferences(userID string) error {
+	if appErr := p.API.KVDelete(getPreferencesKey(userID)); appErr != nil {
+		return appErr
+	}
+	return errors.Wrap(p.setPresenceSync(userID, false), "cannot update presence sync")
+}
+
+// getUserPreferencesOrDefault returns the preferences of a user, falling back to the defaults so
+// that a storage failure never prevents starting a meeting.
+func (p *Plugin) getUserPreferencesOrDefault(userID string) *UserPreferences {
+	prefs, err := p.GetUserPreferences(userID)
+	if err != nil {
+		p.API.LogWarn("failed to get user preferences", "UserID", userID, "error", err.Error())
+		return &UserPreferences{}
+	}
+	return prefs
+}
+
+// Messages of the settings command.
+var (
+	invalidDurationMessage = &i18n.Message{
+		ID:    "mstmeetings.settings.invalid_duration",
+		Other: "The duration must be between 1 and {{.Max}} minutes.",
+	}
+	invalidReminderMessage = &i18n.Message{
+		ID:    "mstmeetings.settings.invalid_reminder",
+		Other: "The reminder must be between 1 and {{.Max}} minutes before the meeting.",
+	}
+	invalidOnOffMessage = &i18n.Message{
+		ID:    "mstmeetings.settings.invalid_on_off",
+		Other: "The value must be `on` or `off`.",
+	}
+)
+
+func (p *Plugin) formatPreferences(l *i18n.Localizer, prefs *UserPreferences) string {
+	topic := p.localize(l, &i18n.Message{ID: "mstmeetings.settings.topic_not_set", Other: "Not set"}, nil)
+	if prefs.TopicTemplate != "" {
+		topic = fmt.Sprintf("`%s`", prefs.TopicTemplate)
+	}
+
+	duration := p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.settings.duration_default",
+		Other: "{{.Minutes}} minutes (default)",
+	}, map[string]any{"Minutes": int(defaultMeetingDuration.Minutes())})
+	if prefs.DurationMinutes > 0 {
+		duration = p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.settings.duration",
+			Other: "{{.Minutes}} minutes",
+		}, map[string]any{"Minutes": prefs.DurationMinutes})
+	}
+
+	invite := p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.settings.invite_default",
+		Other: "Direct and group messages only (default)",
+	}, nil)
+	if prefs.InviteChannelMembers != nil {
+		invite = p.formatOnOff(l, *prefs.InviteChannelMembers)
+	}
+
+	lobby := p.localize(l, &i18n.Message{ID: "mstmeetings.settings.lobby_default", Other: "Microsoft Teams default"}, nil)
+	if prefs.LobbyBypassScope != "" {
+		lobby = prefs.LobbyBypassScope
+	}
+
+	reminder := p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.settings.reminder_default",
+		Other: "{{.Minutes}} minutes before scheduled meetings (default)",
+	}, map[string]any{"Minutes": int(defaultReminderLeadTime.Minutes())})
+	if prefs.ReminderMinutes != nil {
+		reminder = p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.settings.reminder",
+			Other: "{{.Minutes}} minutes before scheduled meetings",
+		}, map[string]any{"Minutes": *prefs.ReminderMinutes})
+		if *prefs.ReminderMinutes == 0 {
+			reminder = p.formatOnOff(l, false)
+		}
+	}
+
+	return p.localize(l, &i18n.Message{
+		ID: "mstmeetings.settings.summary",
+		Other: "###### Your MS Teams Meetings settings\n" +
+			"* Topic template (`topic`): {{.Topic}}\n" +
+			"* Duration (`duration`): {{.Duration}}\n" +
+			"* Invite channel members (`invite`): {{.Invite}}\n" +
+			"* Skip the recent meeting check (`skip-recent-check`): {{.SkipRecentCheck}}\n" +
+			"* Lobby policy (`lobby`): {{.Lobby}}\n" +
+			"* Reminder (`reminder`): {{.Reminder}}\n" +
+			"* Show Teams meetings in your custom status (`presence`): {{.Presence}}\n\n" +
+			"Run `/mstmeetings settings <setting> <value>` to change a setting, or `/mstmeetings settings reset` to restore the defaults.",
+	}, map[string]any{
+		"Topic":           topic,
+		"Duration":        duration,
+		"Invite":          invite,
+		"SkipRecentCheck": p.formatOnOff(l, prefs.SkipRecentMeetingCheck),
+		"Lobby":           lobby,
+		"Reminder":        reminder,
+		"Presence":        p.formatOnOff(l, prefs.SyncPresence),
+	})
+}
+
+func (p *Plugin) parseOnOff(l *i18n.Localizer, value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "on", trueString:
+		return true, nil
+	case "off", "false":
+		return false, nil
+	default:
+		return false, errors.New(p.localize(l, invalidOnOffMessage, nil))
+	}
+}
+
+func (p *Plugin) handleSettings(args []string, extra *model.CommandArgs) (string, error) {
+	l := p.getUserLocalizer(extra.UserId)
+	prefs, err := p.GetUserPreferences(extra.UserId)
+	if err != nil {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.settings.get_failed",
+			Other: "Failed to get your settings.",
+		}, nil), errors.Wrap(err, "cannot get user preferences")
+	}
+
+	if len(args) < 2 {
+		return p.formatPreferences(l, prefs), nil
+	}
+
+	setting, values := args[1], args[2:]
+	value := strings.Join(values, " ")
+	switch setting {
+	case "reset":
+		if len(values) > 0 {
+			return p.localize(l, tooManyParametersMessage, nil), nil
+		}
+		if err = p.DeleteUserPreferences(extra.UserId); err != nil {
+			return p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.settings.reset_failed",
+				Other: "Failed to reset your settings.",
+			}, nil), errors.Wrap(err, "cannot delete user preferences")
+		}
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.settings.reset",
+			Other: "Your settings have been reset to the defaults.",
+		}, nil), nil
+	case "topic":
+		prefs.TopicTemplate = value
+	case "duration":
+		if value == "default" {
+			prefs.DurationMinutes = 0
+			break
+		}
+		minutes, convErr := strconv.Atoi(value)
+		if convErr != nil || minutes < 1 {
+			return p.localize(l, invalidDurationMessage, map[string]any{"Max": maxMeetingDuration}), nil
+		}
+		prefs.DurationMinutes = minutes
+	case "invite":
+		if value == "default" {
+			prefs.InviteChannelMembers = nil
+			break
+		}
+		invite, parseErr := p.parseOnOff(l, value)
+		if parseErr != nil {
+			return parseErr.Error(), nil
+		}
+		prefs.InviteChannelMembers = &invite
+	case "skip-recent-check":
+		skip, parseErr := p.parseOnOff(l, value)
+		if parseErr != nil {
+			return parseErr.Error(), nil
+		}
+		prefs.SkipRecentMeetingCheck = skip
+	case "presence":
+		sync, parseErr := p.parseOnOff(l, value)
+		if parseErr != nil {
+			return parseErr.Error(), nil
+		}
+		prefs.SyncPresence = sync
+	case "lobby":
+		if value == "default" {
+			value = ""
+		}
+		prefs.LobbyBypassScope = value
+	case "reminder":
+		switch value {
+		case "default":
+			prefs.ReminderMinutes = nil
+		case "off":
+			prefs.ReminderMinutes = model.NewPointer(0)
+		default:
+			minutes, convErr := strconv.Atoi(value)
+			if convErr != nil || minutes < 1 {
+				return p.localize(l, invalidReminderMessage, map[string]any{"Max": maxReminderMinutes}), nil
+			}
+			prefs.ReminderMinutes = &minutes
+		}
+	default:
+		return p.localize(l, unknownSettingMessage, map[string]any{"Setting": setting}) + "\n" + p.formatPreferences(l, prefs), nil
+	}
+
+	if err = p.validatePreferences(l, prefs); err != nil {
+		return err.Error(), nil
+	}
+	if err = p.StoreUserPreferences(extra.UserId, prefs); err != nil {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.settings.save_failed",
+			Other: "Failed to save your settings.",
+		}, nil), errors.Wrap(err, "cannot store user preferences")
+	}
+	return p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.settings.saved",
+		Other: "Your settings have been saved.",
+	}, nil) + "\n" + p.formatPreferences(l, prefs), nil
+}
+
+func (p *Plugin) handlePreferences(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		p.API.LogError("handlePreferences, unauthorized user")
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	var prefs *UserPreferences
+	switch r.Method {
+	case http.MethodGet:
+		var err error
+		if prefs, err = p.GetUserPreferences(userID); err != nil {
+			p.API.LogError("handlePreferences, failed to get user preferences", "UserID", userID, "Error", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case http.MethodPut:
+		const maxRequestBodySize = 1 * 1024 * 1024 // 1MB
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+
+		prefs = &UserPreferences{}
+		if err := json.NewDecoder(r.Body).Decode(prefs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := p.validatePreferences(p.getUserLocalizer(userID), prefs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := p.StoreUserPreferences(userID, prefs); err != nil {
+			p.API.LogError("handlePreferences, failed to store user preferences", "UserID", userID, "Error", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(prefs); err != nil {
+		p.API.LogWarn("failed to write response", "error", err.Error())
+	}
+}
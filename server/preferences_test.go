@@ -0,0 +1,240 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserPreferencesMeetingOptions(t *testing.T) {
+	invite := true
+	prefs := &UserPreferences{
+		TopicTemplate:        "{channel} sync",
+		DurationMinutes:      30,
+		InviteChannelMembers: &invite,
+		LobbyBypassScope:     "organization",
+	}
+
+	require.Equal(t, &MeetingOptions{
+		TopicTemplate:        "{channel} sync",
+		Duration:             30 * time.Minute,
+		LobbyBypassScope:     "organization",
+		InviteChannelMembers: &invite,
+	}, prefs.meetingOptions(""))
+	require.Equal(t, "Explicit topic", prefs.meetingOptions("Explicit topic").Subject)
+
+	channel := &model.Channel{Name: "town-square", DisplayName: "Town Square"}
+	creator := &model.User{Username: "demo"}
+	require.Equal(t, "Town Square sync with demo", expandTopicTemplate("{channel} sync with {user}", channel, creator))
+	require.Equal(t, "Plain topic", expandTopicTemplate("Plain topic", channel, creator))
+}
+
+func TestValidatePreferences(t *testing.T) {
+	p := &Plugin{}
+	require.NoError(t, p.validatePreferences(defaultLocalizer, &UserPreferences{}))
+	require.NoError(t, p.validatePreferences(defaultLocalizer, &UserPreferences{DurationMinutes: 90, LobbyBypassScope: "everyone"}))
+	require.EqualError(t, p.validatePreferences(defaultLocalizer, &UserPreferences{DurationMinutes: 2000}), "The duration must be between 1 and 1440 minutes.")
+	require.ErrorContains(t, p.validatePreferences(defaultLocalizer, &UserPreferences{LobbyBypassScope: "nobody"}), "The lobby policy must be one of")
+	require.NoError(t, p.validatePreferences(defaultLocalizer, &UserPreferences{ReminderMinutes: model.NewPointer(0)}))
+	require.ErrorContains(t, p.validatePreferences(defaultLocalizer, &UserPreferences{ReminderMinutes: model.NewPointer(-5)}), "The reminder must be between")
+}
+
+func TestHandleSettings(t *testing.T) {
+	tests := []struct {
+		name             string
+		args             []string
+		stored           []byte
+		expectedStored   []byte
+		expectedPresence []byte
+		expectedOutput   string
+	}{
+		{
+			name:           "Show the defaults",
+			args:           []string{"settings"},
+			expectedOutput: "* Duration (`duration`): 60 minutes (default)",
+		},
+		{
+			name:           "Set the duration",
+			args:           []string{"settings", "duration", "45"},
+			expectedStored: []byte(`{"topic_template":"","duration_minutes":45,"invite_channel_members":null,"skip_recent_meeting_check":false,"lobby_bypass_scope":"","reminder_minutes":null,"sync_presence":false}`),
+			expectedOutput: "Your settings have been saved.",
+		},
+		{
+			name:           "Set the topic template",
+			args:           []string{"settings", "topic", "{channel}", "sync"},
+			stored:         []byte(`{"duration_minutes":45}`),
+			expectedStored: []byte(`{"topic_template":"{channel} sync","duration_minutes":45,"invite_channel_members":null,"skip_recent_meeting_check":false,"lobby_bypass_scope":"","reminder_minutes":null,"sync_presence":false}`),
+			expectedOutput: "* Topic template (`topic`): `{channel} sync`",
+		},
+		{
+			name:           "Set the reminder",
+			args:           []string{"settings", "reminder", "15"},
+			expectedStored: []byte(`{"topic_template":"","duration_minutes":0,"invite_channel_members":null,"skip_recent_meeting_check":false,"lobby_bypass_scope":"","reminder_minutes":15,"sync_presence":false}`),
+			expectedOutput: "* Reminder (`reminder`): 15 minutes before scheduled meetings",
+		},
+		{
+			name:           "Turn reminders off",
+			args:           []string{"settings", "reminder", "off"},
+			expectedStored: []byte(`{"topic_template":"","duration_minutes":0,"invite_channel_members":null,"skip_recent_meeting_check":false,"lobby_bypass_scope":"","reminder_minutes":0,"sync_presence":false}`),
+			expectedOutput: "* Reminder (`reminder`): Off",
+		},
+		{
+			name:             "Show meetings in the custom status",
+			args:             []string{"settings", "presence", "on"},
+			expectedStored:   []byte(`{"topic_template":"","duration_minutes":0,"invite_channel_members":null,"skip_recent_meeting_check":false,"lobby_bypass_scope":"","reminder_minutes":null,"sync_presence":true}`),
+			expectedPresence: []byte(`{"demoUserID":{}}`),
+			expectedOutput:   "* Show Teams meetings in your custom status (`presence`): On",
+		},
+		{
+			name:           "Invalid reminder",
+			args:           []string{"settings", "reminder", "2000"},
+			expectedOutput: "The reminder must be between 1 and 1440 minutes before the meeting.",
+		},
+		{
+			name:           "Invalid duration",
+			args:           []string{"settings", "duration", "forever"},
+			expectedOutput: "The duration must be between 1 and 1440 minutes.",
+		},
+		{
+			name:           "Invalid lobby policy",
+			args:           []string{"settings", "lobby", "nobody"},
+			expectedOutput: "The lobby policy must be one of",
+		},
+		{
+			name:           "Invalid on or off value",
+			args:           []string{"settings", "invite", "maybe"},
+			expectedOutput: "The value must be `on` or `off`.",
+		},
+		{
+			name:           "Unknown setting",
+			args:           []string{"settings", "color", "blue"},
+			expectedOutput: "Unknown setting `color`.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			p := &Plugin{MattermostPlugin: plugin.MattermostPlugin{API: api}}
+
+			api.On("KVGet", "preferences_demoUserID").Return(tt.stored, nil)
+			if tt.expectedStored != nil {
+				api.On("KVSet", "preferences_demoUserID", tt.expectedStored).Return(nil)
+				api.On("KVGet", presenceUsersKey).Return(nil, nil)
+			}
+			if tt.expectedPresence != nil {
+				api.On("KVCompareAndSet", presenceUsersKey, []byte(nil), tt.expectedPresence).Return(true, nil)
+			}
+
+			resp, err := p.handleSettings(tt.args, &model.CommandArgs{UserId: "demoUserID"})
+			require.NoError(t, err)
+			require.Contains(t, resp, tt.expectedOutput)
+			api.AssertExpectations(t)
+		})
+	}
+
+	t.Run("Reset", func(t *testing.T) {
+		api := &plugintest.API{}
+		p := &Plugin{MattermostPlugin: plugin.MattermostPlugin{API: api}}
+
+		api.On("KVGet", "preferences_demoUserID").Return([]byte(`{"duration_minutes":45}`), nil)
+		api.On("KVDelete", "preferences_demoUserID").Return(nil)
+		api.On("KVGet", presenceUsersKey).Return(nil, nil)
+
+		resp, err := p.handleSettings([]string{"settings", "reset"}, &model.CommandArgs{UserId: "demoUserID"})
+		require.NoError(t, err)
+		require.Equal(t, "Your settings have been reset to the defaults.", resp)
+		api.AssertExpectations(t)
+	})
+}
+
+func TestHandlePreferences(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		userID         string
+		body           string
+		setup          func(api *plugintest.API)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:   "Unauthorized user",
+			method: http.MethodGet,
+			setup: func(api *plugintest.API) {
+				api.On("LogError", "handlePreferences, unauthorized user")
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Not authorized\n",
+		},
+		{
+			name:   "Get preferences",
+			method: http.MethodGet,
+			userID: "demoUserID",
+			setup: func(api *plugintest.API) {
+				api.On("KVGet", "preferences_demoUserID").Return([]byte(`{"duration_minutes":45}`), nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"topic_template":"","duration_minutes":45,"invite_channel_members":null,"skip_recent_meeting_check":false,"lobby_bypass_scope":"","reminder_minutes":null,"sync_presence":false}` + "\n",
+		},
+		{
+			name:   "Update preferences",
+			method: http.MethodPut,
+			userID: "demoUserID",
+			body:   `{"duration_minutes":30,"invite_channel_members":false}`,
+			setup: func(api *plugintest.API) {
+				api.On("KVSet", "preferences_demoUserID", []byte(`{"topic_template":"","duration_minutes":30,"invite_channel_members":false,"skip_recent_meeting_check":false,"lobby_bypass_scope":"","reminder_minutes":null,"sync_presence":false}`)).Return(nil)
+				api.On("KVGet", presenceUsersKey).Return(nil, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"topic_template":"","duration_minutes":30,"invite_channel_members":false,"skip_recent_meeting_check":false,"lobby_bypass_scope":"","reminder_minutes":null,"sync_presence":false}` + "\n",
+		},
+		{
+			name:           "Invalid preferences",
+			method:         http.MethodPut,
+			userID:         "demoUserID",
+			body:           `{"duration_minutes":-1}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "The duration must be between 1 and 1440 minutes.\n",
+		},
+		{
+			name:           "Method not allowed",
+			method:         http.MethodDelete,
+			userID:         "demoUserID",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedBody:   "Method not allowed\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			p := &Plugin{MattermostPlugin: plugin.MattermostPlugin{API: api}}
+			if tt.setup != nil {
+				tt.setup(api)
+			}
+
+			req := httptest.NewRequest(tt.method, "/api/v1/preferences", bytes.NewBufferString(tt.body))
+			if tt.userID != "" {
+				req.Header.Set("Mattermost-User-ID", tt.userID)
+			}
+			w := httptest.NewRecorder()
+
+			p.handlePreferences(w, req)
+
+			require.Equal(t, tt.expectedStatus, w.Result().StatusCode)
+			require.Equal(t, tt.expectedBody, w.Body.String())
+			api.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/i18n"
+	"github.com/pkg/errors"
+)
+
+const (
+	presenceSyncJobKey   = "presencesync"
+	presenceSyncInterval = time.Minute
+	presenceUsersKey     = "presenceusers"
+
+	// presenceStatusDuration bounds how long the meeting status outlives the sync, for instance
+	// when the plugin is disabled during a meeting. It is extended while the meeting goes on.
+	presenceStatusDuration = time.Hour
+	presenceStatusEmoji    = "calendar"
+
+	// maxPresenceBatch is the number of users Graph returns the presence of in one request.
+	maxPresenceBatch = 650
+	// presenceClientAttempts bounds how many users' tokens are tried to read the presences, as
+	// users who connected before the sync was enabled have not granted Presence.Read.All yet.
+	presenceClientAttempts = 3
+)
+
+// meetingActivities are the Microsoft Graph presence activities of a user in a call or meeting.
+var meetingActivities = []string{
+	"InACall",
+	"InAConferenceCall",
+	"InAMeeting",
+}
+
+// Presence is the Microsoft Teams presence of a user.
+type Presence struct {
+	Availability string `json:"availability"`
+	Activity     string `json:"activity"`
+}
+
+// inMeeting reports whether the presence shows the user in a call or meeting.
+func (pr *Presence) inMeeting() bool {
+	return slices.Contains(meetingActivities, pr.Activity)
+}
+
+// GetPresences returns the Teams presence of the given Microsoft users, keyed by their ID.
+func (c *Client) GetPresences(ctx context.Context, remoteIDs []string) (map[string]*Presence, error) {
+	presences := map[string]*Presence{}
+	for batch := range slices.Chunk(remoteIDs, maxPresenceBatch) {
+		in := struct {
+			IDs []string `json:"ids"`
+		}{IDs: batch}
+		var out struct {
+			Value []struct {
+				ID string `json:"id"`
+				Presence
+			} `json:"value"`
+		}
+		if err := c.do(ctx, http.MethodPost, "/communications/getPresencesByUserId", nil, &in, &out); err != nil {
+			return nil, errors.Wrap(err, "cannot get presences")
+		}
+		for _, presence := range out.Value {
+			presences[presence.ID] = &Presence{Availability: presence.Availability, Activity: presence.Activity}
+		}
+	}
+	return presences, nil
+}
+
+// presenceStatus records the custom status set for a user in a meeting, and the custom status
+// it replaced.
+type presenceStatus struct {
+	Text     string              `json:"text"`
+	Previous *model.CustomStatus `json:"previous,omitempty"`
+}
+
+// presenceUser is an entry of the index of users who opted in to the presence sync, so that the
+// sync reads a single key rather than the preferences and status of every connected user.
+type presenceUser struct {
+	// Status is the custom status set while the user is in a meeting.
+	Status *presenceStatus `json:"status,omitempty"`
+}
+
+func (p *Plugin) getPresenceUsersIndex() (map[string]*presenceUser, []byte, error) {
+	return getJSONIndex[*presenceUser](p.API, presenceUsersKey)
+}
+
+func (p *Plugin) updatePresenceUsersIndex(update func(index map[string]*presenceUser)) error {
+	return updateJSONIndex(p.API, presenceUsersKey, 0, update)
+}
+
+// setPresenceSync adds a user to the index of users who opted in, or removes them along with
+// the meeting status recorded for them. A meeting status set before a user opted out expires on
+// its own.
+func (p *Plugin) setPresenceSync(userID string, enabled bool) error {
+	index, _, err := p.getPresenceUsersIndex()
+	if err != nil {
+		return err
+	}
+	if _, ok := index[userID]; ok == enabled {
+		return nil
+	}
+
+	return p.updatePresenceUsersIndex(func(index map[string]*presenceUser) {
+		if !enabled {
+			delete(index, userID)
+		} else if _, ok := index[userID]; !ok {
+			index[userID] = &presenceUser{}
+		}
+	})
+}
+
+// syncPresence updates the custom status of the connected users who opted in from their Teams
+// presence. It runs on a single server of the cluster.
+func (p *Plugin) syncPresence() {
+	p.syncPresenceWithDeps(p.NewClient)
+}
+
+func (p *Plugin) syncPresenceWithDeps(newClient ClientFactory) {
+	if config := p.getConfiguration(); config == nil || !config.EnablePresenceSync {
+		return
+	}
+
+	presenceUsers, _, err := p.getPresenceUsersIndex()
+	if err != nil {
+		p.API.LogError("syncPresence, failed to get the presence users index", "error", err.Error())
+		return
+	}
+	if len(presenceUsers) == 0 {
+		return
+	}
+	connectedUsers, _, err := p.getConnectedUsersIndex()
+	if err != nil {
+		p.API.LogError("syncPresence, failed to get the connected users index", "error", err.Error())
+		return
+	}
+
+	userIDs := map[string]string{}
+	var remoteIDs []string
+	for userID := range presenceUsers {
+		if user, ok := connectedUsers[userID]; ok && user.RemoteID != "" {
+			userIDs[user.RemoteID] = userID
+			remoteIDs = append(remoteIDs, user.RemoteID)
+		}
+	}
+	if len(remoteIDs) == 0 {
+		return
+	}
+	slices.Sort(remoteIDs)
+
+	presences, err := p.getPresences(remoteIDs, userIDs, newClient)
+	if err != nil {
+		p.API.LogWarn("syncPresence, failed to get presences", "error", err.Error())
+		return
+	}
+
+	changed := map[string]*presenceStatus{}
+	for remoteID, presence := range presences {
+		userID, ok := userIDs[remoteID]
+		if !ok {
+			continue
+		}
+		previous := presenceUsers[userID].Status
+		status, err := p.syncUserPresence(userID, previous, presence)
+		if err != nil {
+			p.API.LogWarn("syncPresence, failed to sync user presence", "UserID", userID, "error", err.Error())
+		}
+		if status != previous {
+			changed[userID] = status
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	// Users who opted out in the meantime are left out of the index.
+	err = p.updatePresenceUsersIndex(func(index map[string]*presenceUser) {
+		for userID, status := range changed {
+			if user, ok := index[userID]; ok {
+				user.Status = status
+			}
+		}
+	})
+	if err != nil {
+		p.API.LogWarn("syncPresence, failed to update the presence users index", "error", err.Error())
+	}
+}
+
+// getPresences reads the presences of all users in batches, with the token of one of them as
+// Presence.Read.All lets any user read the presence of the others.
+func (p *Plugin) getPresences(remoteIDs []string, userIDs map[string]string, newClient ClientFactory) (map[string]*Presence, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.getConfiguration().getRequestTimeout())
+	defer cancel()
+
+	var err error
+	for _, remoteID := range remoteIDs[:min(len(remoteIDs), presenceClientAttempts)] {
+		var client ClientInterface
+		client, err = p.newUserClient(userIDs[remoteID], newClient)
+		if err != nil {
+			continue
+		}
+		var presences map[string]*Presence
+		presences, err = client.GetPresences(ctx, remoteIDs)
+		if err == nil {
+			return presences, nil
+		}
+	}
+	return nil, err
+}
+
+// syncUserPresence updates the custom status of a user from their presence, and returns the
+// meeting status to record for them.
+func (p *Plugin) syncUserPresence(userID string, status *presenceStatus, presence *Presence) (*presenceStatus, error) {
+	if status == nil && !presence.inMeeting() {
+		return nil, nil
+	}
+
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		return status, appErr
+	}
+
+	if presence.inMeeting() {
+		return p.setMeetingCustomStatus(user, status)
+	}
+	if err := p.restoreCustomStatus(user, status); err != nil {
+		return status, err
+	}
+	return nil, nil
+}
+
+// setMeetingCustomStatus sets the meeting custom status of a user, or extends it if it is about
+// to expire. A status the user set during the meeting is left alone.
+func (p *Plugin) setMeetingCustomStatus(user *model.User, recorded *presenceStatus) (*presenceStatus, error) {
+	current := user.GetCustomStatus()
+	status := recorded
+	if status != nil {
+		if current == nil || current.Text != status.Text || time.Until(current.ExpiresAt) > presenceStatusDuration/2 {
+			return status, nil
+		}
+	} else {
+		status = &presenceStatus{
+			Text: p.localize(p.getUserLocalizer(user.Id), &i18n.Message{
+				ID:    "mstmeetings.presence.in_meeting",
+				Other: "In a Teams meeting",
+			}, nil),
+			Previous: current,
+		}
+	}
+
+	appErr := p.API.UpdateUserCustomStatus(user.Id, &model.CustomStatus{
+		Emoji:     presenceStatusEmoji,
+		Text:      status.Text,
+		Duration:  "date_and_time",
+		ExpiresAt: time.Now().Add(presenceStatusDuration),
+	})
+	if appErr != nil {
+		return recorded, appErr
+	}
+	return status, nil
+}
+
+// restoreCustomStatus restores the custom status a user had before their meeting, unless they
+// changed their status during the meeting.
+func (p *Plugin) restoreCustomStatus(user *model.User, status *presenceStatus) error {
+	current := user.GetCustomStatus()
+	if current == nil || current.Text != status.Text {
+		return nil
+	}
+
+	var appErr *model.AppError
+	if previous := status.Previous; previous != nil && (previous.Text != "" || previous.Emoji != "") && previous.AreDurationAndExpirationTimeValid() {
+		appErr = p.API.UpdateUserCustomStatus(user.Id, previous)
+	} else {
+		appErr = p.API.RemoveUserCustomStatus(user.Id)
+	}
+	if appErr != nil {
+		return appErr
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncUserPresence(t *testing.T) {
+	previous := &model.CustomStatus{Emoji: "palm_tree", Text: "On vacation"}
+	meetingStatus := &model.CustomStatus{Emoji: presenceStatusEmoji, Text: "In a Teams meeting", Duration: "date_and_time", ExpiresAt: time.Now().Add(presenceStatusDuration)}
+	recordedStatus := &presenceStatus{Text: "In a Teams meeting", Previous: previous}
+
+	isMeetingStatus := mock.MatchedBy(func(status *model.CustomStatus) bool {
+		return status.Text == "In a Teams meeting" && status.ExpiresAt.After(time.Now())
+	})
+
+	tests := []struct {
+		name           string
+		activity       string
+		customStatus   *model.CustomStatus
+		recordedStatus *presenceStatus
+		expectedCalls  func(api *plugintest.API)
+		expectedStatus *presenceStatus
+	}{
+		{
+			name:         "Meeting started",
+			activity:     "InAMeeting",
+			customStatus: previous,
+			expectedCalls: func(api *plugintest.API) {
+				api.On("UpdateUserCustomStatus", "demoUserID", isMeetingStatus).Return(nil)
+			},
+			expectedStatus: recordedStatus,
+		},
+		{
+			name:           "Meeting going on",
+			activity:       "InACall",
+			customStatus:   meetingStatus,
+			recordedStatus: recordedStatus,
+			expectedCalls:  func(_ *plugintest.API) {},
+			expectedStatus: recordedStatus,
+		},
+		{
+			name:     "Meeting status about to expire",
+			activity: "InAMeeting",
+			customStatus: &model.CustomStatus{
+				Emoji:     presenceStatusEmoji,
+				Text:      "In a Teams meeting",
+				Duration:  "date_and_time",
+				ExpiresAt: time.Now().Add(5 * time.Minute),
+			},
+			recordedStatus: recordedStatus,
+			expectedCalls: func(api *plugintest.API) {
+				api.On("UpdateUserCustomStatus", "demoUserID", isMeetingStatus).Return(nil)
+			},
+			expectedStatus: recordedStatus,
+		},
+		{
+			name:           "Meeting ended",
+			activity:       "Available",
+			customStatus:   meetingStatus,
+			recordedStatus: recordedStatus,
+			expectedCalls: func(api *plugintest.API) {
+				api.On("UpdateUserCustomStatus", "demoUserID", previous).Return(nil)
+			},
+		},
+		{
+			name:           "Status changed during the meeting",
+			activity:       "Available",
+			customStatus:   &model.CustomStatus{Emoji: "coffee", Text: "Break"},
+			recordedStatus: recordedStatus,
+			expectedCalls:  func(_ *plugintest.API) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			defer api.AssertExpectations(t)
+			p := SetupMockPlugin(api, nil, nil)
+			p.setConfiguration(&configuration{EncryptionKey: "demo_encrypt_key", EnablePresenceSync: true})
+
+			user := &model.User{Id: "demoUserID"}
+			if tt.customStatus != nil {
+				require.NoError(t, user.SetCustomStatus(tt.customStatus))
+			}
+
+			api.On("GetUser", "demoUserID").Return(user, nil)
+			tt.expectedCalls(api)
+
+			status, err := p.syncUserPresence("demoUserID", tt.recordedStatus, &Presence{Activity: tt.activity})
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedStatus, status)
+		})
+	}
+
+	t.Run("Not in a meeting", func(t *testing.T) {
+		api := &plugintest.API{}
+		defer api.AssertExpectations(t)
+		p := SetupMockPlugin(api, nil, nil)
+
+		status, err := p.syncUserPresence("demoUserID", nil, &Presence{Activity: "Available"})
+		require.NoError(t, err)
+		require.Nil(t, status)
+	})
+}
+
+func TestSyncPresence(t *testing.T) {
+	api := &plugintest.API{}
+	defer api.AssertExpectations(t)
+	mockClient := &MockClient{}
+	defer mockClient.AssertExpectations(t)
+	p := SetupMockPlugin(api, nil, nil)
+	p.setConfiguration(&configuration{EncryptionKey: "demo_encrypt_key", EnablePresenceSync: true})
+	setupConnectedDemoUser(t, api)
+
+	connectedUsers, err := json.Marshal(map[string]*connectedUser{
+		"demoUserID":  {UserID: "demoUserID", RemoteID: "demoRemoteID", ConnectedAt: 2},
+		"otherUserID": {UserID: "otherUserID", RemoteID: "otherRemoteID", ConnectedAt: 1},
+	})
+	require.NoError(t, err)
+	presenceUsers := []byte(`{"demoUserID":{}}`)
+
+	// Only the users who opted in are synced, all with one request, and their meeting status is
+	// recorded in the index.
+	api.On("KVGet", presenceUsersKey).Return(presenceUsers, nil)
+	api.On("KVGet", connectedUsersKey).Return(connectedUsers, nil)
+	mockClient.On("GetPresences", []string{"demoRemoteID"}).Return(map[string]*Presence{"demoRemoteID": {Activity: "InAMeeting"}}, nil)
+	api.On("GetUser", "demoUserID").Return(&model.User{Id: "demoUserID"}, nil)
+	api.On("UpdateUserCustomStatus", "demoUserID", mock.AnythingOfType("*model.CustomStatus")).Return(nil)
+	api.On("KVCompareAndSet", presenceUsersKey, presenceUsers, []byte(`{"demoUserID":{"status":{"text":"In a Teams meeting"}}}`)).Return(true, nil)
+
+	p.syncPresenceWithDeps(mockClientFactory(mockClient))
+}
+
+func TestSetPresenceSync(t *testing.T) {
+	api := &plugintest.API{}
+	defer api.AssertExpectations(t)
+	p := SetupMockPlugin(api, nil, nil)
+
+	// Opting out drops the meeting status recorded for the user.
+	presenceUsers := []byte(`{"demoUserID":{"status":{"text":"In a Teams meeting"}},"otherUserID":{}}`)
+	api.On("KVGet", presenceUsersKey).Return(presenceUsers, nil)
+	api.On("KVCompareAndSet", presenceUsersKey, presenceUsers, []byte(`{"otherUserID":{}}`)).Return(true, nil)
+	require.NoError(t, p.setPresenceSync("demoUserID", false))
+
+	// Nothing is written when the user is already in the index.
+	require.NoError(t, p.setPresenceSync("otherUserID", true))
+}
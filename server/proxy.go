@@ -0,0 +1,73 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/oauth2"
+)
+
+// newHTTPClient builds the HTTP client used for all Azure AD and Microsoft Graph traffic,
+// applying the configured outbound proxy and custom CA certificates. It returns nil when
+// neither is configured, in which case the default client is used.
+func (c *configuration) newHTTPClient() (*http.Client, error) {
+	if c.ProxyURL == "" && strings.TrimSpace(c.CACertificates) == "" {
+		return nil, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if c.ProxyURL != "" {
+		proxyURL, err := url.Parse(c.ProxyURL)
+		if err != nil || proxyURL.Host == "" {
+			return nil, errors.New("ProxyURL is not a valid URL")
+		}
+		if c.ProxyUsername != "" {
+			proxyURL.User = url.UserPassword(c.ProxyUsername, c.ProxyPassword)
+		}
+
+		proxyFunc := (&httpproxy.Config{
+			HTTPProxy:  proxyURL.String(),
+			HTTPSProxy: proxyURL.String(),
+			NoProxy:    c.NoProxy,
+		}).ProxyFunc()
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		}
+	}
+
+	if strings.TrimSpace(c.CACertificates) != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(c.CACertificates)) {
+			return nil, errors.New("CACertificates does not contain any valid PEM certificate")
+		}
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs:    pool,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// oauthContext returns a context that makes the oauth2 package use the configured HTTP
+// client for token exchange, token refresh and the requests of clients built from it.
+func (p *Plugin) oauthContext(ctx context.Context) context.Context {
+	config := p.getConfiguration()
+	if config == nil || config.httpClient == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, config.httpClient)
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	t.Run("no proxy or certificates configured", func(t *testing.T) {
+		client, err := (&configuration{}).newHTTPClient()
+		require.NoError(t, err)
+		require.Nil(t, client)
+	})
+
+	t.Run("invalid proxy URL", func(t *testing.T) {
+		_, err := (&configuration{ProxyURL: "not a url"}).newHTTPClient()
+		require.EqualError(t, err, "ProxyURL is not a valid URL")
+	})
+
+	t.Run("invalid CA certificates", func(t *testing.T) {
+		_, err := (&configuration{CACertificates: "not a certificate"}).newHTTPClient()
+		require.EqualError(t, err, "CACertificates does not contain any valid PEM certificate")
+	})
+
+	t.Run("proxy with credentials and exclusions", func(t *testing.T) {
+		client, err := (&configuration{
+			ProxyURL:      "http://proxy.example.com:3128",
+			ProxyUsername: "user",
+			ProxyPassword: "p@ss",
+			NoProxy:       "internal.example.com",
+		}).newHTTPClient()
+		require.NoError(t, err)
+
+		transport := client.Transport.(*http.Transport)
+
+		req, err := http.NewRequest(http.MethodGet, "https://graph.microsoft.com/v1.0/me", nil)
+		require.NoError(t, err)
+		proxyURL, err := transport.Proxy(req)
+		require.NoError(t, err)
+		require.Equal(t, "proxy.example.com:3128", proxyURL.Host)
+		password, _ := proxyURL.User.Password()
+		require.Equal(t, "user", proxyURL.User.Username())
+		require.Equal(t, "p@ss", password)
+
+		req, err = http.NewRequest(http.MethodGet, "https://internal.example.com/", nil)
+		require.NoError(t, err)
+		proxyURL, err = transport.Proxy(req)
+		require.NoError(t, err)
+		require.Nil(t, proxyURL)
+	})
+}
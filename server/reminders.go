@@ -0,0 +1,331 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/mattermost/mattermost/server/public/pluginapi/i18n"
+)
+
+const (
+	meetingRemindersKey      = "meetingreminders"
+	meetingReminderJobKey    = "meetingreminders"
+	meetingReminderInterval  = time.Minute
+	defaultReminderLeadTime  = 10 * time.Minute
+	maxReminderMinutes       = 24 * 60
+	joinMeetingActionPath    = "/api/v1/actions/join"
+	joinMeetingActionContext = "join_url"
+)
+
+// scheduledMeeting is an entry of the index of meetings with pending reminders, keyed by the ID
+// of their post.
+type scheduledMeeting struct {
+	PostID    string `json:"post_id"`
+	ChannelID string `json:"channel_id"`
+	Subject   string `json:"subject"`
+	JoinURL   string `json:"join_url"`
+	StartAt   int64  `json:"start_at"`
+	// OrganizerID is the user who posted the meeting, whose account tells whether it was
+	// cancelled in Teams or Outlook.
+	OrganizerID string `json:"organizer_id,omitempty"`
+	EventID     string `json:"event_id,omitempty"`
+	// Reminders maps the invitees to when they are reminded, in milliseconds.
+	Reminders map[string]int64 `json:"reminders"`
+}
+
+// getReminderLeadTime returns how long before a meeting the user is reminded of it. Zero turns
+// reminders off.
+func (prefs *UserPreferences) getReminderLeadTime() time.Duration {
+	if prefs.ReminderMinutes == nil {
+		return defaultReminderLeadTime
+	}
+	return time.Duration(*prefs.ReminderMinutes) * time.Minute
+}
+
+func (p *Plugin) getMeetingRemindersIndex() (map[string]*scheduledMeeting, []byte, error) {
+	return getJSONIndex[*scheduledMeeting](p.API, meetingRemindersKey)
+}
+
+func (p *Plugin) updateMeetingRemindersIndex(update func(index map[string]*scheduledMeeting)) error {
+	return updateJSONIndex(p.API, meetingRemindersKey, 0, update)
+}
+
+// scheduleMeetingReminders schedules the reminders of the invitees of a meeting post. The lead
+// time of the meeting applies to everyone when set, and each invitee's own setting otherwise.
+func (p *Plugin) scheduleMeetingReminders(post *model.Post, meeting *OnlineMeeting, inviteeIDs []string, leadTime *time.Duration) error {
+	start := meeting.StartDateTime
+	reminders := map[string]int64{}
+	for _, userID := range inviteeIDs {
+		var lead time.Duration
+		if leadTime != nil {
+			lead = *leadTime
+		} else {
+			lead = p.getUserPreferencesOrDefault(userID).getReminderLeadTime()
+		}
+		if lead <= 0 {
+			continue
+		}
+		reminders[userID] = start.Add(-lead).UnixMilli()
+	}
+	if len(reminders) == 0 {
+		return nil
+	}
+
+	return p.updateMeetingRemindersIndex(func(index map[string]*scheduledMeeting) {
+		index[post.Id] = &scheduledMeeting{
+			PostID:      post.Id,
+			ChannelID:   post.ChannelId,
+			Subject:     getString("meeting_topic", post.GetProps()),
+			JoinURL:     meeting.JoinURL,
+			StartAt:     start.UnixMilli(),
+			OrganizerID: post.UserId,
+			EventID:     meeting.EventID,
+			Reminders:   reminders,
+		}
+	})
+}
+
+// cancelMeetingReminders drops the pending reminders of a meeting post.
+func (p *Plugin) cancelMeetingReminders(postID string) error {
+	index, _, err := p.getMeetingRemindersIndex()
+	if err != nil {
+		return err
+	}
+	if _, ok := index[postID]; !ok {
+		return nil
+	}
+
+	return p.updateMeetingRemindersIndex(func(index map[string]*scheduledMeeting) {
+		delete(index, postID)
+	})
+}
+
+// MessageHasBeenDeleted drops deleted meeting posts from the index of their channel, and cancels
+// the reminders and chat mirror of the meetings started through this plugin.
+func (p *Plugin) MessageHasBeenDeleted(_ *plugin.Context, post *model.Post) {
+	if getString("meeting_link", post.GetProps()) != "" {
+		if err := p.removeActiveMeeting(post.ChannelId, post.Id); err != nil {
+			p.API.LogWarn("failed to remove active meeting", "PostID", post.Id, "error", err.Error())
+		}
+	}
+	if post.Type != "custom_mstmeetings" {
+		return
+	}
+	if err := p.cancelMeetingReminders(post.Id); err != nil {
+		p.API.LogWarn("failed to cancel meeting reminders", "PostID", post.Id, "error", err.Error())
+	}
+	if err := p.stopMeetingChatMirror(post.Id, p.NewClient); err != nil {
+		p.API.LogWarn("failed to stop mirroring the meeting chat", "PostID", post.Id, "error", err.Error())
+	}
+}
+
+func (p *Plugin) sendMeetingReminders() {
+	p.sendMeetingRemindersWithDeps(p.NewClient)
+}
+
+// sendMeetingRemindersWithDeps sends the reminders that are due, unless the meeting was cancelled
+// in Teams or Outlook. It runs on a single server of the cluster.
+func (p *Plugin) sendMeetingRemindersWithDeps(newClient ClientFactory) {
+	now := time.Now().UnixMilli()
+	index, _, err := p.getMeetingRemindersIndex()
+	if err != nil {
+		p.API.LogError("sendMeetingReminders, failed to get the meeting reminders index", "error", err.Error())
+		return
+	}
+	if !hasDueReminders(index, now) {
+		return
+	}
+
+	due := map[string]*scheduledMeeting{}
+
+	// Due reminders are removed before being sent, so that a failure never sends them twice.
+	err = p.updateMeetingRemindersIndex(func(index map[string]*scheduledMeeting) {
+		clear(due)
+		for postID, meeting := range index {
+			for userID, remindAt := range meeting.Reminders {
+				if remindAt > now {
+					continue
+				}
+				delete(meeting.Reminders, userID)
+				if meeting.StartAt <= now {
+					continue
+				}
+				if due[postID] == nil {
+					dueMeeting := *meeting
+					dueMeeting.Reminders = map[string]int64{}
+					due[postID] = &dueMeeting
+				}
+				due[postID].Reminders[userID] = remindAt
+			}
+			if len(meeting.Reminders) == 0 || meeting.StartAt <= now {
+				delete(index, postID)
+			}
+		}
+	})
+	if err != nil {
+		p.API.LogError("sendMeetingReminders, failed to update the meeting reminders index", "error", err.Error())
+		return
+	}
+
+	for postID, meeting := range due {
+		if p.isScheduledMeetingCancelled(meeting, newClient) {
+			p.API.LogDebug("sendMeetingReminders, meeting was cancelled", "PostID", postID)
+			if err := p.cancelMeetingReminders(postID); err != nil {
+				p.API.LogWarn("sendMeetingReminders, failed to cancel meeting reminders", "PostID", postID, "error", err.Error())
+			}
+			continue
+		}
+		for userID := range meeting.Reminders {
+			if err := p.sendMeetingReminder(userID, meeting); err != nil {
+				p.API.LogWarn("sendMeetingReminders, failed to send meeting reminder", "UserID", userID, "PostID", meeting.PostID, "error", err.Error())
+			}
+		}
+	}
+}
+
+// isScheduledMeetingCancelled asks the organizer's account whether a meeting was cancelled since
+// it was posted. Meetings are assumed to take place when the organizer cannot be asked.
+func (p *Plugin) isScheduledMeetingCancelled(meeting *scheduledMeeting, newClient ClientFactory) bool {
+	if meeting.OrganizerID == "" {
+		return false
+	}
+	// With application permissions, organizers have no connected account to ask.
+	if config := p.getConfiguration(); config != nil && config.UseApplicationPermissions {
+		return false
+	}
+	client, err := p.newUserClient(meeting.OrganizerID, newClient)
+	if err != nil {
+		p.API.LogDebug("cannot check whether the meeting was cancelled", "PostID", meeting.PostID, "error", err.Error())
+		return false
+	}
+
+	cancelled, err := client.IsMeetingCancelled(context.Background(), meeting.JoinURL, meeting.EventID)
+	if err != nil {
+		p.API.LogWarn("cannot check whether the meeting was cancelled", "PostID", meeting.PostID, "error", err.Error())
+		return false
+	}
+	return cancelled
+}
+
+// hasDueReminders reports whether the index has reminders to send or meetings that started.
+func hasDueReminders(index map[string]*scheduledMeeting, now int64) bool {
+	for _, meeting := range index {
+		if meeting.StartAt <= now {
+			return true
+		}
+		for _, remindAt := range meeting.Reminders {
+			if remindAt <= now {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sendMeetingReminder sends a direct message reminding a user of a meeting, with a button to
+// join it.
+func (p *Plugin) sendMeetingReminder(userID string, meeting *scheduledMeeting) error {
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		return appErr
+	}
+	if user.IsBot || user.DeleteAt != 0 {
+		return nil
+	}
+
+	channel, appErr := p.API.GetDirectChannel(userID, p.botUserID)
+	if appErr != nil {
+		return appErr
+	}
+
+	l := p.getUserLocalizer(userID)
+	post := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: channel.Id,
+		Message: p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.reminder.message",
+			Other: "Reminder: **{{.Subject}}** starts at {{.StartTime}}.",
+		}, map[string]any{
+			"Subject":   meeting.Subject,
+			"StartTime": time.UnixMilli(meeting.StartAt).In(getUserLocation(user)).Format("15:04 MST"),
+		}),
+	}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+		Title:     meeting.Subject,
+		TitleLink: meeting.JoinURL,
+		Actions:   []*model.PostAction{p.newJoinMeetingAction(l, meeting.JoinURL)},
+	}})
+
+	if _, appErr = p.API.CreatePost(post); appErr != nil {
+		return appErr
+	}
+	return nil
+}
+
+// newJoinMeetingAction returns a "Join" button for a meeting.
+func (p *Plugin) newJoinMeetingAction(l *i18n.Localizer, joinURL string) *model.PostAction {
+	return &model.PostAction{
+		Name:  p.localize(l, &i18n.Message{ID: "mstmeetings.reminder.join", Other: "Join"}, nil),
+		Type:  model.PostActionTypeButton,
+		Style: "primary",
+		Integration: &model.PostActionIntegration{
+			URL:     fmt.Sprintf("/plugins/%s%s", url.PathEscape(manifest.Id), joinMeetingActionPath),
+			Context: map[string]any{joinMeetingActionContext: joinURL},
+		},
+	}
+}
+
+// handleJoinMeetingAction answers a click on a "Join" button with the link of the meeting, as
+// post actions cannot open links themselves.
+func (p *Plugin) handleJoinMeetingAction(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		p.API.LogError("handleJoinMeetingAction, unauthorized user")
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request model.PostActionIntegrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		p.API.LogError("handleJoinMeetingAction, failed to decode action request", "Error", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	post := p.getActionPost(userID, &request)
+	if post == nil {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var joinURL string
+	if context := getPostActionContext(post, func(context map[string]any) bool {
+		return context[joinMeetingActionContext] != nil
+	}); context != nil {
+		joinURL, _ = context[joinMeetingActionContext].(string)
+	}
+	if parsed, err := url.Parse(joinURL); err != nil || parsed.Scheme != "https" {
+		http.Error(w, "Invalid join URL", http.StatusBadRequest)
+		return
+	}
+
+	response := &model.PostActionIntegrationResponse{
+		EphemeralText: p.localize(p.getUserLocalizer(userID), &i18n.Message{
+			ID:    "mstmeetings.reminder.join_link",
+			Other: "[Click here to join the meeting.]({{.JoinURL}})",
+		}, map[string]any{"JoinURL": joinURL}),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		p.API.LogWarn("failed to write response", "error", err.Error())
+	}
+}
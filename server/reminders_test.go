@@ -0,0 +1,292 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleMeetingReminders(t *testing.T) {
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Millisecond)
+	post := &model.Post{Id: "postID", ChannelId: "channelID", Props: model.StringInterface{"meeting_topic": "Planning"}}
+	meeting := &OnlineMeeting{JoinURL: "joinURL", StartDateTime: start}
+
+	tests := []struct {
+		name              string
+		leadTime          *time.Duration
+		expectedReminders map[string]int64
+	}{
+		{
+			name: "Each invitee's setting",
+			expectedReminders: map[string]int64{
+				"defaultUserID": start.Add(-defaultReminderLeadTime).UnixMilli(),
+				"earlyUserID":   start.Add(-time.Hour).UnixMilli(),
+			},
+		},
+		{
+			name:     "Lead time of the meeting",
+			leadTime: model.NewPointer(5 * time.Minute),
+			expectedReminders: map[string]int64{
+				"defaultUserID": start.Add(-5 * time.Minute).UnixMilli(),
+				"earlyUserID":   start.Add(-5 * time.Minute).UnixMilli(),
+				"offUserID":     start.Add(-5 * time.Minute).UnixMilli(),
+			},
+		},
+		{
+			name:     "Reminders turned off for the meeting",
+			leadTime: model.NewPointer(time.Duration(0)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			defer api.AssertExpectations(t)
+			p := &Plugin{MattermostPlugin: plugin.MattermostPlugin{API: api}}
+
+			if tt.leadTime == nil {
+				api.On("KVGet", "preferences_defaultUserID").Return(nil, nil)
+				api.On("KVGet", "preferences_earlyUserID").Return([]byte(`{"reminder_minutes":60}`), nil)
+				api.On("KVGet", "preferences_offUserID").Return([]byte(`{"reminder_minutes":0}`), nil)
+			}
+			if tt.expectedReminders != nil {
+				expected, err := json.Marshal(map[string]*scheduledMeeting{"postID": {
+					PostID:    "postID",
+					ChannelID: "channelID",
+					Subject:   "Planning",
+					JoinURL:   "joinURL",
+					StartAt:   start.UnixMilli(),
+					Reminders: tt.expectedReminders,
+				}})
+				require.NoError(t, err)
+				api.On("KVGet", "meetingreminders").Return(nil, nil)
+				api.On("KVCompareAndSet", "meetingreminders", []byte(nil), expected).Return(true, nil)
+			}
+
+			err := p.scheduleMeetingReminders(post, meeting, []string{"defaultUserID", "earlyUserID", "offUserID"}, tt.leadTime)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestSendMeetingReminders(t *testing.T) {
+	api := &plugintest.API{}
+	defer api.AssertExpectations(t)
+	p := &Plugin{MattermostPlugin: plugin.MattermostPlugin{API: api}, botUserID: "botUserID"}
+
+	now := time.Now()
+	start := now.Add(10 * time.Minute).Truncate(time.Minute)
+	stored, err := json.Marshal(map[string]*scheduledMeeting{
+		"soonPostID": {
+			PostID:    "soonPostID",
+			Subject:   "Planning",
+			JoinURL:   "https://teams.microsoft.com/l/meetup-join/planning",
+			StartAt:   start.UnixMilli(),
+			Reminders: map[string]int64{"dueUserID": now.Add(-time.Minute).UnixMilli(), "laterUserID": now.Add(5 * time.Minute).UnixMilli()},
+		},
+		"startedPostID": {
+			PostID:    "startedPostID",
+			StartAt:   now.Add(-time.Minute).UnixMilli(),
+			Reminders: map[string]int64{"lateUserID": now.Add(-2 * time.Minute).UnixMilli()},
+		},
+	})
+	require.NoError(t, err)
+	expected, err := json.Marshal(map[string]*scheduledMeeting{
+		"soonPostID": {
+			PostID:    "soonPostID",
+			Subject:   "Planning",
+			JoinURL:   "https://teams.microsoft.com/l/meetup-join/planning",
+			StartAt:   start.UnixMilli(),
+			Reminders: map[string]int64{"laterUserID": now.Add(5 * time.Minute).UnixMilli()},
+		},
+	})
+	require.NoError(t, err)
+
+	api.On("KVGet", "meetingreminders").Return(stored, nil)
+	api.On("KVCompareAndSet", "meetingreminders", stored, expected).Return(true, nil)
+	api.On("GetUser", "dueUserID").Return(&model.User{Id: "dueUserID"}, nil)
+	api.On("GetDirectChannel", "dueUserID", "botUserID").Return(&model.Channel{Id: "dmChannelID"}, nil)
+	api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+		attachments := post.Attachments()
+		return post.ChannelId == "dmChannelID" &&
+			post.Message == "Reminder: **Planning** starts at "+start.UTC().Format("15:04 MST")+"." &&
+			len(attachments) == 1 && len(attachments[0].Actions) == 1 &&
+			attachments[0].Actions[0].Integration.Context[joinMeetingActionContext] == "https://teams.microsoft.com/l/meetup-join/planning"
+	})).Return(&model.Post{}, nil)
+
+	p.sendMeetingReminders()
+}
+
+func TestSendMeetingRemindersCancelledMeeting(t *testing.T) {
+	api := &plugintest.API{}
+	defer api.AssertExpectations(t)
+	mockClient := &MockClient{}
+	defer mockClient.AssertExpectations(t)
+	p := SetupMockPlugin(api, nil, nil)
+	p.setConfiguration(&configuration{EncryptionKey: "demo_encrypt_key"})
+	setupConnectedDemoUser(t, api)
+
+	now := time.Now()
+	stored, err := json.Marshal(map[string]*scheduledMeeting{
+		"postID": {
+			PostID:      "postID",
+			JoinURL:     "https://teams.microsoft.com/l/meetup-join/planning",
+			StartAt:     now.Add(10 * time.Minute).UnixMilli(),
+			OrganizerID: "demoUserID",
+			EventID:     "eventID",
+			Reminders:   map[string]int64{"dueUserID": now.Add(-time.Minute).UnixMilli()},
+		},
+	})
+	require.NoError(t, err)
+
+	// The due reminder is dropped along with the meeting, so cancelling finds nothing left.
+	api.On("KVGet", "meetingreminders").Return(stored, nil).Twice()
+	api.On("KVCompareAndSet", "meetingreminders", stored, []byte(`{}`)).Return(true, nil)
+	api.On("KVGet", "meetingreminders").Return([]byte(`{}`), nil)
+	mockClient.On("IsMeetingCancelled", "https://teams.microsoft.com/l/meetup-join/planning", "eventID").Return(true, nil)
+	api.On("LogDebug", "sendMeetingReminders, meeting was cancelled", "PostID", "postID").Return(nil)
+
+	p.sendMeetingRemindersWithDeps(mockClientFactory(mockClient))
+}
+
+func TestSendMeetingRemindersNothingDue(t *testing.T) {
+	api := &plugintest.API{}
+	defer api.AssertExpectations(t)
+	p := &Plugin{MattermostPlugin: plugin.MattermostPlugin{API: api}}
+
+	stored, err := json.Marshal(map[string]*scheduledMeeting{
+		"postID": {
+			PostID:    "postID",
+			StartAt:   time.Now().Add(time.Hour).UnixMilli(),
+			Reminders: map[string]int64{"userID": time.Now().Add(50 * time.Minute).UnixMilli()},
+		},
+	})
+	require.NoError(t, err)
+	api.On("KVGet", "meetingreminders").Return(stored, nil)
+
+	p.sendMeetingReminders()
+}
+
+func TestMessageHasBeenDeleted(t *testing.T) {
+	api := &plugintest.API{}
+	defer api.AssertExpectations(t)
+	p := &Plugin{MattermostPlugin: plugin.MattermostPlugin{API: api}}
+
+	stored := []byte(`{"postID":{"post_id":"postID","channel_id":"","subject":"","join_url":"","start_at":0,"reminders":{"userID":1}}}`)
+	api.On("KVGet", "meetingreminders").Return(stored, nil)
+	api.On("KVCompareAndSet", "meetingreminders", stored, []byte(`{}`)).Return(true, nil)
+	api.On("KVGet", "meetingchats").Return(nil, nil)
+	activeMeetings := []byte(`{"postID":{"post_id":"postID"}}`)
+	api.On("KVGet", "activemeetings_channelID").Return(activeMeetings, nil)
+	api.On("KVSetWithOptions", "activemeetings_channelID", []byte(`{}`), mock.Anything).Return(true, nil)
+
+	p.MessageHasBeenDeleted(nil, &model.Post{Id: "postID", ChannelId: "channelID", Type: "custom_mstmeetings", Props: model.StringInterface{"meeting_link": "joinURL"}})
+	p.MessageHasBeenDeleted(nil, &model.Post{Id: "otherPostID", Type: "custom_mstmeetings"})
+	p.MessageHasBeenDeleted(nil, &model.Post{Id: "postID"})
+}
+
+func TestHandleJoinMeetingAction(t *testing.T) {
+	tests := []struct {
+		name           string
+		joinURL        any
+		postChannelID  string
+		postMissing    bool
+		canRead        bool
+		expectedStatus int
+	}{
+		{
+			name:           "Join link",
+			joinURL:        "https://teams.microsoft.com/l/meetup-join/planning",
+			postChannelID:  "channelID",
+			canRead:        true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Invalid link",
+			joinURL:        "javascript:alert(1)",
+			postChannelID:  "channelID",
+			canRead:        true,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Missing link",
+			postChannelID:  "channelID",
+			canRead:        true,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Post in another channel",
+			joinURL:        "https://teams.microsoft.com/l/meetup-join/planning",
+			postChannelID:  "otherChannelID",
+			canRead:        true,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "No permission to the channel",
+			joinURL:        "https://teams.microsoft.com/l/meetup-join/planning",
+			postChannelID:  "channelID",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Post not found",
+			postMissing:    true,
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			p := &Plugin{MattermostPlugin: plugin.MattermostPlugin{API: api}}
+
+			if tt.postMissing {
+				api.On("GetPost", "postID").Return(nil, &model.AppError{Message: "not found"})
+			} else {
+				post := &model.Post{Id: "postID", ChannelId: tt.postChannelID}
+				actions := []*model.PostAction{}
+				if tt.joinURL != nil {
+					actions = append(actions, &model.PostAction{
+						Name:        "Join",
+						Integration: &model.PostActionIntegration{Context: map[string]any{joinMeetingActionContext: tt.joinURL}},
+					})
+				}
+				model.ParseSlackAttachment(post, []*model.SlackAttachment{{Actions: actions}})
+				api.On("GetPost", "postID").Return(post, nil)
+			}
+			api.On("HasPermissionToChannel", "demoUserID", "channelID", model.PermissionReadChannel).Return(tt.canRead)
+
+			// The URL sent by the client is ignored in favor of the one stored with the post.
+			body, err := json.Marshal(&model.PostActionIntegrationRequest{
+				UserId:    "demoUserID",
+				PostId:    "postID",
+				ChannelId: "channelID",
+				Context:   map[string]any{joinMeetingActionContext: "https://example.com/phishing"},
+			})
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, joinMeetingActionPath, bytes.NewReader(body))
+			r.Header.Set("Mattermost-User-Id", "demoUserID")
+			p.handleJoinMeetingAction(w, r)
+
+			require.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var response model.PostActionIntegrationResponse
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+				require.Equal(t, "[Click here to join the meeting.](https://teams.microsoft.com/l/meetup-join/planning)", response.EphemeralText)
+			}
+		})
+	}
+}
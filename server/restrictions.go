@@ -0,0 +1,123 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/pluginapi/i18n"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+var errorPageTemplate = template.Must(template.New("error").Parse(`
+<!DOCTYPE html>
+<html>
+	<head>
+		<title>MS Teams Meetings</title>
+	</head>
+	<body>
+		<h3>{{.Title}}</h3>
+		<p>{{.Message}}</p>
+	</body>
+</html>
+`))
+
+// writeHTMLError renders an error page for the OAuth flow, which runs in a browser window.
+func writeHTMLError(w http.ResponseWriter, status int, title, message string) {
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(status)
+	_ = errorPageTemplate.Execute(w, struct{ Title, Message string }{title, message})
+}
+
+// splitList parses a comma-separated setting into lower-cased, trimmed values.
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// getTenantID reads the tenant ID claim of the ID token returned with an OAuth token, which is
+// requested with the openid scope. Unlike access tokens, ID tokens are meant to be read by the
+// client, and this one comes straight from the token endpoint, so its signature is not checked.
+func getTenantID(token *oauth2.Token) (string, error) {
+	idToken, _ := token.Extra("id_token").(string)
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return "", errors.New("token has no ID token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.Wrap(err, "cannot decode ID token")
+	}
+
+	var claims struct {
+		TenantID string `json:"tid"`
+	}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return "", errors.Wrap(err, "cannot decode ID token claims")
+	}
+	if claims.TenantID == "" {
+		return "", errors.New("ID token has no tenant")
+	}
+	return strings.ToLower(claims.TenantID), nil
+}
+
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
+
+// checkConnectionAllowed enforces the tenant and email domain restrictions on a Microsoft account
+// being connected. The returned error is meant to be shown to the user.
+func (p *Plugin) checkConnectionAllowed(l *i18n.Localizer, userID string, remoteUser *RemoteUser, token *oauth2.Token) error {
+	config := p.getConfiguration()
+
+	if allowedTenants := splitList(config.AllowedTenantIDs); len(allowedTenants) > 0 {
+		tenantID, err := getTenantID(token)
+		if err != nil || !slices.Contains(allowedTenants, tenantID) {
+			return errors.New(p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.oauth.tenant_not_allowed",
+				Other: "Your Microsoft account does not belong to an organization allowed by the system administrator.",
+			}, nil))
+		}
+	}
+
+	if allowedDomains := splitList(config.AllowedEmailDomains); len(allowedDomains) > 0 {
+		if !slices.Contains(allowedDomains, emailDomain(remoteUser.Mail)) {
+			return errors.New(p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.oauth.email_domain_not_allowed",
+				Other: "The email domain of your Microsoft account ({{.Domain}}) is not allowed by the system administrator.",
+			}, map[string]any{"Domain": emailDomain(remoteUser.Mail)}))
+		}
+	}
+
+	if config.RequireMatchingEmail {
+		user, appErr := p.API.GetUser(userID)
+		if appErr != nil {
+			return errors.Wrap(appErr, "cannot get user")
+		}
+		if !strings.EqualFold(user.Email, remoteUser.Mail) && !strings.EqualFold(user.Email, remoteUser.UserPrincipalName) {
+			return errors.New(p.localize(l, &i18n.Message{
+				ID:    "mstmeetings.oauth.email_mismatch",
+				Other: "The email of your Microsoft account must match the email of your Mattermost account.",
+			}, nil))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestCheckConnectionAllowed(t *testing.T) {
+	tenantToken := (&oauth2.Token{AccessToken: "opaque-token"}).WithExtra(map[string]any{
+		"id_token": "header." + base64.RawURLEncoding.EncodeToString([]byte(`{"tid":"ALLOWED-TENANT"}`)) + ".signature",
+	})
+	otherTenantToken := (&oauth2.Token{AccessToken: "opaque-token"}).WithExtra(map[string]any{
+		"id_token": "header." + base64.RawURLEncoding.EncodeToString([]byte(`{"tid":"other-tenant-id"}`)) + ".signature",
+	})
+	personalToken := &oauth2.Token{AccessToken: "header." + base64.RawURLEncoding.EncodeToString([]byte(`{"tid":"allowed-tenant"}`)) + ".signature"}
+	remoteUser := &RemoteUser{ID: "remoteID", Mail: "user@contoso.com", UserPrincipalName: "user@contoso.onmicrosoft.com"}
+
+	for _, testCase := range []struct {
+		name          string
+		config        *configuration
+		token         *oauth2.Token
+		mmEmail       string
+		expectedError string
+	}{
+		{
+			name:   "No restrictions",
+			config: &configuration{},
+			token:  personalToken,
+		},
+		{
+			name:   "Allowed tenant",
+			config: &configuration{AllowedTenantIDs: "other-tenant, allowed-tenant"},
+			token:  tenantToken,
+		},
+		{
+			name:          "Other tenant rejected",
+			config:        &configuration{AllowedTenantIDs: "allowed-tenant"},
+			token:         otherTenantToken,
+			expectedError: "Your Microsoft account does not belong to an organization allowed by the system administrator.",
+		},
+		{
+			name:          "Token without an ID token rejected when tenants are restricted",
+			config:        &configuration{AllowedTenantIDs: "allowed-tenant"},
+			token:         personalToken,
+			expectedError: "Your Microsoft account does not belong to an organization allowed by the system administrator.",
+		},
+		{
+			name:          "Email domain not allowed",
+			config:        &configuration{AllowedEmailDomains: "example.com"},
+			token:         tenantToken,
+			expectedError: "The email domain of your Microsoft account (contoso.com) is not allowed by the system administrator.",
+		},
+		{
+			name:    "Matching email",
+			config:  &configuration{AllowedEmailDomains: "Contoso.com", RequireMatchingEmail: true},
+			token:   tenantToken,
+			mmEmail: "User@contoso.com",
+		},
+		{
+			name:          "Mismatching email",
+			config:        &configuration{RequireMatchingEmail: true},
+			token:         tenantToken,
+			mmEmail:       "someone.else@contoso.com",
+			expectedError: "The email of your Microsoft account must match the email of your Mattermost account.",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			p := SetupMockPlugin(api, nil, nil)
+			p.setConfiguration(testCase.config)
+			if testCase.mmEmail != "" {
+				api.On("GetUser", "testUserID").Return(&model.User{Id: "testUserID", Email: testCase.mmEmail}, nil)
+			}
+
+			err := p.checkConnectionAllowed(defaultLocalizer, "testUserID", remoteUser, testCase.token)
+			if testCase.expectedError != "" {
+				require.EqualError(t, err, testCase.expectedError)
+			} else {
+				require.NoError(t, err)
+			}
+			api.AssertExpectations(t)
+		})
+	}
+}
@@ -4,6 +4,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -13,8 +14,26 @@ const (
 	stateLength                  = 4
 	trueString                   = "true"
 	msteamsMeetingStateKeyPrefix = "msteamsmeetinguserstate"
+	pendingMeetingKeyPrefix      = "pendingmeeting_"
+	pkceVerifierKeySuffix        = "_pkceverifier"
+
+	// pendingMeetingExpirySeconds bounds how long a meeting request waits for the user to connect.
+	pendingMeetingExpirySeconds = 15 * 60
+
+	// pkceVerifierExpirySeconds bounds how long the user has to complete the OAuth flow.
+	pkceVerifierExpirySeconds = 15 * 60
 )
 
+// pendingMeeting is a meeting start request made before the user connected their account. It
+// is replayed once the OAuth flow completes.
+type pendingMeeting struct {
+	ChannelID string `json:"channel_id"`
+	RootID    string `json:"root_id,omitempty"`
+	Topic     string `json:"topic"`
+	// InviteUserIDs are invited on top of the channel members, if any.
+	InviteUserIDs []string `json:"invite_user_ids,omitempty"`
+}
+
 func (p *Plugin) StoreState(userID, channelID string, justConnect bool) (string, error) {
 	key := getOAuthUserStateKey(userID)
 	state := fmt.Sprintf("%v_%v_%v", key, channelID, justConnect)
@@ -59,6 +78,74 @@ func (p *Plugin) ParseState(state string) (key, userID, channelID string, justCo
 	return key, userID, channelID, justConnect, nil
 }
 
+func (p *Plugin) StorePendingMeeting(userID string, pending *pendingMeeting) error {
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return err
+	}
+
+	appErr := p.API.KVSetWithExpiry(pendingMeetingKeyPrefix+userID, data, pendingMeetingExpirySeconds)
+	if appErr != nil {
+		return appErr
+	}
+	return nil
+}
+
+// GetPendingMeeting returns the pending meeting request of the user, or nil if there is none or
+// it has expired.
+func (p *Plugin) GetPendingMeeting(userID string) (*pendingMeeting, error) {
+	data, appErr := p.API.KVGet(pendingMeetingKeyPrefix + userID)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var pending pendingMeeting
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, err
+	}
+	return &pending, nil
+}
+
+func (p *Plugin) DeletePendingMeeting(userID string) error {
+	appErr := p.API.KVDelete(pendingMeetingKeyPrefix + userID)
+	if appErr != nil {
+		return appErr
+	}
+	return nil
+}
+
+// storeMeetingRequestState stores the OAuth state along with the meeting request to replay
+// once the user has connected their account.
+func (p *Plugin) storeMeetingRequestState(userID string, pending *pendingMeeting) error {
+	if _, err := p.StoreState(userID, pending.ChannelID, false); err != nil {
+		return err
+	}
+	return p.StorePendingMeeting(userID, pending)
+}
+
+// StoreVerifier stores the PKCE code verifier alongside the OAuth state stored at stateKey.
+func (p *Plugin) StoreVerifier(stateKey, verifier string) error {
+	appErr := p.API.KVSetWithExpiry(stateKey+pkceVerifierKeySuffix, []byte(verifier), pkceVerifierExpirySeconds)
+	if appErr != nil {
+		return appErr
+	}
+	return nil
+}
+
+// PopVerifier returns the PKCE code verifier stored alongside the OAuth state at stateKey and
+// deletes it, so it can only be used once.
+func (p *Plugin) PopVerifier(stateKey string) (string, error) {
+	verifier, err := p.GetState(stateKey + pkceVerifierKeySuffix)
+	if err != nil {
+		return "", err
+	}
+	_ = p.DeleteState(stateKey + pkceVerifierKeySuffix)
+	return verifier, nil
+}
+
 // getOAuthUserStateKey generates and returns the key for storing the OAuth user state in the KV store.
 func getOAuthUserStateKey(userID string) string {
 	return fmt.Sprintf("%v_%v", msteamsMeetingStateKeyPrefix, userID)
@@ -11,6 +11,7 @@ import (
 	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
 )
 
 func TestStoreState(t *testing.T) {
@@ -208,6 +209,53 @@ func TestParseState(t *testing.T) {
 	}
 }
 
+func TestPendingMeeting(t *testing.T) {
+	t.Run("stored with expiry", func(t *testing.T) {
+		mockAPI := &plugintest.API{}
+		p := SetupMockPlugin(mockAPI, nil, nil)
+
+		mockAPI.On("KVSetWithExpiry", "pendingmeeting_mockUserID", []byte(`{"channel_id":"mockChannelID","topic":"Quarterly review"}`), int64(pendingMeetingExpirySeconds)).Return(nil)
+
+		err := p.StorePendingMeeting("mockUserID", &pendingMeeting{ChannelID: "mockChannelID", Topic: "Quarterly review"})
+		require.NoError(t, err)
+		mockAPI.AssertExpectations(t)
+	})
+
+	t.Run("retrieved", func(t *testing.T) {
+		mockAPI := &plugintest.API{}
+		p := SetupMockPlugin(mockAPI, nil, nil)
+
+		mockAPI.On("KVGet", "pendingmeeting_mockUserID").Return([]byte(`{"channel_id":"mockChannelID","topic":"Quarterly review"}`), nil)
+
+		pending, err := p.GetPendingMeeting("mockUserID")
+		require.NoError(t, err)
+		require.Equal(t, &pendingMeeting{ChannelID: "mockChannelID", Topic: "Quarterly review"}, pending)
+		mockAPI.AssertExpectations(t)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		mockAPI := &plugintest.API{}
+		p := SetupMockPlugin(mockAPI, nil, nil)
+
+		mockAPI.On("KVGet", "pendingmeeting_mockUserID").Return(nil, nil)
+
+		pending, err := p.GetPendingMeeting("mockUserID")
+		require.NoError(t, err)
+		require.Nil(t, pending)
+		mockAPI.AssertExpectations(t)
+	})
+}
+
+// setupConnectedDemoUser mocks the stored token of demoUserID, connected to the Microsoft account
+// demoRemoteID, and the site URL needed to build a client with it. The plugin must be configured
+// with the demo_encrypt_key encryption key.
+func setupConnectedDemoUser(t *testing.T, api *plugintest.API) {
+	encryptedUserInfo, err := (&UserInfo{UserID: "demoUserID", RemoteID: "demoRemoteID", OAuthToken: &oauth2.Token{AccessToken: "token"}}).EncryptedJSON([]byte("demo_encrypt_key"))
+	require.NoError(t, err)
+	api.On("KVGet", "token_demoUserID").Return(encryptedUserInfo, nil)
+	api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewPointer("https://example.com")}})
+}
+
 func SetupMockPlugin(mockAPI *plugintest.API, mockTracker *MockTracker, mockClient *MockClient) *Plugin {
 	return &Plugin{
 		MattermostPlugin: plugin.MattermostPlugin{
@@ -0,0 +1,772 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
+	"github.com/mattermost/mattermost/server/public/pluginapi/i18n"
+	"github.com/pkg/errors"
+)
+
+const (
+	calendarSubscriptionsKey         = "calendarsubscriptions"
+	calendarSubscriptionEventsPrefix = "calendarsubscriptionevents_"
+	calendarSubscriptionJobKey       = "calendarsubscriptions"
+	calendarSubscriptionInterval     = 5 * time.Minute
+	calendarNotificationsPath        = "/api/v1/calendarsubscriptions/notifications"
+
+	// graphCalendarSubscriptionLifetime is how long a Graph subscription to the events of a
+	// calendar lasts before it is renewed. Graph allows up to 7 days.
+	graphCalendarSubscriptionLifetime = 3 * 24 * time.Hour
+	// graphCalendarRenewalMargin is how long before its expiry a Graph subscription is renewed.
+	graphCalendarRenewalMargin = 24 * time.Hour
+
+	// calendarSubscriptionLookahead is how far ahead the meetings of subscribed calendars are
+	// announced.
+	calendarSubscriptionLookahead = 7 * 24 * time.Hour
+	// maxSubscriptionEvents bounds the meetings of a subscribed calendar checked on each sync.
+	maxSubscriptionEvents = 100
+
+	calendarSourceGroup    = "group"
+	calendarSourceCalendar = "calendar"
+)
+
+var graphIDRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// CalendarSource is a calendar meetings are announced from: the calendar of a Microsoft 365
+// group, or a calendar shared with the user.
+type CalendarSource struct {
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func (s *CalendarSource) calendarViewPath() string {
+	if s.Kind == calendarSourceGroup {
+		return "/groups/" + url.PathEscape(s.ID) + "/calendarView"
+	}
+	return "/me/calendars/" + url.PathEscape(s.ID) + "/calendarView"
+}
+
+func (s *CalendarSource) eventsResource() string {
+	if s.Kind == calendarSourceGroup {
+		return "/groups/" + s.ID + "/events"
+	}
+	return "/me/calendars/" + s.ID + "/events"
+}
+
+type graphGroup struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+}
+
+type graphCalendar struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// FindCalendar resolves a Microsoft 365 group from its ID or email address, or else a calendar of
+// the signed-in user, including the calendars shared with them, from its ID or name.
+func (c *Client) FindCalendar(ctx context.Context, ref string) (*CalendarSource, error) {
+	var group *graphGroup
+	switch {
+	case graphIDRegexp.MatchString(ref):
+		var out graphGroup
+		if err := c.do(ctx, http.MethodGet, "/groups/"+url.PathEscape(ref), url.Values{"$select": {"id,displayName"}}, nil, &out); err == nil {
+			group = &out
+		}
+	case strings.Contains(ref, "@"):
+		var out struct {
+			Value []graphGroup `json:"value"`
+		}
+		query := url.Values{
+			"$filter": {"mail eq '" + strings.ReplaceAll(ref, "'", "''") + "'"},
+			"$select": {"id,displayName"},
+		}
+		if err := c.do(ctx, http.MethodGet, "/groups", query, nil, &out); err != nil {
+			return nil, errors.Wrap(err, "cannot find group")
+		}
+		if len(out.Value) > 0 {
+			group = &out.Value[0]
+		}
+	}
+	if group != nil {
+		return &CalendarSource{Kind: calendarSourceGroup, ID: group.ID, Name: group.DisplayName}, nil
+	}
+
+	var calendars struct {
+		Value []graphCalendar `json:"value"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/me/calendars", url.Values{"$select": {"id,name"}, "$top": {"100"}}, nil, &calendars); err != nil {
+		return nil, errors.Wrap(err, "cannot list calendars")
+	}
+	for _, calendar := range calendars.Value {
+		if calendar.ID == ref || strings.EqualFold(calendar.Name, ref) {
+			return &CalendarSource{Kind: calendarSourceCalendar, ID: calendar.ID, Name: calendar.Name}, nil
+		}
+	}
+	return nil, errors.New("calendar not found")
+}
+
+// GetSharedCalendarView returns the Teams meetings of a group or shared calendar between start
+// and end, ordered by start time. Cancelled events are left out.
+func (c *Client) GetSharedCalendarView(ctx context.Context, source *CalendarSource, start, end time.Time) ([]*CalendarEvent, error) {
+	return c.getCalendarView(ctx, source.calendarViewPath(), start, end, maxSubscriptionEvents)
+}
+
+// SubscribeToCalendar asks Graph to notify notificationURL of the events created or updated in
+// a group or shared calendar until expiresAt.
+func (c *Client) SubscribeToCalendar(ctx context.Context, source *CalendarSource, notificationURL, clientState string, expiresAt time.Time) (*GraphSubscription, error) {
+	subscription, err := c.createSubscription(ctx, source.eventsResource(), "created,updated", notificationURL, clientState, expiresAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot subscribe to calendar")
+	}
+	return subscription, nil
+}
+
+// calendarSubscription announces the Teams meetings of a calendar in a channel. The calendar is
+// read with the connected account of the user who subscribed.
+type calendarSubscription struct {
+	ID        string          `json:"id"`
+	ChannelID string          `json:"channel_id"`
+	CreatorID string          `json:"creator_id"`
+	Source    *CalendarSource `json:"source"`
+	CreateAt  int64           `json:"create_at"`
+	// ClientState authenticates the notifications of the Graph subscription.
+	ClientState string `json:"client_state,omitempty"`
+	// GraphSubscriptionID is empty until Graph accepted the subscription to the calendar events.
+	// Until then, the calendar is polled.
+	GraphSubscriptionID string `json:"graph_subscription_id,omitempty"`
+	ExpiresAt           int64  `json:"expires_at,omitempty"`
+}
+
+// errCalendarAccessLost is returned when the user who subscribed can no longer read the calendar
+// or post in the channel.
+var errCalendarAccessLost = errors.New("calendar subscription creator lost access")
+
+func (p *Plugin) getCalendarSubscriptionsIndex() (map[string]*calendarSubscription, []byte, error) {
+	return getJSONIndex[*calendarSubscription](p.API, calendarSubscriptionsKey)
+}
+
+func (p *Plugin) updateCalendarSubscriptionsIndex(update func(index map[string]*calendarSubscription)) error {
+	return updateJSONIndex(p.API, calendarSubscriptionsKey, 0, update)
+}
+
+// listChannelSubscriptions returns the subscriptions of a channel, oldest first.
+func (p *Plugin) listChannelSubscriptions(channelID string) ([]*calendarSubscription, error) {
+	index, _, err := p.getCalendarSubscriptionsIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := []*calendarSubscription{}
+	for _, subscription := range index {
+		if subscription.ChannelID == channelID {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].CreateAt < subscriptions[j].CreateAt
+	})
+	return subscriptions, nil
+}
+
+func getCalendarSubscriptionEventsKey(subscriptionID string) string {
+	return calendarSubscriptionEventsPrefix + subscriptionID
+}
+
+// getAnnouncedEvents returns when the announced events of a subscription were last modified,
+// keyed by event ID, or nil if the subscription was never synced.
+func (p *Plugin) getAnnouncedEvents(subscriptionID string) (map[string]int64, error) {
+	data, appErr := p.API.KVGet(getCalendarSubscriptionEventsKey(subscriptionID))
+	if appErr != nil {
+		return nil, appErr
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	announced := map[string]int64{}
+	if err := json.Unmarshal(data, &announced); err != nil {
+		return nil, errors.Wrap(err, "cannot decode announced events")
+	}
+	return announced, nil
+}
+
+func (p *Plugin) storeAnnouncedEvents(subscriptionID string, announced map[string]int64) error {
+	data, err := json.Marshal(announced)
+	if err != nil {
+		return errors.Wrap(err, "cannot encode announced events")
+	}
+
+	if appErr := p.API.KVSet(getCalendarSubscriptionEventsKey(subscriptionID), data); appErr != nil {
+		return appErr
+	}
+	return nil
+}
+
+// syncCalendarSubscriptions keeps the Graph subscriptions to the subscribed calendars alive, and
+// polls the calendars Graph does not notify of their changes. The subscriptions whose creator can
+// no longer read the calendar or post in the channel are removed. It runs on a single server of
+// the cluster.
+func (p *Plugin) syncCalendarSubscriptions() {
+	p.syncCalendarSubscriptionsWithDeps(p.NewClient)
+}
+
+func (p *Plugin) syncCalendarSubscriptionsWithDeps(newClient ClientFactory) {
+	if config := p.getConfiguration(); config == nil || !config.EnableCalendarSubscriptions || config.UseApplicationPermissions {
+		return
+	}
+
+	index, _, err := p.getCalendarSubscriptionsIndex()
+	if err != nil {
+		p.API.LogError("syncCalendarSubscriptions, failed to get the calendar subscriptions index", "error", err.Error())
+		return
+	}
+
+	now := time.Now()
+	for _, subscription := range index {
+		if err := p.checkCalendarSubscriptionAccess(subscription); err != nil {
+			p.handleCalendarSubscriptionError(subscription, "failed to check calendar subscription access", err, newClient)
+			continue
+		}
+
+		notified := subscription.GraphSubscriptionID != "" && now.UnixMilli() < subscription.ExpiresAt
+		if !notified {
+			// Graph offers no delta queries on group calendars, so the changes missed while Graph
+			// was not notifying them are found by comparing the events with the announced ones.
+			// The first sync only records the existing meetings.
+			if err := p.syncCalendarSubscription(subscription, newClient); err != nil {
+				p.handleCalendarSubscriptionError(subscription, "failed to sync calendar subscription", err, newClient)
+				continue
+			}
+		}
+		if notified && time.UnixMilli(subscription.ExpiresAt).Sub(now) > graphCalendarRenewalMargin {
+			continue
+		}
+
+		if err := p.renewGraphCalendarSubscription(subscription, now, newClient); err != nil {
+			p.handleCalendarSubscriptionError(subscription, "failed to subscribe to calendar events", err, newClient)
+			continue
+		}
+		err := p.updateCalendarSubscriptionsIndex(func(index map[string]*calendarSubscription) {
+			if _, ok := index[subscription.ID]; ok {
+				index[subscription.ID] = subscription
+			}
+		})
+		if err != nil {
+			p.API.LogWarn("syncCalendarSubscriptions, failed to update the calendar subscriptions index", "SubscriptionID", subscription.ID, "error", err.Error())
+		}
+	}
+}
+
+// handleCalendarSubscriptionError removes the subscription if its creator lost access to the
+// calendar or channel, and otherwise logs the error. The subscription is retried on the next run.
+func (p *Plugin) handleCalendarSubscriptionError(subscription *calendarSubscription, message string, err error, newClient ClientFactory) {
+	if errors.Is(err, errCalendarAccessLost) || isAccessDenied(err) {
+		p.API.LogInfo("removing calendar subscription whose creator lost access", "SubscriptionID", subscription.ID, "ChannelID", subscription.ChannelID, "UserID", subscription.CreatorID, "error", err.Error())
+		p.removeInaccessibleCalendarSubscription(subscription, newClient)
+		return
+	}
+	p.API.LogWarn(message, "SubscriptionID", subscription.ID, "ChannelID", subscription.ChannelID, "error", err.Error())
+}
+
+// isAccessDenied reports whether Graph refused access to a resource, or no longer finds it.
+func isAccessDenied(err error) bool {
+	var graphErr *GraphError
+	return errors.As(err, &graphErr) && (graphErr.StatusCode == http.StatusForbidden || graphErr.StatusCode == http.StatusNotFound)
+}
+
+// removeInaccessibleCalendarSubscription removes a subscription whose creator lost access, and
+// tells the channel.
+func (p *Plugin) removeInaccessibleCalendarSubscription(subscription *calendarSubscription, newClient ClientFactory) {
+	removed := false
+	err := p.updateCalendarSubscriptionsIndex(func(index map[string]*calendarSubscription) {
+		_, removed = index[subscription.ID]
+		delete(index, subscription.ID)
+	})
+	if err != nil {
+		p.API.LogWarn("failed to remove calendar subscription", "SubscriptionID", subscription.ID, "error", err.Error())
+		return
+	}
+	if !removed {
+		return
+	}
+	p.deleteCalendarSubscriptionState(subscription, newClient)
+
+	l := p.getUserLocalizer(subscription.CreatorID)
+	post := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: subscription.ChannelID,
+		Message: p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.subscription.access_lost",
+			Other: "The meetings of the {{.Calendar}} calendar are no longer announced in this channel, because the user who subscribed can no longer read the calendar or post in this channel. Run `/mstmeetings subscribe` to subscribe again.",
+		}, map[string]any{"Calendar": subscription.Source.Name}),
+	}
+	if _, appErr := p.API.CreatePost(post); appErr != nil {
+		p.API.LogWarn("failed to post the removal of a calendar subscription", "SubscriptionID", subscription.ID, "error", appErr.Error())
+	}
+}
+
+// deleteCalendarSubscriptionState deletes the announced events and the Graph subscription of a
+// removed calendar subscription. The Graph subscription expires on its own if it cannot be
+// deleted.
+func (p *Plugin) deleteCalendarSubscriptionState(subscription *calendarSubscription, newClient ClientFactory) {
+	if appErr := p.API.KVDelete(getCalendarSubscriptionEventsKey(subscription.ID)); appErr != nil {
+		p.API.LogWarn("failed to delete announced events", "SubscriptionID", subscription.ID, "error", appErr.Error())
+	}
+
+	if subscription.GraphSubscriptionID == "" {
+		return
+	}
+	client, err := p.newUserClient(subscription.CreatorID, newClient)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), p.getConfiguration().getRequestTimeout())
+		defer cancel()
+		err = client.DeleteSubscription(ctx, subscription.GraphSubscriptionID)
+	}
+	if err != nil {
+		p.API.LogDebug("failed to delete the Graph subscription of a calendar subscription", "SubscriptionID", subscription.ID, "error", err.Error())
+	}
+}
+
+func (p *Plugin) getCalendarNotificationURL() (string, error) {
+	siteURL, err := p.getSiteURL()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/plugins/%s%s", siteURL, url.PathEscape(manifest.Id), calendarNotificationsPath), nil
+}
+
+// renewGraphCalendarSubscription extends the Graph subscription to the events of a calendar,
+// subscribing again if it was never accepted or has expired.
+func (p *Plugin) renewGraphCalendarSubscription(subscription *calendarSubscription, now time.Time, newClient ClientFactory) error {
+	client, err := p.newCalendarSubscriptionClient(subscription, newClient)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.getConfiguration().getRequestTimeout())
+	defer cancel()
+
+	expiresAt := now.Add(graphCalendarSubscriptionLifetime)
+	if subscription.GraphSubscriptionID != "" && now.UnixMilli() < subscription.ExpiresAt {
+		if err = client.RenewSubscription(ctx, subscription.GraphSubscriptionID, expiresAt); err == nil {
+			subscription.ExpiresAt = expiresAt.UnixMilli()
+			return nil
+		}
+		p.API.LogDebug("failed to renew the Graph subscription of a calendar subscription, subscribing again", "SubscriptionID", subscription.ID, "error", err.Error())
+	}
+
+	notificationURL, err := p.getCalendarNotificationURL()
+	if err != nil {
+		return err
+	}
+	if subscription.ClientState == "" {
+		subscription.ClientState = model.NewId()
+	}
+	subscription.GraphSubscriptionID = ""
+	graphSubscription, err := client.SubscribeToCalendar(ctx, subscription.Source, notificationURL, subscription.ClientState, expiresAt)
+	if err != nil {
+		return err
+	}
+	subscription.GraphSubscriptionID = graphSubscription.ID
+	subscription.ExpiresAt = graphSubscription.ExpiresAt.UnixMilli()
+	return nil
+}
+
+// checkCalendarSubscriptionAccess returns errCalendarAccessLost if the user who subscribed can no
+// longer post in the channel or disconnected their Microsoft account.
+func (p *Plugin) checkCalendarSubscriptionAccess(subscription *calendarSubscription) error {
+	if !p.API.HasPermissionToChannel(subscription.CreatorID, subscription.ChannelID, model.PermissionCreatePost) {
+		return errCalendarAccessLost
+	}
+	connected, err := p.isUserConnected(subscription.CreatorID)
+	if err != nil {
+		return err
+	}
+	if !connected {
+		return errCalendarAccessLost
+	}
+	return nil
+}
+
+// newCalendarSubscriptionClient returns a client for the user who subscribed, once their access
+// is checked.
+func (p *Plugin) newCalendarSubscriptionClient(subscription *calendarSubscription, newClient ClientFactory) (ClientInterface, error) {
+	if err := p.checkCalendarSubscriptionAccess(subscription); err != nil {
+		return nil, err
+	}
+	return p.newUserClient(subscription.CreatorID, newClient)
+}
+
+// handleCalendarNotifications receives the notifications of the events created or updated in the
+// subscribed calendars. The requests come from Graph, not from Mattermost users, so each
+// notification is authenticated by the client state of its subscription.
+func (p *Plugin) handleCalendarNotifications(w http.ResponseWriter, r *http.Request) {
+	p.handleCalendarNotificationsWithDeps(w, r, p.NewClient)
+}
+
+func (p *Plugin) handleCalendarNotificationsWithDeps(w http.ResponseWriter, r *http.Request, newClient ClientFactory) {
+	// Graph checks that the endpoint answers before creating a subscription.
+	if token := r.URL.Query().Get("validationToken"); token != "" {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(token))
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var notifications struct {
+		Value []graphChangeNotification `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&notifications); err != nil {
+		http.Error(w, "invalid notifications", http.StatusBadRequest)
+		return
+	}
+
+	index, _, err := p.getCalendarSubscriptionsIndex()
+	if err != nil {
+		p.API.LogError("handleCalendarNotifications, failed to get the calendar subscriptions index", "error", err.Error())
+		http.Error(w, "cannot get calendar subscriptions", http.StatusInternalServerError)
+		return
+	}
+	byGraphID := map[string]*calendarSubscription{}
+	for _, subscription := range index {
+		if subscription.GraphSubscriptionID != "" {
+			byGraphID[subscription.GraphSubscriptionID] = subscription
+		}
+	}
+
+	// A change is often notified several times, so each calendar is synced once.
+	var changed []*calendarSubscription
+	for _, notification := range notifications.Value {
+		subscription := byGraphID[notification.SubscriptionID]
+		if subscription == nil || subtle.ConstantTimeCompare([]byte(notification.ClientState), []byte(subscription.ClientState)) != 1 {
+			p.API.LogDebug("handleCalendarNotifications, ignoring notification of an unknown subscription", "SubscriptionID", notification.SubscriptionID)
+			continue
+		}
+		if !slices.Contains(changed, subscription) {
+			changed = append(changed, subscription)
+		}
+	}
+
+	// Graph expects an answer within a few seconds, so the calendars are synced afterwards.
+	w.WriteHeader(http.StatusAccepted)
+	if len(changed) == 0 {
+		return
+	}
+
+	p.calendarNotificationSyncs.Add(1)
+	go func() {
+		defer p.calendarNotificationSyncs.Done()
+		for _, subscription := range changed {
+			if err := p.syncCalendarSubscription(subscription, newClient); err != nil {
+				p.handleCalendarSubscriptionError(subscription, "handleCalendarNotifications, failed to sync calendar subscription", err, newClient)
+			}
+		}
+	}()
+}
+
+// syncCalendarSubscription posts the meetings of a calendar that are new or changed since the
+// last sync. The first sync only records the existing meetings. Syncs of the same calendar are
+// serialized across the cluster, so that a meeting is announced once.
+func (p *Plugin) syncCalendarSubscription(subscription *calendarSubscription, newClient ClientFactory) error {
+	client, err := p.newCalendarSubscriptionClient(subscription, newClient)
+	if err != nil {
+		return err
+	}
+
+	mutex, err := cluster.NewMutex(p.API, getCalendarSubscriptionEventsKey(subscription.ID))
+	if err != nil {
+		return errors.Wrap(err, "cannot create calendar subscription mutex")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	announced, err := p.getAnnouncedEvents(subscription.ID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.getConfiguration().getRequestTimeout())
+	defer cancel()
+
+	now := time.Now()
+	events, err := client.GetSharedCalendarView(ctx, subscription.Source, now, now.Add(calendarSubscriptionLookahead))
+	if err != nil {
+		return err
+	}
+
+	current := map[string]int64{}
+	for _, event := range events {
+		if event.JoinURL == "" || event.ID == "" {
+			continue
+		}
+		lastModified := event.LastModified.UnixMilli()
+		current[event.ID] = lastModified
+
+		if announced == nil {
+			continue
+		}
+		previous, known := announced[event.ID]
+		if known && previous >= lastModified {
+			continue
+		}
+		if err := p.postSubscribedMeeting(subscription, event, known); err != nil {
+			// The event is announced again on the next sync.
+			delete(current, event.ID)
+			p.API.LogWarn("failed to post subscribed meeting", "SubscriptionID", subscription.ID, "error", err.Error())
+		}
+	}
+
+	// Events that left the lookahead window are forgotten, so the stored state stays bounded.
+	return p.storeAnnouncedEvents(subscription.ID, current)
+}
+
+// postSubscribedMeeting posts a meeting of a subscribed calendar as a meeting card.
+func (p *Plugin) postSubscribedMeeting(subscription *calendarSubscription, event *CalendarEvent, updated bool) error {
+	// Like the meetings created from a channel, the post is in the language of the user who
+	// subscribed.
+	l := p.getUserLocalizer(subscription.CreatorID)
+	data := map[string]any{"Calendar": subscription.Source.Name, "JoinURL": event.JoinURL}
+	message := p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.subscription.new_meeting",
+		Other: "New meeting in the {{.Calendar}} calendar at [this link]({{.JoinURL}}).",
+	}, data)
+	if updated {
+		message = p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.subscription.updated_meeting",
+			Other: "Meeting updated in the {{.Calendar}} calendar at [this link]({{.JoinURL}}).",
+		}, data)
+	}
+
+	subject := event.Subject
+	if subject == "" {
+		subject = p.localize(l, defaultSubjectMessage, nil)
+	}
+	post := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: subscription.ChannelID,
+		Message:   message,
+		Type:      "custom_mstmeetings",
+		Props: map[string]any{
+			"meeting_link":       event.JoinURL,
+			"meeting_status":     postTypeStarted,
+			"meeting_personal":   true,
+			"meeting_topic":      subject,
+			"meeting_provider":   msteamsProviderName,
+			"meeting_organizer":  event.Organizer,
+			"meeting_calendar":   subscription.Source.Name,
+			"meeting_start_time": event.Start.UnixMilli(),
+			"meeting_end_time":   event.End.UnixMilli(),
+		},
+	}
+	if _, appErr := p.API.CreatePost(post); appErr != nil {
+		return appErr
+	}
+	return nil
+}
+
+// subscriptionsDisabledMessage is the reply of the subscription commands when they are disabled.
+var subscriptionsDisabledMessage = &i18n.Message{
+	ID:    "mstmeetings.subscription.disabled",
+	Other: "Calendar subscriptions are not enabled on this server.",
+}
+
+func (p *Plugin) formatCalendarSubscriptions(l *i18n.Localizer, subscriptions []*calendarSubscription) string {
+	if len(subscriptions) == 0 {
+		return p.localize(l, &i18n.Message{
+			ID: "mstmeetings.subscription.none",
+			Other: "This channel is not subscribed to any calendar.\n" +
+				"Run `/mstmeetings subscribe <group-or-calendar>` to announce the Teams meetings of a Microsoft 365 group or shared calendar in this channel.",
+		}, nil)
+	}
+
+	var b strings.Builder
+	b.WriteString(p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.subscription.list_title",
+		Other: "###### Calendars announced in this channel",
+	}, nil) + "\n")
+	for _, subscription := range subscriptions {
+		fmt.Fprintf(&b, "* %s (%s `%s`)\n", subscription.Source.Name, subscription.Source.Kind, subscription.Source.ID)
+	}
+	b.WriteString("\n" + p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.subscription.list_footer",
+		Other: "Run `/mstmeetings unsubscribe <group-or-calendar>` to stop announcing the meetings of a calendar.",
+	}, nil))
+	return b.String()
+}
+
+func (p *Plugin) handleSubscriptions(args []string, extra *model.CommandArgs) (string, error) {
+	l := p.getUserLocalizer(extra.UserId)
+	if config := p.getConfiguration(); config == nil || !config.EnableCalendarSubscriptions || config.UseApplicationPermissions {
+		return p.localize(l, subscriptionsDisabledMessage, nil), nil
+	}
+	if len(args) > 1 {
+		return p.localize(l, tooManyParametersMessage, nil), nil
+	}
+
+	subscriptions, err := p.listChannelSubscriptions(extra.ChannelId)
+	if err != nil {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.subscription.list_failed",
+			Other: "Failed to get the calendar subscriptions of this channel.",
+		}, nil), errors.Wrap(err, "cannot list channel subscriptions")
+	}
+	return p.formatCalendarSubscriptions(l, subscriptions), nil
+}
+
+func (p *Plugin) handleSubscribe(args []string, extra *model.CommandArgs) (string, error) {
+	return p.handleSubscribeWithDeps(args, extra, p.NewClient)
+}
+
+func (p *Plugin) handleSubscribeWithDeps(args []string, extra *model.CommandArgs, newClient ClientFactory) (string, error) {
+	l := p.getUserLocalizer(extra.UserId)
+	if config := p.getConfiguration(); config == nil || !config.EnableCalendarSubscriptions || config.UseApplicationPermissions {
+		return p.localize(l, subscriptionsDisabledMessage, nil), nil
+	}
+	ref := strings.Join(args[1:], " ")
+	if ref == "" {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.subscription.subscribe_usage",
+			Other: "Run `/mstmeetings subscribe <group-or-calendar>` with the email address or ID of a Microsoft 365 group, or the name of a calendar shared with you.",
+		}, nil), nil
+	}
+
+	channel, appErr := p.API.GetChannel(extra.ChannelId)
+	if appErr != nil {
+		return p.localize(l, getChannelFailedMessage, nil), errors.Wrap(appErr, "cannot get channel")
+	}
+	if !p.canManageChannelSettings(extra.UserId, channel) {
+		return p.localize(l, channelSettingsNotAllowedMessage, nil), nil
+	}
+
+	client, err := p.newUserClient(extra.UserId, newClient)
+	if err != nil {
+		return p.localize(l, connectFirstMessage, nil), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.getConfiguration().getRequestTimeout())
+	defer cancel()
+
+	// Users who connected before subscriptions were enabled have not granted the calendar
+	// permissions yet, so the calendar is not found until they reconnect.
+	source, err := client.FindCalendar(ctx, ref)
+	if err != nil {
+		p.API.LogDebug("handleSubscribe, cannot find calendar", "UserID", extra.UserId, "error", err.Error())
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.subscription.calendar_not_found",
+			Other: "Could not find the calendar `{{.Calendar}}`. Use the email address or ID of a Microsoft 365 group you belong to, or the name of a calendar shared with you. You may need to reconnect your Microsoft account with `/mstmeetings connect`.",
+		}, map[string]any{"Calendar": ref}), nil
+	}
+
+	subscribed := false
+	subscription := &calendarSubscription{
+		ID:        model.NewId(),
+		ChannelID: extra.ChannelId,
+		CreatorID: extra.UserId,
+		Source:    source,
+		CreateAt:  model.GetMillis(),
+	}
+	err = p.updateCalendarSubscriptionsIndex(func(index map[string]*calendarSubscription) {
+		subscribed = false
+		for _, existing := range index {
+			if existing.ChannelID == extra.ChannelId && existing.Source.Kind == source.Kind && existing.Source.ID == source.ID {
+				subscribed = true
+				return
+			}
+		}
+		index[subscription.ID] = subscription
+	})
+	if err != nil {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.subscription.save_failed",
+			Other: "Failed to save the calendar subscription.",
+		}, nil), errors.Wrap(err, "cannot store calendar subscription")
+	}
+	data := map[string]any{"Calendar": source.Name}
+	if subscribed {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.subscription.already_subscribed",
+			Other: "This channel is already subscribed to the {{.Calendar}} calendar.",
+		}, data), nil
+	}
+
+	return p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.subscription.subscribed",
+		Other: "New and changed Teams meetings of the {{.Calendar}} calendar will be announced in this channel.",
+	}, data), nil
+}
+
+func (p *Plugin) handleUnsubscribe(args []string, extra *model.CommandArgs) (string, error) {
+	return p.handleUnsubscribeWithDeps(args, extra, p.NewClient)
+}
+
+func (p *Plugin) handleUnsubscribeWithDeps(args []string, extra *model.CommandArgs, newClient ClientFactory) (string, error) {
+	l := p.getUserLocalizer(extra.UserId)
+	if config := p.getConfiguration(); config == nil || !config.EnableCalendarSubscriptions || config.UseApplicationPermissions {
+		return p.localize(l, subscriptionsDisabledMessage, nil), nil
+	}
+	ref := strings.Join(args[1:], " ")
+	if ref == "" {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.subscription.unsubscribe_usage",
+			Other: "Run `/mstmeetings unsubscribe <group-or-calendar>` with a calendar listed by `/mstmeetings subscriptions`.",
+		}, nil), nil
+	}
+
+	channel, appErr := p.API.GetChannel(extra.ChannelId)
+	if appErr != nil {
+		return p.localize(l, getChannelFailedMessage, nil), errors.Wrap(appErr, "cannot get channel")
+	}
+	if !p.canManageChannelSettings(extra.UserId, channel) {
+		return p.localize(l, channelSettingsNotAllowedMessage, nil), nil
+	}
+
+	var removed *calendarSubscription
+	err := p.updateCalendarSubscriptionsIndex(func(index map[string]*calendarSubscription) {
+		removed = nil
+		for id, subscription := range index {
+			if subscription.ChannelID == extra.ChannelId && (subscription.Source.ID == ref || strings.EqualFold(subscription.Source.Name, ref)) {
+				removed = subscription
+				delete(index, id)
+				return
+			}
+		}
+	})
+	if err != nil {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.subscription.remove_failed",
+			Other: "Failed to remove the calendar subscription.",
+		}, nil), errors.Wrap(err, "cannot remove calendar subscription")
+	}
+	if removed == nil {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.subscription.not_subscribed",
+			Other: "This channel is not subscribed to the calendar `{{.Calendar}}`.",
+		}, map[string]any{"Calendar": ref}), nil
+	}
+
+	p.deleteCalendarSubscriptionState(removed, newClient)
+	return p.localize(l, &i18n.Message{
+		ID:    "mstmeetings.subscription.unsubscribed",
+		Other: "The meetings of the {{.Calendar}} calendar will no longer be announced in this channel.",
+	}, map[string]any{"Calendar": removed.Source.Name}), nil
+}
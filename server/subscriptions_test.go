@@ -0,0 +1,325 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncCalendarSubscription(t *testing.T) {
+	source := &CalendarSource{Kind: calendarSourceGroup, ID: "groupID", Name: "Design"}
+	subscription := &calendarSubscription{ID: "subscriptionID", ChannelID: "channelID", CreatorID: "demoUserID", Source: source}
+	modified := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	events := []*CalendarEvent{
+		{ID: "knownID", Subject: "Standup", JoinURL: "https://teams.microsoft.com/l/meetup-join/standup", LastModified: modified},
+		{ID: "changedID", Subject: "Review", JoinURL: "https://teams.microsoft.com/l/meetup-join/review", LastModified: modified},
+		{ID: "newID", Subject: "Kickoff", JoinURL: "https://teams.microsoft.com/l/meetup-join/kickoff", Organizer: "Jane Doe", LastModified: modified},
+		{ID: "offlineID", Subject: "Lunch", LastModified: modified},
+	}
+	current := []byte(`{"changedID":1792396800000,"knownID":1792396800000,"newID":1792396800000}`)
+
+	tests := []struct {
+		name          string
+		announced     []byte
+		expectedCalls func(api *plugintest.API)
+	}{
+		{
+			name:          "First sync records the meetings",
+			expectedCalls: func(_ *plugintest.API) {},
+		},
+		{
+			name:      "New and changed meetings are posted",
+			announced: []byte(`{"changedID":1792393200000,"knownID":1792396800000,"removedID":1}`),
+			expectedCalls: func(api *plugintest.API) {
+				api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+					return post.ChannelId == "channelID" &&
+						post.Message == "New meeting in the Design calendar at [this link](https://teams.microsoft.com/l/meetup-join/kickoff)." &&
+						post.GetProp("meeting_topic") == "Kickoff" &&
+						post.GetProp("meeting_organizer") == "Jane Doe" &&
+						post.GetProp("meeting_calendar") == "Design"
+				})).Return(&model.Post{}, nil).Once()
+				api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+					return post.Message == "Meeting updated in the Design calendar at [this link](https://teams.microsoft.com/l/meetup-join/review)."
+				})).Return(&model.Post{}, nil).Once()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			defer api.AssertExpectations(t)
+			mockClient := &MockClient{}
+			defer mockClient.AssertExpectations(t)
+			p := SetupMockPlugin(api, nil, nil)
+			p.botUserID = "botUserID"
+			p.setConfiguration(&configuration{EncryptionKey: "demo_encrypt_key", EnableCalendarSubscriptions: true})
+
+			setupConnectedDemoUser(t, api)
+			api.On("HasPermissionToChannel", "demoUserID", "channelID", model.PermissionCreatePost).Return(true)
+			api.On("KVSetWithOptions", "mutex_calendarsubscriptionevents_subscriptionID", mock.Anything, mock.Anything).Return(true, nil)
+			api.On("KVGet", "calendarsubscriptionevents_subscriptionID").Return(tt.announced, nil)
+			api.On("KVSet", "calendarsubscriptionevents_subscriptionID", current).Return(nil)
+			mockClient.On("GetSharedCalendarView", source, mock.Anything, mock.Anything).Return(events, nil)
+			tt.expectedCalls(api)
+
+			require.NoError(t, p.syncCalendarSubscription(subscription, mockClientFactory(mockClient)))
+		})
+	}
+}
+
+func TestSyncCalendarSubscriptions(t *testing.T) {
+	source := &CalendarSource{Kind: calendarSourceGroup, ID: "groupID", Name: "Design"}
+	index := []byte(`{"subscriptionID":{"id":"subscriptionID","channel_id":"channelID","creator_id":"demoUserID","source":{"kind":"group","id":"groupID","name":"Design"},"create_at":1,"client_state":"secret"}}`)
+	expiresAt := time.Now().Add(72 * time.Hour).Truncate(time.Millisecond)
+
+	tests := []struct {
+		name          string
+		canPost       bool
+		expectedCalls func(t *testing.T, api *plugintest.API, mockClient *MockClient)
+	}{
+		{
+			name:    "Calendar polled until Graph notifies its changes",
+			canPost: true,
+			expectedCalls: func(t *testing.T, api *plugintest.API, mockClient *MockClient) {
+				setupConnectedDemoUser(t, api)
+				api.On("KVSetWithOptions", "mutex_calendarsubscriptionevents_subscriptionID", mock.Anything, mock.Anything).Return(true, nil)
+				api.On("KVGet", "calendarsubscriptionevents_subscriptionID").Return(nil, nil)
+				api.On("KVSet", "calendarsubscriptionevents_subscriptionID", []byte(`{}`)).Return(nil)
+				mockClient.On("GetSharedCalendarView", source, mock.Anything, mock.Anything).Return([]*CalendarEvent{}, nil)
+				mockClient.On("SubscribeToCalendar", source, "https://example.com/plugins/"+manifest.Id+calendarNotificationsPath, "secret", mock.Anything).Return(&GraphSubscription{ID: "graphSubscriptionID", ExpiresAt: expiresAt}, nil)
+				api.On("KVCompareAndSet", "calendarsubscriptions", index, mock.MatchedBy(func(data []byte) bool {
+					return strings.Contains(string(data), `"graph_subscription_id":"graphSubscriptionID"`)
+				})).Return(true, nil)
+			},
+		},
+		{
+			name: "Removed when the creator can no longer post in the channel",
+			expectedCalls: func(_ *testing.T, api *plugintest.API, _ *MockClient) {
+				api.On("LogInfo", "removing calendar subscription whose creator lost access", "SubscriptionID", "subscriptionID", "ChannelID", "channelID", "UserID", "demoUserID", "error", errCalendarAccessLost.Error())
+				api.On("KVCompareAndSet", "calendarsubscriptions", index, []byte(`{}`)).Return(true, nil)
+				api.On("KVDelete", "calendarsubscriptionevents_subscriptionID").Return(nil)
+				api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+					return post.ChannelId == "channelID" && post.UserId == "botUserID" && strings.HasPrefix(post.Message, "The meetings of the Design calendar are no longer announced in this channel")
+				})).Return(&model.Post{}, nil)
+			},
+		},
+		{
+			name:    "Removed when Graph denies access to the calendar",
+			canPost: true,
+			expectedCalls: func(t *testing.T, api *plugintest.API, mockClient *MockClient) {
+				setupConnectedDemoUser(t, api)
+				api.On("KVSetWithOptions", "mutex_calendarsubscriptionevents_subscriptionID", mock.Anything, mock.Anything).Return(true, nil)
+				api.On("KVGet", "calendarsubscriptionevents_subscriptionID").Return(nil, nil)
+				mockClient.On("GetSharedCalendarView", source, mock.Anything, mock.Anything).Return([]*CalendarEvent(nil), &GraphError{StatusCode: http.StatusForbidden})
+				api.On("LogInfo", "removing calendar subscription whose creator lost access", "SubscriptionID", "subscriptionID", "ChannelID", "channelID", "UserID", "demoUserID", "error", "graph request failed with status 403")
+				api.On("KVCompareAndSet", "calendarsubscriptions", index, []byte(`{}`)).Return(true, nil)
+				api.On("KVDelete", "calendarsubscriptionevents_subscriptionID").Return(nil)
+				api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+			},
+		},
+		{
+			name:    "Other failures are logged",
+			canPost: true,
+			expectedCalls: func(t *testing.T, api *plugintest.API, mockClient *MockClient) {
+				setupConnectedDemoUser(t, api)
+				api.On("KVSetWithOptions", "mutex_calendarsubscriptionevents_subscriptionID", mock.Anything, mock.Anything).Return(true, nil)
+				api.On("KVGet", "calendarsubscriptionevents_subscriptionID").Return(nil, nil)
+				mockClient.On("GetSharedCalendarView", source, mock.Anything, mock.Anything).Return([]*CalendarEvent(nil), &GraphError{StatusCode: http.StatusServiceUnavailable})
+				api.On("LogWarn", "failed to sync calendar subscription", "SubscriptionID", "subscriptionID", "ChannelID", "channelID", "error", "graph request failed with status 503")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			defer api.AssertExpectations(t)
+			mockClient := &MockClient{}
+			defer mockClient.AssertExpectations(t)
+			p := SetupMockPlugin(api, nil, nil)
+			p.botUserID = "botUserID"
+			p.setConfiguration(&configuration{EncryptionKey: "demo_encrypt_key", EnableCalendarSubscriptions: true})
+
+			api.On("KVGet", "calendarsubscriptions").Return(index, nil)
+			api.On("HasPermissionToChannel", "demoUserID", "channelID", model.PermissionCreatePost).Return(tt.canPost)
+			tt.expectedCalls(t, api, mockClient)
+
+			p.syncCalendarSubscriptionsWithDeps(mockClientFactory(mockClient))
+		})
+	}
+}
+
+func TestHandleCalendarNotifications(t *testing.T) {
+	source := &CalendarSource{Kind: calendarSourceGroup, ID: "groupID", Name: "Design"}
+	index := []byte(`{"subscriptionID":{"id":"subscriptionID","channel_id":"channelID","creator_id":"demoUserID","source":{"kind":"group","id":"groupID","name":"Design"},"client_state":"secret","graph_subscription_id":"graphSubscriptionID"}}`)
+
+	tests := []struct {
+		name        string
+		clientState string
+		synced      bool
+	}{
+		{
+			name:        "Unknown client state",
+			clientState: "forged",
+		},
+		{
+			name:        "Calendar synced once",
+			clientState: "secret",
+			synced:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			defer api.AssertExpectations(t)
+			mockClient := &MockClient{}
+			defer mockClient.AssertExpectations(t)
+			p := SetupMockPlugin(api, nil, nil)
+			p.setConfiguration(&configuration{EncryptionKey: "demo_encrypt_key", EnableCalendarSubscriptions: true})
+
+			api.On("KVGet", "calendarsubscriptions").Return(index, nil)
+			if tt.synced {
+				setupConnectedDemoUser(t, api)
+				api.On("HasPermissionToChannel", "demoUserID", "channelID", model.PermissionCreatePost).Return(true)
+				api.On("KVSetWithOptions", "mutex_calendarsubscriptionevents_subscriptionID", mock.Anything, mock.Anything).Return(true, nil)
+				api.On("KVGet", "calendarsubscriptionevents_subscriptionID").Return([]byte(`{}`), nil)
+				api.On("KVSet", "calendarsubscriptionevents_subscriptionID", []byte(`{}`)).Return(nil)
+				mockClient.On("GetSharedCalendarView", source, mock.Anything, mock.Anything).Return([]*CalendarEvent{}, nil).Once()
+			} else {
+				api.On("LogDebug", "handleCalendarNotifications, ignoring notification of an unknown subscription", "SubscriptionID", "graphSubscriptionID").Return().Twice()
+			}
+
+			notification := `{"subscriptionId": "graphSubscriptionID", "clientState": "` + tt.clientState + `", "changeType": "updated"}`
+			body := []byte(`{"value": [` + notification + `, ` + notification + `]}`)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, calendarNotificationsPath, bytes.NewReader(body))
+			p.handleCalendarNotificationsWithDeps(w, r, mockClientFactory(mockClient))
+			p.calendarNotificationSyncs.Wait()
+
+			require.Equal(t, http.StatusAccepted, w.Code)
+		})
+	}
+}
+
+func TestHandleSubscribe(t *testing.T) {
+	source := &CalendarSource{Kind: calendarSourceGroup, ID: "groupID", Name: "Design"}
+
+	tests := []struct {
+		name           string
+		config         *configuration
+		args           []string
+		canManage      bool
+		connected      bool
+		index          []byte
+		expectedOutput string
+	}{
+		{
+			name:           "Not enabled",
+			config:         &configuration{},
+			args:           []string{"subscribe", "design@example.com"},
+			expectedOutput: "Calendar subscriptions are not enabled on this server.",
+		},
+		{
+			name:           "Missing calendar",
+			config:         &configuration{EnableCalendarSubscriptions: true},
+			args:           []string{"subscribe"},
+			expectedOutput: "Run `/mstmeetings subscribe <group-or-calendar>`",
+		},
+		{
+			name:           "No permission",
+			config:         &configuration{EnableCalendarSubscriptions: true},
+			args:           []string{"subscribe", "design@example.com"},
+			expectedOutput: "You do not have permission to change the settings of this channel.",
+		},
+		{
+			name:           "Not connected",
+			config:         &configuration{EnableCalendarSubscriptions: true},
+			args:           []string{"subscribe", "design@example.com"},
+			canManage:      true,
+			expectedOutput: "Connect your Microsoft account with `/mstmeetings connect` first.",
+		},
+		{
+			name:           "Subscribed",
+			config:         &configuration{EnableCalendarSubscriptions: true, EncryptionKey: "demo_encrypt_key"},
+			args:           []string{"subscribe", "design@example.com"},
+			canManage:      true,
+			connected:      true,
+			expectedOutput: "New and changed Teams meetings of the Design calendar will be announced in this channel.",
+		},
+		{
+			name:           "Already subscribed",
+			config:         &configuration{EnableCalendarSubscriptions: true, EncryptionKey: "demo_encrypt_key"},
+			args:           []string{"subscribe", "design@example.com"},
+			canManage:      true,
+			connected:      true,
+			index:          []byte(`{"subscriptionID":{"id":"subscriptionID","channel_id":"demoChannelID","source":{"kind":"group","id":"groupID","name":"Design"}}}`),
+			expectedOutput: "This channel is already subscribed to the Design calendar.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			defer api.AssertExpectations(t)
+			mockClient := &MockClient{}
+			defer mockClient.AssertExpectations(t)
+			p := SetupMockPlugin(api, nil, nil)
+			p.setConfiguration(tt.config)
+
+			if tt.config.EnableCalendarSubscriptions && len(tt.args) > 1 {
+				api.On("GetChannel", "demoChannelID").Return(&model.Channel{Id: "demoChannelID", Type: model.ChannelTypeOpen}, nil)
+				api.On("HasPermissionToChannel", "demoUserID", "demoChannelID", model.PermissionManagePublicChannelProperties).Return(tt.canManage)
+			}
+			if tt.canManage && !tt.connected {
+				api.On("KVGet", "token_demoUserID").Return(nil, nil)
+			}
+			if tt.connected {
+				setupConnectedDemoUser(t, api)
+				mockClient.On("FindCalendar", "design@example.com").Return(source, nil)
+				api.On("KVGet", "calendarsubscriptions").Return(tt.index, nil)
+				if tt.index == nil {
+					api.On("KVCompareAndSet", "calendarsubscriptions", []byte(nil), mock.MatchedBy(func(data []byte) bool {
+						return len(data) > 0
+					})).Return(true, nil)
+				} else {
+					api.On("KVCompareAndSet", "calendarsubscriptions", tt.index, mock.Anything).Return(true, nil)
+				}
+			}
+
+			output, err := p.handleSubscribeWithDeps(tt.args, &model.CommandArgs{UserId: "demoUserID", ChannelId: "demoChannelID"}, mockClientFactory(mockClient))
+			require.NoError(t, err)
+			require.Contains(t, output, tt.expectedOutput)
+		})
+	}
+}
+
+func TestHandleUnsubscribe(t *testing.T) {
+	api := &plugintest.API{}
+	defer api.AssertExpectations(t)
+	p := SetupMockPlugin(api, nil, nil)
+	p.setConfiguration(&configuration{EnableCalendarSubscriptions: true})
+
+	index := []byte(`{"subscriptionID":{"id":"subscriptionID","channel_id":"demoChannelID","creator_id":"demoUserID","source":{"kind":"group","id":"groupID","name":"Design"},"create_at":1}}`)
+	api.On("GetChannel", "demoChannelID").Return(&model.Channel{Id: "demoChannelID", Type: model.ChannelTypeOpen}, nil)
+	api.On("HasPermissionToChannel", "demoUserID", "demoChannelID", model.PermissionManagePublicChannelProperties).Return(true)
+	api.On("KVGet", "calendarsubscriptions").Return(index, nil)
+	api.On("KVCompareAndSet", "calendarsubscriptions", index, []byte(`{}`)).Return(true, nil)
+	api.On("KVDelete", "calendarsubscriptionevents_subscriptionID").Return(nil)
+
+	output, err := p.handleUnsubscribe([]string{"unsubscribe", "design"}, &model.CommandArgs{UserId: "demoUserID", ChannelId: "demoChannelID"})
+	require.NoError(t, err)
+	require.Equal(t, "The meetings of the Design calendar will no longer be announced in this channel.", output)
+}
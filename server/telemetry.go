@@ -6,8 +6,10 @@ package main
 type TelemetrySource string
 
 const (
-	telemetryStartSourceWebapp  TelemetrySource = "webapp"
-	telemetryStartSourceCommand TelemetrySource = "command"
+	telemetryStartSourceWebapp   TelemetrySource = "webapp"
+	telemetryStartSourceCommand  TelemetrySource = "command"
+	telemetryStartSourceDialog   TelemetrySource = "dialog"
+	telemetryStartSourcePostMenu TelemetrySource = "post_menu"
 )
 
 func (p *Plugin) trackConnect(userID string) {
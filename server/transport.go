@@ -0,0 +1,129 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+const (
+	graphMaxRetries   = 3
+	graphMaxRetryWait = 30 * time.Second
+	graphBaseBackoff  = 500 * time.Millisecond
+)
+
+// retryTransport retries Graph requests that were throttled or hit a transient failure.
+//
+// Throttled requests (429) were not processed by Graph, so they are retried regardless of
+// the method. Service unavailable and gateway timeout responses are only retried for
+// idempotent methods. Retry-After is honored when present, otherwise a jittered
+// exponential backoff is used. The total time spent waiting is capped by maxWait.
+type retryTransport struct {
+	base        http.RoundTripper
+	api         plugin.API
+	maxRetries  int
+	maxWait     time.Duration
+	baseBackoff time.Duration
+
+	// retries counts every retry issued, shared by all clients of the plugin.
+	retries *atomic.Int64
+}
+
+func newRetryTransport(base http.RoundTripper, api plugin.API, retries *atomic.Int64) *retryTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &retryTransport{
+		base:        base,
+		api:         api,
+		maxRetries:  graphMaxRetries,
+		maxWait:     graphMaxRetryWait,
+		baseBackoff: graphBaseBackoff,
+		retries:     retries,
+	}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var waited time.Duration
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if err != nil || attempt >= t.maxRetries || !shouldRetry(req, resp) {
+			return resp, err
+		}
+
+		wait := t.backoff(attempt, resp)
+		if waited+wait > t.maxWait {
+			return resp, nil
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return resp, nil
+		}
+
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		if req.GetBody != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, bodyErr
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		if t.retries != nil {
+			t.retries.Add(1)
+		}
+		t.api.LogWarn("Retrying Microsoft Graph request", "method", req.Method, "path", req.URL.Path, "status", resp.StatusCode, "attempt", attempt+1, "wait", wait.String())
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		waited += wait
+	}
+}
+
+func (t *retryTransport) backoff(attempt int, resp *http.Response) time.Duration {
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		if date, err := http.ParseTime(retryAfter); err == nil {
+			return max(time.Until(date), 0)
+		}
+	}
+
+	backoff := t.baseBackoff << attempt
+	// Jitter spreads out retries from concurrent requests.
+	return backoff/2 + rand.N(backoff/2+1) //nolint:gosec
+}
+
+func shouldRetry(req *http.Request, resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return isIdempotent(req.Method)
+	}
+	return false
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
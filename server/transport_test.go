@@ -0,0 +1,117 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryTransport(t *testing.T) {
+	for _, testCase := range []struct {
+		name            string
+		method          string
+		status          int
+		throttledCalls  int32
+		retryAfter      string
+		maxWait         time.Duration
+		expectedStatus  int
+		expectedCalls   int32
+		expectedRetries int64
+	}{
+		{
+			name:            "Throttled request is retried until it succeeds",
+			method:          http.MethodPost,
+			status:          http.StatusTooManyRequests,
+			throttledCalls:  2,
+			maxWait:         time.Second,
+			expectedStatus:  http.StatusOK,
+			expectedCalls:   3,
+			expectedRetries: 2,
+		},
+		{
+			name:            "Retries stop after the maximum number of attempts",
+			method:          http.MethodGet,
+			status:          http.StatusServiceUnavailable,
+			throttledCalls:  10,
+			maxWait:         time.Second,
+			expectedStatus:  http.StatusServiceUnavailable,
+			expectedCalls:   graphMaxRetries + 1,
+			expectedRetries: graphMaxRetries,
+		},
+		{
+			name:           "Unavailable non-idempotent request is not retried",
+			method:         http.MethodPost,
+			status:         http.StatusServiceUnavailable,
+			throttledCalls: 1,
+			maxWait:        time.Second,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedCalls:  1,
+		},
+		{
+			name:           "Retry-After beyond the wait cap is not honored",
+			method:         http.MethodGet,
+			status:         http.StatusTooManyRequests,
+			throttledCalls: 1,
+			retryAfter:     "1",
+			maxWait:        500 * time.Millisecond,
+			expectedStatus: http.StatusTooManyRequests,
+			expectedCalls:  1,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				if r.Method == http.MethodPost {
+					require.Equal(t, `{"subject":"test"}`, string(body))
+				}
+
+				if calls.Add(1) <= testCase.throttledCalls {
+					if testCase.retryAfter != "" {
+						w.Header().Set("Retry-After", testCase.retryAfter)
+					} else {
+						w.Header().Set("Retry-After", "0")
+					}
+					w.WriteHeader(testCase.status)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			api := &plugintest.API{}
+			logArgs := []interface{}{"Retrying Microsoft Graph request"}
+			for range 10 {
+				logArgs = append(logArgs, mock.Anything)
+			}
+			api.On("LogWarn", logArgs...).Return()
+
+			var retries atomic.Int64
+			transport := newRetryTransport(nil, api, &retries)
+			transport.maxWait = testCase.maxWait
+			client := &http.Client{Transport: transport}
+
+			req, err := http.NewRequest(testCase.method, server.URL, strings.NewReader(`{"subject":"test"}`))
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, testCase.expectedStatus, resp.StatusCode)
+			require.Equal(t, testCase.expectedCalls, calls.Load())
+			require.Equal(t, testCase.expectedRetries, retries.Load())
+		})
+	}
+}
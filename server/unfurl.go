@@ -0,0 +1,88 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// unfurlTimeout bounds the Microsoft Graph lookup of a shared meeting.
+const unfurlTimeout = 5 * time.Second
+
+// teamsJoinURLRegexp matches the join URLs of Microsoft Teams meetings, stopping at the
+// characters that delimit links in markdown.
+var teamsJoinURLRegexp = regexp.MustCompile(`https://teams\.microsoft\.com/l/meetup-join/[^\s<>()\[\]]+`)
+
+// unfurlMeetingLinkWithDeps returns the post as a meeting card if it shares a meeting the
+// poster can look up with their connected account, or nil to leave it unchanged. Graph only
+// finds the meetings organized by the poster. It runs once the post is created, so that posting
+// does not wait for Graph.
+func (p *Plugin) unfurlMeetingLinkWithDeps(post *model.Post, newClient ClientFactory) *model.Post {
+	if config := p.getConfiguration(); config == nil || !config.EnableMeetingLinkUnfurl || config.UseApplicationPermissions {
+		return nil
+	}
+	if post.Type != "" || post.GetProp("meeting_provider") != nil {
+		return nil
+	}
+
+	joinURL := teamsJoinURLRegexp.FindString(post.Message)
+	if joinURL == "" {
+		return nil
+	}
+
+	meeting, err := p.getSharedMeeting(post.UserId, joinURL, newClient)
+	if err != nil {
+		p.API.LogDebug("unfurlMeetingLink, cannot get the shared meeting", "UserID", post.UserId, "error", err.Error())
+		return nil
+	}
+
+	user, appErr := p.API.GetUser(post.UserId)
+	if appErr != nil {
+		p.API.LogWarn("unfurlMeetingLink, cannot get user", "UserID", post.UserId, "error", appErr.Error())
+		return nil
+	}
+
+	subject := meeting.Subject
+	if subject == "" {
+		subject = p.localize(p.getUserLocalizer(post.UserId), defaultSubjectMessage, nil)
+	}
+	if meeting.JoinURL != "" {
+		joinURL = meeting.JoinURL
+	}
+
+	unfurled := post.Clone()
+	unfurled.Type = "custom_mstmeetings"
+	unfurled.AddProp("meeting_link", joinURL)
+	unfurled.AddProp("meeting_status", postTypeStarted)
+	unfurled.AddProp("meeting_personal", true)
+	unfurled.AddProp("meeting_topic", subject)
+	unfurled.AddProp("meeting_creator_username", user.Username)
+	unfurled.AddProp("meeting_provider", msteamsProviderName)
+	unfurled.AddProp("meeting_organizer", meeting.Organizer)
+	unfurled.AddProp("meeting_shared", true)
+	if !meeting.StartDateTime.IsZero() {
+		unfurled.AddProp("meeting_start_time", meeting.StartDateTime.UnixMilli())
+	}
+	if !meeting.EndDateTime.IsZero() {
+		unfurled.AddProp("meeting_end_time", meeting.EndDateTime.UnixMilli())
+	}
+	return unfurled
+}
+
+// getSharedMeeting looks up a meeting with the connected account of the user sharing it.
+func (p *Plugin) getSharedMeeting(userID, joinURL string, newClient ClientFactory) (*OnlineMeeting, error) {
+	client, err := p.newUserClient(userID, newClient)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), unfurlTimeout)
+	defer cancel()
+
+	return client.GetMeetingByJoinURL(ctx, joinURL)
+}
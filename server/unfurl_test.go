@@ -0,0 +1,141 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnfurlMeetingLink(t *testing.T) {
+	joinURL := "https://teams.microsoft.com/l/meetup-join/19%3ameeting_abc%40thread.v2/0?context=%7b%22Tid%22%3a%22tenant%22%7d"
+	start := time.Date(2026, 10, 19, 14, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		disabled      bool
+		post          *model.Post
+		setup         func(t *testing.T, api *plugintest.API, mockClient *MockClient)
+		expectedProps model.StringInterface
+	}{
+		{
+			name: "No meeting link",
+			post: &model.Post{UserId: "demoUserID", Message: "See https://example.com"},
+			setup: func(_ *testing.T, _ *plugintest.API, _ *MockClient) {
+			},
+		},
+		{
+			name:     "Disabled",
+			disabled: true,
+			post:     &model.Post{UserId: "demoUserID", Message: "Join " + joinURL},
+			setup: func(_ *testing.T, _ *plugintest.API, _ *MockClient) {
+			},
+		},
+		{
+			name: "Post of another type",
+			post: &model.Post{UserId: "demoUserID", Type: "custom_zoom", Message: joinURL},
+			setup: func(_ *testing.T, _ *plugintest.API, _ *MockClient) {
+			},
+		},
+		{
+			name: "Poster not connected",
+			post: &model.Post{UserId: "demoUserID", Message: "Join " + joinURL},
+			setup: func(_ *testing.T, api *plugintest.API, _ *MockClient) {
+				api.On("KVGet", "token_demoUserID").Return(nil, nil)
+				api.On("LogDebug", "unfurlMeetingLink, cannot get the shared meeting", "UserID", "demoUserID", "error", mock.Anything).Return()
+			},
+		},
+		{
+			name: "Meeting not found",
+			post: &model.Post{UserId: "demoUserID", Message: "Join " + joinURL},
+			setup: func(t *testing.T, api *plugintest.API, mockClient *MockClient) {
+				setupConnectedDemoUser(t, api)
+				api.On("LogDebug", "unfurlMeetingLink, cannot get the shared meeting", "UserID", "demoUserID", "error", "meeting not found").Return()
+				mockClient.On("GetMeetingByJoinURL", joinURL).Return(&OnlineMeeting{}, errors.New("meeting not found"))
+			},
+		},
+		{
+			name: "Meeting card",
+			post: &model.Post{UserId: "demoUserID", Message: "Join [the meeting](" + joinURL + ") now"},
+			setup: func(t *testing.T, api *plugintest.API, mockClient *MockClient) {
+				setupConnectedDemoUser(t, api)
+				api.On("GetUser", "demoUserID").Return(&model.User{Id: "demoUserID", Username: "demo"}, nil)
+				mockClient.On("GetMeetingByJoinURL", joinURL).Return(&OnlineMeeting{
+					JoinURL:       joinURL,
+					Subject:       "Planning",
+					Organizer:     "Megan Bowen",
+					StartDateTime: start,
+					EndDateTime:   start.Add(time.Hour),
+				}, nil)
+			},
+			expectedProps: model.StringInterface{
+				"meeting_link":             joinURL,
+				"meeting_status":           postTypeStarted,
+				"meeting_personal":         true,
+				"meeting_topic":            "Planning",
+				"meeting_creator_username": "demo",
+				"meeting_provider":         msteamsProviderName,
+				"meeting_organizer":        "Megan Bowen",
+				"meeting_shared":           true,
+				"meeting_start_time":       start.UnixMilli(),
+				"meeting_end_time":         start.Add(time.Hour).UnixMilli(),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			defer api.AssertExpectations(t)
+			mockClient := &MockClient{}
+			p := SetupMockPlugin(api, nil, nil)
+			p.setConfiguration(&configuration{EncryptionKey: "demo_encrypt_key", EnableMeetingLinkUnfurl: !tt.disabled})
+
+			tt.setup(t, api, mockClient)
+
+			unfurled := p.unfurlMeetingLinkWithDeps(tt.post, mockClientFactory(mockClient))
+			if tt.expectedProps == nil {
+				require.Nil(t, unfurled)
+				return
+			}
+			require.NotNil(t, unfurled)
+			require.Equal(t, "custom_mstmeetings", unfurled.Type)
+			require.Equal(t, tt.post.Message, unfurled.Message)
+			require.Equal(t, tt.expectedProps, unfurled.GetProps())
+			require.Empty(t, tt.post.Type, "the original post must not be modified")
+		})
+	}
+}
+
+func TestMessageHasBeenPostedUnfurlsMeetingLink(t *testing.T) {
+	joinURL := "https://teams.microsoft.com/l/meetup-join/19%3ameeting_abc%40thread.v2/0"
+
+	api := &plugintest.API{}
+	defer api.AssertExpectations(t)
+	mockClient := &MockClient{}
+	defer mockClient.AssertExpectations(t)
+	p := SetupMockPlugin(api, nil, nil)
+	p.setConfiguration(&configuration{EncryptionKey: "demo_encrypt_key", EnableMeetingLinkUnfurl: true})
+
+	setupConnectedDemoUser(t, api)
+	api.On("GetUser", "demoUserID").Return(&model.User{Id: "demoUserID", Username: "demo"}, nil)
+	mockClient.On("GetMeetingByJoinURL", joinURL).Return(&OnlineMeeting{JoinURL: joinURL, Subject: "Planning"}, nil)
+	api.On("UpdatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.Id == "postID" && post.Type == "custom_mstmeetings"
+	})).Return(func(post *model.Post) *model.Post { return post }, nil)
+	// The meeting card counts as a recent meeting of the channel.
+	api.On("KVGet", "activemeetings_channelID").Return(nil, nil)
+	api.On("KVSetWithOptions", "activemeetings_channelID", mock.MatchedBy(func(data []byte) bool {
+		return strings.Contains(string(data), `"post_id":"postID"`)
+	}), mock.Anything).Return(true, nil)
+
+	p.messageHasBeenPostedWithDeps(&model.Post{Id: "postID", ChannelId: "channelID", UserId: "demoUserID", Message: "Join " + joinURL}, mockClientFactory(mockClient))
+}
@@ -11,10 +11,13 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io"
+	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/pkg/errors"
-	msgraph "github.com/yaegashi/msgraph.go/beta"
 	"golang.org/x/oauth2"
 )
 
@@ -84,21 +87,80 @@ const (
 	tokenKeyByRemoteID = "tbyrid_"
 )
 
-func (c *Client) GetMe() (*msgraph.User, error) {
-	ctx := context.Background()
-	graphUser, err := c.builder.Me().Request().Get(ctx)
+// RemoteUser is a Microsoft account as seen by the plugin.
+type RemoteUser struct {
+	ID                string
+	Mail              string
+	UserPrincipalName string
+}
+
+type graphUser struct {
+	ID                string `json:"id"`
+	Mail              string `json:"mail"`
+	UserPrincipalName string `json:"userPrincipalName"`
+}
+
+func (u *graphUser) toRemoteUser() *RemoteUser {
+	return &RemoteUser{
+		ID:                u.ID,
+		Mail:              u.Mail,
+		UserPrincipalName: u.UserPrincipalName,
+	}
+}
+
+var graphUserSelect = url.Values{"$select": {"id,mail,userPrincipalName"}}
+
+func (c *Client) GetMe(ctx context.Context) (*RemoteUser, error) {
+	var out graphUser
+	err := c.do(ctx, http.MethodGet, "/me", graphUserSelect, nil, &out)
 	if err != nil {
 		c.api.LogError(errors.Wrap(err, "cannot get user").Error())
 		return nil, err
 	}
 
-	if graphUser == nil {
+	if out.ID == "" {
 		err = errors.New("empty user")
 		c.api.LogError(errors.Wrap(err, "cannot get user").Error())
 		return nil, err
 	}
 
-	return graphUser, nil
+	return out.toRemoteUser(), nil
+}
+
+// GetUser looks up a directory user by mail address or user principal name.
+// It requires the User.Read.All permission and is used when creating meetings
+// with application permissions, where there is no signed-in user.
+func (c *Client) GetUser(ctx context.Context, email string) (*RemoteUser, error) {
+	escaped := strings.ReplaceAll(email, "'", "''")
+	query := url.Values{
+		"$select": graphUserSelect["$select"],
+		"$filter": {fmt.Sprintf("mail eq '%s' or userPrincipalName eq '%s'", escaped, escaped)},
+	}
+
+	var out struct {
+		Value []graphUser `json:"value"`
+	}
+	err := c.do(ctx, http.MethodGet, "/users", query, nil, &out)
+	if err != nil {
+		c.api.LogError(errors.Wrap(err, "cannot get user by email").Error())
+		return nil, err
+	}
+
+	if len(out.Value) == 0 {
+		return nil, errors.Errorf("no Microsoft user found for %s", email)
+	}
+
+	return out.Value[0].toRemoteUser(), nil
+}
+
+// RevokeSignInSessions invalidates the refresh tokens issued to the signed-in user, including
+// the one stored by the plugin.
+func (c *Client) RevokeSignInSessions(ctx context.Context) error {
+	err := c.do(ctx, http.MethodPost, "/me/revokeSignInSessions", nil, nil, nil)
+	if err != nil {
+		return errors.Wrap(err, "cannot revoke sign-in sessions")
+	}
+	return nil
 }
 
 func (p *Plugin) StoreUserInfo(info *UserInfo) error {
@@ -126,6 +188,33 @@ func (p *Plugin) GetUserInfo(userID string) (*UserInfo, error) {
 	return DecryptUserInfo(infoBytes, key)
 }
 
+// isUserConnected reports whether a Mattermost user has connected a Microsoft account.
+func (p *Plugin) isUserConnected(userID string) (bool, error) {
+	infoBytes, appErr := p.API.KVGet(tokenKey + userID)
+	if appErr != nil {
+		return false, appErr
+	}
+	return infoBytes != nil, nil
+}
+
+// getUserInfoByRemoteID returns the stored info of the user connected to a Microsoft account.
+func (p *Plugin) getUserInfoByRemoteID(remoteID string) (*UserInfo, error) {
+	if remoteID == "" {
+		return nil, errors.New("empty remote ID")
+	}
+
+	infoBytes, appErr := p.API.KVGet(tokenKeyByRemoteID + remoteID)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if infoBytes == nil {
+		return nil, errors.New("no Mattermost account is connected to this Microsoft account")
+	}
+
+	key := []byte(p.getConfiguration().EncryptionKey)
+	return DecryptUserInfo(infoBytes, key)
+}
+
 func (p *Plugin) RemoveUser(userID string) error {
 	info, err := p.GetUserInfo(userID)
 	if err != nil {
@@ -140,6 +229,9 @@ func (p *Plugin) RemoveUser(userID string) error {
 	if errByRemoteID != nil {
 		return errByRemoteID
 	}
+	if err := p.removeConnectedUser(userID); err != nil {
+		p.API.LogWarn("failed to remove user from the connected users index", "UserID", userID, "error", err.Error())
+	}
 	return nil
 }
 
@@ -222,15 +314,40 @@ func generateSecret() (string, error) {
 }
 
 func (p *Plugin) resetAllOAuthTokens() {
-	// At this time the only data the plugin stores in the KV store is the user
-	// OAuth2 tokens, and the temporary state to use during OAuth2
-	// authentication flow. Since a change in the encryption key invalidates all
-	// connections, we can safely remove all of plugin's data since it'll be
-	// irrelevant anyway.
+	// A change in the OAuth2 configuration invalidates all connections, so the stored tokens are
+	// irrelevant anyway. The other data of the plugin, such as user preferences and channel
+	// settings, is kept.
 	p.API.LogInfo("OAuth2 configuration changed. Resetting all users' tokens, everyone will need to reconnect to MS Teams")
-	appErr := p.API.KVDeleteAll()
-	if appErr != nil {
-		p.API.LogError("failed to reset user's OAuth2 tokens", "error", appErr.Error())
+	if err := p.deleteAllOAuthTokens(); err != nil {
+		p.API.LogError("failed to reset user's OAuth2 tokens", "error", err.Error())
 		return
 	}
 }
+
+// deleteAllOAuthTokens deletes the tokens of every connected user and the index of connected
+// users.
+func (p *Plugin) deleteAllOAuthTokens() error {
+	// The keys are listed before any is deleted, so that deleting does not shift the pages.
+	var keys []string
+	for page := 0; ; page++ {
+		pageKeys, appErr := p.API.KVList(page, kvListPerPage)
+		if appErr != nil {
+			return appErr
+		}
+		for _, key := range pageKeys {
+			if strings.HasPrefix(key, tokenKey) || strings.HasPrefix(key, tokenKeyByRemoteID) {
+				keys = append(keys, key)
+			}
+		}
+		if len(pageKeys) < kvListPerPage {
+			break
+		}
+	}
+
+	for _, key := range append(keys, connectedUsersKey) {
+		if appErr := p.API.KVDelete(key); appErr != nil {
+			return appErr
+		}
+	}
+	return nil
+}
@@ -101,12 +101,12 @@ func TestStoreUserInfo(t *testing.T) {
 func TestResetAllOAuthTokens(t *testing.T) {
 	tests := []struct {
 		name           string
-		kvDeleteAllErr error
+		kvDeleteErr    *model.AppError
 		expectLogError bool
 	}{
 		{
 			name:           "Error Deleting Tokens",
-			kvDeleteAllErr: &model.AppError{Message: "error in deleting all oauth token"},
+			kvDeleteErr:    &model.AppError{Message: "error in deleting all oauth token"},
 			expectLogError: true,
 		},
 		{
@@ -120,10 +120,15 @@ func TestResetAllOAuthTokens(t *testing.T) {
 			p := SetupMockPlugin(mockAPI, nil, nil)
 
 			mockAPI.On("LogInfo", "OAuth2 configuration changed. Resetting all users' tokens, everyone will need to reconnect to MS Teams").Return(nil)
-			mockAPI.On("KVDeleteAll").Return(tt.kvDeleteAllErr)
-
+			// Only the tokens and the index of connected users are deleted.
+			mockAPI.On("KVList", 0, kvListPerPage).Return([]string{"token_userID", "tbyrid_remoteID", "preferences_userID", "channelsettings_channelID"}, nil)
 			if tt.expectLogError {
-				mockAPI.On("LogError", "failed to reset user's OAuth2 tokens", "error", tt.kvDeleteAllErr.Error()).Return(nil)
+				mockAPI.On("KVDelete", "token_userID").Return(tt.kvDeleteErr)
+				mockAPI.On("LogError", "failed to reset user's OAuth2 tokens", "error", tt.kvDeleteErr.Error()).Return(nil)
+			} else {
+				mockAPI.On("KVDelete", "token_userID").Return(nil)
+				mockAPI.On("KVDelete", "tbyrid_remoteID").Return(nil)
+				mockAPI.On("KVDelete", connectedUsersKey).Return(nil)
 			}
 
 			p.resetAllOAuthTokens()
@@ -131,3 +136,43 @@ func TestResetAllOAuthTokens(t *testing.T) {
 		})
 	}
 }
+
+func TestUserHasBeenDeactivated(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		connected bool
+	}{
+		{
+			name: "User not connected",
+		},
+		{
+			name:      "Connected user is removed",
+			connected: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAPI := &plugintest.API{}
+			p := SetupMockPlugin(mockAPI, nil, nil)
+			p.setConfiguration(&configuration{
+				EncryptionKey: "demo_encrypt_key",
+			})
+
+			if tt.connected {
+				info := &UserInfo{UserID: "mockUserID", RemoteID: "mockRemoteID"}
+				data, err := info.EncryptedJSON([]byte("demo_encrypt_key"))
+				require.NoError(t, err)
+				mockAPI.On("KVGet", "token_mockUserID").Return(data, nil)
+				mockAPI.On("KVDelete", "token_mockUserID").Return(nil)
+				mockAPI.On("KVDelete", "tbyrid_mockRemoteID").Return(nil)
+				mockAPI.On("KVGet", connectedUsersKey).Return(nil, nil)
+				mockAPI.On("KVCompareAndSet", connectedUsersKey, []byte(nil), []byte(`{}`)).Return(true, nil)
+				mockAPI.On("LogInfo", "Removed the Microsoft account connection of a deactivated user", "UserID", "mockUserID").Return()
+			} else {
+				mockAPI.On("KVGet", "token_mockUserID").Return(nil, nil)
+			}
+
+			p.UserHasBeenDeactivated(nil, &model.User{Id: "mockUserID"})
+			mockAPI.AssertExpectations(t)
+		})
+	}
+}
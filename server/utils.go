@@ -4,6 +4,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"time"
@@ -21,31 +22,18 @@ func (p *Plugin) getSiteURL() (string, error) {
 	return *siteURLRef, nil
 }
 
-func (p *Plugin) checkPreviousMessages(channelID string) (recentMeeting bool, meetingLink string, creatorName string, provider string, err *model.AppError) {
-	var meetingTimeWindow int64 = 30 // 30 seconds
-
-	postList, appErr := p.API.GetPostsSince(channelID, (time.Now().Unix()-meetingTimeWindow)*1000)
-	if appErr != nil {
-		return false, "", "", "", appErr
-	}
-
-	for _, post := range postList.ToSlice() {
-		meetingProvider := getString("meeting_provider", post.Props)
-		if meetingProvider == "" {
-			continue
-		}
-
-		meetingLink := getString("meeting_link", post.Props)
-		if meetingLink == "" {
-			continue
-		}
-
-		creator := getString("meeting_creator_username", post.Props)
-
-		return true, meetingLink, creator, meetingProvider, nil
+// getUserLocation returns the timezone of a user, defaulting to UTC.
+func getUserLocation(user *model.User) *time.Location {
+	loc, err := time.LoadLocation(user.GetPreferredTimezone())
+	if err != nil {
+		return time.UTC
 	}
+	return loc
+}
 
-	return false, "", "", "", nil
+// isTimeout reports whether err was caused by a request running past its deadline.
+func isTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded)
 }
 
 func getString(key string, props model.StringInterface) string {
@@ -0,0 +1,617 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/i18n"
+	"github.com/pkg/errors"
+)
+
+const (
+	webinarsKey             = "webinars"
+	webinarJobKey           = "webinarregistrations"
+	webinarReportInterval   = time.Hour
+	webinarsPath            = "/api/v1/webinars"
+	webinarDialogPath       = "/api/v1/dialog/webinar"
+	webinarDialogCallbackID = "new_webinar"
+	defaultWebinarCapacity  = 100
+	maxWebinarCapacity      = 1000
+	webinarCancelTimeout    = 30 * time.Second
+
+	dialogFieldDescription = "description"
+	dialogFieldCapacity    = "capacity"
+	dialogFieldAudience    = "audience"
+)
+
+// webinarAudiences are who can register to a webinar.
+var webinarAudiences = []string{"organization", "everyone"}
+
+// WebinarOptions are the settings of a webinar being created.
+type WebinarOptions struct {
+	Subject       string
+	Description   string
+	StartDateTime time.Time
+	Duration      time.Duration
+	// Capacity is how many people can register.
+	Capacity int
+	// Audience is "organization" or "everyone".
+	Audience string
+}
+
+// Webinar is a Teams webinar open to registration.
+type Webinar struct {
+	ID              string
+	RegistrationURL string
+}
+
+type graphWebinar struct {
+	ID            string                 `json:"id,omitempty"`
+	DisplayName   string                 `json:"displayName,omitempty"`
+	Description   *graphItemBody         `json:"description,omitempty"`
+	StartDateTime *graphDateTimeTimeZone `json:"startDateTime,omitempty"`
+	EndDateTime   *graphDateTimeTimeZone `json:"endDateTime,omitempty"`
+	Audience      string                 `json:"audience,omitempty"`
+}
+
+type graphWebinarRegistrationConfiguration struct {
+	Capacity                  int    `json:"capacity"`
+	IsManagerApprovalRequired bool   `json:"isManagerApprovalRequired"`
+	IsWaitlistEnabled         bool   `json:"isWaitlistEnabled"`
+	RegistrationWebURL        string `json:"registrationWebUrl,omitempty"`
+}
+
+func getWebinarPath(webinarID string) string {
+	return "/solutions/virtualEvents/webinars/" + url.PathEscape(webinarID)
+}
+
+// CreateWebinar creates a webinar of the signed-in user, opens its registration and publishes
+// it. The webinar is cancelled if it cannot be opened to registration or published, so that no
+// draft is left behind. Creating, configuring, publishing and cancelling webinars are only
+// available in the beta endpoint of Graph. Town halls are not supported.
+func (c *Client) CreateWebinar(ctx context.Context, options *WebinarOptions) (*Webinar, error) {
+	in := graphWebinar{
+		DisplayName:   options.Subject,
+		StartDateTime: newGraphDateTime(options.StartDateTime),
+		EndDateTime:   newGraphDateTime(options.StartDateTime.Add(options.Duration)),
+		Audience:      options.Audience,
+	}
+	if options.Description != "" {
+		in.Description = &graphItemBody{ContentType: "text", Content: options.Description}
+	}
+	var out graphWebinar
+	if err := c.doBeta(ctx, http.MethodPost, "/solutions/virtualEvents/webinars", nil, &in, &out); err != nil {
+		return nil, errors.Wrap(err, "cannot create webinar")
+	}
+
+	registration := graphWebinarRegistrationConfiguration{Capacity: options.Capacity}
+	var registrationOut graphWebinarRegistrationConfiguration
+	if err := c.doBeta(ctx, http.MethodPost, getWebinarPath(out.ID)+"/registrationConfiguration", nil, &registration, &registrationOut); err != nil {
+		c.cancelWebinar(out.ID)
+		return nil, errors.Wrap(err, "cannot configure webinar registration")
+	}
+
+	if err := c.doBeta(ctx, http.MethodPost, getWebinarPath(out.ID)+"/publish", nil, nil, nil); err != nil {
+		c.cancelWebinar(out.ID)
+		return nil, errors.Wrap(err, "cannot publish webinar")
+	}
+
+	return &Webinar{ID: out.ID, RegistrationURL: registrationOut.RegistrationWebURL}, nil
+}
+
+// cancelWebinar cancels a webinar that could not be set up. It does not use the context of the
+// request, which may be why setting it up failed.
+func (c *Client) cancelWebinar(webinarID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), webinarCancelTimeout)
+	defer cancel()
+
+	if err := c.doBeta(ctx, http.MethodPost, getWebinarPath(webinarID)+"/cancel", nil, nil, nil); err != nil {
+		c.api.LogWarn("failed to cancel the webinar that could not be set up", "WebinarID", webinarID, "error", err.Error())
+	}
+}
+
+// GetWebinarRegistrationCount returns how many people are registered to a webinar, leaving out
+// cancelled registrations.
+func (c *Client) GetWebinarRegistrationCount(ctx context.Context, webinarID string) (int, error) {
+	path := getWebinarPath(webinarID) + "/registrations"
+	query := url.Values{"$select": {"id,status"}}
+	count := 0
+	for path != "" {
+		var out struct {
+			Value []struct {
+				Status string `json:"status"`
+			} `json:"value"`
+			NextLink string `json:"@odata.nextLink"`
+		}
+		if err := c.do(ctx, http.MethodGet, path, query, nil, &out); err != nil {
+			return 0, errors.Wrap(err, "cannot list webinar registrations")
+		}
+		for _, registration := range out.Value {
+			if registration.Status != "canceled" {
+				count++
+			}
+		}
+
+		// The next page link carries the query.
+		path, query = "", nil
+		if out.NextLink != "" {
+			if !strings.HasPrefix(out.NextLink, c.baseURL) {
+				return 0, errors.New("unexpected next page link")
+			}
+			path = strings.TrimPrefix(out.NextLink, c.baseURL)
+		}
+	}
+	return count, nil
+}
+
+// trackedWebinar is an entry of the index of webinars whose registrations are reported, keyed by
+// the webinar ID.
+type trackedWebinar struct {
+	WebinarID string `json:"webinar_id"`
+	PostID    string `json:"post_id"`
+	ChannelID string `json:"channel_id"`
+	CreatorID string `json:"creator_id"`
+	Subject   string `json:"subject"`
+	StartAt   int64  `json:"start_at"`
+	// Registrations is the count last reported.
+	Registrations int `json:"registrations"`
+}
+
+func (p *Plugin) getWebinarsIndex() (map[string]*trackedWebinar, []byte, error) {
+	return getJSONIndex[*trackedWebinar](p.API, webinarsKey)
+}
+
+func (p *Plugin) updateWebinarsIndex(update func(index map[string]*trackedWebinar)) error {
+	return updateJSONIndex(p.API, webinarsKey, 0, update)
+}
+
+// postWebinarWithDeps creates a webinar and posts its registration link in a channel. Its
+// registrations are then reported in the thread of the post until it starts.
+func (p *Plugin) postWebinarWithDeps(ctx context.Context, creator *model.User, channelID string, options *WebinarOptions, client ClientInterface) (*model.Post, *Webinar, error) {
+	if !p.API.HasPermissionToChannel(creator.Id, channelID, model.PermissionCreatePost) {
+		return nil, nil, errors.New("cannot create post in this channel")
+	}
+
+	webinar, err := client.CreateWebinar(ctx, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	post := &model.Post{
+		UserId:    creator.Id,
+		ChannelId: channelID,
+		Message: p.localize(p.getUserLocalizer(creator.Id), &i18n.Message{
+			ID:    "mstmeetings.webinar.created",
+			Other: "Webinar **{{.Subject}}** on {{.StartTime}}. [Register here]({{.RegistrationURL}}).",
+		}, map[string]any{
+			"Subject":         options.Subject,
+			"StartTime":       options.StartDateTime.In(getUserLocation(creator)).Format("2006-01-02 15:04 MST"),
+			"RegistrationURL": webinar.RegistrationURL,
+		}),
+		Props: model.StringInterface{
+			"webinar_id":               webinar.ID,
+			"webinar_registration_url": webinar.RegistrationURL,
+		},
+	}
+	post, appErr := p.API.CreatePost(post)
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+
+	err = p.updateWebinarsIndex(func(index map[string]*trackedWebinar) {
+		index[webinar.ID] = &trackedWebinar{
+			WebinarID: webinar.ID,
+			PostID:    post.Id,
+			ChannelID: channelID,
+			CreatorID: creator.Id,
+			Subject:   options.Subject,
+			StartAt:   options.StartDateTime.UnixMilli(),
+		}
+	})
+	if err != nil {
+		p.API.LogWarn("failed to track webinar registrations", "WebinarID", webinar.ID, "error", err.Error())
+	}
+
+	return post, webinar, nil
+}
+
+// reportWebinarRegistrations replies in the thread of each upcoming webinar when its number of
+// registrations changed, and stops tracking the webinars that started. It runs on a single server
+// of the cluster.
+func (p *Plugin) reportWebinarRegistrations() {
+	p.reportWebinarRegistrationsWithDeps(p.NewClient)
+}
+
+func (p *Plugin) reportWebinarRegistrationsWithDeps(newClient ClientFactory) {
+	index, _, err := p.getWebinarsIndex()
+	if err != nil {
+		p.API.LogError("reportWebinarRegistrations, failed to get the webinars index", "error", err.Error())
+		return
+	}
+
+	now := time.Now().UnixMilli()
+	for webinarID, webinar := range index {
+		if now >= webinar.StartAt {
+			err = p.updateWebinarsIndex(func(index map[string]*trackedWebinar) {
+				delete(index, webinarID)
+			})
+			if err != nil {
+				p.API.LogWarn("reportWebinarRegistrations, failed to stop tracking webinar", "WebinarID", webinarID, "error", err.Error())
+			}
+			continue
+		}
+
+		count, err := p.reportWebinarRegistration(webinar, newClient)
+		if err != nil {
+			p.API.LogDebug("reportWebinarRegistrations, failed to report webinar registrations", "WebinarID", webinarID, "error", err.Error())
+			continue
+		}
+		if count == webinar.Registrations {
+			continue
+		}
+		err = p.updateWebinarsIndex(func(index map[string]*trackedWebinar) {
+			if tracked := index[webinarID]; tracked != nil {
+				tracked.Registrations = count
+			}
+		})
+		if err != nil {
+			p.API.LogWarn("reportWebinarRegistrations, failed to update the webinars index", "WebinarID", webinarID, "error", err.Error())
+		}
+	}
+}
+
+// reportWebinarRegistration posts the number of registrations to a webinar if it changed since
+// the last report, and returns it.
+func (p *Plugin) reportWebinarRegistration(webinar *trackedWebinar, newClient ClientFactory) (int, error) {
+	client, err := p.newUserClient(webinar.CreatorID, newClient)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.getConfiguration().getRequestTimeout())
+	defer cancel()
+
+	count, err := client.GetWebinarRegistrationCount(ctx, webinar.WebinarID)
+	if err != nil {
+		return 0, err
+	}
+	if count == webinar.Registrations {
+		return count, nil
+	}
+
+	post := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: webinar.ChannelID,
+		RootId:    webinar.PostID,
+		Message: p.localize(p.getUserLocalizer(webinar.CreatorID), &i18n.Message{
+			ID:    "mstmeetings.webinar.registrations",
+			Other: "Registrations for **{{.Subject}}**: {{.Count}}",
+		}, map[string]any{"Subject": webinar.Subject, "Count": count}),
+	}
+	if _, appErr := p.API.CreatePost(post); appErr != nil {
+		return 0, appErr
+	}
+	return count, nil
+}
+
+// webinarsDisabledMessage is the reply of the webinar command and dialog when they are disabled.
+var webinarsDisabledMessage = &i18n.Message{ID: "mstmeetings.webinar.disabled", Other: "Webinars are not enabled on this server."}
+
+func (p *Plugin) handleWebinar(args []string, extra *model.CommandArgs) (string, error) {
+	l := p.getUserLocalizer(extra.UserId)
+	if config := p.getConfiguration(); config == nil || !config.EnableWebinars || config.UseApplicationPermissions {
+		return p.localize(l, webinarsDisabledMessage, nil), nil
+	}
+	if len(args) < 2 || args[1] != "create" {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.webinar.usage",
+			Other: "Run `/mstmeetings webinar create` to create a Teams webinar with registration.",
+		}, nil), nil
+	}
+	if len(args) > 2 {
+		return p.localize(l, tooManyParametersMessage, nil), nil
+	}
+
+	user, appErr := p.API.GetUser(extra.UserId)
+	if appErr != nil {
+		return p.localize(l, getUserFailedMessage, nil), errors.Wrap(appErr, "cannot get user")
+	}
+
+	appErr = p.API.OpenInteractiveDialog(model.OpenDialogRequest{
+		TriggerId: extra.TriggerId,
+		URL:       fmt.Sprintf("/plugins/%s%s", url.PathEscape(manifest.Id), webinarDialogPath),
+		Dialog:    p.getWebinarDialog(l, user),
+	})
+	if appErr != nil {
+		return p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.webinar.open_dialog_failed",
+			Other: "Failed to open the webinar dialog.",
+		}, nil), errors.Wrap(appErr, "cannot open interactive dialog")
+	}
+	return "", nil
+}
+
+func (p *Plugin) getWebinarDialog(l *i18n.Localizer, user *model.User) model.Dialog {
+	audienceOptions := make([]*model.PostActionOptions, 0, len(webinarAudiences))
+	for _, audience := range webinarAudiences {
+		audienceOptions = append(audienceOptions, &model.PostActionOptions{Text: audience, Value: audience})
+	}
+
+	return model.Dialog{
+		CallbackId:  webinarDialogCallbackID,
+		Title:       p.localize(l, &i18n.Message{ID: "mstmeetings.webinar.dialog_title", Other: "New MS Teams Webinar"}, nil),
+		SubmitLabel: p.localize(l, dialogCreateMessage, nil),
+		Elements: []model.DialogElement{
+			{
+				DisplayName: p.localize(l, &i18n.Message{ID: "mstmeetings.webinar.title", Other: "Title"}, nil),
+				Name:        dialogFieldTopic,
+				Type:        "text",
+				MaxLength:   maxTopicTemplateLength,
+			},
+			{
+				DisplayName: p.localize(l, &i18n.Message{ID: "mstmeetings.webinar.description", Other: "Description"}, nil),
+				Name:        dialogFieldDescription,
+				Type:        "textarea",
+				Optional:    true,
+			},
+			{
+				DisplayName: p.localize(l, dialogStartTimeMessage, nil),
+				Name:        dialogFieldStartTime,
+				Type:        "text",
+				Placeholder: "YYYY-MM-DD HH:MM",
+				HelpText: p.localize(l, &i18n.Message{
+					ID:    "mstmeetings.webinar.start_time_help",
+					Other: "In your timezone ({{.Timezone}}).",
+				}, map[string]any{"Timezone": getUserLocation(user).String()}),
+			},
+			{
+				DisplayName: p.localize(l, dialogDurationMessage, nil),
+				Name:        dialogFieldDuration,
+				Type:        "text",
+				SubType:     "number",
+				Default:     strconv.Itoa(int(defaultMeetingDuration.Minutes())),
+			},
+			{
+				DisplayName: p.localize(l, &i18n.Message{ID: "mstmeetings.webinar.capacity", Other: "Capacity"}, nil),
+				Name:        dialogFieldCapacity,
+				Type:        "text",
+				SubType:     "number",
+				Default:     strconv.Itoa(defaultWebinarCapacity),
+				HelpText:    p.localize(l, &i18n.Message{ID: "mstmeetings.webinar.capacity_help", Other: "How many people can register."}, nil),
+			},
+			{
+				DisplayName: p.localize(l, &i18n.Message{ID: "mstmeetings.webinar.audience", Other: "Audience"}, nil),
+				Name:        dialogFieldAudience,
+				Type:        "select",
+				Default:     webinarAudiences[0],
+				HelpText:    p.localize(l, &i18n.Message{ID: "mstmeetings.webinar.audience_help", Other: "Who can register."}, nil),
+				Options:     audienceOptions,
+			},
+		},
+	}
+}
+
+// validateWebinarOptions returns the errors of webinar options, keyed by dialog field.
+func (p *Plugin) validateWebinarOptions(l *i18n.Localizer, options *WebinarOptions) map[string]string {
+	fieldErrors := map[string]string{}
+	if options.Subject == "" || len(options.Subject) > maxTopicTemplateLength {
+		fieldErrors[dialogFieldTopic] = p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.webinar.invalid_title",
+			Other: "The title must be between 1 and {{.Length}} characters long.",
+		}, map[string]any{"Length": maxTopicTemplateLength})
+	}
+	if !options.StartDateTime.After(time.Now()) {
+		fieldErrors[dialogFieldStartTime] = p.localize(l, pastStartTimeMessage, nil)
+	}
+	if options.Duration < time.Minute || options.Duration > maxMeetingDuration*time.Minute {
+		fieldErrors[dialogFieldDuration] = p.localize(l, invalidDurationMessage, map[string]any{"Max": maxMeetingDuration})
+	}
+	if options.Capacity < 1 || options.Capacity > maxWebinarCapacity {
+		fieldErrors[dialogFieldCapacity] = p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.webinar.invalid_capacity",
+			Other: "The capacity must be between 1 and {{.Max}}.",
+		}, map[string]any{"Max": maxWebinarCapacity})
+	}
+	if !slices.Contains(webinarAudiences, options.Audience) {
+		fieldErrors[dialogFieldAudience] = p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.webinar.invalid_audience",
+			Other: "Select an audience from the list.",
+		}, nil)
+	}
+	if len(fieldErrors) > 0 {
+		return fieldErrors
+	}
+	return nil
+}
+
+// parseWebinarDialog validates a webinar dialog submission. The returned errors are keyed by
+// field and meant to be shown to the user.
+func (p *Plugin) parseWebinarDialog(l *i18n.Localizer, user *model.User, request *model.SubmitDialogRequest) (*WebinarOptions, map[string]string) {
+	submission := request.Submission
+	options := &WebinarOptions{
+		Subject:     getSubmissionString(submission, dialogFieldTopic),
+		Description: getSubmissionString(submission, dialogFieldDescription),
+		Audience:    getSubmissionString(submission, dialogFieldAudience),
+	}
+	minutes, _ := strconv.Atoi(getSubmissionString(submission, dialogFieldDuration))
+	options.Duration = time.Duration(minutes) * time.Minute
+	options.Capacity, _ = strconv.Atoi(getSubmissionString(submission, dialogFieldCapacity))
+
+	start, err := time.ParseInLocation(dialogStartTimeLayout, getSubmissionString(submission, dialogFieldStartTime), getUserLocation(user))
+	if err != nil {
+		return nil, map[string]string{dialogFieldStartTime: p.localize(l, invalidStartTimeMessage, nil)}
+	}
+	options.StartDateTime = start
+
+	if fieldErrors := p.validateWebinarOptions(l, options); fieldErrors != nil {
+		return nil, fieldErrors
+	}
+	return options, nil
+}
+
+func (p *Plugin) handleWebinarDialog(w http.ResponseWriter, r *http.Request) {
+	p.handleWebinarDialogWithDeps(w, r, p.NewClient)
+}
+
+func (p *Plugin) handleWebinarDialogWithDeps(w http.ResponseWriter, r *http.Request, newClient ClientFactory) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		p.API.LogError("handleWebinarDialog, unauthorized user")
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request model.SubmitDialogRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		p.API.LogError("handleWebinarDialog, failed to decode dialog submission", "Error", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Cancelled {
+		return
+	}
+	l := p.getUserLocalizer(userID)
+	if config := p.getConfiguration(); config == nil || !config.EnableWebinars || config.UseApplicationPermissions {
+		p.writeDialogResponse(w, &model.SubmitDialogResponse{Error: p.localize(l, webinarsDisabledMessage, nil)})
+		return
+	}
+
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		p.API.LogError("handleWebinarDialog, failed to get user", "UserID", userID, "Error", appErr.Message)
+		http.Error(w, appErr.Error(), appErr.StatusCode)
+		return
+	}
+
+	options, fieldErrors := p.parseWebinarDialog(l, user, &request)
+	if fieldErrors != nil {
+		p.writeDialogResponse(w, &model.SubmitDialogResponse{Errors: fieldErrors})
+		return
+	}
+
+	// Webinars can only be created with delegated permissions.
+	client, err := p.newUserClient(userID, newClient)
+	if err != nil {
+		p.writeDialogResponse(w, &model.SubmitDialogResponse{Error: p.localize(l, connectFirstMessage, nil)})
+		return
+	}
+
+	if _, _, err := p.postWebinarWithDeps(r.Context(), user, request.ChannelId, options, client); err != nil {
+		p.API.LogError("handleWebinarDialog, failed to post webinar", "UserID", userID, "Error", err.Error())
+		message := p.localize(l, &i18n.Message{
+			ID:    "mstmeetings.webinar.create_failed",
+			Other: "Failed to create the webinar. Please try again.",
+		}, nil)
+		if isTimeout(err) {
+			message = p.localize(l, requestTimeoutMessage, nil)
+		}
+		p.writeDialogResponse(w, &model.SubmitDialogResponse{Error: message})
+		return
+	}
+}
+
+type createWebinarRequest struct {
+	ChannelID       string    `json:"channel_id"`
+	Subject         string    `json:"subject"`
+	Description     string    `json:"description"`
+	StartTime       time.Time `json:"start_time"`
+	DurationMinutes int       `json:"duration_minutes"`
+	Capacity        int       `json:"capacity"`
+	Audience        string    `json:"audience"`
+}
+
+type createWebinarResponse struct {
+	WebinarID       string `json:"webinar_id"`
+	PostID          string `json:"post_id"`
+	RegistrationURL string `json:"registration_url"`
+}
+
+func (p *Plugin) handleCreateWebinar(w http.ResponseWriter, r *http.Request) {
+	p.handleCreateWebinarWithDeps(w, r, p.NewClient)
+}
+
+func (p *Plugin) handleCreateWebinarWithDeps(w http.ResponseWriter, r *http.Request, newClient ClientFactory) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		p.API.LogError("handleCreateWebinar, unauthorized user")
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if config := p.getConfiguration(); config == nil || !config.EnableWebinars || config.UseApplicationPermissions {
+		http.Error(w, "Webinars are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	const maxRequestBodySize = 1 * 1024 * 1024 // 1MB
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+
+	var req createWebinarRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	options := &WebinarOptions{
+		Subject:       strings.TrimSpace(req.Subject),
+		Description:   req.Description,
+		StartDateTime: req.StartTime,
+		Duration:      time.Duration(req.DurationMinutes) * time.Minute,
+		Capacity:      req.Capacity,
+		Audience:      req.Audience,
+	}
+	if options.Duration == 0 {
+		options.Duration = defaultMeetingDuration
+	}
+	if options.Capacity == 0 {
+		options.Capacity = defaultWebinarCapacity
+	}
+	if options.Audience == "" {
+		options.Audience = webinarAudiences[0]
+	}
+	if fieldErrors := p.validateWebinarOptions(p.getUserLocalizer(userID), options); fieldErrors != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]any{"errors": fieldErrors})
+		return
+	}
+
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		p.API.LogError("handleCreateWebinar, failed to get user", "UserID", userID, "Error", appErr.Message)
+		http.Error(w, appErr.Error(), appErr.StatusCode)
+		return
+	}
+
+	client, err := p.newUserClient(userID, newClient)
+	if err != nil {
+		http.Error(w, "Microsoft account not connected", http.StatusForbidden)
+		return
+	}
+
+	post, webinar, err := p.postWebinarWithDeps(r.Context(), user, req.ChannelID, options, client)
+	if err != nil {
+		p.API.LogError("handleCreateWebinar, failed to post webinar", "UserID", userID, "Error", err.Error())
+		writeGraphError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&createWebinarResponse{WebinarID: webinar.ID, PostID: post.Id, RegistrationURL: webinar.RegistrationURL}); err != nil {
+		p.API.LogWarn("failed to write response", "error", err.Error())
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2020-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostWebinar(t *testing.T) {
+	api := &plugintest.API{}
+	defer api.AssertExpectations(t)
+	mockClient := &MockClient{}
+	defer mockClient.AssertExpectations(t)
+	p := SetupMockPlugin(api, nil, nil)
+
+	start := time.Date(2026, 11, 2, 16, 0, 0, 0, time.UTC)
+	options := &WebinarOptions{Subject: "Product launch", StartDateTime: start, Duration: time.Hour, Capacity: 100, Audience: "everyone"}
+	creator := &model.User{Id: "demoUserID"}
+
+	api.On("HasPermissionToChannel", "demoUserID", "channelID", model.PermissionCreatePost).Return(true)
+	mockClient.On("CreateWebinar", options).Return(&Webinar{ID: "webinarID", RegistrationURL: "https://events.teams.microsoft.com/event/webinarID"}, nil)
+	api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.UserId == "demoUserID" &&
+			post.Message == "Webinar **Product launch** on 2026-11-02 16:00 UTC. [Register here](https://events.teams.microsoft.com/event/webinarID)." &&
+			post.GetProp("webinar_id") == "webinarID"
+	})).Return(&model.Post{Id: "postID"}, nil)
+	expected, err := json.Marshal(map[string]*trackedWebinar{"webinarID": {
+		WebinarID: "webinarID",
+		PostID:    "postID",
+		ChannelID: "channelID",
+		CreatorID: "demoUserID",
+		Subject:   "Product launch",
+		StartAt:   start.UnixMilli(),
+	}})
+	require.NoError(t, err)
+	api.On("KVGet", "webinars").Return(nil, nil)
+	api.On("KVCompareAndSet", "webinars", []byte(nil), expected).Return(true, nil)
+
+	post, webinar, err := p.postWebinarWithDeps(context.Background(), creator, "channelID", options, mockClient)
+	require.NoError(t, err)
+	require.Equal(t, "postID", post.Id)
+	require.Equal(t, "webinarID", webinar.ID)
+}
+
+func TestReportWebinarRegistrations(t *testing.T) {
+	api := &plugintest.API{}
+	defer api.AssertExpectations(t)
+	mockClient := &MockClient{}
+	defer mockClient.AssertExpectations(t)
+	p := SetupMockPlugin(api, nil, nil)
+	p.botUserID = "botUserID"
+	p.setConfiguration(&configuration{EncryptionKey: "demo_encrypt_key", EnableWebinars: true})
+
+	setupConnectedDemoUser(t, api)
+
+	upcoming := time.Now().Add(24 * time.Hour).UnixMilli()
+	stored, err := json.Marshal(map[string]*trackedWebinar{
+		"changedID":   {WebinarID: "changedID", PostID: "changedPostID", ChannelID: "channelID", CreatorID: "demoUserID", Subject: "Launch", StartAt: upcoming, Registrations: 3},
+		"unchangedID": {WebinarID: "unchangedID", PostID: "unchangedPostID", ChannelID: "channelID", CreatorID: "demoUserID", Subject: "Q&A", StartAt: upcoming, Registrations: 5},
+		"startedID":   {WebinarID: "startedID", CreatorID: "demoUserID", StartAt: time.Now().Add(-time.Minute).UnixMilli()},
+	})
+	require.NoError(t, err)
+
+	api.On("KVGet", "webinars").Return(stored, nil)
+	api.On("KVCompareAndSet", "webinars", stored, mock.Anything).Return(true, nil)
+	mockClient.On("GetWebinarRegistrationCount", "changedID").Return(7, nil)
+	mockClient.On("GetWebinarRegistrationCount", "unchangedID").Return(5, nil)
+	api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.UserId == "botUserID" && post.RootId == "changedPostID" && post.Message == "Registrations for **Launch**: 7"
+	})).Return(&model.Post{}, nil).Once()
+
+	p.reportWebinarRegistrationsWithDeps(mockClientFactory(mockClient))
+}
+
+func TestParseWebinarDialog(t *testing.T) {
+	p := &Plugin{}
+	user := &model.User{Id: "demoUserID", Timezone: model.StringMap{"useAutomaticTimezone": "false", "manualTimezone": "Europe/Paris"}}
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	next := time.Now().In(paris).AddDate(0, 0, 7)
+
+	options, fieldErrors := p.parseWebinarDialog(defaultLocalizer, user, &model.SubmitDialogRequest{Submission: map[string]any{
+		dialogFieldTopic:     "Product launch",
+		dialogFieldStartTime: next.Format(dialogStartTimeLayout),
+		dialogFieldDuration:  float64(90),
+		dialogFieldCapacity:  "250",
+		dialogFieldAudience:  "everyone",
+	}})
+	require.Nil(t, fieldErrors)
+	expectedStart, err := time.ParseInLocation(dialogStartTimeLayout, next.Format(dialogStartTimeLayout), paris)
+	require.NoError(t, err)
+	require.True(t, expectedStart.Equal(options.StartDateTime))
+	require.Equal(t, 90*time.Minute, options.Duration)
+	require.Equal(t, 250, options.Capacity)
+
+	_, fieldErrors = p.parseWebinarDialog(defaultLocalizer, user, &model.SubmitDialogRequest{Submission: map[string]any{
+		dialogFieldStartTime: next.Format(dialogStartTimeLayout),
+		dialogFieldDuration:  "0",
+		dialogFieldCapacity:  "5000",
+		dialogFieldAudience:  "anyone",
+	}})
+	require.Len(t, fieldErrors, 4)
+}
+
+func TestHandleCreateWebinar(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         *configuration
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "Not enabled",
+			config:         &configuration{},
+			body:           `{}`,
+			expectedStatus: http.StatusNotImplemented,
+		},
+		{
+			name:           "Start time in the past",
+			config:         &configuration{EnableWebinars: true},
+			body:           `{"channel_id": "channelID", "subject": "Launch", "start_time": "2020-01-01T10:00:00Z"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			defer api.AssertExpectations(t)
+			p := SetupMockPlugin(api, nil, nil)
+			p.setConfiguration(tt.config)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, webinarsPath, bytes.NewReader([]byte(tt.body)))
+			r.Header.Set("Mattermost-User-Id", "demoUserID")
+			p.handleCreateWebinarWithDeps(w, r, mockClientFactory(&MockClient{}))
+
+			require.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
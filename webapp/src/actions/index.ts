@@ -4,63 +4,91 @@
 import {Dispatch} from 'redux';
 
 import {PostTypes} from 'mattermost-redux/action_types';
+import {getPost} from 'mattermost-redux/selectors/entities/posts';
 import {GetStateFunc} from 'mattermost-redux/types/actions';
 
 import Client from '../client';
 
-export function startMeeting(channelId: string, force = false, topic: string) {
+export function startMeeting(channelId: string, force = false, topic: string, rootId = '') {
     return async (dispatch: Dispatch, getState: GetStateFunc) => {
         try {
-            const startFunction = force ? Client.forceStartMeeting : Client.startMeeting;
-            const meetingURL = await startFunction(channelId, true, topic);
+            let meetingURL;
+            if (force) {
+                meetingURL = await Client.forceStartMeeting(channelId, true, topic, 0, rootId);
+            } else {
+                meetingURL = await Client.startMeeting(channelId, true, topic, 0, false, rootId);
+            }
             if (meetingURL) {
                 window.open(meetingURL);
             }
 
             return {data: true};
         } catch (error) {
-            let m : string;
-            if (error instanceof Error && error.message && error.message[0] === '{') {
-                const e = JSON.parse(error.message);
+            receivedMeetingError(dispatch, getState, channelId, rootId, error);
+            return {error};
+        }
+    };
+}
 
-                // Error is from MS API
-                if (e?.error?.message) {
-                    m = '\nMSTMeeting error: ' + e.error.message;
-                } else {
-                    m = e;
-                }
-            } else if (error instanceof Error) {
-                m = error.message;
-            } else {
-                m = String(error);
+// startMeetingFromPost starts a meeting about a post, which is posted in the thread of the post.
+export function startMeetingFromPost(postId: string) {
+    return async (dispatch: Dispatch, getState: GetStateFunc) => {
+        try {
+            const meetingURL = await Client.startMeetingFromPost(postId);
+            if (meetingURL) {
+                window.open(meetingURL);
             }
 
-            const post = {
-                id: 'mstMeetingsPlugin' + Date.now(),
-                create_at: Date.now(),
-                update_at: 0,
-                edit_at: 0,
-                delete_at: 0,
-                is_pinned: false,
-                user_id: getState().entities.users.currentUserId,
-                channel_id: channelId,
-                root_id: '',
-                parent_id: '',
-                original_id: '',
-                message: m,
-                type: 'system_ephemeral',
-                props: {},
-                hashtags: '',
-                pending_post_id: '',
-            };
+            return {data: true};
+        } catch (error) {
+            const post = getPost(getState(), postId);
+            if (post) {
+                receivedMeetingError(dispatch, getState, post.channel_id, post.root_id || post.id, error);
+            }
+            return {error};
+        }
+    };
+}
 
-            dispatch({
-                type: PostTypes.RECEIVED_NEW_POST,
-                data: post,
-                channelId,
-            });
+function receivedMeetingError(dispatch: Dispatch, getState: GetStateFunc, channelId: string, rootId: string, error: unknown) {
+    let m : string;
+    if (error instanceof Error && error.message && error.message[0] === '{') {
+        const e = JSON.parse(error.message);
 
-            return {error};
+        // Error is from MS API
+        if (e?.error?.message) {
+            m = '\nMSTMeeting error: ' + e.error.message;
+        } else {
+            m = e;
         }
+    } else if (error instanceof Error) {
+        m = error.message;
+    } else {
+        m = String(error);
+    }
+
+    const post = {
+        id: 'mstMeetingsPlugin' + Date.now(),
+        create_at: Date.now(),
+        update_at: 0,
+        edit_at: 0,
+        delete_at: 0,
+        is_pinned: false,
+        user_id: getState().entities.users.currentUserId,
+        channel_id: channelId,
+        root_id: rootId,
+        parent_id: '',
+        original_id: '',
+        message: m,
+        type: 'system_ephemeral',
+        props: {},
+        hashtags: '',
+        pending_post_id: '',
     };
+
+    dispatch({
+        type: PostTypes.RECEIVED_NEW_POST,
+        data: post,
+        channelId,
+    });
 }
@@ -13,13 +13,18 @@ export default class Client {
         this.url = url + '/plugins/' + id;
     }
 
-    startMeeting = async (channelId: string, personal = true, topic: string, meetingId = 0, force = false) => {
-        const res = await doPost(`${this.url}/api/v1/meetings${force ? '?force=true' : ''}`, {channel_id: channelId, personal, topic, meeting_id: meetingId});
+    startMeeting = async (channelId: string, personal = true, topic: string, meetingId = 0, force = false, rootId = '') => {
+        const res = await doPost(`${this.url}/api/v1/meetings${force ? '?force=true' : ''}`, {channel_id: channelId, root_id: rootId, personal, topic, meeting_id: meetingId});
         return res.meeting_url;
     }
 
-    forceStartMeeting = async (channelId: string, personal = true, topic: string, meetingId = 0) => {
-        const meetingUrl = await this.startMeeting(channelId, personal, topic, meetingId, true);
+    startMeetingFromPost = async (postId: string) => {
+        const res = await doPost(`${this.url}/api/v1/meetings/from_post`, {post_id: postId});
+        return res.meeting_url;
+    }
+
+    forceStartMeeting = async (channelId: string, personal = true, topic: string, meetingId = 0, rootId = '') => {
+        const meetingUrl = await this.startMeeting(channelId, personal, topic, meetingId, true, rootId);
         return meetingUrl;
     }
 }
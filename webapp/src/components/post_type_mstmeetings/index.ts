@@ -23,7 +23,7 @@ type OwnProps = {
 }
 
 type Actions = {
-    startMeeting: (channelID: string, force: boolean, topic: string) => ActionResult;
+    startMeeting: (channelID: string, force: boolean, topic: string, rootID?: string) => ActionResult;
 }
 
 function mapStateToProps(state: GlobalState, ownProps: OwnProps) {
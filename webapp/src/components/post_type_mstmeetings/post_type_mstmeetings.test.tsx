@@ -88,6 +88,44 @@ describe('PostTypeMSTMeetings', () => {
             expect(screen.getByTestId('mstmeetings-join-meeting')).toBeInTheDocument();
         });
 
+        it('shows organizer and start time of a shared meeting', () => {
+            const post: Post = {
+                ...basePost,
+                props: {
+                    meeting_status: 'STARTED',
+                    meeting_link: 'https://teams.microsoft.com/l/meetup-join/shared',
+                    meeting_topic: 'Planning',
+                    meeting_shared: true,
+                    meeting_organizer: 'Megan Bowen',
+                    meeting_start_time: 1792418400000,
+                },
+            };
+            renderComponent({post});
+
+            expect(screen.getByTestId('mstmeetings-pretext')).toHaveTextContent('I have shared a meeting');
+            expect(screen.getByTestId('mstmeetings-subtitle')).toHaveTextContent(new Date(1792418400000).toLocaleString());
+            expect(screen.getByTestId('mstmeetings-subtitle')).toHaveTextContent('Organized by Megan Bowen');
+            expect(screen.getByTestId('mstmeetings-join-meeting')).toHaveAttribute('href', 'https://teams.microsoft.com/l/meetup-join/shared');
+        });
+
+        it('shows the calendar of a subscribed meeting', () => {
+            const post: Post = {
+                ...basePost,
+                props: {
+                    meeting_status: 'STARTED',
+                    meeting_link: 'https://teams.microsoft.com/l/meetup-join/review',
+                    meeting_topic: 'Design review',
+                    meeting_calendar: 'Design',
+                    meeting_organizer: 'Megan Bowen',
+                    meeting_start_time: 1792418400000,
+                },
+            };
+            renderComponent({post, fromBot: true, creatorName: 'MS Teams Meetings'});
+
+            expect(screen.getByTestId('mstmeetings-pretext')).toHaveTextContent('From the Design calendar');
+            expect(screen.getByTestId('mstmeetings-subtitle')).toHaveTextContent('Organized by Megan Bowen');
+        });
+
         it('shows expected pretext, subtitle, CREATE NEW MEETING and JOIN EXISTING MEETING', () => {
             const post: Post = {
                 ...basePost,
@@ -108,6 +146,18 @@ describe('PostTypeMSTMeetings', () => {
             expect(screen.getByTestId('mstmeetings-join-existing-meeting')).toHaveAttribute('href', 'https://teams.microsoft.com/existing');
         });
 
+        it('shows expected pretext and no join control when the meeting has ended', () => {
+            const post: Post = {
+                ...basePost,
+                props: {meeting_status: 'ENDED', meeting_link: 'https://link', meeting_topic: 'Sprint planning'},
+            };
+            renderComponent({post});
+
+            expect(screen.getByTestId('mstmeetings-pretext')).toHaveTextContent('The meeting has ended');
+            expect(screen.getByTestId('mstmeetings-title')).toHaveTextContent('Sprint planning');
+            expect(screen.queryByTestId('mstmeetings-join-meeting')).not.toBeInTheDocument();
+        });
+
         it('shows default title only, no join/create controls', () => {
             const post: Post = {...basePost, props: {}};
             renderComponent({post});
@@ -153,7 +203,7 @@ describe('PostTypeMSTMeetings', () => {
             });
 
             expect(startMeeting).toHaveBeenCalledTimes(1);
-            expect(startMeeting).toHaveBeenCalledWith('channel-456', true, 'My topic');
+            expect(startMeeting).toHaveBeenCalledWith('channel-456', true, 'My topic', '');
         });
 
         it('does not call startMeeting twice when clicked rapidly', async () => {
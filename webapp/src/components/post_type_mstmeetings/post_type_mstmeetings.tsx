@@ -2,6 +2,7 @@
 // See LICENSE.txt for license information.
 
 import React from 'react';
+import {IntlShape, useIntl} from 'react-intl';
 
 import {makeStyleFromTheme} from 'mattermost-redux/utils/theme_utils';
 import {ActionResult} from 'mattermost-redux/types/actions';
@@ -20,11 +21,12 @@ type Props = {
     currentChannelId: string;
     fromBot: boolean;
     actions: {
-        startMeeting: (channelID: string, force: boolean, topic: string) => ActionResult;
+        startMeeting: (channelID: string, force: boolean, topic: string, rootID?: string) => ActionResult;
     };
 }
 
 export default function PostTypeMSTMeetings(props: Props) {
+    const intl = useIntl();
     const style = getStyle(props.theme);
     const post = props.post;
     const postProps = post.props || {};
@@ -34,7 +36,7 @@ export default function PostTypeMSTMeetings(props: Props) {
     const handleForceStart = async () => {
         if (!creatingMeeting) {
             setCreatingMeeting(true);
-            await props.actions.startMeeting(props.currentChannelId, true, postProps?.meeting_topic as string);
+            await props.actions.startMeeting(props.currentChannelId, true, postProps?.meeting_topic as string, post.root_id);
             setCreatingMeeting(false);
         }
     };
@@ -47,6 +49,20 @@ export default function PostTypeMSTMeetings(props: Props) {
         if (props.fromBot) {
             preText = `${props.creatorName} has started a meeting`;
         }
+        if (postProps.meeting_shared) {
+            preText = intl.formatMessage({
+                id: 'msteamsmeetings.post.shared',
+                defaultMessage: 'I have shared a meeting',
+            });
+            subtitle = getSharedMeetingSubtitle(intl, postProps);
+        }
+        if (postProps.meeting_calendar) {
+            preText = intl.formatMessage({
+                id: 'msteamsmeetings.post.calendar',
+                defaultMessage: 'From the {calendar} calendar',
+            }, {calendar: postProps.meeting_calendar as string});
+            subtitle = getSharedMeetingSubtitle(intl, postProps);
+        }
         content = (
             <a
                 className='btn btn-lg btn-primary'
@@ -96,6 +112,11 @@ export default function PostTypeMSTMeetings(props: Props) {
                 </div>
             </div>
         );
+    } else if (postProps.meeting_status === 'ENDED') {
+        preText = intl.formatMessage({
+            id: 'msteamsmeetings.post.ended',
+            defaultMessage: 'The meeting has ended',
+        });
     }
 
     let title = 'MS Teams Meeting';
@@ -136,6 +157,20 @@ export default function PostTypeMSTMeetings(props: Props) {
     );
 }
 
+function getSharedMeetingSubtitle(intl: IntlShape, postProps: Record<string, unknown>) {
+    const details = [];
+    if (postProps.meeting_start_time) {
+        details.push(new Date(postProps.meeting_start_time as number).toLocaleString());
+    }
+    if (postProps.meeting_organizer) {
+        details.push(intl.formatMessage({
+            id: 'msteamsmeetings.post.organizer',
+            defaultMessage: 'Organized by {organizer}',
+        }, {organizer: postProps.meeting_organizer as string}));
+    }
+    return details.join(' · ');
+}
+
 PostTypeMSTMeetings.defaultProps = {
     compactDisplay: false,
     isRHS: false,
@@ -2,16 +2,18 @@
 // See LICENSE.txt for license information.
 
 import React from 'react';
+import {FormattedMessage} from 'react-intl';
 import {Store, Action} from 'redux';
 
 import {Channel} from '@mattermost/types/channels';
 import {GlobalState} from '@mattermost/types/store';
 import {getConfig} from 'mattermost-redux/selectors/entities/general';
+import {getPost} from 'mattermost-redux/selectors/entities/posts';
 
 import {id as pluginId} from './manifest';
 import Icon from './components/icon';
 import PostTypeMSTMeetings from './components/post_type_mstmeetings';
-import {startMeeting} from './actions';
+import {startMeeting, startMeetingFromPost} from './actions';
 import Client from './client';
 // eslint-disable-next-line import/no-unresolved
 import {PluginRegistry} from './types/mattermost-webapp';
@@ -54,6 +56,27 @@ class Plugin {
             registry.registerAppBarComponent(iconURL, action, helpText);
         }
 
+        // Post menu action, which invites the author and the mentioned users
+        const postMenuAction = async (postId: string) => {
+            if (!creatingMeeting) {
+                creatingMeeting = true;
+                await startMeetingFromPost(postId)(store.dispatch, store.getState);
+                creatingMeeting = false;
+            }
+        };
+        const postMenuFilter = (postId: string) => {
+            const post = getPost(store.getState(), postId);
+            return Boolean(post) && !post.type?.startsWith('system_');
+        };
+        registry.registerPostDropdownMenuAction(
+            <FormattedMessage
+                id='msteamsmeetings.postMenu.startMeeting'
+                defaultMessage='Start Teams meeting about this'
+            />,
+            postMenuAction,
+            postMenuFilter,
+        );
+
         registry.registerPostTypeComponent('custom_mstmeetings', PostTypeMSTMeetings);
         Client.setServerRoute(getServerRoute(store.getState()));
     }
@@ -7,4 +7,5 @@ export interface PluginRegistry {
     registerChannelHeaderButtonAction(icon: React.ReactNode, callback: (channel: Channel) => void, text: string)
     registerPostTypeComponent(typeName: string, component: React.ElementType)
     registerAppBarComponent(iconUrl: string, action: (channel: Channel, channelMember: ChannelMembership) => void, tooltipText: React.ReactNode)
+    registerPostDropdownMenuAction(text: React.ReactNode, action: (postId: string) => void, filter?: (postId: string) => boolean)
 }